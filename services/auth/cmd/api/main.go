@@ -10,17 +10,9 @@ import (
 	"time"
 
 	"minisapi/services/auth/internal/configs"
-	"minisapi/services/auth/internal/domain/service"
-	"minisapi/services/auth/internal/domain/usecase"
 	"minisapi/services/auth/internal/infrastructure/database"
-	"minisapi/services/auth/internal/infrastructure/jwt"
-	"minisapi/services/auth/internal/infrastructure/redis"
-	"minisapi/services/auth/internal/infrastructure/repository"
-	"minisapi/services/auth/internal/interfaces/http/handler"
 	"minisapi/services/auth/internal/interfaces/http/routes"
 	"minisapi/services/auth/internal/pkg/logger"
-
-	"github.com/gin-gonic/gin"
 )
 
 func main() {
@@ -55,70 +47,15 @@ func main() {
 	}
 	defer sqlDB.Close()
 
-	// Initialize Redis
-	redisClient, err := redis.NewRedisClient(cfg.Redis)
-	if err != nil {
-		log.Fatal(context.Background(), "Failed to connect to Redis", logger.LogFields{
-			Error: err,
-		})
-	}
-	defer redisClient.Close()
-
-	// Initialize repositories
-	userRepo := repository.NewUserRepository(db)
-	roleRepo := repository.NewRoleRepository(db)
-	permissionRepo := repository.NewPermissionRepository(db)
-	tokenRepo := repository.NewTokenRepository(db)
-	sessionRepo := repository.NewSessionRepository(db)
-
-	// Initialize JWT manager
-	jwtManager, err := jwt.NewJWTManager(cfg.JWT)
-	if err != nil {
-		log.Fatal(context.Background(), "Failed to initialize JWT manager", logger.LogFields{
-			Error: err,
-		})
-	}
-
-	// Initialize use cases
-	authService := service.NewAuthService(jwtManager)
-	authUseCase := usecase.NewAuthUseCase(
-		userRepo,
-		tokenRepo,
-		sessionRepo,
-		authService,
-	)
-
-	// Initialize handlers
-	authHandler := handler.NewAuthHandler(authUseCase)
-	roleHandler := handler.NewRoleHandler(roleRepo, permissionRepo)
-	permissionHandler := handler.NewPermissionHandler(permissionRepo)
-	healthHandler := handler.NewHealthHandler(db)
-
-	// Initialize router
-	router := gin.Default()
-
-	// Setup routes
-	routes.SetupRoutes(
-		router,
-		authHandler,
-		roleHandler,
-		permissionHandler,
-		healthHandler,
-		log,
-	)
-
-	// Create server
-	srv := &http.Server{
-		Addr:    cfg.Server.Port,
-		Handler: router,
-	}
+	// Create server with all repositories, services and routes wired
+	srv := routes.NewServer(cfg, db)
 
 	// Start server in a goroutine
 	go func() {
 		log.Info(context.Background(), "Starting server", logger.LogFields{
 			Path: cfg.Server.Port,
 		})
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := srv.Start(); err != nil && err != http.ErrServerClosed {
 			log.Fatal(context.Background(), "Failed to start server", logger.LogFields{
 				Error: err,
 			})
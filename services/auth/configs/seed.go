@@ -41,6 +41,10 @@ func seedPermissions(db *gorm.DB) error {
 		enums.ResourcePermission,
 		enums.ResourceAuth,
 		enums.ResourceToken,
+		enums.ResourcePolicy,
+		enums.ResourceAuthz,
+		enums.ResourceOrganization,
+		enums.ResourceClient,
 	}
 
 	// Actions
@@ -53,6 +57,8 @@ func seedPermissions(db *gorm.DB) error {
 		enums.ActionRemove,
 		enums.ActionActivate,
 		enums.ActionDeactivate,
+		enums.ActionCheck,
+		enums.ActionTrust,
 	}
 
 	// Create combinations of resources and actions
@@ -100,6 +106,16 @@ func isValidPermission(resource enums.PermissionResource, action enums.Permissio
 		return resource == enums.ResourceUser
 	}
 
+	// Authorization decisions are only checked
+	if action == enums.ActionCheck || resource == enums.ResourceAuthz {
+		return action == enums.ActionCheck && resource == enums.ResourceAuthz
+	}
+
+	// Trusting a client lets it skip the consent screen
+	if action == enums.ActionTrust {
+		return resource == enums.ResourceClient
+	}
+
 	// Auth resource has specific actions
 	if resource == enums.ResourceAuth {
 		return action == enums.ActionCreate || action == enums.ActionRead
@@ -42,11 +42,71 @@ var (
 		"code":  http.StatusNotFound,
 	}
 
+	ROLE_CYCLE = gin.H{
+		"error": "Role cannot inherit from itself",
+		"code":  http.StatusBadRequest,
+	}
+
+	INVALID_ROLE = gin.H{
+		"error": "Invalid role",
+		"code":  http.StatusBadRequest,
+	}
+
+	INVALID_ROLE_PARENT = gin.H{
+		"error": "Roles can only inherit from global roles and roles of their own organization",
+		"code":  http.StatusBadRequest,
+	}
+
 	INVALID_PERMISSION = gin.H{
 		"error": "Invalid permission",
 		"code":  http.StatusBadRequest,
 	}
 
+	POLICY_EXISTS = gin.H{
+		"error": "Policy already exists",
+		"code":  http.StatusBadRequest,
+	}
+
+	POLICY_NOT_FOUND = gin.H{
+		"error": "Policy not found",
+		"code":  http.StatusNotFound,
+	}
+
+	ORGANIZATION_EXISTS = gin.H{
+		"error": "Organization already exists",
+		"code":  http.StatusBadRequest,
+	}
+
+	ORGANIZATION_NOT_FOUND = gin.H{
+		"error": "Organization not found",
+		"code":  http.StatusNotFound,
+	}
+
+	NOT_MEMBER = gin.H{
+		"error": "User is not a member of the organization",
+		"code":  http.StatusBadRequest,
+	}
+
+	INVITATION_NOT_FOUND = gin.H{
+		"error": "Invitation not found",
+		"code":  http.StatusNotFound,
+	}
+
+	INVITATION_NOT_PENDING = gin.H{
+		"error": "Invitation is no longer pending",
+		"code":  http.StatusBadRequest,
+	}
+
+	ALREADY_MEMBER = gin.H{
+		"error": "User is already a member of the organization",
+		"code":  http.StatusBadRequest,
+	}
+
+	USER_NOT_FOUND = gin.H{
+		"error": "User not found",
+		"code":  http.StatusNotFound,
+	}
+
 	UNAUTHORIZED = gin.H{
 		"error": "Unauthorized",
 		"code":  http.StatusUnauthorized,
@@ -57,6 +117,11 @@ var (
 		"code":  http.StatusForbidden,
 	}
 
+	SERVICE_UNAVAILABLE = gin.H{
+		"error": "Service unavailable",
+		"code":  http.StatusServiceUnavailable,
+	}
+
 	SUCCESS = gin.H{
 		"message": "Success",
 		"code":    http.StatusOK,
@@ -2,16 +2,28 @@ package configs
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Redis    RedisConfig
-	JWT      JWTConfig
-	Log      LogConfig
+	Server     ServerConfig
+	Database   DatabaseConfig
+	Redis      RedisConfig
+	JWT        JWTConfig
+	Password   PasswordConfig
+	TwoFactor  TwoFactorConfig
+	Lockout    LockoutConfig
+	Email      EmailConfig
+	Session    SessionConfig
+	Policy     PolicyConfig
+	OAuth      OAuthConfig
+	Federation FederationConfig
+	WebAuthn   WebAuthnConfig
+	Log        LogConfig
 }
 
 type ServerConfig struct {
@@ -31,11 +43,153 @@ type DatabaseConfig struct {
 type RedisConfig struct {
 	Host string
 	Port string
+	// PermissionCacheTTL bounds how long a user's resolved roles and
+	// permissions are cached; zero disables the cache
+	PermissionCacheTTL time.Duration
 }
 
 type JWTConfig struct {
 	Secret     string
 	Expiration string
+	// RefreshExpiration is the lifetime of refresh tokens, and so of an
+	// idle session. Defaults to a week when empty.
+	RefreshExpiration string
+	// Issuer is the public URL of the service. Every token carries it as
+	// iss, and as an OpenID Connect provider the service is discovered
+	// under it.
+	Issuer   string
+	Audience []string
+	// PEM files of asymmetric keys. When set, tokens are signed with the
+	// first active key instead of the shared secret.
+	ActiveKeyFiles   []string
+	RetiringKeyFiles []string
+}
+
+type PasswordConfig struct {
+	Algorithm         string
+	BcryptCost        int
+	Argon2Memory      uint32
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+	Argon2SaltLength  uint32
+	Argon2KeyLength   uint32
+}
+
+type TwoFactorConfig struct {
+	// Issuer is shown by authenticator apps next to the account name
+	Issuer string
+	// EncryptionKey encrypts TOTP secrets at rest
+	EncryptionKey string
+	// Skew is the number of time steps accepted before and after the current one
+	Skew          uint
+	RecoveryCodes int
+	// ChallengeTTL is how long a password-verified login may wait for its
+	// second factor
+	ChallengeTTL time.Duration
+}
+
+type LockoutConfig struct {
+	// MaxAttempts is the number of failed logins within Window after which
+	// the account is locked
+	MaxAttempts int
+	// IPMaxAttempts is the number of failed logins from one IP address
+	// within Window after which further attempts from it are refused
+	IPMaxAttempts int
+	Window        time.Duration
+	// Duration is the first lock duration. It doubles with each further
+	// lock up to MaxDuration, and starts over ResetAfter after the first lock.
+	Duration    time.Duration
+	MaxDuration time.Duration
+	ResetAfter  time.Duration
+}
+
+type EmailConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	// VerifyURL, ResetURL and InviteURL are the pages the links in emails
+	// point to. The token is appended as the "token" query parameter.
+	VerifyURL string
+	ResetURL  string
+	InviteURL string
+	VerifyTTL time.Duration
+	ResetTTL  time.Duration
+	InviteTTL time.Duration
+}
+
+const (
+	// SessionLimitEvictOldest ends the oldest session to make room for a new login
+	SessionLimitEvictOldest = "evict_oldest"
+	// SessionLimitReject refuses new logins once the limit is reached
+	SessionLimitReject = "reject"
+)
+
+type SessionConfig struct {
+	// MaxPerUser is the number of concurrent sessions per user, 0 for no limit
+	MaxPerUser  int
+	LimitPolicy string
+	// ReauthMaxAge is how recently a user must have signed in to add a way
+	// to sign in, such as a linked identity or a passkey
+	ReauthMaxAge time.Duration
+}
+
+type PolicyConfig struct {
+	// File is an optional YAML file of access policies, evaluated together
+	// with the policies stored in the database
+	File string
+}
+
+type OAuthConfig struct {
+	// ClientTokenTTL is the lifetime of access tokens issued to OAuth2
+	// clients for the client_credentials grant
+	ClientTokenTTL time.Duration
+	// LoginURL is the page that signs the user in and asks for consent
+	// during the authorization code flow
+	LoginURL string
+	// CodeTTL is the lifetime of authorization codes
+	CodeTTL time.Duration
+	// TokenTTL is the lifetime of the ID and access tokens issued to
+	// relying parties
+	TokenTTL time.Duration
+}
+
+type FederationConfig struct {
+	// Providers are the external OpenID Connect providers users can sign
+	// in with
+	Providers []FederationProvider
+	// CallbackURL is the page providers send the user back to. It must be
+	// registered with every provider.
+	CallbackURL string
+	// StateTTL is how long a started sign-in may take to come back
+	StateTTL time.Duration
+}
+
+type FederationProvider struct {
+	// ID names the provider in URLs and linked accounts, such as "google"
+	ID           string
+	DisplayName  string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// TrustEmail treats the provider's email addresses as verified even
+	// without an email_verified claim, for providers that control the
+	// addresses they issue but do not send the claim
+	TrustEmail bool
+}
+
+type WebAuthnConfig struct {
+	// RPID is the domain passkeys are bound to. It must be the domain of
+	// the pages that use them or a registrable suffix of it.
+	RPID string
+	// RPName is shown by authenticators next to the account name
+	RPName string
+	// Origins are the origins of the pages allowed to use passkeys
+	Origins []string
+	// ChallengeTTL is how long a started ceremony may take to complete
+	ChallengeTTL time.Duration
 }
 
 type LogConfig struct {
@@ -61,12 +215,80 @@ func LoadConfig() (*Config, error) {
 			Timezone: getEnvOrDefault("DB_TIMEZONE", "Asia/Ho_Chi_Minh"),
 		},
 		Redis: RedisConfig{
-			Host: getEnvOrDefault("REDIS_HOST", "localhost"),
-			Port: getEnvOrDefault("REDIS_PORT", "6379"),
+			Host:               getEnvOrDefault("REDIS_HOST", "localhost"),
+			Port:               getEnvOrDefault("REDIS_PORT", "6379"),
+			PermissionCacheTTL: getEnvDurationOrDefault("PERMISSION_CACHE_TTL", 5*time.Minute),
 		},
 		JWT: JWTConfig{
-			Secret:     getEnvOrDefault("JWT_SECRET", "your-secret-key"),
-			Expiration: getEnvOrDefault("JWT_EXPIRATION", "24h"),
+			Secret:            getEnvOrDefault("JWT_SECRET", "your-secret-key"),
+			Expiration:        getEnvOrDefault("JWT_EXPIRATION", "24h"),
+			RefreshExpiration: getEnvOrDefault("JWT_REFRESH_EXPIRATION", "168h"),
+			Issuer:            getEnvOrDefault("JWT_ISSUER", "http://localhost:8080"),
+			Audience:          getEnvListOrDefault("JWT_AUDIENCE", []string{"minisapi"}),
+			ActiveKeyFiles:    getEnvListOrDefault("JWT_ACTIVE_KEY_FILES", nil),
+			RetiringKeyFiles:  getEnvListOrDefault("JWT_RETIRING_KEY_FILES", nil),
+		},
+		Password: PasswordConfig{
+			Algorithm:         getEnvOrDefault("PASSWORD_HASH_ALGORITHM", "argon2id"),
+			BcryptCost:        getEnvIntOrDefault("PASSWORD_BCRYPT_COST", 12),
+			Argon2Memory:      uint32(getEnvIntOrDefault("PASSWORD_ARGON2_MEMORY", 64*1024)),
+			Argon2Iterations:  uint32(getEnvIntOrDefault("PASSWORD_ARGON2_ITERATIONS", 3)),
+			Argon2Parallelism: uint8(getEnvIntOrDefault("PASSWORD_ARGON2_PARALLELISM", 2)),
+			Argon2SaltLength:  16,
+			Argon2KeyLength:   32,
+		},
+		TwoFactor: TwoFactorConfig{
+			Issuer:        getEnvOrDefault("TWO_FACTOR_ISSUER", "MinisAPI"),
+			EncryptionKey: getEnvOrDefault("TWO_FACTOR_ENCRYPTION_KEY", "your-encryption-key"),
+			Skew:          uint(getEnvIntOrDefault("TWO_FACTOR_SKEW", 1)),
+			RecoveryCodes: getEnvIntOrDefault("TWO_FACTOR_RECOVERY_CODES", 10),
+			ChallengeTTL:  getEnvDurationOrDefault("TWO_FACTOR_CHALLENGE_TTL", 5*time.Minute),
+		},
+		Lockout: LockoutConfig{
+			MaxAttempts:   getEnvIntOrDefault("LOCKOUT_MAX_ATTEMPTS", 5),
+			IPMaxAttempts: getEnvIntOrDefault("LOCKOUT_IP_MAX_ATTEMPTS", 20),
+			Window:        getEnvDurationOrDefault("LOCKOUT_WINDOW", 15*time.Minute),
+			Duration:      getEnvDurationOrDefault("LOCKOUT_DURATION", time.Minute),
+			MaxDuration:   getEnvDurationOrDefault("LOCKOUT_MAX_DURATION", 24*time.Hour),
+			ResetAfter:    getEnvDurationOrDefault("LOCKOUT_RESET_AFTER", 24*time.Hour),
+		},
+		Email: EmailConfig{
+			Host:      getEnvOrDefault("EMAIL_HOST", "smtp.gmail.com"),
+			Port:      getEnvIntOrDefault("EMAIL_PORT", 587),
+			Username:  getEnvOrDefault("EMAIL_USERNAME", "your-email@gmail.com"),
+			Password:  getEnvOrDefault("EMAIL_PASSWORD", "your-password"),
+			From:      getEnvOrDefault("EMAIL_FROM", "your-email@gmail.com"),
+			VerifyURL: getEnvOrDefault("EMAIL_VERIFY_URL", "http://localhost:3000/verify-email"),
+			ResetURL:  getEnvOrDefault("EMAIL_RESET_URL", "http://localhost:3000/reset-password"),
+			InviteURL: getEnvOrDefault("EMAIL_INVITE_URL", "http://localhost:3000/accept-invitation"),
+			VerifyTTL: getEnvDurationOrDefault("EMAIL_VERIFY_TOKEN_TTL", 24*time.Hour),
+			ResetTTL:  getEnvDurationOrDefault("PASSWORD_RESET_TOKEN_TTL", time.Hour),
+			InviteTTL: getEnvDurationOrDefault("INVITATION_TOKEN_TTL", 7*24*time.Hour),
+		},
+		Session: SessionConfig{
+			MaxPerUser:   getEnvIntOrDefault("SESSION_MAX_PER_USER", 10),
+			LimitPolicy:  getEnvOrDefault("SESSION_LIMIT_POLICY", SessionLimitEvictOldest),
+			ReauthMaxAge: getEnvDurationOrDefault("SESSION_REAUTH_MAX_AGE", 10*time.Minute),
+		},
+		Policy: PolicyConfig{
+			File: getEnvOrDefault("POLICY_FILE", ""),
+		},
+		OAuth: OAuthConfig{
+			ClientTokenTTL: getEnvDurationOrDefault("OAUTH_CLIENT_TOKEN_TTL", 5*time.Minute),
+			LoginURL:       getEnvOrDefault("OIDC_LOGIN_URL", "http://localhost:3000/authorize"),
+			CodeTTL:        getEnvDurationOrDefault("OIDC_CODE_TTL", time.Minute),
+			TokenTTL:       getEnvDurationOrDefault("OIDC_TOKEN_TTL", time.Hour),
+		},
+		Federation: FederationConfig{
+			Providers:   loadFederationProviders(),
+			CallbackURL: getEnvOrDefault("FEDERATION_CALLBACK_URL", "http://localhost:3000/auth/callback"),
+			StateTTL:    getEnvDurationOrDefault("FEDERATION_STATE_TTL", 10*time.Minute),
+		},
+		WebAuthn: WebAuthnConfig{
+			RPID:         getEnvOrDefault("WEBAUTHN_RP_ID", "localhost"),
+			RPName:       getEnvOrDefault("WEBAUTHN_RP_NAME", "MinisAPI"),
+			Origins:      getEnvListOrDefault("WEBAUTHN_ORIGINS", []string{"http://localhost:3000"}),
+			ChallengeTTL: getEnvDurationOrDefault("WEBAUTHN_CHALLENGE_TTL", 5*time.Minute),
 		},
 		Log: LogConfig{
 			Level: getEnvOrDefault("LOG_LEVEL", "info"),
@@ -74,9 +296,62 @@ func LoadConfig() (*Config, error) {
 	}, nil
 }
 
+// loadFederationProviders reads the providers listed in FEDERATION_PROVIDERS,
+// each configured by FEDERATION_<ID>_* variables
+func loadFederationProviders() []FederationProvider {
+	var providers []FederationProvider
+	for _, id := range getEnvListOrDefault("FEDERATION_PROVIDERS", nil) {
+		id = strings.ToLower(id)
+		prefix := "FEDERATION_" + strings.ToUpper(id) + "_"
+		providers = append(providers, FederationProvider{
+			ID:           id,
+			DisplayName:  getEnvOrDefault(prefix+"DISPLAY_NAME", id),
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes:       getEnvListOrDefault(prefix+"SCOPES", []string{"openid", "email", "profile"}),
+			TrustEmail:   getEnvOrDefault(prefix+"TRUST_EMAIL", "false") == "true",
+		})
+	}
+	return providers
+}
+
 func getEnvOrDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+func getEnvIntOrDefault(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if intValue, err := strconv.Atoi(value); err == nil {
+			return intValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return defaultValue
+}
+
+func getEnvListOrDefault(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,43 @@
+package entity
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKey is a long-lived credential for scripts and CI jobs acting as a user.
+// Only the digest of the key is stored; the prefix stays readable so that a
+// key can be recognized in listings and logs.
+type APIKey struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	UserID uint   `gorm:"not null;index" json:"user_id"`
+	Name   string `gorm:"size:100;not null" json:"name"`
+	Prefix string `gorm:"size:32;not null;index" json:"prefix"`
+	Hash   string `gorm:"size:255;not null;unique" json:"-"`
+	// Scopes are the resource:action permissions the key is limited to. A
+	// key never grants more than its user currently holds.
+	Scopes     []string   `gorm:"type:text;serializer:json" json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Revoked    bool       `gorm:"default:false" json:"revoked"`
+}
+
+// IsExpired checks if the key has expired. Keys without an expiry never do.
+func (k *APIKey) IsExpired() bool {
+	return k.ExpiresAt != nil && time.Now().After(*k.ExpiresAt)
+}
+
+// IsValid checks if the key is valid (not expired and not revoked)
+func (k *APIKey) IsValid() bool {
+	return !k.IsExpired() && !k.Revoked
+}
+
+// TableName specifies the table name for the APIKey model
+func (APIKey) TableName() string {
+	return "api_keys"
+}
@@ -0,0 +1,39 @@
+package entity
+
+import "time"
+
+// RolePermission links a role to a permission it is granted
+type RolePermission struct {
+	RoleID       uint `gorm:"primaryKey"`
+	PermissionID uint `gorm:"primaryKey"`
+}
+
+// TableName specifies the table name for the RolePermission model
+func (RolePermission) TableName() string {
+	return "role_permissions"
+}
+
+// UserRole grants a role to a user. A grant with ExpiresAt set stops counting
+// once that time has passed and is later swept by the cleanup job.
+type UserRole struct {
+	UserID uint `gorm:"primaryKey" json:"user_id"`
+	RoleID uint `gorm:"primaryKey" json:"role_id"`
+	// GrantedBy is the user who made the grant; nil for grants made by the
+	// system, such as default roles at registration
+	GrantedBy *uint      `json:"granted_by"`
+	GrantedAt time.Time  `gorm:"autoCreateTime" json:"granted_at"`
+	ExpiresAt *time.Time `gorm:"index" json:"expires_at"`
+	Reason    string     `gorm:"size:255" json:"reason"`
+
+	Role *Role `gorm:"foreignKey:RoleID" json:"role,omitempty"`
+}
+
+// TableName specifies the table name for the UserRole model
+func (UserRole) TableName() string {
+	return "user_roles"
+}
+
+// IsExpired reports whether a time-bound grant has run out
+func (g *UserRole) IsExpired() bool {
+	return g.ExpiresAt != nil && !time.Now().Before(*g.ExpiresAt)
+}
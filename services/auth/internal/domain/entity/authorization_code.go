@@ -0,0 +1,71 @@
+package entity
+
+import (
+	"time"
+)
+
+// AuthorizationCode is issued to a relying party once the user has signed
+// in and consented, and is exchanged for tokens at the token endpoint. Only
+// the digest of the code is stored, and a code can be exchanged only once.
+type AuthorizationCode struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	CodeHash    string   `gorm:"size:255;not null;unique" json:"-"`
+	ClientID    string   `gorm:"size:64;not null;index" json:"client_id"`
+	UserID      uint     `gorm:"not null;index" json:"user_id"`
+	RedirectURI string   `gorm:"size:2048;not null" json:"redirect_uri"`
+	Scopes      []string `gorm:"type:text;serializer:json" json:"scopes"`
+	Nonce       string   `gorm:"size:255" json:"-"`
+	// CodeChallenge is the S256 PKCE challenge the code verifier must match
+	CodeChallenge string `gorm:"size:128;not null" json:"-"`
+	// SessionID is the token family of the login session the user
+	// authorized with, and AuthMethods and AuthTime describe that login
+	SessionID   string    `gorm:"size:36" json:"-"`
+	AuthMethods []string  `gorm:"type:text;serializer:json" json:"-"`
+	AuthTime    time.Time `json:"auth_time"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Used        bool      `gorm:"default:false" json:"used"`
+}
+
+// IsExpired checks if the code has expired
+func (c *AuthorizationCode) IsExpired() bool {
+	return time.Now().After(c.ExpiresAt)
+}
+
+// TableName specifies the table name for the AuthorizationCode model
+func (AuthorizationCode) TableName() string {
+	return "oauth_authorization_codes"
+}
+
+// Consent records the scopes a user has allowed a relying party to request,
+// so that the consent screen is only shown again for new scopes
+type Consent struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID   uint     `gorm:"not null;uniqueIndex:idx_oauth_consent" json:"user_id"`
+	ClientID string   `gorm:"size:64;not null;uniqueIndex:idx_oauth_consent" json:"client_id"`
+	Scopes   []string `gorm:"type:text;serializer:json" json:"scopes"`
+}
+
+// Covers reports whether the user has already allowed every one of the scopes
+func (c *Consent) Covers(scopes []string) bool {
+	granted := make(map[string]bool, len(c.Scopes))
+	for _, scope := range c.Scopes {
+		granted[scope] = true
+	}
+	for _, scope := range scopes {
+		if !granted[scope] {
+			return false
+		}
+	}
+	return true
+}
+
+// TableName specifies the table name for the Consent model
+func (Consent) TableName() string {
+	return "oauth_consents"
+}
@@ -0,0 +1,37 @@
+package entity
+
+import (
+	"time"
+)
+
+// LinkedAccount is an identity at an external OpenID Connect provider that
+// the user can sign in with. The identity is the provider's stable subject;
+// the email is only kept for display.
+type LinkedAccount struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID      uint       `gorm:"not null;index" json:"user_id"`
+	Provider    string     `gorm:"size:64;not null;uniqueIndex:idx_linked_account_identity" json:"provider"`
+	Subject     string     `gorm:"size:255;not null;uniqueIndex:idx_linked_account_identity" json:"subject"`
+	Email       string     `gorm:"size:255" json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+// TableName specifies the table name for the LinkedAccount model
+func (LinkedAccount) TableName() string {
+	return "linked_accounts"
+}
+
+// FederationState is what is remembered about a sign-in started with an
+// external provider until the provider sends the user back
+type FederationState struct {
+	Provider string `json:"provider"`
+	Nonce    string `json:"nonce"`
+	// CodeVerifier is the PKCE verifier of the authorization request
+	CodeVerifier string `json:"code_verifier"`
+	// UserID is set when a signed-in user is linking the provider to their
+	// account rather than signing in
+	UserID uint `json:"user_id,omitempty"`
+}
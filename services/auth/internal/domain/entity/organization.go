@@ -0,0 +1,56 @@
+package entity
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Organization is a tenant of the platform. Users join organizations as
+// members and hold roles scoped to them, in addition to their global roles.
+type Organization struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	Name        string             `gorm:"size:255;not null" json:"name"`
+	Slug        string             `gorm:"size:100;not null;unique" json:"slug"`
+	Description string             `gorm:"size:255" json:"description"`
+	Status      OrganizationStatus `gorm:"type:varchar(20);default:'active'" json:"status"`
+}
+
+type OrganizationStatus string
+
+const (
+	OrganizationStatusActive   OrganizationStatus = "active"
+	OrganizationStatusInactive OrganizationStatus = "inactive"
+)
+
+// IsActive reports whether members can work in the organization
+func (o *Organization) IsActive() bool {
+	return o.Status != OrganizationStatusInactive
+}
+
+// TableName specifies the table name for the Organization model
+func (Organization) TableName() string {
+	return "organizations"
+}
+
+// OrganizationMember makes a user a member of an organization. Only members
+// can switch to the organization and hold its roles.
+type OrganizationMember struct {
+	OrganizationID uint      `gorm:"primaryKey" json:"organization_id"`
+	UserID         uint      `gorm:"primaryKey;index" json:"user_id"`
+	JoinedAt       time.Time `gorm:"autoCreateTime" json:"joined_at"`
+	// AddedBy is the user who added the member
+	AddedBy *uint `json:"added_by"`
+
+	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+	User         *User         `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+// TableName specifies the table name for the OrganizationMember model
+func (OrganizationMember) TableName() string {
+	return "organization_members"
+}
@@ -0,0 +1,60 @@
+package entity
+
+import (
+	"time"
+)
+
+// Passkey is a WebAuthn credential the user can sign in with, either
+// without a password or as a second factor. Only the public key is stored.
+type Passkey struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID uint   `gorm:"not null;index" json:"user_id"`
+	Name   string `gorm:"size:100;not null" json:"name"`
+	// CredentialID is the base64url ID the authenticator chose for the
+	// credential
+	CredentialID string `gorm:"size:1400;not null;uniqueIndex" json:"credential_id"`
+	// PublicKey is the COSE encoded public key and Algorithm the COSE
+	// algorithm it signs with
+	PublicKey []byte `gorm:"not null" json:"-"`
+	Algorithm int    `gorm:"not null" json:"-"`
+	// SignCount is the signature counter last reported by the
+	// authenticator. Passkeys synced between devices always report zero.
+	SignCount uint32 `gorm:"not null;default:0" json:"-"`
+	// Transports are hints for how the browser can reach the authenticator,
+	// such as "internal", "hybrid" or "usb"
+	Transports []string `gorm:"type:text;serializer:json" json:"transports"`
+	// AAGUID identifies the authenticator model, when the authenticator
+	// reveals it
+	AAGUID string `gorm:"size:36" json:"aaguid"`
+	// BackupEligible marks passkeys that can be synced between devices, and
+	// BackedUp those that currently are
+	BackupEligible bool       `gorm:"default:false" json:"backup_eligible"`
+	BackedUp       bool       `gorm:"default:false" json:"backed_up"`
+	LastUsedAt     *time.Time `json:"last_used_at"`
+}
+
+// TableName specifies the table name for the Passkey model
+func (Passkey) TableName() string {
+	return "passkeys"
+}
+
+// PasskeyCeremony is what a passkey challenge was issued for
+type PasskeyCeremony string
+
+const (
+	PasskeyCeremonyRegistration PasskeyCeremony = "registration"
+	PasskeyCeremonyLogin        PasskeyCeremony = "login"
+	PasskeyCeremonyTwoFactor    PasskeyCeremony = "two_factor"
+)
+
+// PasskeyChallenge is what is remembered about a started passkey ceremony
+// until the authenticator's response comes back
+type PasskeyChallenge struct {
+	Ceremony PasskeyCeremony `json:"ceremony"`
+	// UserID is the user registering a passkey or completing a login with
+	// one as second factor. Passwordless logins do not know the user yet.
+	UserID uint `json:"user_id,omitempty"`
+}
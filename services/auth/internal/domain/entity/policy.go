@@ -0,0 +1,37 @@
+package entity
+
+import (
+	"time"
+
+	"minisapi/services/auth/internal/pkg/policy"
+)
+
+// Policy is an attribute-based access policy stored in the database
+type Policy struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Name        string             `gorm:"size:255;not null;unique" json:"name"`
+	Description string             `gorm:"size:255" json:"description"`
+	Effect      policy.Effect      `gorm:"type:varchar(10);not null" json:"effect"`
+	Permissions []string           `gorm:"type:text;serializer:json" json:"permissions"`
+	Conditions  []policy.Condition `gorm:"type:text;serializer:json" json:"conditions"`
+	Enabled     bool               `gorm:"not null" json:"enabled"`
+}
+
+// TableName specifies the table name for the Policy model
+func (Policy) TableName() string {
+	return "policies"
+}
+
+// Rule returns the policy in the form the policy engine evaluates
+func (p *Policy) Rule() policy.Policy {
+	return policy.Policy{
+		Name:        p.Name,
+		Description: p.Description,
+		Effect:      p.Effect,
+		Permissions: p.Permissions,
+		Conditions:  p.Conditions,
+	}
+}
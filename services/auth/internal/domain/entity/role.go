@@ -12,13 +12,22 @@ type Role struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
-	Name        string     `gorm:"size:255;not null;unique" json:"name"`
+	// OrganizationID scopes the role to an organization; global roles have
+	// none. Role names are unique among the global roles and within each
+	// organization.
+	OrganizationID *uint `gorm:"uniqueIndex:idx_roles_organization_name,priority:1" json:"organization_id"`
+
+	Name        string     `gorm:"size:255;not null;uniqueIndex:idx_roles_global_name,where:organization_id IS NULL;uniqueIndex:idx_roles_organization_name,priority:2" json:"name"`
 	Description string     `gorm:"size:255" json:"description"`
 	Type        RoleType   `gorm:"type:varchar(20);default:'user'" json:"type"`
 	Status      RoleStatus `gorm:"type:varchar(20);default:'active'" json:"status"`
 
 	Users       []User       `gorm:"many2many:user_roles;" json:"users"`
 	Permissions []Permission `gorm:"many2many:role_permissions;" json:"permissions"`
+
+	// Parents are the roles this role inherits permissions from. The links
+	// are managed by RoleRepository, which rejects cycles.
+	Parents []Role `gorm:"many2many:role_parents;joinForeignKey:RoleID;joinReferences:ParentID" json:"parents,omitempty"`
 }
 
 type RoleType string
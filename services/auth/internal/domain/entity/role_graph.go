@@ -0,0 +1,117 @@
+package entity
+
+import (
+	"sort"
+)
+
+// RoleParent links a role to a role it inherits permissions from
+type RoleParent struct {
+	RoleID   uint `gorm:"primaryKey"`
+	ParentID uint `gorm:"primaryKey"`
+}
+
+// TableName specifies the table name for the RoleParent model
+func (RoleParent) TableName() string {
+	return "role_parents"
+}
+
+// RoleGraph is the role inheritance hierarchy. Traversals keep track of
+// visited roles, so they terminate even if the stored links form a cycle.
+type RoleGraph struct {
+	parents map[uint][]uint
+}
+
+// NewRoleGraph builds the hierarchy from role-parent links
+func NewRoleGraph(links []RoleParent) *RoleGraph {
+	g := &RoleGraph{parents: make(map[uint][]uint)}
+	for _, link := range links {
+		g.parents[link.RoleID] = append(g.parents[link.RoleID], link.ParentID)
+	}
+	for _, parentIDs := range g.parents {
+		sort.Slice(parentIDs, func(i, j int) bool { return parentIDs[i] < parentIDs[j] })
+	}
+	return g
+}
+
+// SetParents replaces the parents of a role
+func (g *RoleGraph) SetParents(roleID uint, parentIDs []uint) {
+	g.parents[roleID] = append([]uint(nil), parentIDs...)
+}
+
+// CreatesCycle reports whether giving the role these parents would make it
+// inherit from itself
+func (g *RoleGraph) CreatesCycle(roleID uint, parentIDs []uint) bool {
+	for _, ancestorID := range g.Expand(parentIDs...) {
+		if ancestorID == roleID {
+			return true
+		}
+	}
+	return false
+}
+
+// Expand returns the given roles followed by every role they inherit from,
+// each listed once
+func (g *RoleGraph) Expand(roleIDs ...uint) []uint {
+	visited := make(map[uint]bool)
+	var result []uint
+
+	queue := append([]uint(nil), roleIDs...)
+	for len(queue) > 0 {
+		roleID := queue[0]
+		queue = queue[1:]
+		if visited[roleID] {
+			continue
+		}
+		visited[roleID] = true
+		result = append(result, roleID)
+		queue = append(queue, g.parents[roleID]...)
+	}
+
+	return result
+}
+
+// Inheritors returns the role followed by every role that inherits from it,
+// directly or transitively
+func (g *RoleGraph) Inheritors(roleID uint) []uint {
+	children := make(map[uint][]uint)
+	for childID, parentIDs := range g.parents {
+		for _, parentID := range parentIDs {
+			children[parentID] = append(children[parentID], childID)
+		}
+	}
+
+	visited := map[uint]bool{roleID: true}
+	result := []uint{roleID}
+	for i := 0; i < len(result); i++ {
+		for _, childID := range children[result[i]] {
+			if !visited[childID] {
+				visited[childID] = true
+				result = append(result, childID)
+			}
+		}
+	}
+
+	return result
+}
+
+// Paths returns, for the role and every role it inherits from, the shortest
+// inheritance path from the role to it. Each path starts with roleID.
+func (g *RoleGraph) Paths(roleID uint) map[uint][]uint {
+	paths := map[uint][]uint{roleID: {roleID}}
+
+	queue := []uint{roleID}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, parentID := range g.parents[current] {
+			if _, seen := paths[parentID]; seen {
+				continue
+			}
+			path := append(append([]uint(nil), paths[current]...), parentID)
+			paths[parentID] = path
+			queue = append(queue, parentID)
+		}
+	}
+
+	return paths
+}
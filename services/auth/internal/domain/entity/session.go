@@ -18,6 +18,12 @@ type Session struct {
 	UserAgent string    `gorm:"size:255" json:"user_agent"`
 	ExpiresAt time.Time `json:"expires_at"`
 	Active    bool      `gorm:"default:true" json:"active"`
+
+	// FamilyID is the refresh token family of the session, also carried as
+	// the sid claim of its access tokens
+	FamilyID   string     `gorm:"size:36;index" json:"-"`
+	Device     string     `gorm:"size:100" json:"device"`
+	LastUsedAt *time.Time `json:"last_used_at"`
 }
 
 // IsExpired checks if the session has expired
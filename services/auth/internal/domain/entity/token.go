@@ -17,6 +17,17 @@ type Token struct {
 	Type      TokenType `gorm:"size:50;not null" json:"type"`
 	ExpiresAt time.Time `json:"expires_at"`
 	Revoked   bool      `gorm:"default:false" json:"revoked"`
+
+	// Refresh tokens issued from the same login share a family. Each
+	// rotation links the old token to the one that replaced it.
+	FamilyID     string `gorm:"size:36;index" json:"family_id"`
+	ReplacedByID *uint  `json:"replaced_by_id"`
+	// AuthMethods is the comma-separated amr of the login, carried over
+	// to access tokens issued on refresh
+	AuthMethods string `gorm:"size:64" json:"auth_methods"`
+	// OrganizationID is the organization the session is switched to,
+	// carried over to access tokens issued on refresh
+	OrganizationID *uint `json:"organization_id"`
 }
 
 type TokenType string
@@ -25,6 +36,7 @@ const (
 	TokenTypeAccess  TokenType = "access"
 	TokenTypeRefresh TokenType = "refresh"
 	TokenTypeReset   TokenType = "reset"
+	TokenTypeVerify  TokenType = "verify"
 )
 
 // IsExpired checks if the token has expired
@@ -46,3 +58,59 @@ func (t *Token) Revoke() {
 func (Token) TableName() string {
 	return "tokens"
 }
+
+// Invitation invites an email address to create an account, or to link an
+// existing one, with a preset set of roles. Like other emailed tokens only
+// the digest of the invite token is stored, and it can be accepted once.
+type Invitation struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	Email string `gorm:"size:255;not null;index" json:"email"`
+	Token string `gorm:"size:255;not null;unique" json:"-"`
+	// OrganizationID is the organization the invitee joins, or nil for an
+	// invitation to global roles only
+	OrganizationID *uint            `gorm:"index" json:"organization_id"`
+	Status         InvitationStatus `gorm:"size:20;not null;default:'pending'" json:"status"`
+	ExpiresAt      time.Time        `json:"expires_at"`
+	InvitedBy      *uint            `json:"invited_by"`
+	AcceptedBy     *uint            `json:"accepted_by"`
+	AcceptedAt     *time.Time       `json:"accepted_at"`
+
+	Roles        []Role        `gorm:"many2many:invitation_roles;" json:"roles"`
+	Organization *Organization `json:"organization,omitempty"`
+}
+
+type InvitationStatus string
+
+const (
+	InvitationStatusPending  InvitationStatus = "pending"
+	InvitationStatusAccepted InvitationStatus = "accepted"
+	InvitationStatusRevoked  InvitationStatus = "revoked"
+)
+
+// IsExpired checks if the invitation has expired
+func (i *Invitation) IsExpired() bool {
+	return time.Now().After(i.ExpiresAt)
+}
+
+// IsPending reports whether the invitation can still be accepted
+func (i *Invitation) IsPending() bool {
+	return i.Status == InvitationStatusPending && !i.IsExpired()
+}
+
+// RoleIDs returns the IDs of the roles the invitation grants
+func (i *Invitation) RoleIDs() []uint {
+	ids := make([]uint, 0, len(i.Roles))
+	for _, role := range i.Roles {
+		ids = append(ids, role.ID)
+	}
+	return ids
+}
+
+// TableName specifies the table name for the Invitation model
+func (Invitation) TableName() string {
+	return "invitations"
+}
@@ -12,24 +12,42 @@ type User struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
-	Email            string     `gorm:"size:255;not null;unique" json:"email"`
-	Username         string     `gorm:"size:255;not null;unique" json:"username"`
-	Password         string     `gorm:"size:255;not null" json:"-"`
-	FirstName        string     `gorm:"size:255" json:"first_name"`
-	LastName         string     `gorm:"size:255" json:"last_name"`
-	Phone            string     `json:"phone"`
-	Active           bool       `json:"active" gorm:"default:true"`
-	EmailVerified    bool       `json:"email_verified" gorm:"default:false"`
-	TwoFactorEnabled bool       `json:"two_factor_enabled" gorm:"default:false"`
-	LastLoginAt      *time.Time `json:"last_login_at"`
-	LastLoginIP      string     `json:"last_login_ip"`
-	FailedLogins     int        `json:"failed_logins" gorm:"default:0"`
-	LockedUntil      *time.Time `json:"locked_until"`
+	Email            string `gorm:"size:255;not null;unique" json:"email"`
+	Username         string `gorm:"size:255;not null;unique" json:"username"`
+	Password         string `gorm:"size:255;not null" json:"-"`
+	FirstName        string `gorm:"size:255" json:"first_name"`
+	LastName         string `gorm:"size:255" json:"last_name"`
+	Phone            string `json:"phone"`
+	Active           bool   `json:"active" gorm:"default:true"`
+	EmailVerified    bool   `json:"email_verified" gorm:"default:false"`
+	TwoFactorEnabled bool   `json:"two_factor_enabled" gorm:"default:false"`
+	// TwoFactorSecret is the encrypted TOTP secret. It is stored while
+	// enrollment is pending and kept once the first code confirms it.
+	TwoFactorSecret string `gorm:"size:255" json:"-"`
+	// TwoFactorLastStep is the last accepted TOTP time step, used to
+	// reject a code that has already been used
+	TwoFactorLastStep int64      `json:"-" gorm:"default:0"`
+	LastLoginAt       *time.Time `json:"last_login_at"`
+	LastLoginIP       string     `json:"last_login_ip"`
+	FailedLogins      int        `json:"failed_logins" gorm:"default:0"`
+	LockedUntil       *time.Time `json:"locked_until"`
+	// PasswordResetRequired blocks logins until the password is reset
+	// through an emailed link
+	PasswordResetRequired bool `json:"password_reset_required" gorm:"default:false"`
+
+	// Attributes are free-form facts about the user, such as their region,
+	// that access policies can refer to as subject.attributes.<name>
+	Attributes map[string]string `gorm:"type:text;serializer:json" json:"attributes"`
 
 	Status UserStatus `gorm:"type:varchar(20);default:'active'" json:"status"`
 	Type   UserType   `gorm:"type:varchar(20);default:'user'" json:"type"`
 
 	Roles []Role `gorm:"many2many:user_roles;" json:"roles"`
+
+	// LinkedAccounts are the external identities the user can sign in with
+	LinkedAccounts []LinkedAccount `gorm:"foreignKey:UserID" json:"linked_accounts,omitempty"`
+	// Passkeys are the WebAuthn credentials the user registered
+	Passkeys []Passkey `gorm:"foreignKey:UserID" json:"passkeys,omitempty"`
 }
 
 type UserStatus string
@@ -46,6 +64,10 @@ type UserType string
 const (
 	UserTypeAdmin UserType = "admin"
 	UserTypeUser  UserType = "user"
+	// UserTypeService marks service accounts, which belong to automation
+	// rather than a person. They have no password and authenticate with
+	// API keys only.
+	UserTypeService UserType = "service"
 )
 
 // DefaultRole returns the default role for a user type
@@ -68,6 +90,16 @@ func (u *User) BeforeSave(tx *gorm.DB) error {
 	return nil
 }
 
+// IsActive reports whether the account has not been deactivated
+func (u *User) IsActive() bool {
+	return u.Active
+}
+
+// IsServiceAccount reports whether the account belongs to automation
+func (u *User) IsServiceAccount() bool {
+	return u.Type == UserTypeService
+}
+
 // IsLocked checks if the user account is locked
 func (u *User) IsLocked() bool {
 	if u.LockedUntil == nil {
@@ -8,11 +8,15 @@ type UserType string
 
 const (
 	// Permission Resources
-	ResourceUser       PermissionResource = "user"
-	ResourceRole       PermissionResource = "role"
-	ResourcePermission PermissionResource = "permission"
-	ResourceAuth       PermissionResource = "auth"
-	ResourceToken      PermissionResource = "token"
+	ResourceUser         PermissionResource = "user"
+	ResourceRole         PermissionResource = "role"
+	ResourcePermission   PermissionResource = "permission"
+	ResourceAuth         PermissionResource = "auth"
+	ResourceToken        PermissionResource = "token"
+	ResourcePolicy       PermissionResource = "policy"
+	ResourceAuthz        PermissionResource = "authz"
+	ResourceOrganization PermissionResource = "organization"
+	ResourceClient       PermissionResource = "client"
 
 	// Permission Actions
 	ActionCreate     PermissionAction = "create"
@@ -23,6 +27,8 @@ const (
 	ActionRemove     PermissionAction = "remove"
 	ActionActivate   PermissionAction = "activate"
 	ActionDeactivate PermissionAction = "deactivate"
+	ActionCheck      PermissionAction = "check"
+	ActionTrust      PermissionAction = "trust"
 
 	// Role Types
 	RoleTypeAdmin RoleType = "admin"
@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"time"
+
+	"minisapi/services/auth/internal/domain/entity"
+)
+
+type APIKeyRepository interface {
+	Create(key *entity.APIKey) error
+	FindByID(id uint) (*entity.APIKey, error)
+	FindByHash(hash string) (*entity.APIKey, error)
+	// FindByUserID returns the user's keys that are not revoked, newest first
+	FindByUserID(userID uint) ([]entity.APIKey, error)
+	Revoke(id uint) error
+	UpdateLastUsed(id uint, at time.Time) error
+}
@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"minisapi/services/auth/internal/domain/entity"
+)
+
+type AuthorizationCodeRepository interface {
+	Create(code *entity.AuthorizationCode) error
+	// Consume marks the code with the digest as used and returns it. A code
+	// that does not exist or was already used yields ErrInvalidGrant.
+	Consume(hash string) (*entity.AuthorizationCode, error)
+	CleanupExpired() error
+}
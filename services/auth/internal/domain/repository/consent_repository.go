@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"minisapi/services/auth/internal/domain/entity"
+)
+
+type ConsentRepository interface {
+	Find(userID uint, clientID string) (*entity.Consent, error)
+	// Save creates the user's consent for the client or replaces its scopes
+	Save(consent *entity.Consent) error
+	FindByUserID(userID uint) ([]entity.Consent, error)
+	Delete(userID uint, clientID string) error
+}
@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"minisapi/services/auth/internal/domain/entity"
+)
+
+// FederationStateRepository keeps sign-ins started with an external
+// provider, keyed by the digest of their state parameter
+type FederationStateRepository interface {
+	Save(ctx context.Context, stateHash string, state *entity.FederationState, ttl time.Duration) error
+	// Consume returns and removes the state, so that a callback can only be
+	// completed once
+	Consume(ctx context.Context, stateHash string) (*entity.FederationState, error)
+}
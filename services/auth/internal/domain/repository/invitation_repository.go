@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"time"
+
+	"minisapi/services/auth/internal/domain/entity"
+)
+
+type InvitationRepository interface {
+	// Create stores the invitation with links to its roles
+	Create(invitation *entity.Invitation) error
+	FindByID(id uint) (*entity.Invitation, error)
+	FindByToken(token string) (*entity.Invitation, error)
+	// ListPending returns a page of the pending invitations of the
+	// organization, or of the global invitations for organization zero
+	ListPending(orgID uint, page, limit int) ([]entity.Invitation, int64, error)
+	// Renew replaces the token digest and expiry of a pending invitation
+	Renew(id uint, token string, expiresAt time.Time) error
+	// Revoke withdraws a pending invitation
+	Revoke(id uint) error
+	// Accept claims the pending invitation for the user and, in the same
+	// transaction, creates the user when it has no ID yet, makes them a
+	// member of the invitation's organization and grants its roles
+	Accept(id uint, user *entity.User) error
+}
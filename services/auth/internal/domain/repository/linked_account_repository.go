@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"minisapi/services/auth/internal/domain/entity"
+)
+
+type LinkedAccountRepository interface {
+	Create(account *entity.LinkedAccount) error
+	FindByIdentity(provider, subject string) (*entity.LinkedAccount, error)
+	FindByUserID(userID uint) ([]entity.LinkedAccount, error)
+	UpdateLastLogin(id uint, email string) error
+	Delete(userID, id uint) error
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// LoginAttemptRepository keeps failed login counters that are shared by
+// every replica of the service
+type LoginAttemptRepository interface {
+	// Increment adds one to the counter and returns the new value. The
+	// counter expires ttl after its first increment.
+	Increment(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	Get(ctx context.Context, key string) (int64, error)
+	Reset(ctx context.Context, keys ...string) error
+}
@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"minisapi/services/auth/internal/domain/entity"
+)
+
+type OAuthClientRepository interface {
+	Create(client *entity.OAuthClient) error
+	Update(client *entity.OAuthClient) error
+	Delete(id uint) error
+	FindByID(id uint) (*entity.OAuthClient, error)
+	FindByClientID(clientID string) (*entity.OAuthClient, error)
+	List(page, limit int) ([]entity.OAuthClient, int64, error)
+}
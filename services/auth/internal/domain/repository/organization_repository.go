@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"minisapi/services/auth/internal/domain/entity"
+)
+
+type OrganizationRepository interface {
+	Create(org *entity.Organization) error
+	Update(org *entity.Organization) error
+	// Delete removes the organization together with its memberships, its
+	// roles and the grants of those roles, and revokes its pending invitations
+	Delete(id uint) error
+	FindByID(id uint) (*entity.Organization, error)
+	FindBySlug(slug string) (*entity.Organization, error)
+	List(page, limit int) ([]entity.Organization, int64, error)
+	FindByUser(userID uint) ([]entity.Organization, error)
+	AddMember(member *entity.OrganizationMember) error
+	// RemoveMember ends the membership and the user's grants of the
+	// organization's roles
+	RemoveMember(orgID, userID uint) error
+	IsMember(orgID, userID uint) (bool, error)
+	ListMembers(orgID uint, page, limit int) ([]entity.OrganizationMember, int64, error)
+	FindMemberIDs(orgID uint) ([]uint, error)
+}
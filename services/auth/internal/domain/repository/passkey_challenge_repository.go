@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"minisapi/services/auth/internal/domain/entity"
+)
+
+// PasskeyChallengeRepository keeps started passkey ceremonies, keyed by the
+// digest of their challenge
+type PasskeyChallengeRepository interface {
+	Save(ctx context.Context, challengeHash string, challenge *entity.PasskeyChallenge, ttl time.Duration) error
+	// Consume returns and removes the challenge, so that a ceremony can
+	// only be completed once
+	Consume(ctx context.Context, challengeHash string) (*entity.PasskeyChallenge, error)
+}
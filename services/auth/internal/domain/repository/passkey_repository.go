@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"minisapi/services/auth/internal/domain/entity"
+)
+
+type PasskeyRepository interface {
+	Create(passkey *entity.Passkey) error
+	FindByCredentialID(credentialID string) (*entity.Passkey, error)
+	FindByUserID(userID uint) ([]entity.Passkey, error)
+	// UpdateUsage records a sign-in with the passkey
+	UpdateUsage(id uint, signCount uint32, backedUp bool) error
+	Rename(userID, id uint, name string) (*entity.Passkey, error)
+	Delete(userID, id uint) error
+}
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// UserAccess is a user's resolved roles and permissions, including those
+// inherited through the role hierarchy
+type UserAccess struct {
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
+// AccessVersion stamps a cache entry with the invalidation counters it was
+// resolved under. An entry is only served while both counters are unchanged.
+type AccessVersion struct {
+	Global int64 `json:"global"`
+	User   int64 `json:"user"`
+}
+
+// PermissionCacheRepository caches resolved user access across replicas. The
+// access of a user is cached separately for each organization, with zero
+// standing for their global access.
+type PermissionCacheRepository interface {
+	// Get returns the cached access of the user, or nil on a miss, together
+	// with the current version. Resolve the access after calling Get and
+	// store it under that version, so a concurrent invalidation is not lost.
+	Get(ctx context.Context, userID, orgID uint) (*UserAccess, AccessVersion, error)
+	Set(ctx context.Context, userID, orgID uint, version AccessVersion, access *UserAccess, ttl time.Duration) error
+	// InvalidateUsers drops the cached access of the users in every
+	// organization
+	InvalidateUsers(ctx context.Context, userIDs ...uint) error
+	// InvalidateAll drops the cached access of every user
+	InvalidateAll(ctx context.Context) error
+}
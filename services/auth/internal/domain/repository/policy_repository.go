@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"minisapi/services/auth/internal/domain/entity"
+)
+
+type PolicyRepository interface {
+	Create(policy *entity.Policy) error
+	Update(policy *entity.Policy) error
+	Delete(id uint) error
+	FindByID(id uint) (*entity.Policy, error)
+	FindByName(name string) (*entity.Policy, error)
+	List() ([]entity.Policy, error)
+	FindEnabled() ([]entity.Policy, error)
+}
@@ -1,10 +1,16 @@
 package repository
 
 import (
+	"time"
+
 	"minisapi/services/auth/internal/domain/entity"
 )
 
 type RoleRepository interface {
+	// ForOrganization returns a repository limited to the roles of the
+	// organization, or to the global roles for organization zero. The
+	// repository returned by the constructor sees every role.
+	ForOrganization(orgID uint) RoleRepository
 	Create(role *entity.Role) error
 	Update(role *entity.Role) error
 	Delete(id uint) error
@@ -13,8 +19,13 @@ type RoleRepository interface {
 	List(page, limit int) ([]entity.Role, int64, error)
 	AssignPermission(roleID uint, permissionID uint) error
 	RemovePermission(roleID uint, permissionID uint) error
+	AssignPermissions(roleID uint, permissionIDs []uint) error
+	RemovePermissions(roleID uint, permissionIDs []uint) error
 	FindByPermission(permissionID uint) ([]entity.Role, error)
 	UpdateStatus(id uint, status entity.RoleStatus) error
 	UpdateDescription(id uint, description string) error
 	FindByUser(userID uint) ([]entity.Role, error)
+	NextGrantExpiry(userID uint) (*time.Time, error)
+	FindByIDs(ids []uint) ([]entity.Role, error)
+	FindHierarchy() (*entity.RoleGraph, error)
 }
@@ -9,10 +9,13 @@ type SessionRepository interface {
 	FindByID(id uint) (*entity.Session, error)
 	FindByUserID(userID uint) ([]entity.Session, error)
 	FindByTokenID(tokenID uint) (*entity.Session, error)
+	FindByFamily(familyID string) (*entity.Session, error)
+	FindActiveByUserID(userID uint) ([]entity.Session, error)
 	Update(session *entity.Session) error
 	Delete(id uint) error
 	Deactivate(id uint) error
 	DeactivateAll(userID uint) error
+	DeactivateByTokenIDs(tokenIDs []uint) error
 	CleanupExpired() error
 	CountActiveSessions(userID uint) (int64, error)
 }
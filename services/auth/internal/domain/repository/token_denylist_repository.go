@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// TokenDenylistRepository records access tokens that must be rejected
+// before they expire. Entries only need to outlive the tokens they cover.
+type TokenDenylistRepository interface {
+	// DenyToken rejects the access token with the given jti
+	DenyToken(ctx context.Context, tokenID string, ttl time.Duration) error
+	// DenySession rejects every access token of the session
+	DenySession(ctx context.Context, sessionID string, ttl time.Duration) error
+	// DenyUserBefore rejects every access token of the user issued at or
+	// before the given time
+	DenyUserBefore(ctx context.Context, userID uint, before time.Time, ttl time.Duration) error
+	// IsDenied reports whether an access token is covered by any entry
+	IsDenied(ctx context.Context, tokenID, sessionID string, userID uint, issuedAt time.Time) (bool, error)
+}
@@ -14,5 +14,12 @@ type TokenRepository interface {
 	Revoke(id uint) error
 	RevokeAll(userID uint) error
 	RevokeByType(userID uint, tokenType entity.TokenType) error
+	RevokeIfValid(id uint) (bool, error)
+	// Rotate revokes the token and stores its replacement in one
+	// transaction. It reports false, storing nothing, when the token was
+	// already revoked.
+	Rotate(id uint, replacement *entity.Token) (bool, error)
+	FindByFamily(familyID string) ([]entity.Token, error)
+	RevokeFamily(familyID string) error
 	CleanupExpired() error
 }
@@ -2,9 +2,24 @@ package repository
 
 import (
 	"context"
+	"time"
+
 	"minisapi/services/auth/internal/domain/entity"
 )
 
+// UserFilter narrows a user search. Zero values do not filter.
+type UserFilter struct {
+	// Query matches email, username, first or last name, case-insensitively
+	Query         string
+	Status        entity.UserStatus
+	RoleID        uint
+	EmailVerified *bool
+	// Deleted lists soft-deleted users instead of live ones
+	Deleted bool
+	Page    int
+	Limit   int
+}
+
 type UserRepository interface {
 	Create(user *entity.User) error
 	Update(user *entity.User) error
@@ -12,15 +27,33 @@ type UserRepository interface {
 	FindByID(id uint) (*entity.User, error)
 	FindByEmail(email string) (*entity.User, error)
 	FindByUsername(username string) (*entity.User, error)
+	// UsernameExists reports whether any user, deleted ones included, has
+	// the username
+	UsernameExists(username string) (bool, error)
 	List(page, limit int) ([]entity.User, int64, error)
+	// ListAfter returns up to limit users with IDs above afterID, in ID
+	// order, soft-deleted ones included
+	ListAfter(afterID uint, limit int) ([]entity.User, error)
+	Search(filter UserFilter) ([]entity.User, int64, error)
+	FindByIDWithRoles(id uint) (*entity.User, error)
+	Restore(id uint) error
+	SetActive(id uint, active bool) error
+	SetPasswordResetRequired(id uint, required bool) error
+	UpdateAttributes(id uint, attributes map[string]string) error
 	FindByRole(roleID uint) ([]entity.User, error)
 	FindByPermission(permissionID uint) ([]entity.User, error)
+	AssignRoles(userID uint, roleIDs []uint, grant entity.UserRole) error
+	FindRoleGrants(userID uint) ([]entity.UserRole, error)
+	CleanupExpiredRoleGrants() error
+	RemoveRoles(userID uint, roleIDs []uint) error
 	UpdateStatus(id uint, status entity.UserStatus) error
 	UpdatePassword(id uint, hashedPassword string) error
+	UpdateEmailVerified(ctx context.Context, id uint, verified bool) error
 	UpdateLastLogin(id uint, ip string) error
 	IncrementFailedLogins(id uint) error
 	ResetFailedLogins(id uint) error
-	LockAccount(id uint, duration int) error
+	LockAccount(id uint, duration time.Duration) error
 	UnlockAccount(id uint) error
 	UpdateTwoFactor(ctx context.Context, id uint, enabled bool, secret string) error
+	AdvanceTwoFactorStep(ctx context.Context, id uint, step int64) (bool, error)
 }
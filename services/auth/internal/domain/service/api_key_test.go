@@ -0,0 +1,31 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScopedPermissions(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  []string
+		granted []string
+		want    []string
+	}{
+		{"scope held", []string{"user:read"}, []string{"user:read", "user:update"}, []string{"user:read"}},
+		{"scope not held", []string{"role:assign"}, []string{"user:read"}, []string{}},
+		{"scope covered by wildcard grant", []string{"user:read"}, []string{"*:*"}, []string{"user:read"}},
+		{"wildcard scope covers grants", []string{"user:*"}, []string{"user:read", "role:read"}, []string{"user:read"}},
+		{"wildcard scope and grant", []string{"user:*"}, []string{"user:*"}, []string{"user:*"}},
+		{"parent scope covers child grant", []string{"notifications:send"}, []string{"notifications.email:send"}, []string{"notifications.email:send"}},
+		{"no scopes", nil, []string{"user:read"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scopedPermissions(tt.scopes, tt.granted); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("scopedPermissions(%q, %q) = %q, want %q", tt.scopes, tt.granted, got, tt.want)
+			}
+		})
+	}
+}
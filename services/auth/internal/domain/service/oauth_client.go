@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"time"
+
+	"minisapi/services/auth/internal/configs"
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/infrastructure/jwt"
+	"minisapi/services/auth/internal/pkg/errors"
+	"minisapi/services/auth/internal/pkg/permission"
+	"minisapi/services/auth/internal/pkg/utils"
+)
+
+// clientIDPrefix starts every generated client ID, so that a client can never
+// be mistaken for a user, whose subject is numeric
+const clientIDPrefix = "svc_"
+
+// OAuthClientService registers OAuth2 clients, authenticates them and
+// issues them access tokens with the client_credentials grant
+type OAuthClientService interface {
+	// Register stores the client with a generated client ID and returns the
+	// client secret, which is not stored and cannot be shown again. Public
+	// clients get no secret.
+	Register(ctx context.Context, client *entity.OAuthClient) (string, error)
+	// RotateSecret replaces the client's secret and returns the new one. The
+	// old secret stops working at once. Public clients have no secret to
+	// rotate.
+	RotateSecret(ctx context.Context, id uint) (string, error)
+	Get(ctx context.Context, id uint) (*entity.OAuthClient, error)
+	List(ctx context.Context, page, limit int) ([]entity.OAuthClient, int64, error)
+	// Update stores the client's new settings. A client made public loses
+	// its secret; one made confidential gets a secret by rotating it.
+	Update(ctx context.Context, client *entity.OAuthClient) error
+	Delete(ctx context.Context, id uint) error
+	// Authenticate checks the credentials of a client at the token
+	// endpoint. Public clients present no secret.
+	Authenticate(ctx context.Context, clientID, secret string) (*entity.OAuthClient, error)
+	// IssueToken issues an authenticated client an access token for the
+	// requested scopes and audience. No scopes means all of the client's
+	// scopes, and no audience means its first one.
+	IssueToken(ctx context.Context, client *entity.OAuthClient, scopes []string, audience string) (*ClientToken, error)
+}
+
+// ClientToken is an access token issued to an OAuth2 client
+type ClientToken struct {
+	AccessToken string
+	ExpiresIn   time.Duration
+	Scopes      []string
+	Audience    string
+}
+
+type oauthClientService struct {
+	clientRepo repository.OAuthClientRepository
+	jwtManager *jwt.JWTManager
+	cfg        configs.OAuthConfig
+}
+
+func NewOAuthClientService(
+	clientRepo repository.OAuthClientRepository,
+	jwtManager *jwt.JWTManager,
+	cfg configs.OAuthConfig,
+) OAuthClientService {
+	return &oauthClientService{
+		clientRepo: clientRepo,
+		jwtManager: jwtManager,
+		cfg:        cfg,
+	}
+}
+
+func (s *oauthClientService) Register(ctx context.Context, client *entity.OAuthClient) (string, error) {
+	if err := validateClient(client); err != nil {
+		return "", err
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	client.ClientID = clientIDPrefix + hex.EncodeToString(id)
+
+	var secret string
+	if client.Public {
+		client.SecretHash = ""
+	} else {
+		var err error
+		if secret, err = s.newSecret(client); err != nil {
+			return "", err
+		}
+	}
+
+	if err := s.clientRepo.Create(client); err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+func (s *oauthClientService) RotateSecret(ctx context.Context, id uint) (string, error) {
+	client, err := s.clientRepo.FindByID(id)
+	if err != nil {
+		return "", err
+	}
+	if client.Public {
+		return "", errors.ErrValidation
+	}
+
+	secret, err := s.newSecret(client)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.clientRepo.Update(client); err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// newSecret generates a client secret and sets its digest on the client
+func (s *oauthClientService) newSecret(client *entity.OAuthClient) (string, error) {
+	secret, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return "", err
+	}
+	secret = strings.TrimRight(secret, "=")
+
+	client.SecretHash = utils.HashToken(secret)
+	client.SecretRotatedAt = time.Now()
+	return secret, nil
+}
+
+func (s *oauthClientService) Get(ctx context.Context, id uint) (*entity.OAuthClient, error) {
+	return s.clientRepo.FindByID(id)
+}
+
+func (s *oauthClientService) List(ctx context.Context, page, limit int) ([]entity.OAuthClient, int64, error) {
+	return s.clientRepo.List(page, limit)
+}
+
+func (s *oauthClientService) Update(ctx context.Context, client *entity.OAuthClient) error {
+	if err := validateClient(client); err != nil {
+		return err
+	}
+	if client.Public {
+		client.SecretHash = ""
+	}
+	return s.clientRepo.Update(client)
+}
+
+func (s *oauthClientService) Delete(ctx context.Context, id uint) error {
+	return s.clientRepo.Delete(id)
+}
+
+// validateClient checks that the client's scopes are resource:action
+// permissions, that its redirect URIs are absolute URLs, and that it can use
+// at least one grant: client_credentials needs an audience to default to,
+// the authorization code flow a redirect URI
+func validateClient(client *entity.OAuthClient) error {
+	for _, scope := range client.Scopes {
+		if _, _, ok := permission.Split(scope); !ok {
+			return errors.ErrInvalidScope
+		}
+	}
+	for _, uri := range client.RedirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Fragment != "" {
+			return errors.ErrInvalidRedirectURI
+		}
+	}
+	if len(client.Audiences) == 0 && len(client.RedirectURIs) == 0 {
+		return errors.ErrValidation
+	}
+	return nil
+}
+
+// Authenticate answers unknown clients, wrong secrets and inactive clients
+// alike, so that the response does not reveal which clients exist
+func (s *oauthClientService) Authenticate(ctx context.Context, clientID, secret string) (*entity.OAuthClient, error) {
+	client, err := s.clientRepo.FindByClientID(clientID)
+	if err != nil {
+		if err == errors.ErrClientNotFound {
+			return nil, errors.ErrInvalidClient
+		}
+		return nil, err
+	}
+
+	if client.Public {
+		if secret != "" || !client.Active {
+			return nil, errors.ErrInvalidClient
+		}
+		return client, nil
+	}
+
+	digest := utils.HashToken(secret)
+	if subtle.ConstantTimeCompare([]byte(digest), []byte(client.SecretHash)) != 1 || !client.Active {
+		return nil, errors.ErrInvalidClient
+	}
+
+	return client, nil
+}
+
+func (s *oauthClientService) IssueToken(ctx context.Context, client *entity.OAuthClient, scopes []string, audience string) (*ClientToken, error) {
+	// Public clients have no credentials to act on their own behalf with
+	if client.Public || len(client.Audiences) == 0 {
+		return nil, errors.ErrUnauthorizedClient
+	}
+
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	allowed := permission.NewSet(client.Scopes)
+	for _, scope := range scopes {
+		if !allowed.Has(scope) {
+			return nil, errors.ErrScopeNotAllowed
+		}
+	}
+
+	if audience == "" {
+		audience = client.Audiences[0]
+	} else if !client.AllowsAudience(audience) {
+		return nil, errors.ErrAudienceNotAllowed
+	}
+
+	token, err := s.jwtManager.GenerateClientToken(client.ClientID, scopes, audience, s.cfg.ClientTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ClientToken{
+		AccessToken: token,
+		ExpiresIn:   s.cfg.ClientTokenTTL,
+		Scopes:      scopes,
+		Audience:    audience,
+	}, nil
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"minisapi/services/auth/internal/configs"
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/infrastructure/jwt"
+	"minisapi/services/auth/internal/pkg/errors"
+)
+
+func TestRegisterClient(t *testing.T) {
+	s, repo := newTestClientService(t)
+
+	confidential := &entity.OAuthClient{Name: "notification", Scopes: []string{"authz:check"}, Audiences: []string{"notification"}, Active: true}
+	secret, err := s.Register(context.Background(), confidential)
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if secret == "" || confidential.SecretHash == "" || confidential.SecretHash == secret {
+		t.Fatalf("confidential client got secret %q and hash %q, want a secret stored as a digest", secret, confidential.SecretHash)
+	}
+	if got, err := s.Authenticate(context.Background(), confidential.ClientID, secret); err != nil || got.ID != confidential.ID {
+		t.Fatalf("Authenticate = %v, %v, want the client", got, err)
+	}
+
+	public := &entity.OAuthClient{Name: "spa", RedirectURIs: []string{"https://app.example.com/callback"}, Public: true, Active: true}
+	secret, err = s.Register(context.Background(), public)
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if secret != "" || repo.clients[public.ID].SecretHash != "" {
+		t.Fatalf("public client got secret %q and hash %q, want none", secret, repo.clients[public.ID].SecretHash)
+	}
+	if _, err := s.Authenticate(context.Background(), public.ClientID, ""); err != nil {
+		t.Fatalf("Authenticate public client: %v", err)
+	}
+	if _, err := s.Authenticate(context.Background(), public.ClientID, "guess"); err != errors.ErrInvalidClient {
+		t.Fatalf("Authenticate public client with a secret = %v, want ErrInvalidClient", err)
+	}
+	if _, err := s.RotateSecret(context.Background(), public.ID); err != errors.ErrValidation {
+		t.Fatalf("RotateSecret of a public client = %v, want ErrValidation", err)
+	}
+}
+
+func TestUpdateClientSecret(t *testing.T) {
+	s, _ := newTestClientService(t)
+	client := &entity.OAuthClient{Name: "wiki", RedirectURIs: []string{"https://wiki.example.com/callback"}, Active: true}
+	secret, err := s.Register(context.Background(), client)
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	// A client made public keeps no secret
+	client.Public = true
+	if err := s.Update(context.Background(), client); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if client.SecretHash != "" {
+		t.Fatalf("public client kept its secret hash")
+	}
+
+	// Made confidential again, it needs a new secret
+	client.Public = false
+	if err := s.Update(context.Background(), client); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, err := s.Authenticate(context.Background(), client.ClientID, secret); err != errors.ErrInvalidClient {
+		t.Fatalf("Authenticate with the old secret = %v, want ErrInvalidClient", err)
+	}
+	if _, err := s.Authenticate(context.Background(), client.ClientID, ""); err != errors.ErrInvalidClient {
+		t.Fatalf("Authenticate without a secret = %v, want ErrInvalidClient", err)
+	}
+	secret, err = s.RotateSecret(context.Background(), client.ID)
+	if err != nil {
+		t.Fatalf("RotateSecret: %v", err)
+	}
+	if _, err := s.Authenticate(context.Background(), client.ClientID, secret); err != nil {
+		t.Fatalf("Authenticate with the new secret: %v", err)
+	}
+}
+
+func TestValidateClient(t *testing.T) {
+	tests := []struct {
+		name   string
+		client entity.OAuthClient
+		want   error
+	}{
+		{"client credentials", entity.OAuthClient{Scopes: []string{"authz:check"}, Audiences: []string{"api"}}, nil},
+		{"authorization code", entity.OAuthClient{RedirectURIs: []string{"https://app.example.com/cb"}}, nil},
+		{"malformed scope", entity.OAuthClient{Scopes: []string{"authz"}, Audiences: []string{"api"}}, errors.ErrInvalidScope},
+		{"relative redirect uri", entity.OAuthClient{RedirectURIs: []string{"/callback"}}, errors.ErrInvalidRedirectURI},
+		{"redirect uri with fragment", entity.OAuthClient{RedirectURIs: []string{"https://app.example.com/cb#x"}}, errors.ErrInvalidRedirectURI},
+		{"no grant", entity.OAuthClient{Scopes: []string{"authz:check"}}, errors.ErrValidation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateClient(&tt.client); err != tt.want {
+				t.Errorf("validateClient() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIssueClientToken(t *testing.T) {
+	s, _ := newTestClientService(t)
+	client := &entity.OAuthClient{
+		Name:      "notification",
+		Scopes:    []string{"authz:check", "user:read"},
+		Audiences: []string{"notification", "billing"},
+		Active:    true,
+	}
+	if _, err := s.Register(context.Background(), client); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		scopes       []string
+		audience     string
+		wantScopes   []string
+		wantAudience string
+		wantErr      error
+	}{
+		{"defaults", nil, "", []string{"authz:check", "user:read"}, "notification", nil},
+		{"narrower scopes", []string{"user:read"}, "billing", []string{"user:read"}, "billing", nil},
+		{"scope not allowed", []string{"user:delete"}, "", nil, "", errors.ErrScopeNotAllowed},
+		{"audience not allowed", nil, "payments", nil, "", errors.ErrAudienceNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := s.IssueToken(context.Background(), client, tt.scopes, tt.audience)
+			if err != tt.wantErr {
+				t.Fatalf("IssueToken() = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(token.Scopes, tt.wantScopes) || token.Audience != tt.wantAudience {
+				t.Fatalf("token for %q %q, want %q %q", token.Scopes, token.Audience, tt.wantScopes, tt.wantAudience)
+			}
+		})
+	}
+
+	public := &entity.OAuthClient{Name: "spa", Audiences: []string{"notification"}, Public: true}
+	if _, err := s.IssueToken(context.Background(), public, nil, ""); err != errors.ErrUnauthorizedClient {
+		t.Fatalf("IssueToken for a public client = %v, want ErrUnauthorizedClient", err)
+	}
+}
+
+func newTestClientService(t *testing.T) (OAuthClientService, *memoryClientRepo) {
+	t.Helper()
+	manager, err := jwt.NewJWTManager(configs.JWTConfig{
+		Secret:     "test-secret",
+		Expiration: "15m",
+		Issuer:     "https://auth.test",
+		Audience:   []string{"api"},
+	})
+	if err != nil {
+		t.Fatalf("NewJWTManager: %v", err)
+	}
+	repo := &memoryClientRepo{clients: map[uint]*entity.OAuthClient{}}
+	return NewOAuthClientService(repo, manager, configs.OAuthConfig{ClientTokenTTL: time.Minute}), repo
+}
+
+type memoryClientRepo struct {
+	repository.OAuthClientRepository
+	clients map[uint]*entity.OAuthClient
+}
+
+func (r *memoryClientRepo) Create(client *entity.OAuthClient) error {
+	client.ID = uint(len(r.clients) + 1)
+	stored := *client
+	r.clients[client.ID] = &stored
+	return nil
+}
+
+func (r *memoryClientRepo) Update(client *entity.OAuthClient) error {
+	stored := *client
+	r.clients[client.ID] = &stored
+	return nil
+}
+
+func (r *memoryClientRepo) FindByID(id uint) (*entity.OAuthClient, error) {
+	if client, ok := r.clients[id]; ok {
+		found := *client
+		return &found, nil
+	}
+	return nil, errors.ErrClientNotFound
+}
+
+func (r *memoryClientRepo) FindByClientID(clientID string) (*entity.OAuthClient, error) {
+	for _, client := range r.clients {
+		if client.ClientID == clientID {
+			found := *client
+			return &found, nil
+		}
+	}
+	return nil, errors.ErrClientNotFound
+}
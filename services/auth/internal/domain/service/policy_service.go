@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"minisapi/services/auth/internal/configs"
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/pkg/permission"
+	"minisapi/services/auth/internal/pkg/policy"
+)
+
+// PolicyService decides access requests with the attribute-based policies of
+// the policy file and the database, layered on the subject's RBAC grants
+type PolicyService interface {
+	Authorize(ctx context.Context, req AccessRequest) (*policy.Decision, error)
+	// AuthorizeBatch decides several requests, loading each subject and the
+	// active policies once
+	AuthorizeBatch(ctx context.Context, reqs []AccessRequest) ([]*policy.Decision, error)
+	// FilePolicies returns the policies loaded from the policy file. They are
+	// read-only and take precedence over database policies of the same name.
+	FilePolicies() []policy.Policy
+}
+
+// AccessRequest asks whether a user may perform an action on a resource
+type AccessRequest struct {
+	SubjectID uint
+	// OrganizationID is the organization the subject acts in. The grants of
+	// its roles count together with the subject's global grants, and it is
+	// exposed to policies as subject.organization_id. Zero means none.
+	OrganizationID uint
+	Resource       string
+	Action         string
+	// ResourceAttributes describe the resource, such as "owner_id". They are
+	// exposed to policies as resource.<name>.
+	ResourceAttributes map[string]interface{}
+	// Environment describes the request context, such as "ip". It is exposed
+	// to policies as environment.<name>, together with the current time,
+	// hour and weekday.
+	Environment map[string]interface{}
+	// Scopes, when not nil, bound what the subject may do, as for requests
+	// made with an API key. Permissions they do not cover are denied even
+	// when a policy would allow them, and the subject has no roles and only
+	// the grants the scopes cover.
+	Scopes []string
+	// Policies are evaluated in place of the active policies with the same
+	// name, or in addition to them, so changes can be tried out before they
+	// are saved
+	Policies []policy.Policy
+}
+
+type policyService struct {
+	policyRepo   repository.PolicyRepository
+	userRepo     repository.UserRepository
+	authService  AuthService
+	filePolicies []policy.Policy
+}
+
+// NewPolicyService creates a policy service, loading the policy file when one
+// is configured
+func NewPolicyService(
+	policyRepo repository.PolicyRepository,
+	userRepo repository.UserRepository,
+	authService AuthService,
+	cfg configs.PolicyConfig,
+) (PolicyService, error) {
+	s := &policyService{
+		policyRepo:  policyRepo,
+		userRepo:    userRepo,
+		authService: authService,
+	}
+
+	if cfg.File != "" {
+		policies, err := policy.LoadFile(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		s.filePolicies = policies
+	}
+
+	return s, nil
+}
+
+func (s *policyService) FilePolicies() []policy.Policy {
+	return s.filePolicies
+}
+
+// subjectKey identifies a subject acting in an organization
+type subjectKey struct {
+	userID uint
+	orgID  uint
+}
+
+// subject is a user as policies see them
+type subject struct {
+	active      bool
+	permissions []string
+	attributes  policy.Attributes
+}
+
+func (s *policyService) Authorize(ctx context.Context, req AccessRequest) (*policy.Decision, error) {
+	decisions, err := s.AuthorizeBatch(ctx, []AccessRequest{req})
+	if err != nil {
+		return nil, err
+	}
+	return decisions[0], nil
+}
+
+func (s *policyService) AuthorizeBatch(ctx context.Context, reqs []AccessRequest) ([]*policy.Decision, error) {
+	stored, err := s.policyRepo.FindEnabled()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	subjects := make(map[subjectKey]*subject)
+	decisions := make([]*policy.Decision, 0, len(reqs))
+	for _, req := range reqs {
+		key := subjectKey{userID: req.SubjectID, orgID: req.OrganizationID}
+		sub, ok := subjects[key]
+		if !ok {
+			if sub, err = s.loadSubject(ctx, req.SubjectID, req.OrganizationID); err != nil {
+				return nil, err
+			}
+			subjects[key] = sub
+		}
+
+		if !sub.active {
+			decisions = append(decisions, &policy.Decision{Reason: "subject is inactive"})
+			continue
+		}
+
+		permissions := sub.permissions
+		if req.Scopes != nil {
+			if !permission.NewSet(req.Scopes).Has(permission.Key(req.Resource, req.Action)) {
+				decisions = append(decisions, &policy.Decision{Reason: "outside the scopes of the api key"})
+				continue
+			}
+			permissions = scopedPermissions(req.Scopes, sub.permissions)
+		}
+
+		attrs := make(policy.Attributes, len(sub.attributes)+len(req.ResourceAttributes)+len(req.Environment)+3)
+		for name, value := range sub.attributes {
+			attrs[name] = value
+		}
+		if req.Scopes != nil {
+			attrs[policy.SubjectPrefix+"roles"] = []string{}
+			attrs[policy.SubjectPrefix+"permissions"] = permissions
+		}
+		for name, value := range req.ResourceAttributes {
+			attrs[policy.ResourcePrefix+name] = value
+		}
+		for name, value := range environmentAttributes(now) {
+			attrs[policy.EnvironmentPrefix+name] = value
+		}
+		for name, value := range req.Environment {
+			attrs[policy.EnvironmentPrefix+name] = value
+		}
+
+		decisions = append(decisions, policy.Evaluate(s.activePolicies(stored, req.Policies), policy.Request{
+			Resource:    req.Resource,
+			Action:      req.Action,
+			Permissions: permissions,
+			Attributes:  attrs,
+		}))
+	}
+
+	return decisions, nil
+}
+
+// loadSubject loads the user with their effective roles and permissions
+// within the organization
+func (s *policyService) loadSubject(ctx context.Context, userID, orgID uint) (*subject, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	access, err := s.authService.GetUserAccess(ctx, user.ID, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := subjectAttributes(user, access.Roles, access.Permissions)
+	if orgID != 0 {
+		attrs[policy.SubjectPrefix+"organization_id"] = strconv.FormatUint(uint64(orgID), 10)
+	}
+
+	return &subject{
+		active:      user.IsActive() && !user.IsLocked(),
+		permissions: access.Permissions,
+		attributes:  attrs,
+	}, nil
+}
+
+// activePolicies returns the file policies followed by the enabled database
+// policies, with the candidates of a dry run replacing those of the same name
+func (s *policyService) activePolicies(stored []entity.Policy, candidates []policy.Policy) []policy.Policy {
+	replaced := make(map[string]bool, len(candidates))
+	for _, candidate := range candidates {
+		replaced[candidate.Name] = true
+	}
+
+	policies := make([]policy.Policy, 0, len(s.filePolicies)+len(stored)+len(candidates))
+	seen := make(map[string]bool)
+	for _, p := range s.filePolicies {
+		if !replaced[p.Name] {
+			policies = append(policies, p)
+			seen[p.Name] = true
+		}
+	}
+	for i := range stored {
+		if !replaced[stored[i].Name] && !seen[stored[i].Name] {
+			policies = append(policies, stored[i].Rule())
+		}
+	}
+
+	return append(policies, candidates...)
+}
+
+// subjectAttributes describes the user to policies. Free-form user
+// attributes are nested under subject.attributes so they cannot shadow the
+// built-in ones.
+func subjectAttributes(user *entity.User, roles, permissions []string) policy.Attributes {
+	attrs := policy.Attributes{
+		policy.SubjectPrefix + "id":          strconv.FormatUint(uint64(user.ID), 10),
+		policy.SubjectPrefix + "type":        string(user.Type),
+		policy.SubjectPrefix + "status":      string(user.Status),
+		policy.SubjectPrefix + "roles":       roles,
+		policy.SubjectPrefix + "permissions": permissions,
+	}
+	for name, value := range user.Attributes {
+		attrs[policy.SubjectPrefix+"attributes."+name] = value
+	}
+	return attrs
+}
+
+func environmentAttributes(now time.Time) map[string]interface{} {
+	now = now.UTC()
+	return map[string]interface{}{
+		"time":    now.Format(time.RFC3339),
+		"hour":    now.Hour(),
+		"weekday": strings.ToLower(now.Weekday().String()),
+	}
+}
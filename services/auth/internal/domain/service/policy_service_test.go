@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/pkg/errors"
+	"minisapi/services/auth/internal/pkg/policy"
+)
+
+func TestAuthorizeWithinAPIKeyScopes(t *testing.T) {
+	s := &policyService{
+		policyRepo:  fakePolicyRepo{},
+		userRepo:    &fakeUserRepo{users: map[uint]*entity.User{1: {ID: 1, Active: true}}},
+		authService: &fakeAccessService{access: &repository.UserAccess{Roles: []string{"admin"}, Permissions: []string{"*:*"}}},
+		filePolicies: []policy.Policy{{
+			Name:        "admins-manage-settings",
+			Effect:      policy.EffectAllow,
+			Permissions: []string{"settings:update"},
+			Conditions:  []policy.Condition{{Attribute: "subject.roles", Operator: policy.OpContains, Value: "admin"}},
+		}},
+	}
+
+	tests := []struct {
+		name       string
+		resource   string
+		action     string
+		scopes     []string
+		wantAllow  bool
+		wantReason string
+	}{
+		{"admin login", "user", "read", nil, true, "granted user:read by role"},
+		{"admin login with a wildcard grant", "settings", "update", nil, true, "granted settings:update by role"},
+		{"key within its scopes", "reports", "read", []string{"reports:read"}, true, "granted reports:read by role"},
+		{"key outside its scopes", "user", "read", []string{"reports:read"}, false, "outside the scopes of the api key"},
+		{"key outside its scopes allowed by a role policy", "settings", "update", []string{"reports:read"}, false, "outside the scopes of the api key"},
+		{"key without scopes", "reports", "read", []string{}, false, "outside the scopes of the api key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := s.Authorize(context.Background(), AccessRequest{
+				SubjectID: 1,
+				Resource:  tt.resource,
+				Action:    tt.action,
+				Scopes:    tt.scopes,
+			})
+			if err != nil {
+				t.Fatalf("Authorize: %v", err)
+			}
+			if decision.Allowed != tt.wantAllow || decision.Reason != tt.wantReason {
+				t.Errorf("decision = %v %q, want %v %q", decision.Allowed, decision.Reason, tt.wantAllow, tt.wantReason)
+			}
+		})
+	}
+
+	// Policies see a key's subject without roles and with the scoped grants
+	decision, err := s.Authorize(context.Background(), AccessRequest{SubjectID: 1, Resource: "settings", Action: "update", Scopes: []string{"settings:update"}})
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if len(decision.Policies) != 1 || decision.Policies[0].Matched {
+		t.Errorf("policies = %+v, want the admin policy not to match a key", decision.Policies)
+	}
+}
+
+type fakePolicyRepo struct {
+	repository.PolicyRepository
+}
+
+func (fakePolicyRepo) FindEnabled() ([]entity.Policy, error) {
+	return nil, nil
+}
+
+type fakeUserRepo struct {
+	repository.UserRepository
+	users map[uint]*entity.User
+}
+
+func (r *fakeUserRepo) FindByID(id uint) (*entity.User, error) {
+	if user, ok := r.users[id]; ok {
+		return user, nil
+	}
+	return nil, errors.ErrUserNotFound
+}
+
+type fakeAccessService struct {
+	AuthService
+	access *repository.UserAccess
+}
+
+func (s *fakeAccessService) GetUserAccess(ctx context.Context, userID, orgID uint) (*repository.UserAccess, error) {
+	return s.access, nil
+}
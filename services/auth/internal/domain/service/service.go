@@ -1,33 +1,88 @@
 package service
 
 import (
+	"context"
+	"time"
+
+	"minisapi/services/auth/internal/configs"
 	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/infrastructure/email"
 	"minisapi/services/auth/internal/infrastructure/jwt"
+	"minisapi/services/auth/internal/pkg/encryption"
+	"minisapi/services/auth/internal/pkg/errors"
+	"minisapi/services/auth/internal/pkg/password"
+	"minisapi/services/auth/internal/pkg/utils"
 )
 
 // AuthService defines the interface for authentication-related operations
 type AuthService interface {
 	Validate(user interface{}) error
-	ValidateToken(token string) (uint, error)
+	ValidateToken(token string) (*jwt.Claims, error)
+	IsAccessRevoked(ctx context.Context, claims *jwt.Claims) (bool, error)
+	RevokeAccessToken(ctx context.Context, claims *jwt.Claims) error
+	RevokeSessionAccess(ctx context.Context, sessionID string) error
+	RevokeUserAccess(ctx context.Context, userIDs ...uint) error
 	GetUserRoles(userID uint) ([]string, error)
 	GetUserPermissions(userID uint) ([]string, error)
-	IsTwoFactorEnabled(userID uint) (bool, error)
+	GetUserAccess(ctx context.Context, userID, orgID uint) (*repository.UserAccess, error)
+	InvalidateUserPermissions(ctx context.Context, userIDs ...uint) error
+	InvalidateAllPermissions(ctx context.Context) error
+	GetEffectivePermissions(roleID uint) ([]EffectivePermission, error)
 	ValidatePassword(user *entity.User, password string) error
-	GenerateTokens(user *entity.User) (string, string, error)
-	GenerateAccessToken(user *entity.User) (string, error)
-	SendPasswordResetEmail(user *entity.User) error
-	VerifyEmail(token string) error
-	GenerateTwoFactorSecret() (string, error)
-	ValidateTwoFactorCode(user *entity.User, code string) error
+	ValidateUnknownUserPassword(password string) error
+	HashPassword(password string) (string, error)
+	PasswordNeedsRehash(user *entity.User) bool
+	GenerateTokens(user *entity.User, sessionID string, authMethods []string, orgID uint) (string, string, error)
+	GenerateAccessToken(user *entity.User, sessionID string, authMethods []string, orgID uint) (string, error)
+	GenerateMFAChallenge(user *entity.User, authMethods []string) (string, error)
+	ValidateMFAChallenge(token string) (uint, []string, error)
+	RefreshTokenTTL() time.Duration
+	SendVerificationEmail(user *entity.User, token string) error
+	SendPasswordResetEmail(user *entity.User, token string) error
+	SendInvitationEmail(invitation *entity.Invitation, token string) error
+	GenerateTwoFactorSecret(user *entity.User) (*TwoFactorSetup, error)
+	ValidateTwoFactorCode(user *entity.User, code string) (int64, error)
+	GenerateRecoveryCodes() ([]string, []string, error)
+	HashRecoveryCode(code string) string
 }
 
 type authService struct {
-	jwtManager *jwt.JWTManager
+	jwtManager     *jwt.JWTManager
+	hasher         *password.Hasher
+	cipher         *encryption.Cipher
+	emailService   *email.EmailService
+	twoFactorCfg   configs.TwoFactorConfig
+	roleRepo       repository.RoleRepository
+	permissionRepo repository.PermissionRepository
+	denylistRepo   repository.TokenDenylistRepository
+	permCacheRepo  repository.PermissionCacheRepository
+	permCacheTTL   time.Duration
 }
 
-func NewAuthService(jwtManager *jwt.JWTManager) AuthService {
+func NewAuthService(
+	jwtManager *jwt.JWTManager,
+	hasher *password.Hasher,
+	cipher *encryption.Cipher,
+	emailService *email.EmailService,
+	twoFactorCfg configs.TwoFactorConfig,
+	roleRepo repository.RoleRepository,
+	permissionRepo repository.PermissionRepository,
+	denylistRepo repository.TokenDenylistRepository,
+	permCacheRepo repository.PermissionCacheRepository,
+	permCacheTTL time.Duration,
+) AuthService {
 	return &authService{
-		jwtManager: jwtManager,
+		jwtManager:     jwtManager,
+		hasher:         hasher,
+		cipher:         cipher,
+		emailService:   emailService,
+		twoFactorCfg:   twoFactorCfg,
+		roleRepo:       roleRepo,
+		permissionRepo: permissionRepo,
+		denylistRepo:   denylistRepo,
+		permCacheRepo:  permCacheRepo,
+		permCacheTTL:   permCacheTTL,
 	}
 }
 
@@ -36,56 +91,187 @@ func (s *authService) Validate(user interface{}) error {
 	return nil
 }
 
-func (s *authService) ValidateToken(token string) (uint, error) {
+func (s *authService) ValidateToken(token string) (*jwt.Claims, error) {
 	return s.jwtManager.ValidateToken(token)
 }
 
-func (s *authService) GetUserRoles(userID uint) ([]string, error) {
-	// TODO: Implement
-	return nil, nil
+// IsAccessRevoked reports whether a valid access token was revoked
+// before its expiry, individually, with its session or for its user
+func (s *authService) IsAccessRevoked(ctx context.Context, claims *jwt.Claims) (bool, error) {
+	userID, err := claims.UserID()
+	if err != nil {
+		return true, nil
+	}
+
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+
+	return s.denylistRepo.IsDenied(ctx, claims.ID, claims.SessionID, userID, issuedAt)
 }
 
-func (s *authService) GetUserPermissions(userID uint) ([]string, error) {
-	// TODO: Implement
-	return nil, nil
+// RevokeAccessToken rejects a single access token for the rest of its lifetime
+func (s *authService) RevokeAccessToken(ctx context.Context, claims *jwt.Claims) error {
+	if claims.ExpiresAt == nil {
+		return nil
+	}
+	return s.denylistRepo.DenyToken(ctx, claims.ID, time.Until(claims.ExpiresAt.Time))
 }
 
-func (s *authService) IsTwoFactorEnabled(userID uint) (bool, error) {
-	// TODO: Implement
-	return false, nil
+// RevokeSessionAccess rejects the access tokens already issued for a session.
+// Entries are kept for one access token lifetime, after which every token
+// of the session has expired anyway.
+func (s *authService) RevokeSessionAccess(ctx context.Context, sessionID string) error {
+	return s.denylistRepo.DenySession(ctx, sessionID, s.jwtManager.AccessTokenTTL())
 }
 
-func (s *authService) ValidatePassword(user *entity.User, password string) error {
-	// TODO: Implement
+// RevokeUserAccess rejects the access tokens already issued to the users.
+// Tokens issued afterwards, for example on refresh, are accepted again.
+func (s *authService) RevokeUserAccess(ctx context.Context, userIDs ...uint) error {
+	now := time.Now()
+	for _, userID := range userIDs {
+		if err := s.denylistRepo.DenyUserBefore(ctx, userID, now, s.jwtManager.AccessTokenTTL()); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (s *authService) GenerateTokens(user *entity.User) (string, string, error) {
-	// TODO: Implement
-	return "", "", nil
+// GetUserRoles returns the names of the user's global roles, including the
+// roles they inherit from
+func (s *authService) GetUserRoles(userID uint) ([]string, error) {
+	access, err := s.GetUserAccess(context.Background(), userID, 0)
+	if err != nil {
+		return nil, err
+	}
+	return access.Roles, nil
 }
 
-func (s *authService) GenerateAccessToken(user *entity.User) (string, error) {
-	// TODO: Implement
-	return "", nil
+// GetUserPermissions returns the user's global permissions, including
+// inherited ones, flattened to resource:action strings
+func (s *authService) GetUserPermissions(userID uint) ([]string, error) {
+	access, err := s.GetUserAccess(context.Background(), userID, 0)
+	if err != nil {
+		return nil, err
+	}
+	return access.Permissions, nil
 }
 
-func (s *authService) SendPasswordResetEmail(user *entity.User) error {
-	// TODO: Implement
+func (s *authService) ValidatePassword(user *entity.User, password string) error {
+	ok, err := s.hasher.Verify(password, user.Password)
+	if err != nil || !ok {
+		return errors.ErrInvalidCredentials
+	}
 	return nil
 }
 
-func (s *authService) VerifyEmail(token string) error {
-	// TODO: Implement
-	return nil
+// ValidateUnknownUserPassword spends the time of ValidatePassword for a user
+// that does not exist, so that timing does not reveal which emails have an
+// account, and always fails
+func (s *authService) ValidateUnknownUserPassword(password string) error {
+	s.hasher.VerifyDummy(password)
+	return errors.ErrInvalidCredentials
+}
+
+func (s *authService) HashPassword(password string) (string, error) {
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return "", errors.ErrPasswordHash
+	}
+	return hash, nil
 }
 
-func (s *authService) GenerateTwoFactorSecret() (string, error) {
-	// TODO: Implement
-	return "", nil
+// PasswordNeedsRehash reports whether the stored hash was produced with an
+// algorithm or parameters other than the configured ones
+func (s *authService) PasswordNeedsRehash(user *entity.User) bool {
+	return s.hasher.NeedsRehash(user.Password)
 }
 
-func (s *authService) ValidateTwoFactorCode(user *entity.User, code string) error {
-	// TODO: Implement
-	return nil
+// GenerateTokens returns a signed access token and an opaque refresh token.
+// Persisting the refresh token is left to the caller.
+func (s *authService) GenerateTokens(user *entity.User, sessionID string, authMethods []string, orgID uint) (string, string, error) {
+	accessToken, err := s.GenerateAccessToken(user, sessionID, authMethods, orgID)
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshToken, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// GenerateAccessToken issues an access token carrying the user's current
+// roles and permissions and the methods used to authenticate. A token scoped
+// to an organization also carries the roles and permissions the user holds
+// only within it, apart from the global ones, so that they never satisfy a
+// platform-wide permission check.
+func (s *authService) GenerateAccessToken(user *entity.User, sessionID string, authMethods []string, orgID uint) (string, error) {
+	access, err := s.GetUserAccess(context.Background(), user.ID, 0)
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.NewClaims(user.ID)
+	claims.SessionID = sessionID
+	claims.Roles = access.Roles
+	claims.Permissions = access.Permissions
+	claims.AuthMethods = authMethods
+	claims.AuthLevel = jwt.AuthLevelFor(authMethods)
+
+	if orgID != 0 {
+		scoped, err := s.GetUserAccess(context.Background(), user.ID, orgID)
+		if err != nil {
+			return "", err
+		}
+		claims.OrganizationID = orgID
+		claims.OrganizationRoles = without(scoped.Roles, access.Roles)
+		claims.OrganizationPermissions = without(scoped.Permissions, access.Permissions)
+	}
+
+	return s.jwtManager.GenerateAccessToken(claims)
+}
+
+// GenerateMFAChallenge issues the short-lived token that stands for a login
+// whose first factor, given by authMethods, is verified until the second
+// factor is presented
+func (s *authService) GenerateMFAChallenge(user *entity.User, authMethods []string) (string, error) {
+	return s.jwtManager.GenerateChallengeToken(user.ID, jwt.PurposeMFAPending, authMethods, s.twoFactorCfg.ChallengeTTL)
+}
+
+// ValidateMFAChallenge verifies an MFA challenge token and returns its user
+// and the methods of the first factor
+func (s *authService) ValidateMFAChallenge(token string) (uint, []string, error) {
+	claims, err := s.jwtManager.ValidateChallengeToken(token, jwt.PurposeMFAPending)
+	if err != nil {
+		return 0, nil, errors.ErrInvalidToken
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return 0, nil, errors.ErrInvalidToken
+	}
+	return userID, claims.AuthMethods, nil
+}
+
+func (s *authService) RefreshTokenTTL() time.Duration {
+	return s.jwtManager.RefreshTokenTTL()
+}
+
+func (s *authService) SendVerificationEmail(user *entity.User, token string) error {
+	return s.emailService.SendVerificationEmail(user.Email, token)
+}
+
+func (s *authService) SendPasswordResetEmail(user *entity.User, token string) error {
+	return s.emailService.SendPasswordResetEmail(user.Email, token)
+}
+
+func (s *authService) SendInvitationEmail(invitation *entity.Invitation, token string) error {
+	var organization string
+	if invitation.Organization != nil {
+		organization = invitation.Organization.Name
+	}
+	return s.emailService.SendInvitationEmail(invitation.Email, organization, token)
 }
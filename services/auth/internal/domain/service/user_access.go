@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/pkg/permission"
+)
+
+// GetUserAccess returns the user's effective roles and permissions within the
+// organization: their global grants together with those of the
+// organization's roles. Organization zero yields the global grants alone.
+// They are served from the permission cache when possible. A cache outage
+// falls back to the database.
+func (s *authService) GetUserAccess(ctx context.Context, userID, orgID uint) (*repository.UserAccess, error) {
+	if s.permCacheTTL <= 0 {
+		return s.resolveUserAccess(userID, orgID)
+	}
+
+	cached, version, cacheErr := s.permCacheRepo.Get(ctx, userID, orgID)
+	if cacheErr == nil && cached != nil {
+		return cached, nil
+	}
+
+	access, err := s.resolveUserAccess(userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if cacheErr != nil {
+		return access, nil
+	}
+
+	// Expiring role grants are filtered out when access is resolved, so the
+	// entry must not outlive the first of them
+	ttl := s.permCacheTTL
+	expiry, err := s.roleRepo.NextGrantExpiry(userID)
+	if err != nil {
+		return access, nil
+	}
+	if expiry != nil {
+		if untilExpiry := time.Until(*expiry); untilExpiry < ttl {
+			ttl = untilExpiry
+		}
+	}
+
+	// Caching is best effort; a failed write only costs a later lookup
+	_ = s.permCacheRepo.Set(ctx, userID, orgID, version, access, ttl)
+	return access, nil
+}
+
+// InvalidateUserPermissions drops the cached access of users whose role
+// grants, or whose roles, changed
+func (s *authService) InvalidateUserPermissions(ctx context.Context, userIDs ...uint) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	return s.permCacheRepo.InvalidateUsers(ctx, userIDs...)
+}
+
+// InvalidateAllPermissions drops the cached access of every user, for
+// changes whose affected users are not known
+func (s *authService) InvalidateAllPermissions(ctx context.Context) error {
+	return s.permCacheRepo.InvalidateAll(ctx)
+}
+
+// resolveUserAccess loads the user's roles, including inherited ones, and
+// flattens their permissions to resource:action strings
+func (s *authService) resolveUserAccess(userID, orgID uint) (*repository.UserAccess, error) {
+	roles, err := s.effectiveRoles(userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	access := &repository.UserAccess{
+		Roles:       make([]string, 0, len(roles)),
+		Permissions: make([]string, 0),
+	}
+	seen := make(map[string]bool)
+	for _, role := range roles {
+		access.Roles = append(access.Roles, role.Name)
+		for _, p := range role.Permissions {
+			name := permission.Key(p.Resource, p.Action)
+			if !seen[name] {
+				seen[name] = true
+				access.Permissions = append(access.Permissions, name)
+			}
+		}
+	}
+	return access, nil
+}
+
+// without returns the entries of values that are not in exclude
+func without(values, exclude []string) []string {
+	excluded := make(map[string]bool, len(exclude))
+	for _, value := range exclude {
+		excluded[value] = true
+	}
+
+	var rest []string
+	for _, value := range values {
+		if !excluded[value] {
+			rest = append(rest, value)
+		}
+	}
+	return rest
+}
@@ -2,97 +2,878 @@ package usecase
 
 import (
 	"context"
+	"fmt"
+	"minisapi/services/auth/internal/configs"
 	"minisapi/services/auth/internal/domain/entity"
 	"minisapi/services/auth/internal/domain/repository"
 	"minisapi/services/auth/internal/domain/service"
+	"minisapi/services/auth/internal/infrastructure/jwt"
+	"minisapi/services/auth/internal/infrastructure/metrics"
+	"minisapi/services/auth/internal/pkg/errors"
+	"minisapi/services/auth/internal/pkg/utils"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 type AuthUseCase interface {
 	Register(ctx context.Context, user *entity.User) error
-	Login(ctx context.Context, email, password string) (*entity.User, string, string, error)
-	Logout(ctx context.Context, userID uint, refreshToken string) error
-	RefreshToken(ctx context.Context, refreshToken string) (string, error)
-	ResetPassword(ctx context.Context, email string) error
+	Login(ctx context.Context, email, password string, client ClientInfo) (*LoginResult, error)
+	LoginTwoFactor(ctx context.Context, mfaToken, code string, client ClientInfo) (*LoginResult, error)
+	LoginSecondFactor(ctx context.Context, mfaToken string, client ClientInfo, verify SecondFactorFunc) (*LoginResult, error)
+	LoginExternal(ctx context.Context, user *entity.User, authMethods []string, client ClientInfo) (*LoginResult, error)
+	UnlockAccount(ctx context.Context, userID uint) error
+	Logout(ctx context.Context, claims *jwt.Claims) error
+	LogoutAll(ctx context.Context, userID uint) error
+	ListSessions(ctx context.Context, userID uint) ([]entity.Session, error)
+	RevokeSession(ctx context.Context, userID, sessionID uint) error
+	RefreshToken(ctx context.Context, refreshToken string) (string, string, error)
+	ListOrganizations(ctx context.Context, userID uint) ([]entity.Organization, error)
+	SwitchOrganization(ctx context.Context, claims *jwt.Claims, orgID uint) (string, error)
+	ResetPassword(ctx context.Context, token, newPassword string) error
 	VerifyEmail(ctx context.Context, token string) error
+	ResendVerificationEmail(ctx context.Context, email string) error
 	ChangePassword(ctx context.Context, userID uint, oldPassword, newPassword string) error
-	EnableTwoFactor(ctx context.Context, userID uint) (string, error)
-	DisableTwoFactor(ctx context.Context, userID uint) error
-	VerifyTwoFactor(ctx context.Context, userID uint, code string) error
+	EnableTwoFactor(ctx context.Context, userID uint) (*service.TwoFactorSetup, error)
+	DisableTwoFactor(ctx context.Context, userID uint, code, password string) error
+	VerifyTwoFactor(ctx context.Context, userID uint, code string) ([]string, error)
 	ForgotPassword(ctx context.Context, email string) error
 }
 
+// ClientInfo describes the client a login comes from
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// SecondFactorFunc verifies the second factor a user presented and returns
+// its authentication method
+type SecondFactorFunc func(ctx context.Context, user *entity.User) (string, error)
+
+// LoginResult is the outcome of a login step. When the user has two-factor
+// authentication enabled, the password step only yields an MFAToken that
+// must be exchanged together with a second-factor code for real tokens.
+type LoginResult struct {
+	User         *entity.User
+	AccessToken  string
+	RefreshToken string
+	MFAToken     string
+}
+
+// MFARequired reports whether the login is waiting for a second factor
+func (r *LoginResult) MFARequired() bool {
+	return r.MFAToken != ""
+}
+
 type authUseCase struct {
-	userRepo    repository.UserRepository
-	tokenRepo   repository.TokenRepository
-	sessionRepo repository.SessionRepository
-	authService service.AuthService
+	userRepo         repository.UserRepository
+	tokenRepo        repository.TokenRepository
+	sessionRepo      repository.SessionRepository
+	recoveryCodeRepo repository.RecoveryCodeRepository
+	attemptRepo      repository.LoginAttemptRepository
+	orgRepo          repository.OrganizationRepository
+	authService      service.AuthService
+	lockoutCfg       configs.LockoutConfig
+	emailCfg         configs.EmailConfig
+	sessionCfg       configs.SessionConfig
 }
 
 func (uc *authUseCase) Register(ctx context.Context, user *entity.User) error {
-	return uc.userRepo.Create(user)
+	hashedPassword, err := uc.authService.HashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+	user.Password = hashedPassword
+
+	if user.Username == "" {
+		if user.Username, err = newUsername(uc.userRepo, "", user.Email); err != nil {
+			return err
+		}
+	}
+
+	if err := uc.userRepo.Create(user); err != nil {
+		return err
+	}
+
+	// A failed delivery must not undo the registration; the user can ask
+	// for a new link with ResendVerificationEmail
+	_ = uc.sendVerificationEmail(user)
+
+	return nil
 }
 
-func (uc *authUseCase) Login(ctx context.Context, email, password string) (*entity.User, string, string, error) {
+func (uc *authUseCase) Login(ctx context.Context, email, password string, client ClientInfo) (*LoginResult, error) {
+	if err := uc.checkIPThrottle(ctx, client.IP); err != nil {
+		return nil, err
+	}
+
 	user, err := uc.userRepo.FindByEmail(email)
-	if err != nil {
-		return nil, "", "", err
+	if err != nil && err != errors.ErrUserNotFound {
+		return nil, err
+	}
+
+	// Service accounts have no password. They are answered like unknown
+	// emails, so that failed attempts cannot lock them out of their API keys.
+	if user == nil || user.IsServiceAccount() {
+		return nil, uc.recordFailedLogin(ctx, nil, client.IP, uc.authService.ValidateUnknownUserPassword(password))
 	}
 
+	// The password is checked before the lock, so that wrong passwords for
+	// locked accounts are answered like those for any other email. They only
+	// count against the IP address, not towards a longer lock.
 	if err := uc.authService.ValidatePassword(user, password); err != nil {
-		return nil, "", "", err
+		if user.IsLocked() {
+			return nil, uc.recordFailedLogin(ctx, nil, client.IP, err)
+		}
+		return nil, uc.recordFailedLogin(ctx, user, client.IP, err)
+	}
+
+	// Account state is only revealed to callers who know the password
+	if user.IsLocked() {
+		metrics.RecordLoginAttempt(false)
+		return nil, errors.ErrAccountLocked
+	}
+	if err := checkAccountUsable(user); err != nil {
+		return nil, err
+	}
+
+	// Upgrade the stored hash when the hashing parameters have changed.
+	// A failure here must not block an otherwise valid login.
+	if uc.authService.PasswordNeedsRehash(user) {
+		if hashedPassword, err := uc.authService.HashPassword(password); err == nil {
+			if err := uc.userRepo.UpdatePassword(user.ID, hashedPassword); err == nil {
+				user.Password = hashedPassword
+			}
+		}
+	}
+
+	// Failed attempts are only cleared once the whole login succeeds, so
+	// the second factor cannot be guessed by interleaving correct passwords
+	return uc.completeFirstFactor(ctx, user, client, []string{jwt.AuthMethodPassword})
+}
+
+// completeFirstFactor either completes the login or, when the user has
+// two-factor authentication enabled and the methods used so far are not
+// multi-factor already, starts waiting for the second factor
+func (uc *authUseCase) completeFirstFactor(ctx context.Context, user *entity.User, client ClientInfo, authMethods []string) (*LoginResult, error) {
+	if user.TwoFactorEnabled && jwt.AuthLevelFor(authMethods) != jwt.AuthLevelMultiFactor {
+		mfaToken, err := uc.authService.GenerateMFAChallenge(user, authMethods)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{User: user, MFAToken: mfaToken}, nil
+	}
+
+	return uc.completeLogin(ctx, user, client, authMethods)
+}
+
+// LoginExternal signs in a user who authenticated outside of the password
+// check, such as with an external identity provider or a passkey.
+// Two-factor authentication still applies unless the methods are
+// multi-factor already.
+func (uc *authUseCase) LoginExternal(ctx context.Context, user *entity.User, authMethods []string, client ClientInfo) (*LoginResult, error) {
+	if user.IsLocked() {
+		metrics.RecordLoginAttempt(false)
+		return nil, errors.ErrAccountLocked
+	}
+
+	if err := checkAccountUsable(user); err != nil {
+		return nil, err
+	}
+
+	return uc.completeFirstFactor(ctx, user, client, authMethods)
+}
+
+// LoginTwoFactor completes a login that is waiting for its second factor
+// with a TOTP or recovery code
+func (uc *authUseCase) LoginTwoFactor(ctx context.Context, mfaToken, code string, client ClientInfo) (*LoginResult, error) {
+	return uc.LoginSecondFactor(ctx, mfaToken, client, func(ctx context.Context, user *entity.User) (string, error) {
+		return uc.verifySecondFactor(ctx, user, code)
+	})
+}
+
+// LoginSecondFactor completes a login that is waiting for its second factor
+// once verify accepts it. Failures count towards the lockout of the account
+// and the throttling of the address, whichever factor was presented.
+func (uc *authUseCase) LoginSecondFactor(ctx context.Context, mfaToken string, client ClientInfo, verify SecondFactorFunc) (*LoginResult, error) {
+	if err := uc.checkIPThrottle(ctx, client.IP); err != nil {
+		return nil, err
+	}
+
+	userID, authMethods, err := uc.authService.ValidateMFAChallenge(mfaToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := uc.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.IsLocked() {
+		metrics.RecordLoginAttempt(false)
+		return nil, errors.ErrAccountLocked
+	}
+
+	if err := checkAccountUsable(user); err != nil {
+		return nil, err
+	}
+
+	if !user.TwoFactorEnabled {
+		return nil, errors.ErrTwoFactorDisabled
+	}
+
+	method, err := verify(ctx, user)
+	if err != nil {
+		return nil, uc.recordFailedLogin(ctx, user, client.IP, err)
+	}
+
+	// Challenges issued before they recorded the first factor came from
+	// password logins
+	if len(authMethods) == 0 {
+		authMethods = []string{jwt.AuthMethodPassword}
+	}
+	return uc.completeLogin(ctx, user, client, append(authMethods, method))
+}
+
+// UnlockAccount lifts a lock and clears the failed login history of an account
+func (uc *authUseCase) UnlockAccount(ctx context.Context, userID uint) error {
+	if _, err := uc.userRepo.FindByID(userID); err != nil {
+		return err
+	}
+
+	if err := uc.userRepo.UnlockAccount(userID); err != nil {
+		return err
+	}
+
+	return uc.attemptRepo.Reset(ctx, accountAttemptKey(userID), lockoutLevelKey(userID))
+}
+
+// checkAccountUsable refuses logins to deactivated accounts and to accounts
+// whose password must be reset first
+func checkAccountUsable(user *entity.User) error {
+	if !user.IsActive() {
+		return errors.ErrUserInactive
+	}
+	if user.PasswordResetRequired {
+		return errors.ErrPasswordResetRequired
+	}
+	return nil
+}
+
+// completeLogin starts the session of a fully authenticated login and
+// clears the account's failed attempts
+func (uc *authUseCase) completeLogin(ctx context.Context, user *entity.User, client ClientInfo, authMethods []string) (*LoginResult, error) {
+	result, err := uc.startSession(ctx, user, client, authMethods)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := uc.attemptRepo.Reset(ctx, accountAttemptKey(user.ID)); err != nil {
+		return nil, err
+	}
+	if user.FailedLogins > 0 {
+		if err := uc.userRepo.ResetFailedLogins(user.ID); err != nil {
+			return nil, err
+		}
+		user.FailedLogins = 0
+	}
+	if err := uc.userRepo.UpdateLastLogin(user.ID, client.IP); err != nil {
+		return nil, err
+	}
+
+	metrics.RecordLoginAttempt(true)
+	return result, nil
+}
+
+// checkIPThrottle refuses logins from an address with too many recent
+// failures, whichever accounts they targeted
+func (uc *authUseCase) checkIPThrottle(ctx context.Context, ip string) error {
+	if ip == "" {
+		return nil
+	}
+
+	count, err := uc.attemptRepo.Get(ctx, ipAttemptKey(ip))
+	if err != nil {
+		return err
+	}
+	if count >= int64(uc.lockoutCfg.IPMaxAttempts) {
+		metrics.RecordLoginAttempt(false)
+		return errors.ErrRateLimitExceeded
+	}
+
+	return nil
+}
+
+// recordFailedLogin counts a failed attempt against the IP address and,
+// when known, the account. Reaching the account threshold locks the account
+// for a duration that doubles with each lock. It returns cause even when
+// this attempt locked the account, so that the lock is only revealed to
+// callers who know the password.
+func (uc *authUseCase) recordFailedLogin(ctx context.Context, user *entity.User, ip string, cause error) error {
+	metrics.RecordLoginAttempt(false)
+
+	if ip != "" {
+		if _, err := uc.attemptRepo.Increment(ctx, ipAttemptKey(ip), uc.lockoutCfg.Window); err != nil {
+			return err
+		}
+	}
+
+	if user == nil {
+		return cause
+	}
+
+	if err := uc.userRepo.IncrementFailedLogins(user.ID); err != nil {
+		return err
+	}
+
+	count, err := uc.attemptRepo.Increment(ctx, accountAttemptKey(user.ID), uc.lockoutCfg.Window)
+	if err != nil {
+		return err
+	}
+	if count < int64(uc.lockoutCfg.MaxAttempts) {
+		return cause
+	}
+
+	level, err := uc.attemptRepo.Increment(ctx, lockoutLevelKey(user.ID), uc.lockoutCfg.ResetAfter)
+	if err != nil {
+		return err
+	}
+
+	if err := uc.userRepo.LockAccount(user.ID, uc.lockoutDuration(level)); err != nil {
+		return err
+	}
+
+	if err := uc.attemptRepo.Reset(ctx, accountAttemptKey(user.ID)); err != nil {
+		return err
+	}
+
+	return cause
+}
+
+// lockoutDuration returns the lock duration for the nth consecutive lock
+func (uc *authUseCase) lockoutDuration(level int64) time.Duration {
+	duration := uc.lockoutCfg.Duration
+	for i := int64(1); i < level && duration < uc.lockoutCfg.MaxDuration; i++ {
+		duration *= 2
+	}
+	if duration > uc.lockoutCfg.MaxDuration {
+		duration = uc.lockoutCfg.MaxDuration
+	}
+	return duration
+}
+
+func accountAttemptKey(userID uint) string {
+	return fmt.Sprintf("login:failed:user:%d", userID)
+}
+
+func ipAttemptKey(ip string) string {
+	return "login:failed:ip:" + ip
+}
+
+func lockoutLevelKey(userID uint) string {
+	return fmt.Sprintf("login:lockouts:user:%d", userID)
+}
+
+// startSession records a new login session and issues its first token pair
+func (uc *authUseCase) startSession(ctx context.Context, user *entity.User, client ClientInfo, authMethods []string) (*LoginResult, error) {
+	if err := uc.enforceSessionLimit(ctx, user.ID); err != nil {
+		return nil, err
 	}
 
-	accessToken, refreshToken, err := uc.authService.GenerateTokens(user)
+	// The token family identifies the login session across rotations
+	familyID := uuid.New().String()
+
+	accessToken, refreshToken, err := uc.authService.GenerateTokens(user, familyID, authMethods, 0)
 	if err != nil {
-		return nil, "", "", err
+		return nil, err
 	}
 
-	return user, accessToken, refreshToken, nil
+	token, err := uc.storeRefreshToken(user.ID, refreshToken, familyID, authMethods, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &entity.Session{
+		UserID:    user.ID,
+		TokenID:   token.ID,
+		FamilyID:  familyID,
+		IP:        client.IP,
+		UserAgent: truncate(client.UserAgent, 255),
+		Device:    utils.DeviceLabel(client.UserAgent),
+		ExpiresAt: token.ExpiresAt,
+		Active:    true,
+	}
+	if err := uc.sessionRepo.Create(session); err != nil {
+		return nil, err
+	}
+
+	return &LoginResult{
+		User:         user,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
 }
 
-func (uc *authUseCase) Logout(ctx context.Context, userID uint, refreshToken string) error {
-	if err := uc.tokenRepo.RevokeAll(userID); err != nil {
+// Logout revokes the presented access token and ends its session
+func (uc *authUseCase) Logout(ctx context.Context, claims *jwt.Claims) error {
+	if err := uc.authService.RevokeAccessToken(ctx, claims); err != nil {
 		return err
 	}
 
-	token, err := uc.tokenRepo.FindByToken(refreshToken)
+	userID, err := claims.UserID()
 	if err != nil {
 		return err
 	}
 
-	session, err := uc.sessionRepo.FindByTokenID(token.ID)
+	session, err := uc.sessionRepo.FindByFamily(claims.SessionID)
 	if err != nil {
 		return err
 	}
 
-	return uc.sessionRepo.Deactivate(session.ID)
+	if session.UserID != userID {
+		return errors.ErrSessionNotFound
+	}
+
+	return uc.endSession(ctx, session)
+}
+
+// LogoutAll ends every session of the user and revokes their access tokens
+func (uc *authUseCase) LogoutAll(ctx context.Context, userID uint) error {
+	if err := uc.tokenRepo.RevokeByType(userID, entity.TokenTypeRefresh); err != nil {
+		return err
+	}
+
+	if err := uc.sessionRepo.DeactivateAll(userID); err != nil {
+		return err
+	}
+
+	return uc.authService.RevokeUserAccess(ctx, userID)
 }
 
-func (uc *authUseCase) RefreshToken(ctx context.Context, refreshToken string) (string, error) {
-	token, err := uc.tokenRepo.FindByToken(refreshToken)
+// ListSessions returns the user's active sessions, oldest first
+func (uc *authUseCase) ListSessions(ctx context.Context, userID uint) ([]entity.Session, error) {
+	return uc.sessionRepo.FindActiveByUserID(userID)
+}
+
+// RevokeSession ends one of the user's sessions
+func (uc *authUseCase) RevokeSession(ctx context.Context, userID, sessionID uint) error {
+	session, err := uc.sessionRepo.FindByID(sessionID)
 	if err != nil {
-		return "", err
+		return err
+	}
+
+	// Sessions of other users are reported as missing rather than forbidden
+	if session.UserID != userID {
+		return errors.ErrSessionNotFound
+	}
+
+	return uc.endSession(ctx, session)
+}
+
+// endSession revokes the tokens of a session and deactivates it
+func (uc *authUseCase) endSession(ctx context.Context, session *entity.Session) error {
+	if session.FamilyID != "" {
+		if err := uc.tokenRepo.RevokeFamily(session.FamilyID); err != nil {
+			return err
+		}
+	} else if err := uc.tokenRepo.Revoke(session.TokenID); err != nil {
+		return err
+	}
+
+	if err := uc.sessionRepo.Deactivate(session.ID); err != nil {
+		return err
+	}
+
+	return uc.authService.RevokeSessionAccess(ctx, session.FamilyID)
+}
+
+// enforceSessionLimit applies the max sessions policy before a new session
+// is started: the oldest sessions are ended, or the login is rejected
+func (uc *authUseCase) enforceSessionLimit(ctx context.Context, userID uint) error {
+	if uc.sessionCfg.MaxPerUser <= 0 {
+		return nil
+	}
+
+	sessions, err := uc.sessionRepo.FindActiveByUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	excess := len(sessions) - uc.sessionCfg.MaxPerUser + 1
+	if excess <= 0 {
+		return nil
+	}
+
+	if uc.sessionCfg.LimitPolicy == configs.SessionLimitReject {
+		return errors.ErrTooManySessions
+	}
+
+	for i := 0; i < excess; i++ {
+		if err := uc.endSession(ctx, &sessions[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RefreshToken rotates a refresh token: the presented token is revoked and
+// replaced by a new one in the same family. Presenting a token that was
+// already rotated or revoked is treated as theft, and the whole family is
+// revoked together with its sessions.
+func (uc *authUseCase) RefreshToken(ctx context.Context, refreshToken string) (string, string, error) {
+	token, err := uc.tokenRepo.FindByToken(utils.HashToken(refreshToken))
+	if err != nil {
+		return "", "", errors.ErrInvalidToken
+	}
+
+	if token.Type != entity.TokenTypeRefresh {
+		return "", "", errors.ErrTokenTypeInvalid
+	}
+
+	if token.Revoked {
+		if err := uc.revokeTokenFamily(ctx, token.FamilyID); err != nil {
+			return "", "", err
+		}
+		return "", "", errors.ErrTokenRevoked
+	}
+
+	if token.IsExpired() {
+		return "", "", errors.ErrTokenExpired
 	}
 
 	user, err := uc.userRepo.FindByID(token.UserID)
 	if err != nil {
+		return "", "", err
+	}
+
+	if !user.IsActive() {
+		return "", "", errors.ErrUserInactive
+	}
+
+	// The new tokens keep the authentication strength of the original login
+	var authMethods []string
+	if token.AuthMethods != "" {
+		authMethods = strings.Split(token.AuthMethods, ",")
+	}
+
+	// The new tokens stay scoped to the organization switched to, as long
+	// as the user is still a member of it
+	orgID, err := uc.sessionOrganization(token)
+	if err != nil {
+		return "", "", err
+	}
+
+	accessToken, newRefreshToken, err := uc.authService.GenerateTokens(user, token.FamilyID, authMethods, orgID)
+	if err != nil {
+		return "", "", err
+	}
+
+	var scope *uint
+	if orgID != 0 {
+		scope = &orgID
+	}
+	newToken := uc.newRefreshToken(user.ID, newRefreshToken, token.FamilyID, authMethods, scope)
+
+	// Claim the token and store its replacement in one transaction, so that
+	// two concurrent refreshes with the same token cannot both succeed and
+	// a failed refresh does not lose the session
+	claimed, err := uc.tokenRepo.Rotate(token.ID, newToken)
+	if err != nil {
+		return "", "", err
+	}
+	if !claimed {
+		if err := uc.revokeTokenFamily(ctx, token.FamilyID); err != nil {
+			return "", "", err
+		}
+		return "", "", errors.ErrTokenRevoked
+	}
+
+	// Keep the session attached to the live token of its family
+	if session, err := uc.sessionRepo.FindByTokenID(token.ID); err == nil {
+		now := time.Now()
+		session.TokenID = newToken.ID
+		session.ExpiresAt = newToken.ExpiresAt
+		session.LastUsedAt = &now
+		if err := uc.sessionRepo.Update(session); err != nil {
+			return "", "", err
+		}
+	}
+
+	return accessToken, newRefreshToken, nil
+}
+
+// storeRefreshToken persists the digest of a refresh token in the given family
+func (uc *authUseCase) storeRefreshToken(userID uint, refreshToken, familyID string, authMethods []string, orgID *uint) (*entity.Token, error) {
+	token := uc.newRefreshToken(userID, refreshToken, familyID, authMethods, orgID)
+	if err := uc.tokenRepo.Create(token); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// newRefreshToken returns the unsaved record of a refresh token's digest
+func (uc *authUseCase) newRefreshToken(userID uint, refreshToken, familyID string, authMethods []string, orgID *uint) *entity.Token {
+	return &entity.Token{
+		UserID:         userID,
+		Token:          utils.HashToken(refreshToken),
+		Type:           entity.TokenTypeRefresh,
+		ExpiresAt:      time.Now().Add(uc.authService.RefreshTokenTTL()),
+		FamilyID:       familyID,
+		AuthMethods:    strings.Join(authMethods, ","),
+		OrganizationID: orgID,
+	}
+}
+
+// sessionOrganization returns the organization a refresh token is scoped to,
+// or zero when it is not scoped or the user has left the organization since
+func (uc *authUseCase) sessionOrganization(token *entity.Token) (uint, error) {
+	if token.OrganizationID == nil {
+		return 0, nil
+	}
+
+	member, err := uc.orgRepo.IsMember(*token.OrganizationID, token.UserID)
+	if err != nil {
+		return 0, err
+	}
+	if !member {
+		return 0, nil
+	}
+
+	org, err := uc.orgRepo.FindByID(*token.OrganizationID)
+	if err == errors.ErrOrganizationNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !org.IsActive() {
+		return 0, nil
+	}
+	return org.ID, nil
+}
+
+// ListOrganizations returns the organizations the user is a member of
+func (uc *authUseCase) ListOrganizations(ctx context.Context, userID uint) ([]entity.Organization, error) {
+	return uc.orgRepo.FindByUser(userID)
+}
+
+// SwitchOrganization scopes the session of the presented access token to an
+// organization the user is a member of, or back to no organization for zero.
+// It returns an access token with the new scope and revokes the presented
+// one; later refreshes of the session keep the new scope.
+func (uc *authUseCase) SwitchOrganization(ctx context.Context, claims *jwt.Claims, orgID uint) (string, error) {
+	userID, err := claims.UserID()
+	if err != nil {
+		return "", errors.ErrInvalidToken
+	}
+
+	user, err := uc.userRepo.FindByID(userID)
+	if err != nil {
+		return "", err
+	}
+
+	var scope *uint
+	if orgID != 0 {
+		org, err := uc.orgRepo.FindByID(orgID)
+		if err != nil {
+			return "", err
+		}
+
+		member, err := uc.orgRepo.IsMember(org.ID, userID)
+		if err != nil {
+			return "", err
+		}
+		if !member {
+			return "", errors.ErrNotMember
+		}
+		if !org.IsActive() {
+			return "", errors.ErrOrganizationInactive
+		}
+		scope = &org.ID
+	}
+
+	session, err := uc.sessionRepo.FindByFamily(claims.SessionID)
+	if err != nil || session.UserID != userID || !session.IsValid() {
+		return "", errors.ErrSessionNotFound
+	}
+
+	token, err := uc.tokenRepo.FindByID(session.TokenID)
+	if err != nil {
+		return "", err
+	}
+	token.OrganizationID = scope
+	if err := uc.tokenRepo.Update(token); err != nil {
+		return "", err
+	}
+
+	accessToken, err := uc.authService.GenerateAccessToken(user, claims.SessionID, claims.AuthMethods, orgID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := uc.authService.RevokeAccessToken(ctx, claims); err != nil {
 		return "", err
 	}
 
-	return uc.authService.GenerateAccessToken(user)
+	return accessToken, nil
 }
 
-func (uc *authUseCase) ResetPassword(ctx context.Context, email string) error {
-	user, err := uc.userRepo.FindByEmail(email)
+// revokeTokenFamily revokes every token of a family, deactivates the
+// sessions bound to them and rejects the access tokens of the session
+func (uc *authUseCase) revokeTokenFamily(ctx context.Context, familyID string) error {
+	if familyID == "" {
+		return nil
+	}
+
+	tokens, err := uc.tokenRepo.FindByFamily(familyID)
 	if err != nil {
 		return err
 	}
 
-	return uc.authService.SendPasswordResetEmail(user)
+	if err := uc.tokenRepo.RevokeFamily(familyID); err != nil {
+		return err
+	}
+
+	tokenIDs := make([]uint, 0, len(tokens))
+	for _, t := range tokens {
+		tokenIDs = append(tokenIDs, t.ID)
+	}
+
+	if err := uc.sessionRepo.DeactivateByTokenIDs(tokenIDs); err != nil {
+		return err
+	}
+
+	return uc.authService.RevokeSessionAccess(ctx, familyID)
+}
+
+// ResetPassword sets a new password from a password reset token. Every
+// session of the user is ended, since the reset may follow a compromise.
+func (uc *authUseCase) ResetPassword(ctx context.Context, token, newPassword string) error {
+	resetToken, err := uc.consumeToken(token, entity.TokenTypeReset)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := uc.authService.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := uc.userRepo.UpdatePassword(resetToken.UserID, hashedPassword); err != nil {
+		return err
+	}
+
+	if err := uc.userRepo.SetPasswordResetRequired(resetToken.UserID, false); err != nil {
+		return err
+	}
+
+	if err := uc.tokenRepo.RevokeAll(resetToken.UserID); err != nil {
+		return err
+	}
+
+	if err := uc.sessionRepo.DeactivateAll(resetToken.UserID); err != nil {
+		return err
+	}
+
+	return uc.authService.RevokeUserAccess(ctx, resetToken.UserID)
 }
 
 func (uc *authUseCase) VerifyEmail(ctx context.Context, token string) error {
-	return uc.authService.VerifyEmail(token)
+	verifyToken, err := uc.consumeToken(token, entity.TokenTypeVerify)
+	if err != nil {
+		return err
+	}
+
+	return uc.userRepo.UpdateEmailVerified(ctx, verifyToken.UserID, true)
+}
+
+// ResendVerificationEmail sends a new verification link. Unknown and
+// already verified addresses are ignored so the response does not reveal
+// which accounts exist.
+func (uc *authUseCase) ResendVerificationEmail(ctx context.Context, email string) error {
+	user, err := uc.userRepo.FindByEmail(email)
+	if err != nil {
+		if err == errors.ErrUserNotFound {
+			return nil
+		}
+		return err
+	}
+
+	if user.EmailVerified {
+		return nil
+	}
+
+	return uc.sendVerificationEmail(user)
+}
+
+func (uc *authUseCase) sendVerificationEmail(user *entity.User) error {
+	token, err := uc.issueToken(user.ID, entity.TokenTypeVerify, uc.emailCfg.VerifyTTL)
+	if err != nil {
+		return err
+	}
+
+	return uc.authService.SendVerificationEmail(user, token)
+}
+
+// issueToken creates a single-use token of the given type and stores its
+// digest. Earlier tokens of the same type are revoked, so only the most
+// recent link works.
+func (uc *authUseCase) issueToken(userID uint, tokenType entity.TokenType, ttl time.Duration) (string, error) {
+	if err := uc.tokenRepo.RevokeByType(userID, tokenType); err != nil {
+		return "", err
+	}
+
+	raw, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	token := &entity.Token{
+		UserID:    userID,
+		Token:     utils.HashToken(raw),
+		Type:      tokenType,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := uc.tokenRepo.Create(token); err != nil {
+		return "", err
+	}
+
+	return raw, nil
+}
+
+// consumeToken validates a single-use token of the given type and revokes
+// it, so that it cannot be used again
+func (uc *authUseCase) consumeToken(raw string, tokenType entity.TokenType) (*entity.Token, error) {
+	token, err := uc.tokenRepo.FindByToken(utils.HashToken(raw))
+	if err != nil {
+		return nil, errors.ErrInvalidToken
+	}
+
+	if token.Type != tokenType {
+		return nil, errors.ErrTokenTypeInvalid
+	}
+
+	if token.Revoked {
+		return nil, errors.ErrTokenRevoked
+	}
+
+	if token.IsExpired() {
+		return nil, errors.ErrTokenExpired
+	}
+
+	claimed, err := uc.tokenRepo.RevokeIfValid(token.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, errors.ErrTokenRevoked
+	}
+
+	return token, nil
 }
 
 func (uc *authUseCase) ChangePassword(ctx context.Context, userID uint, oldPassword, newPassword string) error {
@@ -105,55 +886,203 @@ func (uc *authUseCase) ChangePassword(ctx context.Context, userID uint, oldPassw
 		return err
 	}
 
-	return uc.userRepo.UpdatePassword(userID, newPassword)
+	hashedPassword, err := uc.authService.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := uc.userRepo.UpdatePassword(userID, hashedPassword); err != nil {
+		return err
+	}
+
+	// Sessions started with the old password are ended
+	return uc.LogoutAll(ctx, userID)
 }
 
-func (uc *authUseCase) EnableTwoFactor(ctx context.Context, userID uint) (string, error) {
-	secret, err := uc.authService.GenerateTwoFactorSecret()
+// EnableTwoFactor starts TOTP enrollment. The encrypted secret is stored
+// as pending and only takes effect once VerifyTwoFactor confirms a code.
+func (uc *authUseCase) EnableTwoFactor(ctx context.Context, userID uint) (*service.TwoFactorSetup, error) {
+	user, err := uc.userRepo.FindByID(userID)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	err = uc.userRepo.UpdateTwoFactor(ctx, userID, true, secret)
+	if user.TwoFactorEnabled {
+		return nil, errors.ErrTwoFactorEnabled
+	}
+
+	setup, err := uc.authService.GenerateTwoFactorSecret(user)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return secret, nil
+	if err := uc.userRepo.UpdateTwoFactor(ctx, userID, false, setup.EncryptedSecret); err != nil {
+		return nil, err
+	}
+
+	return setup, nil
 }
 
-func (uc *authUseCase) DisableTwoFactor(ctx context.Context, userID uint) error {
-	return uc.userRepo.UpdateTwoFactor(ctx, userID, false, "")
+// DisableTwoFactor turns two-factor authentication off once the user proves
+// it is them again, with a current TOTP or recovery code or with their
+// password, so that a stolen session alone cannot remove the second factor
+func (uc *authUseCase) DisableTwoFactor(ctx context.Context, userID uint, code, password string) error {
+	user, err := uc.userRepo.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.IsLocked() {
+		return errors.ErrAccountLocked
+	}
+
+	switch {
+	case code != "" && user.TwoFactorEnabled:
+		_, err = uc.verifySecondFactor(ctx, user, code)
+	case password != "":
+		err = uc.authService.ValidatePassword(user, password)
+	case code != "":
+		err = errors.ErrInvalidTwoFactor
+	default:
+		return errors.ErrValidation
+	}
+	if err == errors.ErrInvalidTwoFactor || err == errors.ErrInvalidCredentials {
+		// Wrong guesses count towards the lockout like failed logins
+		return uc.recordFailedLogin(ctx, user, "", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := uc.userRepo.UpdateTwoFactor(ctx, userID, false, ""); err != nil {
+		return err
+	}
+
+	return uc.recoveryCodeRepo.DeleteByUser(userID)
 }
 
-func (uc *authUseCase) VerifyTwoFactor(ctx context.Context, userID uint, code string) error {
+// VerifyTwoFactor confirms TOTP enrollment with the first valid code after
+// EnableTwoFactor and returns a new set of recovery codes. Once enrollment
+// is confirmed it answers ErrTwoFactorEnabled, so that it cannot serve to
+// guess codes outside of the login.
+func (uc *authUseCase) VerifyTwoFactor(ctx context.Context, userID uint, code string) ([]string, error) {
 	user, err := uc.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TwoFactorEnabled {
+		return nil, errors.ErrTwoFactorEnabled
+	}
+
+	if err := uc.verifyTOTP(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := uc.authService.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := uc.recoveryCodeRepo.ReplaceForUser(userID, hashes); err != nil {
+		return nil, err
+	}
+
+	if err := uc.userRepo.UpdateTwoFactor(ctx, userID, true, user.TwoFactorSecret); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code
+// and returns the authentication method of the one given
+func (uc *authUseCase) verifySecondFactor(ctx context.Context, user *entity.User, code string) (string, error) {
+	if err := uc.verifyTOTP(ctx, user, code); err == nil {
+		return jwt.AuthMethodOTP, nil
+	} else if err != errors.ErrInvalidTwoFactor {
+		return "", err
+	}
+
+	consumed, err := uc.recoveryCodeRepo.Consume(user.ID, uc.authService.HashRecoveryCode(code))
+	if err != nil {
+		return "", err
+	}
+	if !consumed {
+		return "", errors.ErrInvalidTwoFactor
+	}
+
+	return jwt.AuthMethodRecoveryCode, nil
+}
+
+// verifyTOTP validates a TOTP code and records its time step so it cannot
+// be used again
+func (uc *authUseCase) verifyTOTP(ctx context.Context, user *entity.User, code string) error {
+	step, err := uc.authService.ValidateTwoFactorCode(user, code)
 	if err != nil {
 		return err
 	}
 
-	return uc.authService.ValidateTwoFactorCode(user, code)
+	advanced, err := uc.userRepo.AdvanceTwoFactorStep(ctx, user.ID, step)
+	if err != nil {
+		return err
+	}
+	if !advanced {
+		return errors.ErrInvalidTwoFactor
 	}
 
+	user.TwoFactorLastStep = step
+	return nil
+}
+
+// ForgotPassword emails a password reset link. Unknown addresses are
+// ignored so the response does not reveal which accounts exist.
 func (uc *authUseCase) ForgotPassword(ctx context.Context, email string) error {
 	user, err := uc.userRepo.FindByEmail(email)
+	if err != nil {
+		if err == errors.ErrUserNotFound {
+			return nil
+		}
+		return err
+	}
+
+	token, err := uc.issueToken(user.ID, entity.TokenTypeReset, uc.emailCfg.ResetTTL)
 	if err != nil {
 		return err
 	}
 
-	return uc.authService.SendPasswordResetEmail(user)
+	return uc.authService.SendPasswordResetEmail(user, token)
+}
+
+// truncate shortens s to at most n bytes
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
 }
 
 func NewAuthUseCase(
 	userRepo repository.UserRepository,
 	tokenRepo repository.TokenRepository,
 	sessionRepo repository.SessionRepository,
+	recoveryCodeRepo repository.RecoveryCodeRepository,
+	attemptRepo repository.LoginAttemptRepository,
+	orgRepo repository.OrganizationRepository,
 	authService service.AuthService,
+	lockoutCfg configs.LockoutConfig,
+	emailCfg configs.EmailConfig,
+	sessionCfg configs.SessionConfig,
 ) AuthUseCase {
 	return &authUseCase{
-		userRepo:    userRepo,
-		tokenRepo:   tokenRepo,
-		sessionRepo: sessionRepo,
-		authService: authService,
+		userRepo:         userRepo,
+		tokenRepo:        tokenRepo,
+		sessionRepo:      sessionRepo,
+		recoveryCodeRepo: recoveryCodeRepo,
+		attemptRepo:      attemptRepo,
+		orgRepo:          orgRepo,
+		authService:      authService,
+		lockoutCfg:       lockoutCfg,
+		emailCfg:         emailCfg,
+		sessionCfg:       sessionCfg,
 	}
 }
@@ -0,0 +1,820 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"minisapi/services/auth/internal/configs"
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/domain/service"
+	"minisapi/services/auth/internal/pkg/errors"
+	"minisapi/services/auth/internal/pkg/utils"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	uc, tokens, sessions, _ := newRefreshUseCase(t)
+
+	accessToken, refreshToken, err := uc.RefreshToken(context.Background(), "refresh-1")
+	if err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+	if accessToken == "" || refreshToken == "" || refreshToken == "refresh-1" {
+		t.Fatalf("RefreshToken = %q, %q, want a new pair", accessToken, refreshToken)
+	}
+
+	first := tokens.byDigest("refresh-1")
+	second := tokens.byDigest(refreshToken)
+	if !first.Revoked || first.ReplacedByID == nil || *first.ReplacedByID != second.ID {
+		t.Fatalf("presented token = %+v, want it revoked and replaced", first)
+	}
+	if second.Revoked || second.FamilyID != first.FamilyID || second.AuthMethods != first.AuthMethods {
+		t.Fatalf("new token = %+v, want a live token of the same family and login", second)
+	}
+	if session := sessions.sessions[0]; session.TokenID != second.ID || session.LastUsedAt == nil {
+		t.Fatalf("session = %+v, want it moved to the new token", session)
+	}
+
+	// The new token rotates in turn
+	if _, _, err := uc.RefreshToken(context.Background(), refreshToken); err != nil {
+		t.Fatalf("RefreshToken with the new token: %v", err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	uc, tokens, sessions, authService := newRefreshUseCase(t)
+
+	_, refreshToken, err := uc.RefreshToken(context.Background(), "refresh-1")
+	if err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+
+	// Presenting the rotated token again means one of its two holders
+	// stole it, so the whole session ends
+	if _, _, err := uc.RefreshToken(context.Background(), "refresh-1"); err != errors.ErrTokenRevoked {
+		t.Fatalf("reused token = %v, want ErrTokenRevoked", err)
+	}
+	for _, token := range tokens.tokens {
+		if token.FamilyID == "family-1" && !token.Revoked {
+			t.Fatalf("token %d of the family is still live", token.ID)
+		}
+	}
+	if tokens.byDigest("refresh-other").Revoked {
+		t.Fatal("token of another family revoked")
+	}
+	if sessions.sessions[0].Active || !sessions.sessions[1].Active {
+		t.Fatalf("sessions = %+v, want only the family's deactivated", sessions.sessions)
+	}
+	if len(authService.revokedSessions) != 1 || authService.revokedSessions[0] != "family-1" {
+		t.Fatalf("revoked session access = %v, want family-1", authService.revokedSessions)
+	}
+
+	if _, _, err := uc.RefreshToken(context.Background(), refreshToken); err != errors.ErrTokenRevoked {
+		t.Fatalf("replacement after reuse = %v, want ErrTokenRevoked", err)
+	}
+}
+
+func TestRefreshTokenRejected(t *testing.T) {
+	uc, tokens, _, _ := newRefreshUseCase(t)
+	tokens.tokens[0].ExpiresAt = time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"unknown", "refresh-unknown", errors.ErrInvalidToken},
+		{"expired", "refresh-1", errors.ErrTokenExpired},
+		{"not a refresh token", "reset-1", errors.ErrTokenTypeInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := uc.RefreshToken(context.Background(), tt.token); err != tt.want {
+				t.Errorf("RefreshToken() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// newRefreshUseCase returns a use case with the refresh token "refresh-1" of
+// jane's session in family-1, and a session of another family
+func newRefreshUseCase(t *testing.T) (AuthUseCase, *memoryTokens, *memorySessions, *fakeAuthService) {
+	t.Helper()
+	users := &memoryUsers{users: map[uint]*entity.User{
+		1: {ID: 1, Email: "jane@example.com", Active: true},
+	}}
+	expires := time.Now().Add(time.Hour)
+	tokens := &memoryTokens{}
+	for _, token := range []*entity.Token{
+		{UserID: 1, Token: utils.HashToken("refresh-1"), Type: entity.TokenTypeRefresh, ExpiresAt: expires, FamilyID: "family-1", AuthMethods: "pwd,otp"},
+		{UserID: 1, Token: utils.HashToken("refresh-other"), Type: entity.TokenTypeRefresh, ExpiresAt: expires, FamilyID: "family-2"},
+		{UserID: 1, Token: utils.HashToken("reset-1"), Type: entity.TokenTypeReset, ExpiresAt: expires},
+	} {
+		_ = tokens.Create(token)
+	}
+	sessions := &memorySessions{sessions: []*entity.Session{
+		{ID: 1, UserID: 1, TokenID: 1, FamilyID: "family-1", Active: true, ExpiresAt: expires},
+		{ID: 2, UserID: 1, TokenID: 2, FamilyID: "family-2", Active: true, ExpiresAt: expires},
+	}}
+	authService := &fakeAuthService{}
+
+	uc := &authUseCase{
+		userRepo:    users,
+		tokenRepo:   tokens,
+		sessionRepo: sessions,
+		authService: authService,
+	}
+	return uc, tokens, sessions, authService
+}
+
+var testLockout = configs.LockoutConfig{
+	MaxAttempts:   3,
+	IPMaxAttempts: 100,
+	Window:        15 * time.Minute,
+	Duration:      time.Minute,
+	MaxDuration:   time.Hour,
+	ResetAfter:    24 * time.Hour,
+}
+
+func TestLoginLocksAfterMaxAttempts(t *testing.T) {
+	uc, users, _ := newLockoutUseCase(testLockout)
+
+	for i := 0; i < testLockout.MaxAttempts; i++ {
+		if _, err := login(uc, "jane@example.com", "wrong", "10.0.0.1"); err != errors.ErrInvalidCredentials {
+			t.Fatalf("attempt %d = %v, want ErrInvalidCredentials", i+1, err)
+		}
+	}
+	if !users.users[1].IsLocked() {
+		t.Fatal("account not locked after the maximum attempts")
+	}
+	lockedUntil := *users.users[1].LockedUntil
+
+	// A locked account answers wrong passwords like an unknown email, and
+	// they do not extend the lock
+	if _, err := login(uc, "jane@example.com", "wrong", "10.0.0.1"); err != errors.ErrInvalidCredentials {
+		t.Fatalf("wrong password on a locked account = %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := login(uc, "nobody@example.com", "wrong", "10.0.0.1"); err != errors.ErrInvalidCredentials {
+		t.Fatalf("unknown email = %v, want ErrInvalidCredentials", err)
+	}
+	if !users.users[1].LockedUntil.Equal(lockedUntil) {
+		t.Fatalf("lock moved from %v to %v", lockedUntil, *users.users[1].LockedUntil)
+	}
+
+	if _, err := login(uc, "jane@example.com", "right", "10.0.0.1"); err != errors.ErrAccountLocked {
+		t.Fatalf("right password on a locked account = %v, want ErrAccountLocked", err)
+	}
+}
+
+func TestLoginAttemptsExpireAfterWindow(t *testing.T) {
+	uc, users, attempts := newLockoutUseCase(testLockout)
+
+	for i := 0; i < testLockout.MaxAttempts-1; i++ {
+		_, _ = login(uc, "jane@example.com", "wrong", "10.0.0.1")
+	}
+	attempts.now = attempts.now.Add(testLockout.Window + time.Second)
+	for i := 0; i < testLockout.MaxAttempts-1; i++ {
+		_, _ = login(uc, "jane@example.com", "wrong", "10.0.0.1")
+	}
+
+	if users.users[1].IsLocked() {
+		t.Fatal("account locked by attempts spread over two windows")
+	}
+}
+
+func TestUnlockAccount(t *testing.T) {
+	uc, users, _ := newLockoutUseCase(testLockout)
+	lock := func() {
+		for i := 0; i < testLockout.MaxAttempts; i++ {
+			_, _ = login(uc, "jane@example.com", "wrong", "10.0.0.1")
+		}
+	}
+
+	lock()
+	if err := uc.UnlockAccount(context.Background(), 1); err != nil {
+		t.Fatalf("UnlockAccount: %v", err)
+	}
+	result, err := login(uc, "jane@example.com", "right", "10.0.0.1")
+	if err != nil || !result.MFARequired() {
+		t.Fatalf("login after unlock = %v, %v, want the second factor step", result, err)
+	}
+
+	// Unlocking clears the lock history, so the next lock is a first one
+	lock()
+	if got := time.Until(*users.users[1].LockedUntil); got > testLockout.Duration {
+		t.Fatalf("lock after unlock lasts %v, want %v", got, testLockout.Duration)
+	}
+
+	// Without an unlock, each further lock doubles
+	expired := time.Now().Add(-time.Second)
+	users.users[1].LockedUntil = &expired
+	lock()
+	if got := time.Until(*users.users[1].LockedUntil); got <= testLockout.Duration || got > 2*testLockout.Duration {
+		t.Fatalf("second lock lasts %v, want %v", got, 2*testLockout.Duration)
+	}
+
+	if err := uc.UnlockAccount(context.Background(), 99); err != errors.ErrUserNotFound {
+		t.Fatalf("UnlockAccount of an unknown user = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestLoginIPThrottle(t *testing.T) {
+	cfg := testLockout
+	cfg.MaxAttempts = 100
+	cfg.IPMaxAttempts = 3
+	uc, _, _ := newLockoutUseCase(cfg)
+
+	// Failures count against the address whichever accounts they target
+	_, _ = login(uc, "jane@example.com", "wrong", "10.0.0.1")
+	_, _ = login(uc, "john@example.com", "wrong", "10.0.0.1")
+	_, _ = login(uc, "nobody@example.com", "wrong", "10.0.0.1")
+
+	if _, err := login(uc, "jane@example.com", "right", "10.0.0.1"); err != errors.ErrRateLimitExceeded {
+		t.Fatalf("login from a throttled address = %v, want ErrRateLimitExceeded", err)
+	}
+	if result, err := login(uc, "jane@example.com", "right", "10.0.0.2"); err != nil || !result.MFARequired() {
+		t.Fatalf("login from another address = %v, %v, want the second factor step", result, err)
+	}
+}
+
+func TestVerificationTokenIsSingleUse(t *testing.T) {
+	uc, users, authService := newEmailUseCase()
+
+	if err := uc.ResendVerificationEmail(context.Background(), "jane@example.com"); err != nil {
+		t.Fatalf("ResendVerificationEmail: %v", err)
+	}
+	token := authService.emailed["verify"]
+
+	if err := uc.VerifyEmail(context.Background(), token); err != nil {
+		t.Fatalf("VerifyEmail: %v", err)
+	}
+	if !users.users[1].EmailVerified {
+		t.Fatal("email not verified")
+	}
+	if err := uc.VerifyEmail(context.Background(), token); err != errors.ErrTokenRevoked {
+		t.Fatalf("second use = %v, want ErrTokenRevoked", err)
+	}
+}
+
+func TestEmailTokenExpires(t *testing.T) {
+	uc, users, authService := newEmailUseCase()
+	tokens := uc.tokenRepo.(*memoryTokens)
+
+	if err := uc.ResendVerificationEmail(context.Background(), "jane@example.com"); err != nil {
+		t.Fatalf("ResendVerificationEmail: %v", err)
+	}
+	token := authService.emailed["verify"]
+	tokens.byDigest(token).ExpiresAt = time.Now().Add(-time.Second)
+
+	if err := uc.VerifyEmail(context.Background(), token); err != errors.ErrTokenExpired {
+		t.Fatalf("expired token = %v, want ErrTokenExpired", err)
+	}
+	if users.users[1].EmailVerified {
+		t.Fatal("email verified with an expired token")
+	}
+}
+
+// TestOnlyLatestEmailTokenWorks checks that sending a new link revokes the
+// earlier links of the same kind only
+func TestOnlyLatestEmailTokenWorks(t *testing.T) {
+	uc, _, authService := newEmailUseCase()
+	ctx := context.Background()
+
+	_ = uc.ResendVerificationEmail(ctx, "jane@example.com")
+	first := authService.emailed["verify"]
+	_ = uc.ForgotPassword(ctx, "jane@example.com")
+	reset := authService.emailed["reset"]
+	_ = uc.ResendVerificationEmail(ctx, "jane@example.com")
+	second := authService.emailed["verify"]
+
+	if err := uc.VerifyEmail(ctx, first); err != errors.ErrTokenRevoked {
+		t.Fatalf("superseded link = %v, want ErrTokenRevoked", err)
+	}
+	if err := uc.VerifyEmail(ctx, reset); err != errors.ErrTokenTypeInvalid {
+		t.Fatalf("reset link used to verify = %v, want ErrTokenTypeInvalid", err)
+	}
+	if err := uc.VerifyEmail(ctx, second); err != nil {
+		t.Fatalf("latest link = %v", err)
+	}
+}
+
+func TestResetTokenIsSingleUse(t *testing.T) {
+	uc, users, authService := newEmailUseCase()
+	ctx := context.Background()
+
+	if err := uc.ForgotPassword(ctx, "nobody@example.com"); err != nil || len(authService.emailed) != 0 {
+		t.Fatalf("ForgotPassword for an unknown email = %v, emailed %v, want silence", err, authService.emailed)
+	}
+	if err := uc.ForgotPassword(ctx, "jane@example.com"); err != nil {
+		t.Fatalf("ForgotPassword: %v", err)
+	}
+	token := authService.emailed["reset"]
+
+	if err := uc.ResetPassword(ctx, token, "new password"); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	if users.users[1].Password != "hashed:new password" {
+		t.Fatalf("password = %q, want the new one hashed", users.users[1].Password)
+	}
+	if err := uc.ResetPassword(ctx, token, "another password"); err != errors.ErrTokenRevoked {
+		t.Fatalf("second use = %v, want ErrTokenRevoked", err)
+	}
+	if users.users[1].Password != "hashed:new password" {
+		t.Fatal("password changed by a used token")
+	}
+}
+
+// newEmailUseCase returns a use case for jane, whose email is not verified
+func newEmailUseCase() (*authUseCase, *memoryUsers, *fakeAuthService) {
+	users := &memoryUsers{users: map[uint]*entity.User{
+		1: {ID: 1, Email: "jane@example.com", Password: "right", Active: true},
+	}}
+	authService := &fakeAuthService{emailed: map[string]string{}}
+
+	uc := &authUseCase{
+		userRepo:    users,
+		tokenRepo:   &memoryTokens{},
+		sessionRepo: &memorySessions{},
+		authService: authService,
+		emailCfg:    configs.EmailConfig{VerifyTTL: time.Hour, ResetTTL: time.Hour},
+	}
+	return uc, users, authService
+}
+
+func TestSessionLimitEvictsOldest(t *testing.T) {
+	uc, sessions, authService := newSessionUseCase(configs.SessionConfig{MaxPerUser: 2, LimitPolicy: configs.SessionLimitEvictOldest})
+	tokens := uc.tokenRepo.(*memoryTokens)
+
+	for i := 0; i < 3; i++ {
+		if _, err := login(uc, "jane@example.com", "right", "10.0.0.1"); err != nil {
+			t.Fatalf("login %d: %v", i+1, err)
+		}
+	}
+
+	active, _ := uc.ListSessions(context.Background(), 1)
+	if len(active) != 2 || active[0].ID != 2 || active[1].ID != 3 {
+		t.Fatalf("active sessions = %+v, want the two most recent", active)
+	}
+	oldest := sessions.sessions[0]
+	if oldest.Active || !tokens.tokens[oldest.TokenID-1].Revoked {
+		t.Fatalf("oldest session = %+v, want it ended with its refresh token", oldest)
+	}
+	if len(authService.revokedSessions) != 1 || authService.revokedSessions[0] != oldest.FamilyID {
+		t.Fatalf("revoked session access = %v, want the oldest session's", authService.revokedSessions)
+	}
+}
+
+func TestSessionLimitRejects(t *testing.T) {
+	uc, _, _ := newSessionUseCase(configs.SessionConfig{MaxPerUser: 2, LimitPolicy: configs.SessionLimitReject})
+
+	for i := 0; i < 2; i++ {
+		if _, err := login(uc, "jane@example.com", "right", "10.0.0.1"); err != nil {
+			t.Fatalf("login %d: %v", i+1, err)
+		}
+	}
+	if _, err := login(uc, "jane@example.com", "right", "10.0.0.1"); err != errors.ErrTooManySessions {
+		t.Fatalf("login over the limit = %v, want ErrTooManySessions", err)
+	}
+	if active, _ := uc.ListSessions(context.Background(), 1); len(active) != 2 {
+		t.Fatalf("%d active sessions, want the first two kept", len(active))
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	uc, sessions, authService := newSessionUseCase(configs.SessionConfig{})
+	ctx := context.Background()
+	_, _ = login(uc, "jane@example.com", "right", "10.0.0.1")
+	_, _ = login(uc, "john@example.com", "right", "10.0.0.2")
+
+	// Sessions of other users are reported as missing
+	if err := uc.RevokeSession(ctx, 1, 2); err != errors.ErrSessionNotFound {
+		t.Fatalf("revoking another user's session = %v, want ErrSessionNotFound", err)
+	}
+	if err := uc.RevokeSession(ctx, 1, 99); err != errors.ErrSessionNotFound {
+		t.Fatalf("revoking an unknown session = %v, want ErrSessionNotFound", err)
+	}
+	if !sessions.sessions[1].Active {
+		t.Fatal("another user's session was ended")
+	}
+
+	if err := uc.RevokeSession(ctx, 1, 1); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+	if active, _ := uc.ListSessions(ctx, 1); len(active) != 0 {
+		t.Fatalf("active sessions after revocation = %+v", active)
+	}
+	if len(authService.revokedSessions) != 1 || authService.revokedSessions[0] != sessions.sessions[0].FamilyID {
+		t.Fatalf("revoked session access = %v, want the revoked session's", authService.revokedSessions)
+	}
+}
+
+func TestLogoutAllEndsEverySession(t *testing.T) {
+	uc, sessions, authService := newSessionUseCase(configs.SessionConfig{})
+	tokens := uc.tokenRepo.(*memoryTokens)
+	_, _ = login(uc, "jane@example.com", "right", "10.0.0.1")
+	_, _ = login(uc, "jane@example.com", "right", "10.0.0.2")
+	_, _ = login(uc, "john@example.com", "right", "10.0.0.3")
+
+	if err := uc.LogoutAll(context.Background(), 1); err != nil {
+		t.Fatalf("LogoutAll: %v", err)
+	}
+	for _, session := range sessions.sessions {
+		ended := !session.Active && tokens.tokens[session.TokenID-1].Revoked
+		if ended != (session.UserID == 1) {
+			t.Errorf("session %+v ended = %v", session, ended)
+		}
+	}
+	if len(authService.revokedUsers) != 1 || authService.revokedUsers[0] != 1 {
+		t.Errorf("revoked user access = %v, want jane's", authService.revokedUsers)
+	}
+}
+
+// newSessionUseCase returns the login of two users whose password is
+// "right", without two-factor authentication
+func newSessionUseCase(cfg configs.SessionConfig) (*authUseCase, *memorySessions, *fakeAuthService) {
+	users := &memoryUsers{users: map[uint]*entity.User{
+		1: {ID: 1, Email: "jane@example.com", Password: "right", Active: true},
+		2: {ID: 2, Email: "john@example.com", Password: "right", Active: true},
+	}}
+	sessions := &memorySessions{}
+	authService := &fakeAuthService{}
+
+	uc := &authUseCase{
+		userRepo:    users,
+		tokenRepo:   &memoryTokens{},
+		sessionRepo: sessions,
+		attemptRepo: &memoryAttempts{now: time.Now(), counters: map[string]*attemptCounter{}},
+		authService: authService,
+		lockoutCfg:  testLockout,
+		sessionCfg:  cfg,
+	}
+	return uc, sessions, authService
+}
+
+// login signs in with the password from the address
+func login(uc AuthUseCase, email, password, ip string) (*LoginResult, error) {
+	return uc.Login(context.Background(), email, password, ClientInfo{IP: ip})
+}
+
+// newLockoutUseCase returns the login of two users whose password is
+// "right". They have two-factor authentication enabled, so that a correct
+// password ends at the second factor step.
+func newLockoutUseCase(cfg configs.LockoutConfig) (AuthUseCase, *memoryUsers, *memoryAttempts) {
+	users := &memoryUsers{users: map[uint]*entity.User{
+		1: {ID: 1, Email: "jane@example.com", Password: "right", Active: true, TwoFactorEnabled: true},
+		2: {ID: 2, Email: "john@example.com", Password: "right", Active: true, TwoFactorEnabled: true},
+	}}
+	attempts := &memoryAttempts{now: time.Now(), counters: map[string]*attemptCounter{}}
+
+	uc := &authUseCase{
+		userRepo:    users,
+		attemptRepo: attempts,
+		authService: &fakeAuthService{},
+		lockoutCfg:  cfg,
+	}
+	return uc, users, attempts
+}
+
+type memoryUsers struct {
+	repository.UserRepository
+	users map[uint]*entity.User
+}
+
+func (r *memoryUsers) FindByID(id uint) (*entity.User, error) {
+	if user, ok := r.users[id]; ok {
+		found := *user
+		return &found, nil
+	}
+	return nil, errors.ErrUserNotFound
+}
+
+func (r *memoryUsers) FindByEmail(email string) (*entity.User, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			found := *user
+			return &found, nil
+		}
+	}
+	return nil, errors.ErrUserNotFound
+}
+
+func (r *memoryUsers) IncrementFailedLogins(id uint) error {
+	r.users[id].FailedLogins++
+	return nil
+}
+
+func (r *memoryUsers) ResetFailedLogins(id uint) error {
+	r.users[id].FailedLogins = 0
+	return nil
+}
+
+func (r *memoryUsers) LockAccount(id uint, duration time.Duration) error {
+	r.users[id].LockAccount(duration)
+	return nil
+}
+
+func (r *memoryUsers) UnlockAccount(id uint) error {
+	r.users[id].UnlockAccount()
+	return nil
+}
+
+func (r *memoryUsers) UpdateEmailVerified(ctx context.Context, id uint, verified bool) error {
+	r.users[id].EmailVerified = verified
+	return nil
+}
+
+func (r *memoryUsers) UpdateLastLogin(id uint, ip string) error {
+	r.users[id].UpdateLastLogin(ip)
+	return nil
+}
+
+func (r *memoryUsers) UpdatePassword(id uint, hashedPassword string) error {
+	r.users[id].Password = hashedPassword
+	return nil
+}
+
+func (r *memoryUsers) SetPasswordResetRequired(id uint, required bool) error {
+	r.users[id].PasswordResetRequired = required
+	return nil
+}
+
+func (r *memoryUsers) UsernameExists(username string) (bool, error) {
+	for _, user := range r.users {
+		if user.Username == username {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// memoryAttempts keeps login counters that expire by a clock the test moves
+type memoryAttempts struct {
+	now      time.Time
+	counters map[string]*attemptCounter
+}
+
+type attemptCounter struct {
+	count   int64
+	expires time.Time
+}
+
+func (r *memoryAttempts) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	counter, ok := r.counters[key]
+	if !ok || !r.now.Before(counter.expires) {
+		counter = &attemptCounter{expires: r.now.Add(ttl)}
+		r.counters[key] = counter
+	}
+	counter.count++
+	return counter.count, nil
+}
+
+func (r *memoryAttempts) Get(ctx context.Context, key string) (int64, error) {
+	if counter, ok := r.counters[key]; ok && r.now.Before(counter.expires) {
+		return counter.count, nil
+	}
+	return 0, nil
+}
+
+func (r *memoryAttempts) Reset(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		delete(r.counters, key)
+	}
+	return nil
+}
+
+// fakeAuthService compares passwords as stored, without hashing, and
+// issues numbered tokens
+type fakeAuthService struct {
+	service.AuthService
+	issued          int
+	revokedSessions []string
+	revokedUsers    []uint
+	// invalidatedUsers are those whose cached permissions were dropped
+	invalidatedUsers []uint
+	// emailed holds the last token mailed per kind, "verify" or "reset"
+	emailed map[string]string
+}
+
+func (s *fakeAuthService) ValidatePassword(user *entity.User, password string) error {
+	if user.Password != password {
+		return errors.ErrInvalidCredentials
+	}
+	return nil
+}
+
+func (s *fakeAuthService) ValidateUnknownUserPassword(password string) error {
+	return errors.ErrInvalidCredentials
+}
+
+func (s *fakeAuthService) PasswordNeedsRehash(user *entity.User) bool {
+	return false
+}
+
+func (s *fakeAuthService) GenerateMFAChallenge(user *entity.User, authMethods []string) (string, error) {
+	return "mfa-token", nil
+}
+
+func (s *fakeAuthService) GenerateTokens(user *entity.User, sessionID string, authMethods []string, orgID uint) (string, string, error) {
+	s.issued++
+	return fmt.Sprintf("access-%d", s.issued), fmt.Sprintf("refresh-new-%d", s.issued), nil
+}
+
+func (s *fakeAuthService) RefreshTokenTTL() time.Duration {
+	return time.Hour
+}
+
+func (s *fakeAuthService) RevokeSessionAccess(ctx context.Context, sessionID string) error {
+	s.revokedSessions = append(s.revokedSessions, sessionID)
+	return nil
+}
+
+func (s *fakeAuthService) HashPassword(password string) (string, error) {
+	return "hashed:" + password, nil
+}
+
+func (s *fakeAuthService) RevokeUserAccess(ctx context.Context, userIDs ...uint) error {
+	s.revokedUsers = append(s.revokedUsers, userIDs...)
+	return nil
+}
+
+func (s *fakeAuthService) InvalidateUserPermissions(ctx context.Context, userIDs ...uint) error {
+	s.invalidatedUsers = append(s.invalidatedUsers, userIDs...)
+	return nil
+}
+
+func (s *fakeAuthService) SendVerificationEmail(user *entity.User, token string) error {
+	s.emailed["verify"] = token
+	return nil
+}
+
+func (s *fakeAuthService) SendPasswordResetEmail(user *entity.User, token string) error {
+	s.emailed["reset"] = token
+	return nil
+}
+
+type memoryTokens struct {
+	repository.TokenRepository
+	tokens []*entity.Token
+}
+
+func (r *memoryTokens) byDigest(raw string) *entity.Token {
+	for _, token := range r.tokens {
+		if token.Token == utils.HashToken(raw) {
+			return token
+		}
+	}
+	return nil
+}
+
+func (r *memoryTokens) Create(token *entity.Token) error {
+	token.ID = uint(len(r.tokens) + 1)
+	r.tokens = append(r.tokens, token)
+	return nil
+}
+
+func (r *memoryTokens) FindByToken(digest string) (*entity.Token, error) {
+	for _, token := range r.tokens {
+		if token.Token == digest {
+			found := *token
+			return &found, nil
+		}
+	}
+	return nil, errors.ErrTokenNotFound
+}
+
+func (r *memoryTokens) Rotate(id uint, replacement *entity.Token) (bool, error) {
+	token := r.tokens[id-1]
+	if token.Revoked {
+		return false, nil
+	}
+	token.Revoked = true
+	_ = r.Create(replacement)
+	token.ReplacedByID = &replacement.ID
+	return true, nil
+}
+
+func (r *memoryTokens) FindByFamily(familyID string) ([]entity.Token, error) {
+	var tokens []entity.Token
+	for _, token := range r.tokens {
+		if token.FamilyID == familyID {
+			tokens = append(tokens, *token)
+		}
+	}
+	return tokens, nil
+}
+
+func (r *memoryTokens) RevokeFamily(familyID string) error {
+	for _, token := range r.tokens {
+		if token.FamilyID == familyID {
+			token.Revoked = true
+		}
+	}
+	return nil
+}
+
+func (r *memoryTokens) RevokeByType(userID uint, tokenType entity.TokenType) error {
+	for _, token := range r.tokens {
+		if token.UserID == userID && token.Type == tokenType {
+			token.Revoked = true
+		}
+	}
+	return nil
+}
+
+func (r *memoryTokens) RevokeIfValid(id uint) (bool, error) {
+	token := r.tokens[id-1]
+	if token.Revoked {
+		return false, nil
+	}
+	token.Revoked = true
+	return true, nil
+}
+
+func (r *memoryTokens) Revoke(id uint) error {
+	r.tokens[id-1].Revoked = true
+	return nil
+}
+
+func (r *memoryTokens) RevokeAll(userID uint) error {
+	for _, token := range r.tokens {
+		if token.UserID == userID {
+			token.Revoked = true
+		}
+	}
+	return nil
+}
+
+type memorySessions struct {
+	repository.SessionRepository
+	sessions []*entity.Session
+}
+
+func (r *memorySessions) Create(session *entity.Session) error {
+	session.ID = uint(len(r.sessions) + 1)
+	stored := *session
+	r.sessions = append(r.sessions, &stored)
+	return nil
+}
+
+func (r *memorySessions) FindByID(id uint) (*entity.Session, error) {
+	if id == 0 || int(id) > len(r.sessions) {
+		return nil, errors.ErrSessionNotFound
+	}
+	found := *r.sessions[id-1]
+	return &found, nil
+}
+
+// FindActiveByUserID returns the user's active sessions, oldest first
+func (r *memorySessions) FindActiveByUserID(userID uint) ([]entity.Session, error) {
+	var sessions []entity.Session
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.Active {
+			sessions = append(sessions, *session)
+		}
+	}
+	return sessions, nil
+}
+
+func (r *memorySessions) Deactivate(id uint) error {
+	r.sessions[id-1].Active = false
+	return nil
+}
+
+func (r *memorySessions) FindByTokenID(tokenID uint) (*entity.Session, error) {
+	for _, session := range r.sessions {
+		if session.TokenID == tokenID {
+			found := *session
+			return &found, nil
+		}
+	}
+	return nil, errors.ErrSessionNotFound
+}
+
+func (r *memorySessions) Update(session *entity.Session) error {
+	stored := *session
+	r.sessions[session.ID-1] = &stored
+	return nil
+}
+
+func (r *memorySessions) DeactivateByTokenIDs(tokenIDs []uint) error {
+	for _, session := range r.sessions {
+		for _, id := range tokenIDs {
+			if session.TokenID == id {
+				session.Active = false
+			}
+		}
+	}
+	return nil
+}
+
+func (r *memorySessions) DeactivateAll(userID uint) error {
+	for _, session := range r.sessions {
+		if session.UserID == userID {
+			session.Active = false
+		}
+	}
+	return nil
+}
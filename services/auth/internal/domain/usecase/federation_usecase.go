@@ -0,0 +1,295 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+
+	"minisapi/services/auth/internal/configs"
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/domain/service"
+	"minisapi/services/auth/internal/infrastructure/federation"
+	"minisapi/services/auth/internal/infrastructure/jwt"
+	"minisapi/services/auth/internal/pkg/errors"
+	"minisapi/services/auth/internal/pkg/utils"
+)
+
+// FederationUseCase signs users in with external OpenID Connect providers
+// and manages the identities linked to their accounts
+type FederationUseCase interface {
+	Providers() []IdentityProvider
+	BeginLogin(ctx context.Context, providerID string) (*FederationRedirect, error)
+	CompleteLogin(ctx context.Context, code, state string, client ClientInfo) (*LoginResult, error)
+	BeginLink(ctx context.Context, userID uint, providerID string) (*FederationRedirect, error)
+	CompleteLink(ctx context.Context, userID uint, code, state string) (*entity.LinkedAccount, error)
+	ListLinkedAccounts(ctx context.Context, userID uint) ([]entity.LinkedAccount, error)
+	UnlinkAccount(ctx context.Context, userID, accountID uint) error
+}
+
+// IdentityProvider describes a provider users can sign in with
+type IdentityProvider struct {
+	ID          string `json:"id" example:"google"`
+	DisplayName string `json:"display_name" example:"Google"`
+}
+
+// FederationRedirect starts a sign-in at a provider. The state comes back
+// with the user and must be checked against the one kept by the browser.
+type FederationRedirect struct {
+	AuthorizationURL string `json:"authorization_url"`
+	State            string `json:"state"`
+}
+
+type federationUseCase struct {
+	registry    *federation.Registry
+	stateRepo   repository.FederationStateRepository
+	accountRepo repository.LinkedAccountRepository
+	userRepo    repository.UserRepository
+	authUseCase AuthUseCase
+	authService service.AuthService
+	cfg         configs.FederationConfig
+}
+
+// Providers lists the configured providers
+func (uc *federationUseCase) Providers() []IdentityProvider {
+	providers := make([]IdentityProvider, 0)
+	for _, provider := range uc.registry.Providers() {
+		providers = append(providers, IdentityProvider{ID: provider.ID(), DisplayName: provider.DisplayName()})
+	}
+	return providers
+}
+
+// BeginLogin starts a sign-in with a provider
+func (uc *federationUseCase) BeginLogin(ctx context.Context, providerID string) (*FederationRedirect, error) {
+	return uc.begin(ctx, providerID, 0)
+}
+
+// BeginLink starts linking a provider to the account of a signed-in user
+func (uc *federationUseCase) BeginLink(ctx context.Context, userID uint, providerID string) (*FederationRedirect, error) {
+	return uc.begin(ctx, providerID, userID)
+}
+
+// begin remembers the nonce and PKCE verifier of a new authorization
+// request under the digest of its state, and returns where to send the user
+func (uc *federationUseCase) begin(ctx context.Context, providerID string, userID uint) (*FederationRedirect, error) {
+	provider, ok := uc.registry.Provider(providerID)
+	if !ok {
+		return nil, errors.ErrProviderNotFound
+	}
+
+	// Padding is trimmed, since PKCE verifiers may not contain it
+	values := make([]string, 3)
+	for i := range values {
+		value, err := utils.GenerateRandomString(32)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = strings.TrimRight(value, "=")
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	authURL, err := provider.AuthorizationURL(ctx, state, nonce, verifier)
+	if err != nil {
+		return nil, errors.ErrServiceUnavailable
+	}
+
+	err = uc.stateRepo.Save(ctx, utils.HashToken(state), &entity.FederationState{
+		Provider:     providerID,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		UserID:       userID,
+	}, uc.cfg.StateTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FederationRedirect{AuthorizationURL: authURL, State: state}, nil
+}
+
+// CompleteLogin redeems the code a provider sent the user back with and
+// signs in the user its identity belongs to. An identity seen for the first
+// time is linked to the account with the same verified email, or gets a
+// new account when there is none. Accounts whose own email is unverified
+// are never linked automatically, since whoever registered them may not
+// own the address.
+func (uc *federationUseCase) CompleteLogin(ctx context.Context, code, state string, client ClientInfo) (*LoginResult, error) {
+	flow, identity, err := uc.complete(ctx, code, state)
+	if err != nil {
+		return nil, err
+	}
+	if flow.UserID != 0 {
+		return nil, errors.ErrInvalidFederationState
+	}
+
+	user, err := uc.findOrLinkUser(flow.Provider, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	return uc.authUseCase.LoginExternal(ctx, user, []string{jwt.AuthMethodFederated}, client)
+}
+
+// findOrLinkUser returns the user the identity is linked to, applying the
+// linking rules to an identity seen for the first time
+func (uc *federationUseCase) findOrLinkUser(providerID string, identity *federation.Identity) (*entity.User, error) {
+	account, err := uc.accountRepo.FindByIdentity(providerID, identity.Subject)
+	switch err {
+	case nil:
+		if err := uc.accountRepo.UpdateLastLogin(account.ID, identity.Email); err != nil {
+			return nil, err
+		}
+		return uc.userRepo.FindByID(account.UserID)
+	case errors.ErrLinkedAccountNotFound:
+	default:
+		return nil, err
+	}
+
+	if !identity.EmailVerified {
+		return nil, errors.ErrEmailUnverified
+	}
+
+	user, err := uc.userRepo.FindByEmail(identity.Email)
+	switch err {
+	case nil:
+		if !user.EmailVerified {
+			return nil, errors.ErrAccountLinkRequired
+		}
+	case errors.ErrUserNotFound:
+		if user, err = uc.createUser(identity); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	if _, err := uc.link(user.ID, providerID, identity); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// createUser registers an account for an identity. Its password is random
+// and never revealed, so the user signs in through the provider until they
+// set one with a password reset.
+func (uc *federationUseCase) createUser(identity *federation.Identity) (*entity.User, error) {
+	secret, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := uc.authService.HashPassword(secret)
+	if err != nil {
+		return nil, err
+	}
+	username, err := newUsername(uc.userRepo, identity.PreferredUsername, identity.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &entity.User{
+		Username:      username,
+		Email:         identity.Email,
+		Password:      hashedPassword,
+		FirstName:     identity.GivenName,
+		LastName:      identity.FamilyName,
+		Active:        true,
+		EmailVerified: true,
+	}
+	if user.FirstName == "" && user.LastName == "" {
+		user.FirstName = identity.Name
+	}
+
+	if err := uc.userRepo.Create(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// CompleteLink redeems the code a provider sent the user back with and
+// links its identity to the account of the signed-in user that started the
+// link. Emails do not need to match, since the user proved both identities.
+func (uc *federationUseCase) CompleteLink(ctx context.Context, userID uint, code, state string) (*entity.LinkedAccount, error) {
+	flow, identity, err := uc.complete(ctx, code, state)
+	if err != nil {
+		return nil, err
+	}
+	if flow.UserID == 0 || flow.UserID != userID {
+		return nil, errors.ErrInvalidFederationState
+	}
+
+	account, err := uc.accountRepo.FindByIdentity(flow.Provider, identity.Subject)
+	switch err {
+	case nil:
+		if account.UserID != userID {
+			return nil, errors.ErrIdentityLinked
+		}
+		return account, nil
+	case errors.ErrLinkedAccountNotFound:
+		return uc.link(userID, flow.Provider, identity)
+	default:
+		return nil, err
+	}
+}
+
+// complete consumes the state of a sign-in and exchanges the code at its
+// provider
+func (uc *federationUseCase) complete(ctx context.Context, code, state string) (*entity.FederationState, *federation.Identity, error) {
+	flow, err := uc.stateRepo.Consume(ctx, utils.HashToken(state))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	provider, ok := uc.registry.Provider(flow.Provider)
+	if !ok {
+		return nil, nil, errors.ErrProviderNotFound
+	}
+
+	identity, err := provider.Exchange(ctx, code, flow.CodeVerifier, flow.Nonce)
+	if err != nil {
+		return nil, nil, errors.ErrFederationFailed
+	}
+
+	return flow, identity, nil
+}
+
+func (uc *federationUseCase) link(userID uint, providerID string, identity *federation.Identity) (*entity.LinkedAccount, error) {
+	account := &entity.LinkedAccount{
+		UserID:   userID,
+		Provider: providerID,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+	if err := uc.accountRepo.Create(account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// ListLinkedAccounts returns the identities linked to the user's account
+func (uc *federationUseCase) ListLinkedAccounts(ctx context.Context, userID uint) ([]entity.LinkedAccount, error) {
+	return uc.accountRepo.FindByUserID(userID)
+}
+
+// UnlinkAccount removes an identity from the user's account. Sessions
+// started with it are not ended.
+func (uc *federationUseCase) UnlinkAccount(ctx context.Context, userID, accountID uint) error {
+	return uc.accountRepo.Delete(userID, accountID)
+}
+
+func NewFederationUseCase(
+	registry *federation.Registry,
+	stateRepo repository.FederationStateRepository,
+	accountRepo repository.LinkedAccountRepository,
+	userRepo repository.UserRepository,
+	authUseCase AuthUseCase,
+	authService service.AuthService,
+	cfg configs.FederationConfig,
+) FederationUseCase {
+	return &federationUseCase{
+		registry:    registry,
+		stateRepo:   stateRepo,
+		accountRepo: accountRepo,
+		userRepo:    userRepo,
+		authUseCase: authUseCase,
+		authService: authService,
+		cfg:         cfg,
+	}
+}
@@ -0,0 +1,231 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"minisapi/services/auth/internal/configs"
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/domain/service"
+	"minisapi/services/auth/internal/pkg/errors"
+	"minisapi/services/auth/internal/pkg/utils"
+)
+
+// InvitationUseCase onboards users by email with a preset set of roles.
+// Organization zero stands for invitations to global roles only.
+type InvitationUseCase interface {
+	Invite(ctx context.Context, invitation *entity.Invitation) error
+	ListPending(ctx context.Context, orgID uint, page, limit int) ([]entity.Invitation, int64, error)
+	Resend(ctx context.Context, orgID, invitationID uint) error
+	Revoke(ctx context.Context, orgID, invitationID uint) error
+	Accept(ctx context.Context, token string, signup InvitationSignup) (*entity.User, error)
+}
+
+// InvitationSignup holds the account details of an invitee without an
+// account. It is ignored when the invited email already has one.
+type InvitationSignup struct {
+	Password  string
+	FirstName string
+	LastName  string
+}
+
+type invitationUseCase struct {
+	invitationRepo repository.InvitationRepository
+	userRepo       repository.UserRepository
+	orgRepo        repository.OrganizationRepository
+	authService    service.AuthService
+	emailCfg       configs.EmailConfig
+}
+
+// Invite stores a pending invitation and emails its link. The roles are
+// expected to be checked by the caller.
+func (uc *invitationUseCase) Invite(ctx context.Context, invitation *entity.Invitation) error {
+	if invitation.OrganizationID != nil {
+		org, err := uc.orgRepo.FindByID(*invitation.OrganizationID)
+		if err != nil {
+			return err
+		}
+		if !org.IsActive() {
+			return errors.ErrOrganizationInactive
+		}
+
+		if user, err := uc.userRepo.FindByEmail(invitation.Email); err == nil {
+			member, err := uc.orgRepo.IsMember(org.ID, user.ID)
+			if err != nil {
+				return err
+			}
+			if member {
+				return errors.ErrAlreadyMember
+			}
+		} else if err != errors.ErrUserNotFound {
+			return err
+		}
+		invitation.Organization = org
+	}
+
+	raw, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return err
+	}
+
+	invitation.Token = utils.HashToken(raw)
+	invitation.Status = entity.InvitationStatusPending
+	invitation.ExpiresAt = time.Now().Add(uc.emailCfg.InviteTTL)
+	if err := uc.invitationRepo.Create(invitation); err != nil {
+		return err
+	}
+
+	// A failed delivery must not undo the invitation; it can be sent again
+	// with Resend
+	_ = uc.authService.SendInvitationEmail(invitation, raw)
+
+	return nil
+}
+
+func (uc *invitationUseCase) ListPending(ctx context.Context, orgID uint, page, limit int) ([]entity.Invitation, int64, error) {
+	return uc.invitationRepo.ListPending(orgID, page, limit)
+}
+
+// Resend emails a new link for a pending invitation. The previous link stops
+// working and the expiry starts over.
+func (uc *invitationUseCase) Resend(ctx context.Context, orgID, invitationID uint) error {
+	invitation, err := uc.findInvitation(orgID, invitationID)
+	if err != nil {
+		return err
+	}
+
+	if invitation.Status != entity.InvitationStatusPending {
+		return errors.ErrInvitationNotPending
+	}
+
+	raw, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return err
+	}
+
+	if err := uc.invitationRepo.Renew(invitation.ID, utils.HashToken(raw), time.Now().Add(uc.emailCfg.InviteTTL)); err != nil {
+		return err
+	}
+
+	return uc.authService.SendInvitationEmail(invitation, raw)
+}
+
+func (uc *invitationUseCase) Revoke(ctx context.Context, orgID, invitationID uint) error {
+	invitation, err := uc.findInvitation(orgID, invitationID)
+	if err != nil {
+		return err
+	}
+
+	return uc.invitationRepo.Revoke(invitation.ID)
+}
+
+// findInvitation loads an invitation of the organization. Invitations of
+// other organizations are reported as missing.
+func (uc *invitationUseCase) findInvitation(orgID, invitationID uint) (*entity.Invitation, error) {
+	invitation, err := uc.invitationRepo.FindByID(invitationID)
+	if err != nil {
+		return nil, err
+	}
+
+	var invitationOrgID uint
+	if invitation.OrganizationID != nil {
+		invitationOrgID = *invitation.OrganizationID
+	}
+	if invitationOrgID != orgID {
+		return nil, errors.ErrInvitationNotFound
+	}
+
+	return invitation, nil
+}
+
+// Accept redeems an invitation token. The account with the invited email is
+// linked, or created from signup when there is none; either way its email
+// counts as verified, since the token was delivered to it. Account creation,
+// membership and role grants happen in one transaction.
+func (uc *invitationUseCase) Accept(ctx context.Context, token string, signup InvitationSignup) (*entity.User, error) {
+	invitation, err := uc.invitationRepo.FindByToken(utils.HashToken(token))
+	if err != nil {
+		if err == errors.ErrInvitationNotFound {
+			return nil, errors.ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	if invitation.Status != entity.InvitationStatusPending {
+		return nil, errors.ErrTokenRevoked
+	}
+	if invitation.IsExpired() {
+		return nil, errors.ErrTokenExpired
+	}
+
+	if invitation.Organization != nil && !invitation.Organization.IsActive() {
+		return nil, errors.ErrOrganizationInactive
+	}
+
+	user, err := uc.userRepo.FindByEmail(invitation.Email)
+	switch err {
+	case nil:
+	case errors.ErrUserNotFound:
+		if len(signup.Password) < 8 || signup.FirstName == "" || signup.LastName == "" {
+			return nil, errors.ErrValidation
+		}
+
+		hashedPassword, err := uc.authService.HashPassword(signup.Password)
+		if err != nil {
+			return nil, err
+		}
+		username, err := newUsername(uc.userRepo, "", invitation.Email)
+		if err != nil {
+			return nil, err
+		}
+
+		user = &entity.User{
+			Username:      username,
+			Email:         invitation.Email,
+			Password:      hashedPassword,
+			FirstName:     signup.FirstName,
+			LastName:      signup.LastName,
+			EmailVerified: true,
+		}
+	default:
+		return nil, err
+	}
+
+	if err := uc.invitationRepo.Accept(invitation.ID, user); err != nil {
+		if err == errors.ErrInvitationNotPending {
+			return nil, errors.ErrTokenRevoked
+		}
+		return nil, err
+	}
+
+	if !user.EmailVerified {
+		if err := uc.userRepo.UpdateEmailVerified(ctx, user.ID, true); err != nil {
+			return nil, err
+		}
+		user.EmailVerified = true
+	}
+
+	// Access tokens issued before only lack the new grants until refreshed
+	if err := uc.authService.InvalidateUserPermissions(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func NewInvitationUseCase(
+	invitationRepo repository.InvitationRepository,
+	userRepo repository.UserRepository,
+	orgRepo repository.OrganizationRepository,
+	authService service.AuthService,
+	emailCfg configs.EmailConfig,
+) InvitationUseCase {
+	return &invitationUseCase{
+		invitationRepo: invitationRepo,
+		userRepo:       userRepo,
+		orgRepo:        orgRepo,
+		authService:    authService,
+		emailCfg:       emailCfg,
+	}
+}
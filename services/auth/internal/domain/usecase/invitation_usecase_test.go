@@ -0,0 +1,203 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/pkg/errors"
+	"minisapi/services/auth/internal/pkg/utils"
+)
+
+func TestAcceptCreatesTheInvitedUser(t *testing.T) {
+	uc, invitations, users, auth := newInvitationUseCase()
+	token := invitations.invite(&entity.Invitation{Email: "new@example.com"})
+
+	user, err := uc.Accept(context.Background(), token, InvitationSignup{
+		Password:  "password123",
+		FirstName: "New",
+		LastName:  "User",
+	})
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+
+	if user.ID == 0 || users.users[user.ID] == nil {
+		t.Fatalf("user %+v was not created", user)
+	}
+	if user.Email != "new@example.com" || user.Username != "new" || user.Password != "hashed:password123" {
+		t.Errorf("user = %+v, want the invited email with a hashed password", user)
+	}
+	if !user.EmailVerified {
+		t.Error("the invited email is not verified")
+	}
+	if got := invitations.acceptedBy(token); got != user.ID {
+		t.Errorf("invitation accepted by %d, want %d", got, user.ID)
+	}
+	if !reflect.DeepEqual(auth.invalidatedUsers, []uint{user.ID}) {
+		t.Errorf("invalidated users = %v, want the new user", auth.invalidatedUsers)
+	}
+}
+
+func TestAcceptLinksTheExistingUser(t *testing.T) {
+	uc, invitations, users, auth := newInvitationUseCase()
+	users.users[1] = &entity.User{ID: 1, Username: "jane", Email: "jane@example.com", Password: "secret"}
+	token := invitations.invite(&entity.Invitation{Email: "jane@example.com"})
+
+	// The signup details are ignored when the email has an account
+	user, err := uc.Accept(context.Background(), token, InvitationSignup{Password: "other-password"})
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+
+	if user.ID != 1 || len(users.users) != 1 {
+		t.Fatalf("accepted as %+v, want the existing user", user)
+	}
+	if users.users[1].Password != "secret" {
+		t.Error("the password of the existing user changed")
+	}
+	if !users.users[1].EmailVerified {
+		t.Error("the invited email is not verified")
+	}
+	if got := invitations.acceptedBy(token); got != 1 {
+		t.Errorf("invitation accepted by %d, want 1", got)
+	}
+	if !reflect.DeepEqual(auth.invalidatedUsers, []uint{1}) {
+		t.Errorf("invalidated users = %v, want the existing user", auth.invalidatedUsers)
+	}
+}
+
+func TestAcceptRejectsUnusableInvitations(t *testing.T) {
+	signup := InvitationSignup{Password: "password123", FirstName: "New", LastName: "User"}
+	orgID := uint(7)
+
+	tests := []struct {
+		name       string
+		invitation *entity.Invitation
+		signup     InvitationSignup
+		want       error
+	}{
+		{"revoked", &entity.Invitation{Status: entity.InvitationStatusRevoked}, signup, errors.ErrTokenRevoked},
+		{"accepted", &entity.Invitation{Status: entity.InvitationStatusAccepted}, signup, errors.ErrTokenRevoked},
+		{"expired", &entity.Invitation{ExpiresAt: time.Now().Add(-time.Minute)}, signup, errors.ErrTokenExpired},
+		{"inactive organization", &entity.Invitation{
+			OrganizationID: &orgID,
+			Organization:   &entity.Organization{ID: orgID, Status: entity.OrganizationStatusInactive},
+		}, signup, errors.ErrOrganizationInactive},
+		{"short password", &entity.Invitation{}, InvitationSignup{Password: "short", FirstName: "New", LastName: "User"}, errors.ErrValidation},
+		{"missing name", &entity.Invitation{}, InvitationSignup{Password: "password123"}, errors.ErrValidation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc, invitations, users, _ := newInvitationUseCase()
+			tt.invitation.Email = "new@example.com"
+			token := invitations.invite(tt.invitation)
+
+			if _, err := uc.Accept(context.Background(), token, tt.signup); err != tt.want {
+				t.Fatalf("Accept = %v, want %v", err, tt.want)
+			}
+			if len(users.users) != 0 {
+				t.Error("a user was created")
+			}
+		})
+	}
+
+	t.Run("unknown token", func(t *testing.T) {
+		uc, _, _, _ := newInvitationUseCase()
+		if _, err := uc.Accept(context.Background(), "unknown", signup); err != errors.ErrInvalidToken {
+			t.Fatalf("Accept = %v, want ErrInvalidToken", err)
+		}
+	})
+}
+
+func TestInvitationIsSingleUse(t *testing.T) {
+	uc, invitations, _, _ := newInvitationUseCase()
+	token := invitations.invite(&entity.Invitation{Email: "new@example.com"})
+	signup := InvitationSignup{Password: "password123", FirstName: "New", LastName: "User"}
+
+	if _, err := uc.Accept(context.Background(), token, signup); err != nil {
+		t.Fatalf("first Accept: %v", err)
+	}
+	if _, err := uc.Accept(context.Background(), token, signup); err != errors.ErrTokenRevoked {
+		t.Fatalf("second Accept = %v, want ErrTokenRevoked", err)
+	}
+}
+
+func newInvitationUseCase() (InvitationUseCase, *memoryInvitations, *memoryUsers, *fakeAuthService) {
+	users := &memoryUsers{users: make(map[uint]*entity.User)}
+	invitations := &memoryInvitations{users: users, invitations: make(map[uint]*entity.Invitation)}
+	auth := &fakeAuthService{}
+	uc := &invitationUseCase{
+		invitationRepo: invitations,
+		userRepo:       users,
+		authService:    auth,
+	}
+	return uc, invitations, users, auth
+}
+
+// memoryInvitations stores invitations and, on acceptance, creates the
+// invitee in users
+type memoryInvitations struct {
+	repository.InvitationRepository
+	users       *memoryUsers
+	invitations map[uint]*entity.Invitation
+}
+
+// invite stores the invitation, pending and unexpired unless set otherwise,
+// and returns its raw token
+func (r *memoryInvitations) invite(invitation *entity.Invitation) string {
+	invitation.ID = uint(len(r.invitations) + 1)
+	raw := fmt.Sprintf("invite-token-%d", invitation.ID)
+	invitation.Token = utils.HashToken(raw)
+	if invitation.Status == "" {
+		invitation.Status = entity.InvitationStatusPending
+	}
+	if invitation.ExpiresAt.IsZero() {
+		invitation.ExpiresAt = time.Now().Add(time.Hour)
+	}
+	r.invitations[invitation.ID] = invitation
+	return raw
+}
+
+// acceptedBy returns who accepted the invitation of the raw token
+func (r *memoryInvitations) acceptedBy(raw string) uint {
+	invitation, err := r.FindByToken(utils.HashToken(raw))
+	if err != nil || invitation.AcceptedBy == nil {
+		return 0
+	}
+	return *invitation.AcceptedBy
+}
+
+func (r *memoryInvitations) FindByToken(digest string) (*entity.Invitation, error) {
+	for _, invitation := range r.invitations {
+		if invitation.Token == digest {
+			found := *invitation
+			return &found, nil
+		}
+	}
+	return nil, errors.ErrInvitationNotFound
+}
+
+func (r *memoryInvitations) Accept(id uint, user *entity.User) error {
+	invitation := r.invitations[id]
+	if !invitation.IsPending() {
+		return errors.ErrInvitationNotPending
+	}
+
+	if user.ID == 0 {
+		user.ID = uint(len(r.users.users) + 1)
+		created := *user
+		r.users.users[user.ID] = &created
+	}
+
+	now := time.Now()
+	invitation.Status = entity.InvitationStatusAccepted
+	invitation.AcceptedAt = &now
+	invitation.AcceptedBy = &user.ID
+	return nil
+}
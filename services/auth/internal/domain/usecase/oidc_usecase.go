@@ -0,0 +1,545 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"time"
+
+	"minisapi/services/auth/internal/configs"
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/domain/service"
+	"minisapi/services/auth/internal/infrastructure/jwt"
+	"minisapi/services/auth/internal/pkg/errors"
+	"minisapi/services/auth/internal/pkg/utils"
+)
+
+// OpenID Connect scopes. openid is required in every request; profile and
+// email release the matching claims in ID tokens and from userinfo.
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+const (
+	userInfoPath        = "/oauth/userinfo"
+	responseTypeCode    = "code"
+	codeChallengeS256   = "S256"
+	promptNone          = "none"
+	promptConsent       = "consent"
+	minCodeVerifierSize = 43
+	maxCodeVerifierSize = 128
+)
+
+var supportedScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail}
+
+// OIDCUseCase makes the service an OpenID Connect provider for the web apps
+// registered as OAuth clients, with the authorization code flow and PKCE.
+// Users sign in on the login page with their regular credentials; the page
+// then authorizes the relying party with the resulting access token.
+type OIDCUseCase interface {
+	// CheckAuthorization validates an authorization request and returns the
+	// login page URL carrying it. Requests whose client or redirect URI
+	// cannot be trusted fail with ErrInvalidClient or ErrInvalidRedirectURI
+	// and must not be redirected back.
+	CheckAuthorization(ctx context.Context, req AuthorizationRequest) (string, error)
+	// Authorize issues an authorization code for the signed-in user, unless
+	// the user still has to consent. approved is the user's answer on the
+	// consent screen, nil until they have been asked.
+	Authorize(ctx context.Context, claims *jwt.Claims, req AuthorizationRequest, approved *bool) (*AuthorizationResult, error)
+	// ExchangeCode redeems an authorization code for an ID token and an
+	// access token to the userinfo endpoint
+	ExchangeCode(ctx context.Context, client *entity.OAuthClient, code, redirectURI, codeVerifier string) (*OIDCTokens, error)
+	UserInfo(ctx context.Context, accessToken string) (*UserInfo, error)
+	// Metadata returns the discovery document. Like every other step of
+	// the flow, it fails with ErrOIDCUnavailable unless tokens are signed
+	// with an asymmetric key that relying parties can verify.
+	Metadata() (*ProviderMetadata, error)
+	ListConsents(ctx context.Context, userID uint) ([]entity.Consent, error)
+	RevokeConsent(ctx context.Context, userID uint, clientID string) error
+}
+
+// AuthorizationRequest holds the parameters of an authorization request
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Prompt              string
+}
+
+// Values encodes the request as query parameters
+func (r AuthorizationRequest) Values() url.Values {
+	values := url.Values{}
+	for key, value := range map[string]string{
+		"response_type":         r.ResponseType,
+		"client_id":             r.ClientID,
+		"redirect_uri":          r.RedirectURI,
+		"scope":                 r.Scope,
+		"state":                 r.State,
+		"nonce":                 r.Nonce,
+		"code_challenge":        r.CodeChallenge,
+		"code_challenge_method": r.CodeChallengeMethod,
+		"prompt":                r.Prompt,
+	} {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	return values
+}
+
+// AuthorizationResult is the outcome of an authorization by the user.
+// Either the user has to consent first, or RedirectURI sends the user agent
+// back to the relying party with the code.
+type AuthorizationResult struct {
+	Client          *entity.OAuthClient
+	Scopes          []string
+	ConsentRequired bool
+	RedirectURI     string
+}
+
+// OIDCTokens are the tokens a relying party gets for an authorization code
+type OIDCTokens struct {
+	AccessToken string
+	IDToken     string
+	ExpiresIn   time.Duration
+	Scopes      []string
+}
+
+// UserInfo is the response of the userinfo endpoint
+type UserInfo struct {
+	Subject string `json:"sub"`
+	jwt.Profile
+}
+
+// ProviderMetadata is the OpenID Connect discovery document
+type ProviderMetadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	AuthorizationResponseIssParameter bool     `json:"authorization_response_iss_parameter_supported"`
+}
+
+type oidcUseCase struct {
+	clientRepo  repository.OAuthClientRepository
+	codeRepo    repository.AuthorizationCodeRepository
+	consentRepo repository.ConsentRepository
+	userRepo    repository.UserRepository
+	sessionRepo repository.SessionRepository
+	authService service.AuthService
+	jwtManager  *jwt.JWTManager
+	cfg         configs.OAuthConfig
+}
+
+func NewOIDCUseCase(
+	clientRepo repository.OAuthClientRepository,
+	codeRepo repository.AuthorizationCodeRepository,
+	consentRepo repository.ConsentRepository,
+	userRepo repository.UserRepository,
+	sessionRepo repository.SessionRepository,
+	authService service.AuthService,
+	jwtManager *jwt.JWTManager,
+	cfg configs.OAuthConfig,
+) OIDCUseCase {
+	return &oidcUseCase{
+		clientRepo:  clientRepo,
+		codeRepo:    codeRepo,
+		consentRepo: consentRepo,
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		authService: authService,
+		jwtManager:  jwtManager,
+		cfg:         cfg,
+	}
+}
+
+func (uc *oidcUseCase) CheckAuthorization(ctx context.Context, req AuthorizationRequest) (string, error) {
+	if _, _, err := uc.validateRequest(req); err != nil {
+		return "", err
+	}
+	return utils.AppendQuery(uc.cfg.LoginURL, req.Values()), nil
+}
+
+// validateRequest checks the client and redirect URI first, so that every
+// later error can safely be reported to the redirect URI
+func (uc *oidcUseCase) validateRequest(req AuthorizationRequest) (*entity.OAuthClient, []string, error) {
+	client, err := uc.clientRepo.FindByClientID(req.ClientID)
+	if err != nil {
+		if err == errors.ErrClientNotFound {
+			return nil, nil, errors.ErrInvalidClient
+		}
+		return nil, nil, err
+	}
+	if !client.Active {
+		return nil, nil, errors.ErrInvalidClient
+	}
+	if !client.AllowsRedirectURI(req.RedirectURI) {
+		return nil, nil, errors.ErrInvalidRedirectURI
+	}
+	if !uc.jwtManager.Asymmetric() {
+		return nil, nil, errors.ErrOIDCUnavailable
+	}
+
+	if req.ResponseType != responseTypeCode {
+		return nil, nil, errors.ErrUnsupportedResponseType
+	}
+
+	scopes, err := parseScopes(req.Scope)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// PKCE is required of every client, confidential ones included
+	if req.CodeChallengeMethod != codeChallengeS256 || len(req.CodeChallenge) != minCodeVerifierSize {
+		return nil, nil, errors.ErrInvalidAuthRequest
+	}
+	if req.Prompt != "" && req.Prompt != promptNone && req.Prompt != promptConsent {
+		return nil, nil, errors.ErrInvalidAuthRequest
+	}
+
+	return client, scopes, nil
+}
+
+// parseScopes splits the scope parameter, which must include openid and
+// nothing but supported scopes
+func parseScopes(scope string) ([]string, error) {
+	seen := make(map[string]bool)
+	scopes := make([]string, 0, len(supportedScopes))
+	for _, s := range strings.Fields(scope) {
+		if seen[s] {
+			continue
+		}
+		if !isSupportedScope(s) {
+			return nil, errors.ErrScopeNotAllowed
+		}
+		seen[s] = true
+		scopes = append(scopes, s)
+	}
+	if !seen[ScopeOpenID] {
+		return nil, errors.ErrScopeNotAllowed
+	}
+	return scopes, nil
+}
+
+func isSupportedScope(scope string) bool {
+	for _, s := range supportedScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (uc *oidcUseCase) Authorize(ctx context.Context, claims *jwt.Claims, req AuthorizationRequest, approved *bool) (*AuthorizationResult, error) {
+	client, scopes, err := uc.validateRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only a login session can authorize a relying party; API keys and
+	// tokens issued to other relying parties cannot
+	if claims.SessionID == "" || claims.ClientID != "" {
+		return nil, errors.ErrLoginRequired
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return nil, errors.ErrLoginRequired
+	}
+	session, err := uc.sessionRepo.FindByFamily(claims.SessionID)
+	if err != nil || !session.IsValid() {
+		return nil, errors.ErrLoginRequired
+	}
+
+	if approved != nil && !*approved {
+		return nil, errors.ErrAccessDenied
+	}
+
+	if !client.SkipConsent {
+		consent, err := uc.consentRepo.Find(userID, client.ClientID)
+		if err != nil && err != errors.ErrConsentNotFound {
+			return nil, err
+		}
+
+		if approved == nil {
+			if consent == nil || !consent.Covers(scopes) || req.Prompt == promptConsent {
+				if req.Prompt == promptNone {
+					return nil, errors.ErrConsentRequired
+				}
+				return &AuthorizationResult{Client: client, Scopes: scopes, ConsentRequired: true}, nil
+			}
+		} else {
+			granted := scopes
+			if consent != nil {
+				granted = mergeScopes(consent.Scopes, scopes)
+			}
+			if err := uc.consentRepo.Save(&entity.Consent{UserID: userID, ClientID: client.ClientID, Scopes: granted}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	code, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return nil, err
+	}
+	code = strings.TrimRight(code, "=")
+
+	err = uc.codeRepo.Create(&entity.AuthorizationCode{
+		CodeHash:      utils.HashToken(code),
+		ClientID:      client.ClientID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        scopes,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		SessionID:     claims.SessionID,
+		AuthMethods:   claims.AuthMethods,
+		AuthTime:      session.CreatedAt,
+		ExpiresAt:     time.Now().Add(uc.cfg.CodeTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The iss parameter (RFC 9207) lets the relying party detect responses
+	// from another provider
+	params := url.Values{"code": {code}, "iss": {uc.jwtManager.Issuer()}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	return &AuthorizationResult{
+		Client:      client,
+		Scopes:      scopes,
+		RedirectURI: utils.AppendQuery(req.RedirectURI, params),
+	}, nil
+}
+
+// mergeScopes returns the granted scopes followed by the requested ones not
+// granted yet
+func mergeScopes(granted, requested []string) []string {
+	merged := append([]string{}, granted...)
+	for _, scope := range requested {
+		found := false
+		for _, g := range granted {
+			if g == scope {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, scope)
+		}
+	}
+	return merged
+}
+
+// ExchangeCode answers every problem with the code itself alike, whether it
+// is unknown, used, expired, for another client or redirect URI, or fails
+// the PKCE check
+func (uc *oidcUseCase) ExchangeCode(ctx context.Context, client *entity.OAuthClient, code, redirectURI, codeVerifier string) (*OIDCTokens, error) {
+	if !uc.jwtManager.Asymmetric() {
+		return nil, errors.ErrOIDCUnavailable
+	}
+	if code == "" || codeVerifier == "" {
+		return nil, errors.ErrInvalidAuthRequest
+	}
+
+	stored, err := uc.codeRepo.Consume(utils.HashToken(code))
+	if err != nil {
+		return nil, err
+	}
+
+	if stored.ClientID != client.ClientID || stored.IsExpired() || stored.RedirectURI != redirectURI ||
+		!verifyCodeChallenge(codeVerifier, stored.CodeChallenge) {
+		return nil, errors.ErrInvalidGrant
+	}
+
+	user, err := uc.userRepo.FindByID(stored.UserID)
+	if err != nil {
+		if err == errors.ErrUserNotFound {
+			return nil, errors.ErrInvalidGrant
+		}
+		return nil, err
+	}
+	if !user.IsActive() || user.IsLocked() {
+		return nil, errors.ErrInvalidGrant
+	}
+
+	// The tokens belong to the login session, so they must not outlive it
+	session, err := uc.sessionRepo.FindByFamily(stored.SessionID)
+	if err != nil || !session.IsValid() {
+		return nil, errors.ErrInvalidGrant
+	}
+
+	claims := jwt.NewClaims(user.ID)
+	claims.SessionID = stored.SessionID
+	claims.AuthMethods = stored.AuthMethods
+	claims.AuthLevel = jwt.AuthLevelFor(stored.AuthMethods)
+	claims.ClientID = client.ClientID
+	claims.Scope = strings.Join(stored.Scopes, " ")
+	accessToken, err := uc.jwtManager.GenerateScopedToken(claims, uc.endpoint(userInfoPath), uc.cfg.TokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	idClaims := jwt.NewIDTokenClaims(claims.Subject, client.ClientID)
+	idClaims.Profile = profileFor(user, stored.Scopes)
+	idClaims.Nonce = stored.Nonce
+	idClaims.AuthTime = stored.AuthTime.Unix()
+	idClaims.SessionID = stored.SessionID
+	idClaims.AuthMethods = stored.AuthMethods
+	idClaims.AuthLevel = claims.AuthLevel
+	idClaims.AccessTokenHash = jwt.AccessTokenHash(accessToken)
+	idToken, err := uc.jwtManager.GenerateIDToken(idClaims, uc.cfg.TokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OIDCTokens{
+		AccessToken: accessToken,
+		IDToken:     idToken,
+		ExpiresIn:   uc.cfg.TokenTTL,
+		Scopes:      stored.Scopes,
+	}, nil
+}
+
+// verifyCodeChallenge checks a PKCE code verifier against its S256 challenge
+func verifyCodeChallenge(verifier, challenge string) bool {
+	if len(verifier) < minCodeVerifierSize || len(verifier) > maxCodeVerifierSize {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// UserInfo accepts only the access tokens issued by ExchangeCode. Like any
+// other access token they are revoked with their session or user.
+func (uc *oidcUseCase) UserInfo(ctx context.Context, accessToken string) (*UserInfo, error) {
+	claims, err := uc.jwtManager.ValidateScopedToken(accessToken, uc.endpoint(userInfoPath))
+	if err != nil {
+		return nil, errors.ErrInvalidToken
+	}
+
+	revoked, err := uc.authService.IsAccessRevoked(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, errors.ErrTokenRevoked
+	}
+
+	scopes := strings.Fields(claims.Scope)
+	if !isScopeGranted(scopes, ScopeOpenID) {
+		return nil, errors.ErrForbidden
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		return nil, errors.ErrInvalidToken
+	}
+	user, err := uc.userRepo.FindByID(userID)
+	if err != nil {
+		if err == errors.ErrUserNotFound {
+			return nil, errors.ErrInvalidToken
+		}
+		return nil, err
+	}
+	if !user.IsActive() {
+		return nil, errors.ErrInvalidToken
+	}
+
+	return &UserInfo{Subject: claims.Subject, Profile: profileFor(user, scopes)}, nil
+}
+
+func isScopeGranted(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// profileFor returns the claims about the user that the scopes release
+func profileFor(user *entity.User, scopes []string) jwt.Profile {
+	var profile jwt.Profile
+	for _, scope := range scopes {
+		switch scope {
+		case ScopeProfile:
+			profile.Name = strings.TrimSpace(user.FirstName + " " + user.LastName)
+			profile.GivenName = user.FirstName
+			profile.FamilyName = user.LastName
+			profile.PreferredUsername = user.Username
+			profile.UpdatedAt = user.UpdatedAt.Unix()
+		case ScopeEmail:
+			verified := user.EmailVerified
+			profile.Email = user.Email
+			profile.EmailVerified = &verified
+		}
+	}
+	return profile
+}
+
+// Metadata lists the endpoints at the paths the routes serve them under
+func (uc *oidcUseCase) Metadata() (*ProviderMetadata, error) {
+	if !uc.jwtManager.Asymmetric() {
+		return nil, errors.ErrOIDCUnavailable
+	}
+
+	return &ProviderMetadata{
+		Issuer:                            uc.jwtManager.Issuer(),
+		AuthorizationEndpoint:             uc.endpoint("/oauth/authorize"),
+		TokenEndpoint:                     uc.endpoint("/oauth/token"),
+		UserInfoEndpoint:                  uc.endpoint(userInfoPath),
+		JWKSURI:                           uc.endpoint("/.well-known/jwks.json"),
+		ScopesSupported:                   supportedScopes,
+		ResponseTypesSupported:            []string{responseTypeCode},
+		GrantTypesSupported:               []string{"authorization_code", "client_credentials"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{uc.jwtManager.SigningAlgorithm()},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{codeChallengeS256},
+		ClaimsSupported: []string{
+			"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "acr", "amr", "azp", "sid",
+			"name", "given_name", "family_name", "preferred_username", "updated_at", "email", "email_verified",
+		},
+		AuthorizationResponseIssParameter: true,
+	}, nil
+}
+
+// endpoint returns the URL the routes serve the path under
+func (uc *oidcUseCase) endpoint(path string) string {
+	return strings.TrimRight(uc.jwtManager.Issuer(), "/") + path
+}
+
+func (uc *oidcUseCase) ListConsents(ctx context.Context, userID uint) ([]entity.Consent, error) {
+	return uc.consentRepo.FindByUserID(userID)
+}
+
+// RevokeConsent makes the relying party ask for consent again on its next
+// authorization request. Tokens it already holds stay valid until they expire.
+func (uc *oidcUseCase) RevokeConsent(ctx context.Context, userID uint, clientID string) error {
+	return uc.consentRepo.Delete(userID, clientID)
+}
@@ -0,0 +1,335 @@
+package usecase
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+
+	"minisapi/services/auth/internal/configs"
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/domain/service"
+	"minisapi/services/auth/internal/infrastructure/jwt"
+	"minisapi/services/auth/internal/infrastructure/webauthn"
+	"minisapi/services/auth/internal/pkg/errors"
+	"minisapi/services/auth/internal/pkg/utils"
+)
+
+// PasskeyUseCase registers WebAuthn passkeys and signs users in with them,
+// either without a password or as the second factor of a login
+type PasskeyUseCase interface {
+	BeginRegistration(ctx context.Context, userID uint) (*webauthn.CreationOptions, error)
+	FinishRegistration(ctx context.Context, userID uint, name string, resp *webauthn.RegistrationResponse) (*entity.Passkey, error)
+	BeginLogin(ctx context.Context) (*webauthn.RequestOptions, error)
+	FinishLogin(ctx context.Context, resp *webauthn.AssertionResponse, client ClientInfo) (*LoginResult, error)
+	BeginTwoFactor(ctx context.Context, mfaToken string) (*webauthn.RequestOptions, error)
+	FinishTwoFactor(ctx context.Context, mfaToken string, resp *webauthn.AssertionResponse, client ClientInfo) (*LoginResult, error)
+	ListPasskeys(ctx context.Context, userID uint) ([]entity.Passkey, error)
+	RenamePasskey(ctx context.Context, userID, passkeyID uint, name string) (*entity.Passkey, error)
+	DeletePasskey(ctx context.Context, userID, passkeyID uint) error
+}
+
+// defaultPasskeyName names passkeys registered without a name
+const defaultPasskeyName = "Passkey"
+
+// secondFactorUserVerification is asked of passkeys presented after a
+// password. Possession is the factor they add, so verification is not
+// required, but authenticators that can verify the user are asked to.
+const secondFactorUserVerification = webauthn.UserVerificationPreferred
+
+type passkeyUseCase struct {
+	rp            *webauthn.RelyingParty
+	challengeRepo repository.PasskeyChallengeRepository
+	passkeyRepo   repository.PasskeyRepository
+	userRepo      repository.UserRepository
+	authUseCase   AuthUseCase
+	authService   service.AuthService
+	cfg           configs.WebAuthnConfig
+}
+
+// BeginRegistration returns the options to create a passkey for the user.
+// Passkeys the user already has are excluded, so that an authenticator
+// does not register twice.
+func (uc *passkeyUseCase) BeginRegistration(ctx context.Context, userID uint) (*webauthn.CreationOptions, error) {
+	user, err := uc.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	exclude, err := uc.descriptors(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := uc.begin(ctx, entity.PasskeyCeremonyRegistration, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	displayName := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if displayName == "" {
+		displayName = user.Email
+	}
+	return uc.rp.CreationOptions(challenge, webauthn.User{
+		ID:          userHandle(userID),
+		Name:        user.Email,
+		DisplayName: displayName,
+	}, exclude), nil
+}
+
+// FinishRegistration verifies the authenticator's response to a
+// registration started by the same user and stores the new passkey
+func (uc *passkeyUseCase) FinishRegistration(ctx context.Context, userID uint, name string, resp *webauthn.RegistrationResponse) (*entity.Passkey, error) {
+	challenge, err := resp.Challenge()
+	if err != nil {
+		return nil, errors.ErrPasskeyVerification
+	}
+	if err := uc.consume(ctx, challenge, entity.PasskeyCeremonyRegistration, userID); err != nil {
+		return nil, err
+	}
+
+	credential, err := uc.rp.VerifyRegistration(resp, challenge, webauthn.UserVerificationPreferred)
+	if err != nil {
+		return nil, errors.ErrPasskeyVerification
+	}
+
+	credentialID := base64.RawURLEncoding.EncodeToString(credential.ID)
+	switch _, err := uc.passkeyRepo.FindByCredentialID(credentialID); err {
+	case nil:
+		return nil, errors.ErrPasskeyExists
+	case errors.ErrPasskeyNotFound:
+	default:
+		return nil, err
+	}
+
+	if name = strings.TrimSpace(name); name == "" {
+		name = defaultPasskeyName
+	}
+	passkey := &entity.Passkey{
+		UserID:         userID,
+		Name:           name,
+		CredentialID:   credentialID,
+		PublicKey:      credential.PublicKey,
+		Algorithm:      credential.Algorithm,
+		SignCount:      credential.SignCount,
+		Transports:     credential.Transports,
+		AAGUID:         formatAAGUID(credential.AAGUID),
+		BackupEligible: credential.BackupEligible,
+		BackedUp:       credential.BackedUp,
+	}
+	if err := uc.passkeyRepo.Create(passkey); err != nil {
+		return nil, err
+	}
+	return passkey, nil
+}
+
+// BeginLogin returns the options to sign in with any passkey registered
+// for this service, without a username or password
+func (uc *passkeyUseCase) BeginLogin(ctx context.Context) (*webauthn.RequestOptions, error) {
+	challenge, err := uc.begin(ctx, entity.PasskeyCeremonyLogin, 0)
+	if err != nil {
+		return nil, err
+	}
+	return uc.rp.RequestOptions(challenge, nil, webauthn.UserVerificationRequired), nil
+}
+
+// FinishLogin signs in the owner of the passkey. The authenticator must
+// have verified the user, so the passkey stands in for both factors and no
+// second factor is asked for.
+func (uc *passkeyUseCase) FinishLogin(ctx context.Context, resp *webauthn.AssertionResponse, client ClientInfo) (*LoginResult, error) {
+	passkey, err := uc.verify(ctx, resp, entity.PasskeyCeremonyLogin, 0, webauthn.UserVerificationRequired)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := uc.userRepo.FindByID(passkey.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return uc.authUseCase.LoginExternal(ctx, user, []string{jwt.AuthMethodPasskey}, client)
+}
+
+// BeginTwoFactor returns the options to present one of the user's passkeys
+// as the second factor of a login waiting for it
+func (uc *passkeyUseCase) BeginTwoFactor(ctx context.Context, mfaToken string) (*webauthn.RequestOptions, error) {
+	userID, _, err := uc.authService.ValidateMFAChallenge(mfaToken)
+	if err != nil {
+		return nil, err
+	}
+
+	allow, err := uc.descriptors(userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(allow) == 0 {
+		return nil, errors.ErrNoPasskeys
+	}
+
+	challenge, err := uc.begin(ctx, entity.PasskeyCeremonyTwoFactor, userID)
+	if err != nil {
+		return nil, err
+	}
+	return uc.rp.RequestOptions(challenge, allow, secondFactorUserVerification), nil
+}
+
+// FinishTwoFactor completes a login waiting for its second factor with one
+// of the user's passkeys. It goes through the same lockout and throttling
+// as LoginTwoFactor does with a TOTP code.
+func (uc *passkeyUseCase) FinishTwoFactor(ctx context.Context, mfaToken string, resp *webauthn.AssertionResponse, client ClientInfo) (*LoginResult, error) {
+	return uc.authUseCase.LoginSecondFactor(ctx, mfaToken, client, func(ctx context.Context, user *entity.User) (string, error) {
+		if _, err := uc.verify(ctx, resp, entity.PasskeyCeremonyTwoFactor, user.ID, secondFactorUserVerification); err != nil {
+			return "", err
+		}
+		return jwt.AuthMethodPasskey, nil
+	})
+}
+
+// verify consumes the challenge of an authentication ceremony, verifies the
+// assertion against the stored passkey and records its use. When userID is
+// set, the passkey must be one of that user's.
+func (uc *passkeyUseCase) verify(ctx context.Context, resp *webauthn.AssertionResponse, ceremony entity.PasskeyCeremony, userID uint, userVerification string) (*entity.Passkey, error) {
+	challenge, err := resp.Challenge()
+	if err != nil {
+		return nil, errors.ErrPasskeyVerification
+	}
+	if err := uc.consume(ctx, challenge, ceremony, userID); err != nil {
+		return nil, err
+	}
+
+	credentialID, err := resp.CredentialID()
+	if err != nil {
+		return nil, errors.ErrPasskeyVerification
+	}
+	passkey, err := uc.passkeyRepo.FindByCredentialID(credentialID)
+	if err != nil {
+		if err == errors.ErrPasskeyNotFound {
+			return nil, errors.ErrPasskeyVerification
+		}
+		return nil, err
+	}
+	if userID != 0 && passkey.UserID != userID {
+		return nil, errors.ErrPasskeyVerification
+	}
+
+	// Discoverable credentials return the user handle they were created
+	// with, which must belong to the passkey's owner
+	handle, err := resp.UserHandle()
+	if err != nil || (len(handle) == 0 && userID == 0) || (len(handle) != 0 && string(handle) != string(userHandle(passkey.UserID))) {
+		return nil, errors.ErrPasskeyVerification
+	}
+
+	assertion, err := uc.rp.VerifyAssertion(resp, challenge, passkey.PublicKey, passkey.SignCount, userVerification)
+	if err != nil {
+		return nil, errors.ErrPasskeyVerification
+	}
+
+	if err := uc.passkeyRepo.UpdateUsage(passkey.ID, assertion.SignCount, assertion.BackedUp); err != nil {
+		return nil, err
+	}
+	return passkey, nil
+}
+
+// begin remembers a new ceremony under the digest of its challenge and
+// returns the challenge
+func (uc *passkeyUseCase) begin(ctx context.Context, ceremony entity.PasskeyCeremony, userID uint) (string, error) {
+	challenge, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return "", err
+	}
+	// Clients return the challenge base64url encoded without padding
+	challenge = strings.TrimRight(challenge, "=")
+
+	err = uc.challengeRepo.Save(ctx, utils.HashToken(challenge), &entity.PasskeyChallenge{
+		Ceremony: ceremony,
+		UserID:   userID,
+	}, uc.cfg.ChallengeTTL)
+	if err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+// consume removes the ceremony a response answers, which must be of the
+// given kind and started by the same user
+func (uc *passkeyUseCase) consume(ctx context.Context, challenge string, ceremony entity.PasskeyCeremony, userID uint) error {
+	if challenge == "" {
+		return errors.ErrInvalidPasskeyChallenge
+	}
+	started, err := uc.challengeRepo.Consume(ctx, utils.HashToken(challenge))
+	if err != nil {
+		return err
+	}
+	if started.Ceremony != ceremony || started.UserID != userID {
+		return errors.ErrInvalidPasskeyChallenge
+	}
+	return nil
+}
+
+// descriptors lists the user's passkeys for the browser
+func (uc *passkeyUseCase) descriptors(userID uint) ([]webauthn.CredentialDescriptor, error) {
+	passkeys, err := uc.passkeyRepo.FindByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	descriptors := make([]webauthn.CredentialDescriptor, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		descriptors = append(descriptors, webauthn.NewCredentialDescriptor(passkey.CredentialID, passkey.Transports))
+	}
+	return descriptors, nil
+}
+
+// ListPasskeys returns the passkeys the user registered
+func (uc *passkeyUseCase) ListPasskeys(ctx context.Context, userID uint) ([]entity.Passkey, error) {
+	return uc.passkeyRepo.FindByUserID(userID)
+}
+
+// RenamePasskey changes the name a passkey is listed under
+func (uc *passkeyUseCase) RenamePasskey(ctx context.Context, userID, passkeyID uint, name string) (*entity.Passkey, error) {
+	return uc.passkeyRepo.Rename(userID, passkeyID, strings.TrimSpace(name))
+}
+
+// DeletePasskey removes a passkey. Sessions started with it are not ended,
+// and the credential stays on the authenticator until the user removes it.
+// Like registration, it is only offered right after a full login.
+func (uc *passkeyUseCase) DeletePasskey(ctx context.Context, userID, passkeyID uint) error {
+	return uc.passkeyRepo.Delete(userID, passkeyID)
+}
+
+// userHandle is the opaque WebAuthn user ID of a user: their ID as eight
+// big-endian bytes, which reveals nothing about the account
+func userHandle(userID uint) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(userID))
+}
+
+// formatAAGUID formats an authenticator model ID as a UUID. Authenticators
+// that do not reveal their model send zeros.
+func formatAAGUID(aaguid []byte) string {
+	if len(aaguid) != 16 || strings.Trim(string(aaguid), "\x00") == "" {
+		return ""
+	}
+	h := hex.EncodeToString(aaguid)
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+func NewPasskeyUseCase(
+	rp *webauthn.RelyingParty,
+	challengeRepo repository.PasskeyChallengeRepository,
+	passkeyRepo repository.PasskeyRepository,
+	userRepo repository.UserRepository,
+	authUseCase AuthUseCase,
+	authService service.AuthService,
+	cfg configs.WebAuthnConfig,
+) PasskeyUseCase {
+	return &passkeyUseCase{
+		rp:            rp,
+		challengeRepo: challengeRepo,
+		passkeyRepo:   passkeyRepo,
+		userRepo:      userRepo,
+		authUseCase:   authUseCase,
+		authService:   authService,
+		cfg:           cfg,
+	}
+}
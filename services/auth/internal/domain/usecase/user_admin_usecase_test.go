@@ -0,0 +1,224 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"minisapi/services/auth/internal/configs"
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/pkg/errors"
+)
+
+// adminUserRepo keeps live and soft-deleted users in memory
+type adminUserRepo struct {
+	repository.UserRepository
+	users   map[uint]*entity.User
+	deleted map[uint]*entity.User
+	// lockedFor records the duration of the last lock per user
+	lockedFor map[uint]time.Duration
+}
+
+func newAdminUserRepo(users ...*entity.User) *adminUserRepo {
+	r := &adminUserRepo{
+		users:     make(map[uint]*entity.User),
+		deleted:   make(map[uint]*entity.User),
+		lockedFor: make(map[uint]time.Duration),
+	}
+	for _, user := range users {
+		r.users[user.ID] = user
+	}
+	return r
+}
+
+func (r *adminUserRepo) FindByID(id uint) (*entity.User, error) {
+	user, ok := r.users[id]
+	if !ok {
+		return nil, errors.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (r *adminUserRepo) SetActive(id uint, active bool) error {
+	r.users[id].Active = active
+	return nil
+}
+
+func (r *adminUserRepo) LockAccount(id uint, duration time.Duration) error {
+	until := time.Now().Add(duration)
+	r.users[id].LockedUntil = &until
+	r.lockedFor[id] = duration
+	return nil
+}
+
+func (r *adminUserRepo) SetPasswordResetRequired(id uint, required bool) error {
+	r.users[id].PasswordResetRequired = required
+	return nil
+}
+
+func (r *adminUserRepo) Delete(id uint) error {
+	r.deleted[id] = r.users[id]
+	delete(r.users, id)
+	return nil
+}
+
+func (r *adminUserRepo) Restore(id uint) error {
+	user, ok := r.deleted[id]
+	if !ok {
+		return errors.ErrUserNotFound
+	}
+	r.users[id] = user
+	delete(r.deleted, id)
+	return nil
+}
+
+// recordingAuthUseCase records the sessions ended and the reset links sent
+type recordingAuthUseCase struct {
+	AuthUseCase
+	loggedOut []uint
+	resetSent []string
+}
+
+func (a *recordingAuthUseCase) LogoutAll(ctx context.Context, userID uint) error {
+	a.loggedOut = append(a.loggedOut, userID)
+	return nil
+}
+
+func (a *recordingAuthUseCase) ForgotPassword(ctx context.Context, email string) error {
+	a.resetSent = append(a.resetSent, email)
+	return nil
+}
+
+func newAdminUseCase(users *adminUserRepo, auth *recordingAuthUseCase) UserAdminUseCase {
+	return NewUserAdminUseCase(users, auth, configs.LockoutConfig{MaxDuration: 24 * time.Hour})
+}
+
+func newAdminTestUser() *entity.User {
+	return &entity.User{ID: 7, Email: "alice@example.com", Active: true, Status: entity.UserStatusActive}
+}
+
+// endedSessions fails the test unless exactly the user's sessions were ended
+func endedSessions(t *testing.T, auth *recordingAuthUseCase, userID uint) {
+	t.Helper()
+	if len(auth.loggedOut) != 1 || auth.loggedOut[0] != userID {
+		t.Errorf("sessions ended for %v, want user %d", auth.loggedOut, userID)
+	}
+}
+
+func TestLockUserEndsSessions(t *testing.T) {
+	user := newAdminTestUser()
+	users := newAdminUserRepo(user)
+	auth := &recordingAuthUseCase{}
+	uc := newAdminUseCase(users, auth)
+
+	if err := uc.LockUser(context.Background(), user.ID, 0); err != nil {
+		t.Fatalf("LockUser: %v", err)
+	}
+	if !user.IsLocked() || users.lockedFor[user.ID] != 24*time.Hour {
+		t.Errorf("locked for %v, want the maximum lockout duration", users.lockedFor[user.ID])
+	}
+	endedSessions(t, auth, user.ID)
+
+	if err := uc.LockUser(context.Background(), user.ID, time.Hour); err != nil {
+		t.Fatalf("LockUser: %v", err)
+	}
+	if users.lockedFor[user.ID] != time.Hour {
+		t.Errorf("locked for %v, want the requested hour", users.lockedFor[user.ID])
+	}
+}
+
+func TestDeactivateUserEndsSessions(t *testing.T) {
+	user := newAdminTestUser()
+	auth := &recordingAuthUseCase{}
+	uc := newAdminUseCase(newAdminUserRepo(user), auth)
+
+	if err := uc.DeactivateUser(context.Background(), user.ID); err != nil {
+		t.Fatalf("DeactivateUser: %v", err)
+	}
+	if user.Active {
+		t.Error("user is still active")
+	}
+	endedSessions(t, auth, user.ID)
+}
+
+func TestForcePasswordResetEndsSessions(t *testing.T) {
+	user := newAdminTestUser()
+	auth := &recordingAuthUseCase{}
+	uc := newAdminUseCase(newAdminUserRepo(user), auth)
+
+	if err := uc.ForcePasswordReset(context.Background(), user.ID); err != nil {
+		t.Fatalf("ForcePasswordReset: %v", err)
+	}
+	if !user.PasswordResetRequired {
+		t.Error("password reset is not required")
+	}
+	endedSessions(t, auth, user.ID)
+	if len(auth.resetSent) != 1 || auth.resetSent[0] != user.Email {
+		t.Errorf("reset links sent to %v, want %s", auth.resetSent, user.Email)
+	}
+}
+
+func TestDeleteAndRestoreUser(t *testing.T) {
+	user := newAdminTestUser()
+	users := newAdminUserRepo(user)
+	auth := &recordingAuthUseCase{}
+	uc := newAdminUseCase(users, auth)
+	ctx := context.Background()
+
+	if err := uc.RestoreUser(ctx, user.ID); err != errors.ErrUserNotFound {
+		t.Errorf("RestoreUser of a live user = %v, want ErrUserNotFound", err)
+	}
+
+	if err := uc.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if _, err := users.FindByID(user.ID); err != errors.ErrUserNotFound {
+		t.Error("deleted user is still found")
+	}
+	endedSessions(t, auth, user.ID)
+
+	if err := uc.RestoreUser(ctx, user.ID); err != nil {
+		t.Fatalf("RestoreUser: %v", err)
+	}
+	if _, err := users.FindByID(user.ID); err != nil {
+		t.Errorf("restored user is not found: %v", err)
+	}
+}
+
+// TestAdminActionsOnUnknownUsers checks that every action reports an unknown
+// user as not found and ends no one's sessions
+func TestAdminActionsOnUnknownUsers(t *testing.T) {
+	const unknownID = 99
+	actions := map[string]func(UserAdminUseCase) error{
+		"lock": func(uc UserAdminUseCase) error {
+			return uc.LockUser(context.Background(), unknownID, time.Hour)
+		},
+		"deactivate": func(uc UserAdminUseCase) error {
+			return uc.DeactivateUser(context.Background(), unknownID)
+		},
+		"force reset": func(uc UserAdminUseCase) error {
+			return uc.ForcePasswordReset(context.Background(), unknownID)
+		},
+		"delete": func(uc UserAdminUseCase) error {
+			return uc.DeleteUser(context.Background(), unknownID)
+		},
+		"restore": func(uc UserAdminUseCase) error {
+			return uc.RestoreUser(context.Background(), unknownID)
+		},
+	}
+
+	for name, action := range actions {
+		t.Run(name, func(t *testing.T) {
+			auth := &recordingAuthUseCase{}
+			uc := newAdminUseCase(newAdminUserRepo(newAdminTestUser()), auth)
+
+			if err := action(uc); err != errors.ErrUserNotFound {
+				t.Errorf("err = %v, want ErrUserNotFound", err)
+			}
+			if len(auth.loggedOut) != 0 || len(auth.resetSent) != 0 {
+				t.Errorf("sessions ended for %v and reset links sent to %v", auth.loggedOut, auth.resetSent)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package usecase
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/pkg/errors"
+)
+
+const (
+	maxUsernameLength = 64
+	usernameAttempts  = 5
+)
+
+// newUsername picks a free username for an account created without one:
+// the preferred name when it is given, the local part of the email
+// otherwise. A random suffix is added when the name is taken.
+func newUsername(userRepo repository.UserRepository, preferred, email string) (string, error) {
+	base := sanitizeUsername(preferred)
+	if base == "" {
+		local, _, _ := strings.Cut(email, "@")
+		base = sanitizeUsername(local)
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	candidate := base
+	for attempt := 0; attempt < usernameAttempts; attempt++ {
+		taken, err := userRepo.UsernameExists(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+
+		suffix := make([]byte, 3)
+		if _, err := rand.Read(suffix); err != nil {
+			return "", err
+		}
+		candidate = base + "-" + hex.EncodeToString(suffix)
+	}
+	return "", errors.ErrUsernameExists
+}
+
+// sanitizeUsername lowercases the name and keeps letters, digits, dots,
+// dashes and underscores, so that names from providers and emails do not
+// carry spaces or other characters into the username
+func sanitizeUsername(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			b.WriteRune(r)
+		}
+	}
+
+	username := strings.Trim(b.String(), ".-_")
+	if len(username) > maxUsernameLength {
+		username = strings.TrimRight(username[:maxUsernameLength], ".-_")
+	}
+	return username
+}
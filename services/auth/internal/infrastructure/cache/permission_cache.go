@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/pkg/errors"
+)
+
+// permissionVersionKey is bumped to drop the cached access of every user at
+// once
+const permissionVersionKey = "permissions:version"
+
+// permissionEntry is a cached user access with the version it was resolved
+// under
+type permissionEntry struct {
+	Version repository.AccessVersion `json:"version"`
+	Access  repository.UserAccess    `json:"access"`
+}
+
+// permissionCacheRepository keeps resolved user access in Redis. Entries are
+// invalidated through version counters rather than deleted, so that every
+// replica stops serving them on its next read and a resolution racing with
+// an invalidation cannot store a stale entry.
+type permissionCacheRepository struct {
+	cache *RedisCache
+}
+
+func NewPermissionCacheRepository(cache *RedisCache) repository.PermissionCacheRepository {
+	return &permissionCacheRepository{cache: cache}
+}
+
+func (r *permissionCacheRepository) Get(ctx context.Context, userID, orgID uint) (*repository.UserAccess, repository.AccessVersion, error) {
+	var version repository.AccessVersion
+	var entry permissionEntry
+	found, err := r.cache.GetMulti(ctx,
+		[]string{permissionVersionKey, userPermissionVersionKey(userID), userPermissionKey(userID, orgID)},
+		&version.Global, &version.User, &entry,
+	)
+	if err != nil {
+		return nil, repository.AccessVersion{}, errors.ErrServiceUnavailable
+	}
+
+	if !found[2] || entry.Version != version {
+		return nil, version, nil
+	}
+	return &entry.Access, version, nil
+}
+
+func (r *permissionCacheRepository) Set(ctx context.Context, userID, orgID uint, version repository.AccessVersion, access *repository.UserAccess, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+	entry := permissionEntry{Version: version, Access: *access}
+	if err := r.cache.Set(ctx, userPermissionKey(userID, orgID), entry, ttl); err != nil {
+		return errors.ErrServiceUnavailable
+	}
+	return nil
+}
+
+func (r *permissionCacheRepository) InvalidateUsers(ctx context.Context, userIDs ...uint) error {
+	for _, userID := range userIDs {
+		if _, err := r.cache.Increment(ctx, userPermissionVersionKey(userID)); err != nil {
+			return errors.ErrServiceUnavailable
+		}
+	}
+	return nil
+}
+
+func (r *permissionCacheRepository) InvalidateAll(ctx context.Context) error {
+	if _, err := r.cache.Increment(ctx, permissionVersionKey); err != nil {
+		return errors.ErrServiceUnavailable
+	}
+	return nil
+}
+
+// userPermissionKey holds the access of the user within the organization.
+// The version counter is shared by all organizations of the user.
+func userPermissionKey(userID, orgID uint) string {
+	if orgID == 0 {
+		return fmt.Sprintf("permissions:user:%d", userID)
+	}
+	return fmt.Sprintf("permissions:user:%d:org:%d", userID, orgID)
+}
+
+func userPermissionVersionKey(userID uint) string {
+	return fmt.Sprintf("permissions:version:user:%d", userID)
+}
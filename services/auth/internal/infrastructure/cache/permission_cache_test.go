@@ -0,0 +1,183 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"minisapi/services/auth/internal/domain/repository"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// memoryRedis answers the commands the permission cache sends from a map,
+// without a server
+type memoryRedis struct {
+	values map[string]string
+}
+
+func (m *memoryRedis) DialHook(redis.DialHook) redis.DialHook {
+	return func(context.Context, string, string) (net.Conn, error) {
+		return nil, fmt.Errorf("memoryRedis does not dial")
+	}
+}
+
+func (m *memoryRedis) ProcessHook(redis.ProcessHook) redis.ProcessHook {
+	return func(_ context.Context, cmd redis.Cmder) error {
+		args := cmd.Args()
+		switch c := cmd.(type) {
+		case *redis.SliceCmd:
+			values := make([]interface{}, 0, len(args)-1)
+			for _, key := range args[1:] {
+				if value, ok := m.values[key.(string)]; ok {
+					values = append(values, value)
+				} else {
+					values = append(values, nil)
+				}
+			}
+			c.SetVal(values)
+		case *redis.IntCmd:
+			var n int64
+			fmt.Sscan(m.values[args[1].(string)], &n)
+			n++
+			m.values[args[1].(string)] = fmt.Sprint(n)
+			c.SetVal(n)
+		case *redis.StatusCmd:
+			switch value := args[2].(type) {
+			case []byte:
+				m.values[args[1].(string)] = string(value)
+			default:
+				m.values[args[1].(string)] = fmt.Sprint(value)
+			}
+			c.SetVal("OK")
+		default:
+			return fmt.Errorf("memoryRedis does not support %v", args[0])
+		}
+		return nil
+	}
+}
+
+func (m *memoryRedis) ProcessPipelineHook(redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(context.Context, []redis.Cmder) error {
+		return fmt.Errorf("memoryRedis does not support pipelines")
+	}
+}
+
+func newMemoryPermissionCache() repository.PermissionCacheRepository {
+	client := redis.NewClient(&redis.Options{Addr: "memory:0"})
+	client.AddHook(&memoryRedis{values: make(map[string]string)})
+	return NewPermissionCacheRepository(NewRedisCacheFromClient(client))
+}
+
+// cacheAccess resolves and stores an access for the user the way the auth
+// service does, under the version read before resolving
+func cacheAccess(t *testing.T, cache repository.PermissionCacheRepository, userID, orgID uint, permissions ...string) {
+	t.Helper()
+	ctx := context.Background()
+	_, version, err := cache.Get(ctx, userID, orgID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	access := &repository.UserAccess{Roles: []string{"member"}, Permissions: permissions}
+	if err := cache.Set(ctx, userID, orgID, version, access, time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+}
+
+func cached(t *testing.T, cache repository.PermissionCacheRepository, userID, orgID uint) bool {
+	t.Helper()
+	access, _, err := cache.Get(context.Background(), userID, orgID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	return access != nil
+}
+
+func TestPermissionCacheServesEntries(t *testing.T) {
+	cache := newMemoryPermissionCache()
+	cacheAccess(t, cache, 1, 0, "user:read")
+
+	access, _, err := cache.Get(context.Background(), 1, 0)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if access == nil || len(access.Permissions) != 1 || access.Permissions[0] != "user:read" {
+		t.Fatalf("cached access = %+v, want user:read", access)
+	}
+	if cached(t, cache, 1, 7) {
+		t.Error("the access of another organization is served")
+	}
+}
+
+func TestInvalidateUsersDropsOnlyTheirEntries(t *testing.T) {
+	cache := newMemoryPermissionCache()
+	cacheAccess(t, cache, 1, 0, "user:read")
+	cacheAccess(t, cache, 1, 7, "organization:read")
+	cacheAccess(t, cache, 2, 0, "user:read")
+
+	if err := cache.InvalidateUsers(context.Background(), 1); err != nil {
+		t.Fatalf("InvalidateUsers: %v", err)
+	}
+
+	if cached(t, cache, 1, 0) || cached(t, cache, 1, 7) {
+		t.Error("an invalidated user's access is still served")
+	}
+	if !cached(t, cache, 2, 0) {
+		t.Error("another user's access was dropped")
+	}
+}
+
+func TestInvalidateAllDropsEveryEntry(t *testing.T) {
+	cache := newMemoryPermissionCache()
+	cacheAccess(t, cache, 1, 0, "user:read")
+	cacheAccess(t, cache, 2, 7, "organization:read")
+
+	if err := cache.InvalidateAll(context.Background()); err != nil {
+		t.Fatalf("InvalidateAll: %v", err)
+	}
+
+	if cached(t, cache, 1, 0) || cached(t, cache, 2, 7) {
+		t.Error("access is still served after a global invalidation")
+	}
+
+	cacheAccess(t, cache, 1, 0, "user:read")
+	if !cached(t, cache, 1, 0) {
+		t.Error("access resolved after the invalidation is not served")
+	}
+}
+
+// TestStaleResolutionIsNotServed checks that an access resolved before an
+// invalidation and stored after it is never served
+func TestStaleResolutionIsNotServed(t *testing.T) {
+	for name, invalidate := range map[string]func(repository.PermissionCacheRepository) error{
+		"user": func(cache repository.PermissionCacheRepository) error {
+			return cache.InvalidateUsers(context.Background(), 1)
+		},
+		"global": func(cache repository.PermissionCacheRepository) error {
+			return cache.InvalidateAll(context.Background())
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cache := newMemoryPermissionCache()
+			ctx := context.Background()
+
+			_, version, err := cache.Get(ctx, 1, 0)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if err := invalidate(cache); err != nil {
+				t.Fatalf("invalidate: %v", err)
+			}
+			stale := &repository.UserAccess{Permissions: []string{"user:delete"}}
+			if err := cache.Set(ctx, 1, 0, version, stale, time.Minute); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+
+			if cached(t, cache, 1, 0) {
+				t.Error("access resolved before the invalidation is served")
+			}
+		})
+	}
+}
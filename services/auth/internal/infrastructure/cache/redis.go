@@ -31,6 +31,11 @@ func NewRedisCache(cfg configs.RedisConfig) (*RedisCache, error) {
 	return &RedisCache{client: client}, nil
 }
 
+// NewRedisCacheFromClient creates a cache that shares an existing connection
+func NewRedisCacheFromClient(client *redis.Client) *RedisCache {
+	return &RedisCache{client: client}
+}
+
 func (c *RedisCache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
 	data, err := json.Marshal(value)
 	if err != nil {
@@ -49,6 +54,33 @@ func (c *RedisCache) Get(ctx context.Context, key string, value interface{}) err
 	return json.Unmarshal(data, value)
 }
 
+// GetMulti reads several keys in one round trip. Each value found is decoded
+// into the value at the same index; found reports which keys exist.
+func (c *RedisCache) GetMulti(ctx context.Context, keys []string, values ...interface{}) ([]bool, error) {
+	results, err := c.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	found := make([]bool, len(keys))
+	for i, result := range results {
+		data, ok := result.(string)
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal([]byte(data), values[i]); err != nil {
+			return nil, err
+		}
+		found[i] = true
+	}
+	return found, nil
+}
+
+// Increment atomically adds one to a counter and returns the new value
+func (c *RedisCache) Increment(ctx context.Context, key string) (int64, error) {
+	return c.client.Incr(ctx, key).Result()
+}
+
 func (c *RedisCache) Delete(ctx context.Context, key string) error {
 	return c.client.Del(ctx, key).Err()
 }
@@ -29,6 +29,14 @@ func NewPostgresDB(cfg configs.DatabaseConfig) (*gorm.DB, error) {
 	sqlDB.SetMaxOpenConns(100)
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
+	// Role grants carry metadata, so user_roles is backed by its own model
+	if err := db.SetupJoinTable(&entity.User{}, "Roles", &entity.UserRole{}); err != nil {
+		return nil, fmt.Errorf("failed to set up join table: %v", err)
+	}
+	if err := db.SetupJoinTable(&entity.Role{}, "Users", &entity.UserRole{}); err != nil {
+		return nil, fmt.Errorf("failed to set up join table: %v", err)
+	}
+
 	// Auto migrate schemas
 	err = db.AutoMigrate(
 		&entity.User{},
@@ -36,6 +44,17 @@ func NewPostgresDB(cfg configs.DatabaseConfig) (*gorm.DB, error) {
 		&entity.Permission{},
 		&entity.Token{},
 		&entity.Session{},
+		&entity.RecoveryCode{},
+		&entity.Policy{},
+		&entity.Organization{},
+		&entity.OrganizationMember{},
+		&entity.Invitation{},
+		&entity.APIKey{},
+		&entity.OAuthClient{},
+		&entity.AuthorizationCode{},
+		&entity.Consent{},
+		&entity.LinkedAccount{},
+		&entity.Passkey{},
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to migrate database: %v", err)
@@ -2,8 +2,9 @@ package email
 
 import (
 	"fmt"
-	"minisapi/services/auth/configs"
+	"minisapi/services/auth/internal/configs"
 	"net/smtp"
+	"net/url"
 )
 
 type EmailService struct {
@@ -17,17 +18,58 @@ func NewEmailService(config *configs.EmailConfig) *EmailService {
 }
 
 func (s *EmailService) SendVerificationEmail(to, token string) error {
+	link, err := tokenLink(s.config.VerifyURL, token)
+	if err != nil {
+		return err
+	}
+
 	subject := "Verify your email"
-	body := fmt.Sprintf("Click the link to verify your email: http://localhost:8080/api/v1/auth/verify-email?token=%s", token)
+	body := fmt.Sprintf("Click the link to verify your email: %s", link)
 	return s.sendEmail(to, subject, body)
 }
 
 func (s *EmailService) SendPasswordResetEmail(to, token string) error {
+	link, err := tokenLink(s.config.ResetURL, token)
+	if err != nil {
+		return err
+	}
+
 	subject := "Reset your password"
-	body := fmt.Sprintf("Click the link to reset your password: http://localhost:8080/api/v1/auth/reset-password?token=%s", token)
+	body := fmt.Sprintf("Click the link to reset your password: %s", link)
 	return s.sendEmail(to, subject, body)
 }
 
+// SendInvitationEmail sends an invitation link, naming the organization the
+// invitee joins when there is one
+func (s *EmailService) SendInvitationEmail(to, organization, token string) error {
+	link, err := tokenLink(s.config.InviteURL, token)
+	if err != nil {
+		return err
+	}
+
+	subject := "You have been invited"
+	body := fmt.Sprintf("Click the link to accept your invitation: %s", link)
+	if organization != "" {
+		subject = fmt.Sprintf("You have been invited to join %s", organization)
+		body = fmt.Sprintf("Click the link to join %s: %s", organization, link)
+	}
+	return s.sendEmail(to, subject, body)
+}
+
+// tokenLink appends the token to the base URL as the "token" query parameter
+func tokenLink(baseURL, token string) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid link base URL %q: %v", baseURL, err)
+	}
+
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
 func (s *EmailService) sendEmail(to, subject, body string) error {
 	auth := smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)
 
@@ -0,0 +1,278 @@
+// Package federationtest provides a local OpenID Connect provider, so that
+// federated sign-in can be tested without a real provider.
+package federationtest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"minisapi/services/auth/internal/configs"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims are claims about the user signing in. They must include "sub", and
+// may override the claims the issuer sets on ID tokens, such as "aud" or
+// "nonce", to produce invalid tokens.
+type Claims map[string]interface{}
+
+// Issuer is an OpenID Connect provider served in-process. It serves
+// discovery, keys, the token and the userinfo endpoints, and signs ID tokens
+// with an RSA key. The user's visit to the authorization endpoint is
+// simulated by SignIn.
+type Issuer struct {
+	URL          string
+	ClientID     string
+	ClientSecret string
+	// UserInfoOnly lists claims that are left out of ID tokens and only
+	// served by the userinfo endpoint
+	UserInfoOnly []string
+
+	t      testing.TB
+	mu     sync.Mutex
+	key    *rsa.PrivateKey
+	keyID  string
+	grants map[string]*grant
+	tokens map[string]Claims
+}
+
+// grant is an authorization code waiting to be redeemed
+type grant struct {
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+	claims        Claims
+}
+
+// NewIssuer starts an issuer for a client with the given credentials. An
+// empty secret makes the client public. The issuer stops when the test ends.
+func NewIssuer(t testing.TB, clientID, clientSecret string) *Issuer {
+	t.Helper()
+
+	issuer := &Issuer{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		t:            t,
+		grants:       make(map[string]*grant),
+		tokens:       make(map[string]Claims),
+	}
+	issuer.RotateKey()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", issuer.discovery)
+	mux.HandleFunc("/jwks", issuer.jwks)
+	mux.HandleFunc("/token", issuer.token)
+	mux.HandleFunc("/userinfo", issuer.userInfo)
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	issuer.URL = server.URL
+
+	return issuer
+}
+
+// Provider returns the configuration of the issuer as a provider with the
+// given ID
+func (i *Issuer) Provider(id string) configs.FederationProvider {
+	return configs.FederationProvider{
+		ID:           id,
+		DisplayName:  id,
+		Issuer:       i.URL,
+		ClientID:     i.ClientID,
+		ClientSecret: i.ClientSecret,
+		Scopes:       []string{"openid", "email", "profile"},
+	}
+}
+
+// RotateKey replaces the signing key. Tokens signed afterwards carry a new kid.
+func (i *Issuer) RotateKey() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		i.t.Fatalf("generate issuer key: %v", err)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.key = key
+	i.keyID = randomString(i.t)
+}
+
+// SignIn plays the user signing in at the authorization endpoint the
+// authorization URL points to, and returns the parameters the provider
+// sends the user back to the redirect URI with
+func (i *Issuer) SignIn(authorizationURL string, claims Claims) url.Values {
+	i.t.Helper()
+
+	u, err := url.Parse(authorizationURL)
+	if err != nil || u.Scheme+"://"+u.Host != i.URL || u.Path != "/authorize" {
+		i.t.Fatalf("authorization URL %q does not point to the issuer", authorizationURL)
+	}
+
+	query := u.Query()
+	switch {
+	case query.Get("response_type") != "code":
+		i.t.Fatalf("response_type = %q, want code", query.Get("response_type"))
+	case query.Get("client_id") != i.ClientID:
+		i.t.Fatalf("client_id = %q, want %q", query.Get("client_id"), i.ClientID)
+	case query.Get("redirect_uri") == "":
+		i.t.Fatal("authorization request has no redirect_uri")
+	case !strings.Contains(" "+query.Get("scope")+" ", " openid "):
+		i.t.Fatalf("scope %q does not include openid", query.Get("scope"))
+	case query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "":
+		i.t.Fatal("authorization request does not use PKCE with S256")
+	case query.Get("state") == "" || query.Get("nonce") == "":
+		i.t.Fatal("authorization request has no state or nonce")
+	}
+
+	code := randomString(i.t)
+	i.mu.Lock()
+	i.grants[code] = &grant{
+		redirectURI:   query.Get("redirect_uri"),
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+		claims:        claims,
+	}
+	i.mu.Unlock()
+
+	return url.Values{"code": {code}, "state": {query.Get("state")}}
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                i.URL,
+		"authorization_endpoint":                i.URL + "/authorize",
+		"token_endpoint":                        i.URL + "/token",
+		"userinfo_endpoint":                     i.URL + "/userinfo",
+		"jwks_uri":                              i.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": i.keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(i.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(i.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	clientID, secret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+	}
+	if clientID != i.ClientID || secret != i.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	code := r.PostForm.Get("code")
+	g, ok := i.grants[code]
+	delete(i.grants, code)
+	if !ok || g.redirectURI != r.PostForm.Get("redirect_uri") || challenge(r.PostForm.Get("code_verifier")) != g.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	idClaims := jwt.MapClaims{
+		"iss":   i.URL,
+		"aud":   i.ClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": g.nonce,
+	}
+	for name, value := range g.claims {
+		idClaims[name] = value
+	}
+	for _, name := range i.UserInfoOnly {
+		delete(idClaims, name)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, idClaims)
+	token.Header["kid"] = i.keyID
+	idToken, err := token.SignedString(i.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	accessToken := randomString(i.t)
+	i.tokens[accessToken] = g.claims
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (i *Issuer) userInfo(w http.ResponseWriter, r *http.Request) {
+	i.mu.Lock()
+	claims, ok := i.tokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+	i.mu.Unlock()
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_token"})
+		return
+	}
+	writeJSON(w, http.StatusOK, claims)
+}
+
+// challenge computes the S256 PKCE challenge of a verifier
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func randomString(t testing.TB) string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(fmt.Errorf("generate random string: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,424 @@
+package federation
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"minisapi/services/auth/internal/configs"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// maxResponseSize bounds the documents read from a provider
+	maxResponseSize = 1 << 20
+	// keyRefreshInterval limits how often an unknown kid makes the provider
+	// fetch its keys again
+	keyRefreshInterval = time.Minute
+	// clockSkew is tolerated on the time claims of ID tokens
+	clockSkew = 30 * time.Second
+)
+
+// signingMethods are the ID token algorithms accepted from providers
+var signingMethods = []string{"RS256", "PS256", "ES256", "EdDSA"}
+
+// Identity is the user as described by an external provider
+type Identity struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	GivenName         string
+	FamilyName        string
+	PreferredUsername string
+}
+
+// Provider signs users in with an external OpenID Connect provider, using
+// the authorization code flow with PKCE. The provider's metadata and keys
+// are discovered from its issuer on first use.
+type Provider struct {
+	cfg         configs.FederationProvider
+	redirectURI string
+	httpClient  *http.Client
+
+	mu          sync.Mutex
+	metadata    *metadata
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+// metadata is the part of the provider's discovery document that is used
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// tokenResponse is the answer of the provider's token endpoint
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// idTokenClaims are the claims read from the provider's ID tokens
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	profileClaims
+	Nonce           string `json:"nonce"`
+	AuthorizedParty string `json:"azp"`
+}
+
+// profileClaims are the standard claims about the user, found in ID tokens
+// and userinfo responses
+type profileClaims struct {
+	Email             string    `json:"email"`
+	EmailVerified     claimBool `json:"email_verified"`
+	Name              string    `json:"name"`
+	GivenName         string    `json:"given_name"`
+	FamilyName        string    `json:"family_name"`
+	PreferredUsername string    `json:"preferred_username"`
+}
+
+// userInfoClaims are the claims of a userinfo response
+type userInfoClaims struct {
+	Subject string `json:"sub"`
+	profileClaims
+}
+
+// claimBool reads a boolean claim that some providers send as a string
+type claimBool bool
+
+func (b *claimBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	case "false", "null":
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean claim %s", data)
+	}
+	return nil
+}
+
+// NewProvider creates a provider that sends users back to redirectURI
+func NewProvider(cfg configs.FederationProvider, redirectURI string, httpClient *http.Client) *Provider {
+	return &Provider{
+		cfg:         cfg,
+		redirectURI: redirectURI,
+		httpClient:  httpClient,
+	}
+}
+
+// ID returns the identifier of the provider
+func (p *Provider) ID() string {
+	return p.cfg.ID
+}
+
+// DisplayName returns the name of the provider shown to users
+func (p *Provider) DisplayName() string {
+	return p.cfg.DisplayName
+}
+
+// AuthorizationURL returns the URL that starts a sign-in at the provider.
+// The code verifier is kept by the caller and presented to Exchange.
+func (p *Provider) AuthorizationURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.redirectURI},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge(codeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(md.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return md.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the identity its ID
+// token vouches for. The ID token must carry the nonce of the request. The
+// email claims are read from the userinfo endpoint when the ID token lacks
+// them.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := p.redeem(ctx, md, code, codeVerifier)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := p.verifyIDToken(ctx, md, tokens.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("ID token nonce does not match the request")
+	}
+
+	profile := claims.profileClaims
+	if profile.Email == "" && md.UserInfoEndpoint != "" && tokens.AccessToken != "" {
+		info, err := p.userInfo(ctx, md, tokens.AccessToken)
+		if err != nil {
+			return nil, err
+		}
+		// The userinfo response must describe the user of the ID token
+		if info.Subject != claims.Subject {
+			return nil, fmt.Errorf("userinfo subject does not match the ID token")
+		}
+		profile = info.profileClaims
+	}
+
+	return &Identity{
+		Subject:           claims.Subject,
+		Email:             strings.ToLower(profile.Email),
+		EmailVerified:     profile.Email != "" && (bool(profile.EmailVerified) || p.cfg.TrustEmail),
+		Name:              profile.Name,
+		GivenName:         profile.GivenName,
+		FamilyName:        profile.FamilyName,
+		PreferredUsername: profile.PreferredUsername,
+	}, nil
+}
+
+// redeem exchanges the code at the token endpoint, authenticating with
+// client_secret_basic when the provider gave the client a secret
+func (p *Provider) redeem(ctx context.Context, md *metadata, code, codeVerifier string) (*tokenResponse, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURI},
+		"code_verifier": {codeVerifier},
+	}
+	if p.cfg.ClientSecret == "" {
+		form.Set("client_id", p.cfg.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		// RFC 6749 section 2.3.1
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	var tokens tokenResponse
+	status, err := p.do(req, &tokens)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK || tokens.Error != "" {
+		return nil, fmt.Errorf("token endpoint of %s answered %d: %s %s", p.cfg.ID, status, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("token endpoint of %s returned no ID token", p.cfg.ID)
+	}
+
+	return &tokens, nil
+}
+
+// verifyIDToken checks the signature, issuer, audience and lifetime of an
+// ID token
+func (p *Provider) verifyIDToken(ctx context.Context, md *metadata, raw string) (*idTokenClaims, error) {
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims,
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return p.key(ctx, md, kid)
+		},
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(md.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token from %s: %v", p.cfg.ID, err)
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("ID token from %s has no subject", p.cfg.ID)
+	}
+	// With several audiences the token must name the client as the party
+	// it was issued to
+	if (len(claims.Audience) > 1 || claims.AuthorizedParty != "") && claims.AuthorizedParty != p.cfg.ClientID {
+		return nil, fmt.Errorf("ID token from %s was issued to another party", p.cfg.ID)
+	}
+
+	return claims, nil
+}
+
+func (p *Provider) userInfo(ctx context.Context, md *metadata, accessToken string) (*userInfoClaims, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, md.UserInfoEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	var info userInfoClaims
+	status, err := p.do(req, &info)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("userinfo endpoint of %s answered %d", p.cfg.ID, status)
+	}
+	return &info, nil
+}
+
+// discover fetches the provider's metadata once. A failed attempt is
+// retried on the next sign-in.
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var md metadata
+	status, err := p.do(req, &md)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("discovery of %s answered %d", p.cfg.ID, status)
+	}
+	// OpenID Connect Discovery section 4.3
+	if md.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("discovery of %s returned issuer %q, want %q", p.cfg.ID, md.Issuer, p.cfg.Issuer)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery of %s is missing endpoints", p.cfg.ID)
+	}
+
+	p.metadata = &md
+	return p.metadata, nil
+}
+
+// key returns the provider's verification key with the given kid. The keys
+// are fetched again when the kid is unknown, so that key rotations at the
+// provider are picked up.
+func (p *Provider) key(ctx context.Context, md *metadata, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookup(kid); ok {
+		return key, nil
+	}
+
+	if time.Since(p.keysFetched) < keyRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	keys, err := p.fetchKeys(ctx, md)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	p.keysFetched = time.Now()
+
+	if key, ok := p.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookup finds a cached key. A token without a kid is accepted when the
+// provider publishes a single key.
+func (p *Provider) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *Provider) fetchKeys(ctx context.Context, md *metadata) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, md.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var set jwks
+	status, err := p.do(req, &set)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("JWKS of %s answered %d", p.cfg.ID, status)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			// Keys of unsupported types are skipped rather than failing
+			// every sign-in
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+// codeChallenge computes the S256 PKCE challenge of a verifier
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// do sends the request and decodes the JSON response into out
+func (p *Provider) do(req *http.Request, out interface{}) (int, error) {
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("request to %s failed: %v", p.cfg.ID, err)
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(out); err != nil && resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("invalid response from %s: %v", p.cfg.ID, err)
+	}
+	return resp.StatusCode, nil
+}
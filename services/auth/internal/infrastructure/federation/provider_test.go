@@ -0,0 +1,187 @@
+package federation
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"minisapi/services/auth/internal/configs"
+	"minisapi/services/auth/internal/infrastructure/federation/federationtest"
+)
+
+const testCallbackURL = "https://app.example.com/auth/callback"
+
+// signIn runs a sign-in against the issuer and returns the identity the
+// provider vouches for
+func signIn(t *testing.T, p *Provider, issuer *federationtest.Issuer, claims federationtest.Claims) (*Identity, error) {
+	t.Helper()
+	ctx := context.Background()
+	verifier := strings.Repeat("v", 43)
+
+	authURL, err := p.AuthorizationURL(ctx, "state-1", "nonce-1", verifier)
+	if err != nil {
+		t.Fatalf("AuthorizationURL: %v", err)
+	}
+	if u, _ := url.Parse(authURL); u.Query().Get("redirect_uri") != testCallbackURL {
+		t.Fatalf("redirect_uri = %q, want %q", u.Query().Get("redirect_uri"), testCallbackURL)
+	}
+
+	callback := issuer.SignIn(authURL, claims)
+	if callback.Get("state") != "state-1" {
+		t.Fatalf("state = %q, want state-1", callback.Get("state"))
+	}
+	return p.Exchange(ctx, callback.Get("code"), verifier, "nonce-1")
+}
+
+func newTestProvider(t *testing.T, issuer *federationtest.Issuer, modify func(*configs.FederationProvider)) *Provider {
+	cfg := issuer.Provider("test")
+	if modify != nil {
+		modify(&cfg)
+	}
+	return NewProvider(cfg, testCallbackURL, http.DefaultClient)
+}
+
+func TestExchange(t *testing.T) {
+	issuer := federationtest.NewIssuer(t, "client-1", "secret-1")
+	p := newTestProvider(t, issuer, nil)
+
+	identity, err := signIn(t, p, issuer, federationtest.Claims{
+		"sub":            "248289761001",
+		"email":          "Jane.Doe@Example.com",
+		"email_verified": true,
+		"given_name":     "Jane",
+		"family_name":    "Doe",
+	})
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	want := Identity{Subject: "248289761001", Email: "jane.doe@example.com", EmailVerified: true, GivenName: "Jane", FamilyName: "Doe"}
+	if *identity != want {
+		t.Fatalf("identity = %+v, want %+v", *identity, want)
+	}
+}
+
+func TestExchangeRejectsInvalidIDTokens(t *testing.T) {
+	issuer := federationtest.NewIssuer(t, "client-1", "secret-1")
+	p := newTestProvider(t, issuer, nil)
+
+	tests := []struct {
+		name   string
+		claims federationtest.Claims
+	}{
+		{"nonce of another request", federationtest.Claims{"nonce": "nonce-2"}},
+		{"other audience", federationtest.Claims{"aud": "client-2"}},
+		{"other issuer", federationtest.Claims{"iss": "https://evil.example.com"}},
+		{"expired", federationtest.Claims{"exp": time.Now().Add(-time.Hour).Unix()}},
+		{"several audiences without azp", federationtest.Claims{"aud": []string{"client-1", "client-2"}}},
+		{"issued to another party", federationtest.Claims{"azp": "client-2"}},
+		{"no subject", federationtest.Claims{"sub": ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := federationtest.Claims{"sub": "248289761001", "email": "jane@example.com", "email_verified": true}
+			for name, value := range tt.claims {
+				claims[name] = value
+			}
+			if _, err := signIn(t, p, issuer, claims); err == nil {
+				t.Fatal("Exchange accepted an invalid ID token")
+			}
+		})
+	}
+}
+
+func TestExchangeReadsEmailFromUserInfo(t *testing.T) {
+	issuer := federationtest.NewIssuer(t, "client-1", "")
+	issuer.UserInfoOnly = []string{"email", "email_verified"}
+	p := newTestProvider(t, issuer, nil)
+
+	// Some providers send email_verified as a string
+	identity, err := signIn(t, p, issuer, federationtest.Claims{"sub": "f:1234", "email": "jane@example.com", "email_verified": "true"})
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if identity.Email != "jane@example.com" || !identity.EmailVerified {
+		t.Fatalf("identity = %+v, want the verified email from userinfo", *identity)
+	}
+}
+
+func TestExchangeEmailVerification(t *testing.T) {
+	issuer := federationtest.NewIssuer(t, "client-1", "secret-1")
+	claims := federationtest.Claims{"sub": "00u1", "email": "jane@example.com"}
+
+	identity, err := signIn(t, newTestProvider(t, issuer, nil), issuer, claims)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if identity.EmailVerified {
+		t.Fatal("email without email_verified was reported as verified")
+	}
+
+	trusting := newTestProvider(t, issuer, func(cfg *configs.FederationProvider) { cfg.TrustEmail = true })
+	identity, err = signIn(t, trusting, issuer, claims)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if !identity.EmailVerified {
+		t.Fatal("email of a trusted provider was not reported as verified")
+	}
+}
+
+func TestExchangeFollowsKeyRotation(t *testing.T) {
+	issuer := federationtest.NewIssuer(t, "client-1", "secret-1")
+	p := newTestProvider(t, issuer, nil)
+	claims := federationtest.Claims{"sub": "1"}
+
+	if _, err := signIn(t, p, issuer, claims); err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	issuer.RotateKey()
+
+	// Unknown keys are only fetched again once the refresh interval passed
+	if _, err := signIn(t, p, issuer, claims); err == nil {
+		t.Fatal("Exchange refetched keys within the refresh interval")
+	}
+	p.keysFetched = time.Now().Add(-keyRefreshInterval)
+	if _, err := signIn(t, p, issuer, claims); err != nil {
+		t.Fatalf("Exchange after key rotation: %v", err)
+	}
+}
+
+func TestDiscoveryRequiresMatchingIssuer(t *testing.T) {
+	issuer := federationtest.NewIssuer(t, "client-1", "secret-1")
+	p := newTestProvider(t, issuer, func(cfg *configs.FederationProvider) { cfg.Issuer += "/" })
+
+	if _, err := p.AuthorizationURL(context.Background(), "state", "nonce", "verifier"); err == nil {
+		t.Fatal("AuthorizationURL accepted discovery of another issuer")
+	}
+}
+
+func TestNewRegistry(t *testing.T) {
+	valid := configs.FederationProvider{ID: "google", Issuer: "https://accounts.google.com", ClientID: "client"}
+
+	tests := []struct {
+		name      string
+		providers []configs.FederationProvider
+		wantErr   bool
+	}{
+		{"valid", []configs.FederationProvider{valid}, false},
+		{"invalid id", []configs.FederationProvider{{ID: "Google/1", Issuer: valid.Issuer, ClientID: "client"}}, true},
+		{"duplicate id", []configs.FederationProvider{valid, valid}, true},
+		{"missing issuer", []configs.FederationProvider{{ID: "google", ClientID: "client"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRegistry(configs.FederationConfig{Providers: tt.providers, CallbackURL: testCallbackURL})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewRegistry error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package federation
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"minisapi/services/auth/internal/configs"
+)
+
+// providerID restricts provider IDs to what can appear in URLs and
+// environment variable names
+var providerID = regexp.MustCompile(`^[a-z0-9][a-z0-9_]{0,63}$`)
+
+// Registry holds the configured external providers
+type Registry struct {
+	providers map[string]*Provider
+	order     []string
+}
+
+// NewRegistry creates the providers of the configuration. Providers are only
+// contacted on first use, so an unreachable provider does not prevent the
+// service from starting.
+func NewRegistry(cfg configs.FederationConfig) (*Registry, error) {
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	registry := &Registry{providers: make(map[string]*Provider)}
+
+	for _, providerCfg := range cfg.Providers {
+		if !providerID.MatchString(providerCfg.ID) {
+			return nil, fmt.Errorf("invalid identity provider id %q", providerCfg.ID)
+		}
+		if _, exists := registry.providers[providerCfg.ID]; exists {
+			return nil, fmt.Errorf("duplicate identity provider %q", providerCfg.ID)
+		}
+		if providerCfg.Issuer == "" || providerCfg.ClientID == "" {
+			return nil, fmt.Errorf("identity provider %q needs an issuer and a client id", providerCfg.ID)
+		}
+
+		registry.providers[providerCfg.ID] = NewProvider(providerCfg, cfg.CallbackURL, httpClient)
+		registry.order = append(registry.order, providerCfg.ID)
+	}
+
+	return registry, nil
+}
+
+// Provider returns the provider with the given ID
+func (r *Registry) Provider(id string) (*Provider, bool) {
+	provider, ok := r.providers[id]
+	return provider, ok
+}
+
+// Providers returns the providers in the order they were configured
+func (r *Registry) Providers() []*Provider {
+	providers := make([]*Provider, 0, len(r.order))
+	for _, id := range r.order {
+		providers = append(providers, r.providers[id])
+	}
+	return providers
+}
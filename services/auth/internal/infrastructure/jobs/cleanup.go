@@ -10,12 +10,16 @@ import (
 type CleanupJob struct {
 	tokenRepo   repository.TokenRepository
 	sessionRepo repository.SessionRepository
+	userRepo    repository.UserRepository
+	codeRepo    repository.AuthorizationCodeRepository
 }
 
-func NewCleanupJob(tokenRepo repository.TokenRepository, sessionRepo repository.SessionRepository) *CleanupJob {
+func NewCleanupJob(tokenRepo repository.TokenRepository, sessionRepo repository.SessionRepository, userRepo repository.UserRepository, codeRepo repository.AuthorizationCodeRepository) *CleanupJob {
 	return &CleanupJob{
 		tokenRepo:   tokenRepo,
 		sessionRepo: sessionRepo,
+		userRepo:    userRepo,
+		codeRepo:    codeRepo,
 	}
 }
 
@@ -46,5 +50,15 @@ func (j *CleanupJob) cleanup(ctx context.Context) error {
 		return err
 	}
 
+	// Cleanup expired role grants
+	if err := j.userRepo.CleanupExpiredRoleGrants(); err != nil {
+		return err
+	}
+
+	// Cleanup expired authorization codes
+	if err := j.codeRepo.CleanupExpired(); err != nil {
+		return err
+	}
+
 	return nil
 }
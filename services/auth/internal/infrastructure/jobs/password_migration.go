@@ -0,0 +1,44 @@
+package jobs
+
+import (
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/pkg/password"
+)
+
+// passwordMigrationBatch is the number of users loaded at a time
+const passwordMigrationBatch = 500
+
+// HashPlaintextPasswords hashes the passwords that versions before password
+// hashing stored in plain text, and returns how many it hashed. Hashes are
+// recognized by their encoding and left alone, so once every password is
+// hashed, running it again changes nothing.
+func HashPlaintextPasswords(userRepo repository.UserRepository, hasher *password.Hasher) (int, error) {
+	hashed := 0
+	var afterID uint
+	for {
+		users, err := userRepo.ListAfter(afterID, passwordMigrationBatch)
+		if err != nil {
+			return hashed, err
+		}
+		if len(users) == 0 {
+			return hashed, nil
+		}
+
+		for _, user := range users {
+			afterID = user.ID
+			// Accounts created without a password have nothing to hash
+			if user.Password == "" || hasher.Recognizes(user.Password) {
+				continue
+			}
+
+			encoded, err := hasher.Hash(user.Password)
+			if err != nil {
+				return hashed, err
+			}
+			if err := userRepo.UpdatePassword(user.ID, encoded); err != nil {
+				return hashed, err
+			}
+			hashed++
+		}
+	}
+}
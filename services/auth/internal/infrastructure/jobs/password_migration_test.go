@@ -0,0 +1,106 @@
+package jobs
+
+import (
+	"testing"
+
+	"minisapi/services/auth/internal/configs"
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/pkg/password"
+)
+
+// memoryUsers keeps users in ID order
+type memoryUsers struct {
+	repository.UserRepository
+	users []entity.User
+}
+
+func (r *memoryUsers) ListAfter(afterID uint, limit int) ([]entity.User, error) {
+	var page []entity.User
+	for _, user := range r.users {
+		if user.ID > afterID && len(page) < limit {
+			page = append(page, user)
+		}
+	}
+	return page, nil
+}
+
+func (r *memoryUsers) UpdatePassword(id uint, hashedPassword string) error {
+	for i := range r.users {
+		if r.users[i].ID == id {
+			r.users[i].Password = hashedPassword
+		}
+	}
+	return nil
+}
+
+func newTestHasher(t *testing.T, algorithm string) *password.Hasher {
+	t.Helper()
+	hasher, err := password.NewHasher(configs.PasswordConfig{
+		Algorithm:         algorithm,
+		BcryptCost:        4,
+		Argon2Memory:      1024,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 1,
+		Argon2SaltLength:  16,
+		Argon2KeyLength:   32,
+	})
+	if err != nil {
+		t.Fatalf("NewHasher: %v", err)
+	}
+	return hasher
+}
+
+func TestHashPlaintextPasswords(t *testing.T) {
+	hasher := newTestHasher(t, password.AlgorithmArgon2id)
+	bcryptHash, err := newTestHasher(t, password.AlgorithmBcrypt).Hash("bcrypt password")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	users := &memoryUsers{}
+	plaintext := map[uint]string{}
+	for id := uint(1); id <= passwordMigrationBatch+2; id++ {
+		user := entity.User{ID: id}
+		switch {
+		case id == 2:
+			user.Password = bcryptHash
+		case id == 3:
+			// created without a password
+		default:
+			user.Password = "plain password"
+			plaintext[id] = user.Password
+		}
+		users.users = append(users.users, user)
+	}
+
+	hashed, err := HashPlaintextPasswords(users, hasher)
+	if err != nil {
+		t.Fatalf("HashPlaintextPasswords: %v", err)
+	}
+	if hashed != len(plaintext) {
+		t.Errorf("hashed %d passwords, want %d", hashed, len(plaintext))
+	}
+
+	for _, user := range users.users {
+		switch {
+		case user.ID == 2:
+			if user.Password != bcryptHash {
+				t.Error("a bcrypt hash was replaced; it is upgraded at the next login instead")
+			}
+		case user.ID == 3:
+			if user.Password != "" {
+				t.Error("an account without a password was given one")
+			}
+		default:
+			ok, err := hasher.Verify(plaintext[user.ID], user.Password)
+			if err != nil || !ok {
+				t.Fatalf("user %d: password does not verify after hashing: %v", user.ID, err)
+			}
+		}
+	}
+
+	if hashed, err := HashPlaintextPasswords(users, hasher); err != nil || hashed != 0 {
+		t.Errorf("second run hashed %d passwords (%v), want none", hashed, err)
+	}
+}
@@ -3,77 +3,304 @@ package jwt
 import (
 	"fmt"
 	"minisapi/services/auth/internal/configs"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
+// Token times carry milliseconds, so that a token issued right after its
+// user's tokens were revoked can be told apart from those revoked in the
+// same second. NumericDate allows fractional seconds (RFC 7519).
+func init() {
+	jwt.TimePrecision = time.Millisecond
+}
+
 type JWTManager struct {
 	secretKey       []byte
+	keySet          *KeySet
+	issuer          string
+	audience        []string
 	accessTokenTTL  time.Duration
 	refreshTokenTTL time.Duration
 }
 
+// defaultRefreshTokenTTL is the refresh token lifetime when none is configured
+const defaultRefreshTokenTTL = 7 * 24 * time.Hour
+
 func NewJWTManager(cfg configs.JWTConfig) (*JWTManager, error) {
 	expiration, err := time.ParseDuration(cfg.Expiration)
 	if err != nil {
 		return nil, fmt.Errorf("invalid expiration duration: %v", err)
 	}
 
+	refreshExpiration := defaultRefreshTokenTTL
+	if cfg.RefreshExpiration != "" {
+		if refreshExpiration, err = time.ParseDuration(cfg.RefreshExpiration); err != nil {
+			return nil, fmt.Errorf("invalid refresh expiration duration: %v", err)
+		}
+	}
+	if expiration <= 0 || refreshExpiration <= 0 {
+		return nil, fmt.Errorf("token expirations must be positive")
+	}
+
+	keySet, err := LoadKeySet(cfg.ActiveKeyFiles, cfg.RetiringKeyFiles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing keys: %v", err)
+	}
+	if !keySet.Empty() && keySet.SigningKey() == nil {
+		return nil, fmt.Errorf("at least one active signing key is required")
+	}
+
+	if cfg.Issuer == "" || len(cfg.Audience) == 0 {
+		return nil, fmt.Errorf("issuer and audience are required")
+	}
+
 	return &JWTManager{
 		secretKey:       []byte(cfg.Secret),
+		keySet:          keySet,
+		issuer:          cfg.Issuer,
+		audience:        cfg.Audience,
 		accessTokenTTL:  expiration,
-		refreshTokenTTL: expiration * 2,
+		refreshTokenTTL: refreshExpiration,
 	}, nil
 }
 
-func (m *JWTManager) GenerateAccessToken(userID uint) (string, error) {
-	return m.generateToken(userID, m.accessTokenTTL)
+// JWKS returns the public keys that verify tokens issued by this manager
+func (m *JWTManager) JWKS() JWKS {
+	return m.keySet.JWKS()
+}
+
+// Issuer returns the iss of every token the manager signs
+func (m *JWTManager) Issuer() string {
+	return m.issuer
+}
+
+// Asymmetric reports whether tokens are signed with an asymmetric key, so
+// that parties without the shared secret can verify them from the JWKS
+func (m *JWTManager) Asymmetric() bool {
+	return m.keySet.SigningKey() != nil
 }
 
-func (m *JWTManager) GenerateRefreshToken(userID uint) (string, error) {
-	return m.generateToken(userID, m.refreshTokenTTL)
+func (m *JWTManager) AccessTokenTTL() time.Duration {
+	return m.accessTokenTTL
+}
+
+func (m *JWTManager) RefreshTokenTTL() time.Duration {
+	return m.refreshTokenTTL
+}
+
+// GenerateAccessToken signs an access token for the given claims. The
+// issuer, audience, lifetime and token ID are filled in by the manager.
+func (m *JWTManager) GenerateAccessToken(claims *Claims) (string, error) {
+	now := time.Now()
+	claims.Issuer = m.issuer
+	claims.Audience = m.audience
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.NotBefore = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(m.accessTokenTTL))
+	claims.ID = uuid.New().String()
+
+	return m.sign(claims)
+}
+
+// GenerateClientToken signs an access token for an OAuth2 client acting on
+// its own behalf. The token is issued for the requested audience only and
+// carries the granted scopes, space-separated.
+func (m *JWTManager) GenerateClientToken(clientID string, scopes []string, audience string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   clientID,
+			Issuer:    m.issuer,
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			ID:        uuid.New().String(),
+		},
+		ClientID: clientID,
+		Scope:    strings.Join(scopes, " "),
+	}
+
+	return m.sign(claims)
+}
+
+// GenerateScopedToken signs an access token that a relying party obtained
+// on behalf of a user. It is issued for the given audience only, so the
+// services that accept regular access tokens never accept it.
+func (m *JWTManager) GenerateScopedToken(claims *Claims, audience string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims.Issuer = m.issuer
+	claims.Audience = jwt.ClaimStrings{audience}
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.NotBefore = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+	claims.ID = uuid.New().String()
+
+	return m.sign(claims)
+}
+
+// GenerateIDToken signs an OpenID Connect ID token. The subject and
+// audience are set by the caller, since ID tokens are issued for a single
+// relying party. ID tokens are never signed with the shared secret: a
+// relying party able to verify them could forge any token.
+func (m *JWTManager) GenerateIDToken(claims *IDTokenClaims, ttl time.Duration) (string, error) {
+	if !m.Asymmetric() {
+		return "", fmt.Errorf("ID tokens require an asymmetric signing key")
+	}
+
+	now := time.Now()
+	claims.Issuer = m.issuer
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+	claims.ID = uuid.New().String()
+
+	return m.sign(claims)
 }
 
-func (m *JWTManager) GenerateResetToken(userID uint) (string, error) {
-	return m.generateToken(userID, 1*time.Hour)
+// SigningAlgorithm returns the algorithm new tokens are signed with
+func (m *JWTManager) SigningAlgorithm() string {
+	if key := m.keySet.SigningKey(); key != nil {
+		return key.Method.Alg()
+	}
+	return jwt.SigningMethodHS256.Alg()
 }
 
-func (m *JWTManager) GenerateVerifyToken(userID uint) (string, error) {
-	return m.generateToken(userID, 24*time.Hour)
+// GenerateChallengeToken signs a short-lived token for an intermediate
+// authentication step, recording the methods the user has already passed.
+// It is issued for the auth service itself rather than the configured
+// audience, so other services never accept it.
+func (m *JWTManager) GenerateChallengeToken(userID uint, purpose string, authMethods []string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := NewClaims(userID)
+	claims.Purpose = purpose
+	claims.AuthMethods = authMethods
+	claims.Issuer = m.issuer
+	claims.Audience = jwt.ClaimStrings{m.issuer}
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.NotBefore = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+	claims.ID = uuid.New().String()
+
+	return m.sign(claims)
 }
 
-func (m *JWTManager) generateToken(userID uint, expiration time.Duration) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(expiration).Unix(),
+// sign signs the claims with the current signing key, falling back to the
+// shared secret when no asymmetric keys are configured
+func (m *JWTManager) sign(claims jwt.Claims) (string, error) {
+	key := m.keySet.SigningKey()
+	if key == nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString(m.secretKey)
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(m.secretKey)
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
 }
 
-func (m *JWTManager) ValidateToken(tokenString string) (uint, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+// keyFunc resolves the verification key from the token header. Once
+// asymmetric keys are configured, HMAC tokens are rejected so that the
+// shared secret can no longer be used to forge tokens.
+func (m *JWTManager) keyFunc(token *jwt.Token) (interface{}, error) {
+	if m.keySet.Empty() {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		return m.secretKey, nil
-	})
+	}
 
+	kid, _ := token.Header["kid"].(string)
+	key, ok := m.keySet.Lookup(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key: %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.PublicKey, nil
+}
+
+// ValidateToken verifies the signature and the registered claims of a user
+// access token. Tokens from another issuer or for none of the configured
+// audiences are rejected, and so are tokens issued to OAuth2 clients, even
+// for one of those audiences: their subject is a client, not a user.
+func (m *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
+	claims, err := m.parse(tokenString, m.audience...)
 	if err != nil {
-		return 0, fmt.Errorf("invalid token: %v", err)
+		return nil, err
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok || !token.Valid {
-		return 0, fmt.Errorf("invalid token claims")
+	if claims.Purpose != "" || claims.ClientID != "" {
+		return nil, fmt.Errorf("invalid token claims")
 	}
 
-	userID, ok := claims["user_id"].(float64)
-	if !ok {
-		return 0, fmt.Errorf("invalid user_id in token")
+	return claims, nil
+}
+
+// ValidateChallengeToken verifies a token issued by GenerateChallengeToken
+// for the given purpose
+func (m *JWTManager) ValidateChallengeToken(tokenString, purpose string) (*Claims, error) {
+	claims, err := m.parse(tokenString, m.issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Purpose != purpose {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+
+	return claims, nil
+}
+
+// ValidateScopedToken verifies a token issued by GenerateScopedToken for
+// the given audience
+func (m *JWTManager) ValidateScopedToken(tokenString, audience string) (*Claims, error) {
+	claims, err := m.parse(tokenString, audience)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Purpose != "" || claims.ClientID == "" {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+
+	return claims, nil
+}
+
+// parse verifies a token issued for at least one of the audiences
+func (m *JWTManager) parse(tokenString string, audiences ...string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, m.keyFunc,
+		jwt.WithIssuer(m.issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %v", err)
 	}
 
-	return uint(userID), nil
+	if !token.Valid || claims.Subject == "" || claims.ID == "" {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+
+	if !issuedFor(claims.Audience, audiences) {
+		return nil, fmt.Errorf("invalid token audience")
+	}
+
+	return claims, nil
+}
+
+// issuedFor reports whether the token audience names any of the audiences
+func issuedFor(tokenAudience jwt.ClaimStrings, audiences []string) bool {
+	for _, aud := range tokenAudience {
+		for _, expected := range audiences {
+			if aud == expected {
+				return true
+			}
+		}
+	}
+	return false
 }
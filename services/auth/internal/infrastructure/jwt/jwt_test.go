@@ -0,0 +1,290 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"minisapi/services/auth/internal/configs"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writeKey writes a freshly generated key to a PEM file. Private keys are
+// written in PKCS#8, public ones in PKIX.
+func writeKey(t *testing.T, name string, private interface{}, public bool) string {
+	t.Helper()
+	var block *pem.Block
+	if public {
+		var pub interface{}
+		switch key := private.(type) {
+		case *rsa.PrivateKey:
+			pub = key.Public()
+		case ed25519.PrivateKey:
+			pub = key.Public()
+		}
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			t.Fatalf("MarshalPKIXPublicKey: %v", err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	} else {
+		der, err := x509.MarshalPKCS8PrivateKey(private)
+		if err != nil {
+			t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func newEd25519Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	return key
+}
+
+func newRSAKey(t *testing.T, bits int) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	return key
+}
+
+func newManager(t *testing.T, audience []string, active, retiring []string) *JWTManager {
+	t.Helper()
+	manager, err := NewJWTManager(configs.JWTConfig{
+		Secret:           "test-secret",
+		Expiration:       "15m",
+		Issuer:           "https://auth.test",
+		Audience:         audience,
+		ActiveKeyFiles:   active,
+		RetiringKeyFiles: retiring,
+	})
+	if err != nil {
+		t.Fatalf("NewJWTManager: %v", err)
+	}
+	return manager
+}
+
+func issue(t *testing.T, manager *JWTManager) string {
+	t.Helper()
+	token, err := manager.GenerateAccessToken(NewClaims(1))
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+	return token
+}
+
+// header returns the alg and kid of a token
+func header(t *testing.T, token string) (string, string) {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified: %v", err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return parsed.Method.Alg(), kid
+}
+
+func TestKeySetSignsWithTheFirstActiveKey(t *testing.T) {
+	edKey := newEd25519Key(t)
+	rsaKey := newRSAKey(t, 2048)
+	retired := newEd25519Key(t)
+
+	ks, err := LoadKeySet(
+		[]string{writeKey(t, "ed.pem", edKey, false), writeKey(t, "rsa.pem", rsaKey, false)},
+		[]string{writeKey(t, "retired.pem", retired, true)},
+	)
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+
+	signing := ks.SigningKey()
+	if signing == nil || signing.Method != jwt.SigningMethodEdDSA || signing.Status != KeyStatusActive {
+		t.Fatalf("signing key = %+v, want the active Ed25519 key", signing)
+	}
+
+	jwks := ks.JWKS()
+	if len(jwks.Keys) != 3 {
+		t.Fatalf("JWKS has %d keys, want 3", len(jwks.Keys))
+	}
+	wantAlg := []string{"EdDSA", "RS256", "EdDSA"}
+	wantKty := []string{"OKP", "RSA", "OKP"}
+	for i, jwk := range jwks.Keys {
+		if jwk.Alg != wantAlg[i] || jwk.Kty != wantKty[i] || jwk.Use != "sig" {
+			t.Errorf("JWKS key %d = %+v, want %s %s", i, jwk, wantKty[i], wantAlg[i])
+		}
+		key, ok := ks.Lookup(jwk.Kid)
+		if !ok {
+			t.Errorf("kid %q is published but not found", jwk.Kid)
+			continue
+		}
+		if i == 2 && (key.Status != KeyStatusRetiring || key.PrivateKey != nil) {
+			t.Errorf("retiring key = %+v, want a public verification key", key)
+		}
+	}
+
+	if _, ok := ks.Lookup("unknown"); ok {
+		t.Error("an unknown kid is found")
+	}
+}
+
+// TestKeyIDsAreThumbprints checks that every replica derives the same kid
+// for the same key, whether it holds the private or the public part
+func TestKeyIDsAreThumbprints(t *testing.T) {
+	key := newEd25519Key(t)
+	private, err := LoadKeySet([]string{writeKey(t, "private.pem", key, false)}, nil)
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+	public, err := LoadKeySet(nil, []string{writeKey(t, "public.pem", key, true)})
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+
+	if got, want := public.JWKS().Keys[0].Kid, private.SigningKey().ID; got != want {
+		t.Errorf("public kid = %q, private kid = %q", got, want)
+	}
+}
+
+func TestLoadKeySetRejectsUnusableKeys(t *testing.T) {
+	edKey := newEd25519Key(t)
+	edFile := writeKey(t, "ed.pem", edKey, false)
+
+	tests := []struct {
+		name     string
+		active   []string
+		retiring []string
+	}{
+		{"public active key", []string{writeKey(t, "public.pem", edKey, true)}, nil},
+		{"short RSA key", []string{writeKey(t, "short.pem", newRSAKey(t, 1024), false)}, nil},
+		{"duplicate key", []string{edFile}, []string{writeKey(t, "copy.pem", edKey, true)}},
+		{"missing file", []string{filepath.Join(t.TempDir(), "missing.pem")}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadKeySet(tt.active, tt.retiring); err == nil {
+				t.Fatal("LoadKeySet succeeded")
+			}
+		})
+	}
+}
+
+// TestKeyRotation checks that tokens signed with a key stay valid while the
+// key is retiring and are rejected once it is removed
+func TestKeyRotation(t *testing.T) {
+	audience := []string{"api"}
+	oldFile := writeKey(t, "old.pem", newEd25519Key(t), false)
+	newFile := writeKey(t, "new.pem", newRSAKey(t, 2048), false)
+
+	before := newManager(t, audience, []string{oldFile}, nil)
+	oldToken := issue(t, before)
+	_, oldKid := header(t, oldToken)
+
+	rotating := newManager(t, audience, []string{newFile}, []string{oldFile})
+	if _, err := rotating.ValidateToken(oldToken); err != nil {
+		t.Fatalf("token signed with the retiring key is rejected: %v", err)
+	}
+	newToken := issue(t, rotating)
+	alg, newKid := header(t, newToken)
+	if alg != "RS256" || newKid == oldKid || newKid != rotating.keySet.SigningKey().ID {
+		t.Fatalf("new token alg %s kid %q, want RS256 signed with the new key", alg, newKid)
+	}
+	if rotating.SigningAlgorithm() != "RS256" {
+		t.Errorf("SigningAlgorithm = %s, want RS256", rotating.SigningAlgorithm())
+	}
+
+	after := newManager(t, audience, []string{newFile}, nil)
+	if _, err := after.ValidateToken(oldToken); err == nil {
+		t.Error("token signed with a removed key is accepted")
+	}
+	if _, err := after.ValidateToken(newToken); err != nil {
+		t.Errorf("token signed with the active key is rejected: %v", err)
+	}
+}
+
+// TestSharedSecretFallback checks that tokens are signed with HS256 when no
+// keys are configured, and that HMAC tokens are rejected once keys are
+func TestSharedSecretFallback(t *testing.T) {
+	audience := []string{"api"}
+	hmac := newManager(t, audience, nil, nil)
+	if hmac.Asymmetric() || hmac.SigningAlgorithm() != "HS256" {
+		t.Fatalf("manager without keys signs with %s", hmac.SigningAlgorithm())
+	}
+
+	token := issue(t, hmac)
+	if alg, kid := header(t, token); alg != "HS256" || kid != "" {
+		t.Fatalf("token alg %s kid %q, want HS256 without kid", alg, kid)
+	}
+	if _, err := hmac.ValidateToken(token); err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+
+	keyed := newManager(t, audience, []string{writeKey(t, "ed.pem", newEd25519Key(t), false)}, nil)
+	if _, err := keyed.ValidateToken(token); err == nil {
+		t.Error("HS256 token is accepted once asymmetric keys are configured")
+	}
+	if _, err := hmac.ValidateToken(issue(t, keyed)); err == nil {
+		t.Error("EdDSA token is accepted by a manager using the shared secret")
+	}
+
+	other, err := NewJWTManager(configs.JWTConfig{
+		Secret:     "other-secret",
+		Expiration: "15m",
+		Issuer:     "https://auth.test",
+		Audience:   audience,
+	})
+	if err != nil {
+		t.Fatalf("NewJWTManager: %v", err)
+	}
+	if _, err := hmac.ValidateToken(issue(t, other)); err == nil {
+		t.Error("token signed with another secret is accepted")
+	}
+}
+
+// TestValidateTokenAcceptsAnyConfiguredAudience checks that a service
+// configured with several audiences accepts tokens issued for any of them
+func TestValidateTokenAcceptsAnyConfiguredAudience(t *testing.T) {
+	admin := newManager(t, []string{"admin"}, nil, nil)
+	token := issue(t, admin)
+
+	if _, err := newManager(t, []string{"api", "admin"}, nil, nil).ValidateToken(token); err != nil {
+		t.Errorf("token for the second audience is rejected: %v", err)
+	}
+	if _, err := newManager(t, []string{"api"}, nil, nil).ValidateToken(token); err == nil {
+		t.Error("token for another audience is accepted")
+	}
+}
+
+// TestValidateTokenRejectsClientTokens checks that a token issued to an
+// OAuth2 client is never accepted as a user's access token, even when the
+// client ID looks like a user ID
+func TestValidateTokenRejectsClientTokens(t *testing.T) {
+	manager := newManager(t, []string{"api"}, nil, nil)
+	token, err := manager.GenerateClientToken("42", []string{"authz:check"}, "api", time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateClientToken: %v", err)
+	}
+
+	if _, err := manager.ValidateToken(token); err == nil {
+		t.Error("client token is accepted as a user access token")
+	}
+}
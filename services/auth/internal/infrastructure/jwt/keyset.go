@@ -0,0 +1,262 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type KeyStatus string
+
+const (
+	// KeyStatusActive keys are published and accepted for verification.
+	// The first active key signs new tokens.
+	KeyStatusActive KeyStatus = "active"
+	// KeyStatusRetiring keys are still published and accepted for
+	// verification, but never sign, so tokens issued with them can expire
+	// naturally before the key is removed.
+	KeyStatusRetiring KeyStatus = "retiring"
+)
+
+// Key is an asymmetric signing key identified by its kid
+type Key struct {
+	ID         string
+	Status     KeyStatus
+	Method     jwt.SigningMethod
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+}
+
+// KeySet holds the keys used to sign and verify tokens
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+	order   []string
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// OKP
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// LoadKeySet loads active signing keys and retiring verification keys from
+// PEM files. Active key files must contain private keys; retiring key files
+// may contain either private or public keys.
+func LoadKeySet(activeFiles, retiringFiles []string) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*Key)}
+
+	for _, path := range activeFiles {
+		key, err := loadKeyFile(path, KeyStatusActive)
+		if err != nil {
+			return nil, err
+		}
+		if key.PrivateKey == nil {
+			return nil, fmt.Errorf("active key %s must contain a private key", path)
+		}
+		if err := ks.add(key); err != nil {
+			return nil, err
+		}
+		if ks.signing == nil {
+			ks.signing = key
+		}
+	}
+
+	for _, path := range retiringFiles {
+		key, err := loadKeyFile(path, KeyStatusRetiring)
+		if err != nil {
+			return nil, err
+		}
+		if err := ks.add(key); err != nil {
+			return nil, err
+		}
+	}
+
+	return ks, nil
+}
+
+func (ks *KeySet) add(key *Key) error {
+	if _, exists := ks.keys[key.ID]; exists {
+		return fmt.Errorf("duplicate key with kid %s", key.ID)
+	}
+	ks.keys[key.ID] = key
+	ks.order = append(ks.order, key.ID)
+	return nil
+}
+
+// SigningKey returns the key used to sign new tokens, or nil if the set is empty
+func (ks *KeySet) SigningKey() *Key {
+	return ks.signing
+}
+
+// Lookup returns the key with the given kid
+func (ks *KeySet) Lookup(kid string) (*Key, bool) {
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+// Empty reports whether the set holds no keys
+func (ks *KeySet) Empty() bool {
+	return len(ks.keys) == 0
+}
+
+// JWKS returns the public part of every key in the set
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: make([]JWK, 0, len(ks.order))}
+	for _, kid := range ks.order {
+		jwk, err := publicJWK(ks.keys[kid])
+		if err != nil {
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+func loadKeyFile(path string, status KeyStatus) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file %s: %v", path, err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+
+	key := &Key{Status: status}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key %s: %v", path, err)
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type in %s", path)
+		}
+		key.PrivateKey = signer
+		key.PublicKey = signer.Public()
+	case "RSA PRIVATE KEY":
+		parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse RSA private key %s: %v", path, err)
+		}
+		key.PrivateKey = parsed
+		key.PublicKey = parsed.Public()
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key %s: %v", path, err)
+		}
+		key.PublicKey = parsed
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q in %s", block.Type, path)
+	}
+
+	switch pub := key.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA key %s must be at least 2048 bits", path)
+		}
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type in %s: only RSA and Ed25519 are supported", path)
+	}
+
+	kid, err := thumbprint(key)
+	if err != nil {
+		return nil, err
+	}
+	key.ID = kid
+
+	return key, nil
+}
+
+func publicJWK(key *Key) (JWK, error) {
+	jwk := JWK{
+		Kid: key.ID,
+		Use: "sig",
+		Alg: key.Method.Alg(),
+	}
+
+	switch pub := key.PublicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return jwk, fmt.Errorf("unsupported public key type %T", pub)
+	}
+
+	return jwk, nil
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint of the public key, so
+// every replica derives the same kid for the same key file
+func thumbprint(key *Key) (string, error) {
+	var members interface{}
+
+	switch pub := key.PublicKey.(type) {
+	case *rsa.PublicKey:
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		}
+	case ed25519.PublicKey:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{
+			Crv: "Ed25519",
+			Kty: "OKP",
+			X:   base64.RawURLEncoding.EncodeToString(pub),
+		}
+	default:
+		return "", fmt.Errorf("unsupported public key type %T", pub)
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
@@ -7,23 +7,7 @@ import (
 )
 
 var (
-	// HTTP metrics
-	httpRequestsTotal = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "http_requests_total",
-			Help: "Total number of HTTP requests",
-		},
-		[]string{"method", "path", "status"},
-	)
-
-	httpRequestDuration = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "http_request_duration_seconds",
-			Help:    "HTTP request duration in seconds",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"method", "path"},
-	)
+	// HTTP metrics are collected by the metrics middleware
 
 	// Authentication metrics
 	loginAttempts = prometheus.NewCounterVec(
@@ -55,19 +39,11 @@ var (
 )
 
 func init() {
-	prometheus.MustRegister(httpRequestsTotal)
-	prometheus.MustRegister(httpRequestDuration)
 	prometheus.MustRegister(loginAttempts)
 	prometheus.MustRegister(tokenOperations)
 	prometheus.MustRegister(dbOperations)
 }
 
-// HTTP metrics
-func RecordHTTPRequest(method, path string, status int, duration time.Duration) {
-	httpRequestsTotal.WithLabelValues(method, path, string(status)).Inc()
-	httpRequestDuration.WithLabelValues(method, path).Observe(duration.Seconds())
-}
-
 // Authentication metrics
 func RecordLoginAttempt(success bool) {
 	status := "failure"
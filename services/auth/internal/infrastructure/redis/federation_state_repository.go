@@ -0,0 +1,54 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/pkg/errors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type federationStateRepository struct {
+	client *redis.Client
+}
+
+func NewFederationStateRepository(client *redis.Client) repository.FederationStateRepository {
+	return &federationStateRepository{client: client}
+}
+
+func (r *federationStateRepository) Save(ctx context.Context, stateHash string, state *entity.FederationState, ttl time.Duration) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := r.client.Set(ctx, federationStateKey(stateHash), data, ttl).Err(); err != nil {
+		return errors.ErrServiceUnavailable
+	}
+	return nil
+}
+
+// Consume reads and deletes the state in one command, so that concurrent
+// callbacks with the same state cannot both succeed
+func (r *federationStateRepository) Consume(ctx context.Context, stateHash string) (*entity.FederationState, error) {
+	data, err := r.client.GetDel(ctx, federationStateKey(stateHash)).Bytes()
+	if err == redis.Nil {
+		return nil, errors.ErrInvalidFederationState
+	}
+	if err != nil {
+		return nil, errors.ErrServiceUnavailable
+	}
+
+	var state entity.FederationState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, errors.ErrInvalidFederationState
+	}
+	return &state, nil
+}
+
+func federationStateKey(stateHash string) string {
+	return "federation:state:" + stateHash
+}
@@ -0,0 +1,58 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/pkg/errors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// incrementScript increments a counter and sets its expiry on the first
+// increment only, so the window is not extended by later attempts
+var incrementScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return count
+`)
+
+type loginAttemptRepository struct {
+	client *redis.Client
+}
+
+func NewLoginAttemptRepository(client *redis.Client) repository.LoginAttemptRepository {
+	return &loginAttemptRepository{client: client}
+}
+
+func (r *loginAttemptRepository) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	count, err := incrementScript.Run(ctx, r.client, []string{key}, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return 0, errors.ErrServiceUnavailable
+	}
+	return count, nil
+}
+
+func (r *loginAttemptRepository) Get(ctx context.Context, key string) (int64, error) {
+	count, err := r.client.Get(ctx, key).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.ErrServiceUnavailable
+	}
+	return count, nil
+}
+
+func (r *loginAttemptRepository) Reset(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := r.client.Del(ctx, keys...).Err(); err != nil {
+		return errors.ErrServiceUnavailable
+	}
+	return nil
+}
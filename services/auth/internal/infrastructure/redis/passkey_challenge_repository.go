@@ -0,0 +1,54 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/pkg/errors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type passkeyChallengeRepository struct {
+	client *redis.Client
+}
+
+func NewPasskeyChallengeRepository(client *redis.Client) repository.PasskeyChallengeRepository {
+	return &passkeyChallengeRepository{client: client}
+}
+
+func (r *passkeyChallengeRepository) Save(ctx context.Context, challengeHash string, challenge *entity.PasskeyChallenge, ttl time.Duration) error {
+	data, err := json.Marshal(challenge)
+	if err != nil {
+		return err
+	}
+	if err := r.client.Set(ctx, passkeyChallengeKey(challengeHash), data, ttl).Err(); err != nil {
+		return errors.ErrServiceUnavailable
+	}
+	return nil
+}
+
+// Consume reads and deletes the challenge in one command, so that the same
+// response cannot be replayed concurrently
+func (r *passkeyChallengeRepository) Consume(ctx context.Context, challengeHash string) (*entity.PasskeyChallenge, error) {
+	data, err := r.client.GetDel(ctx, passkeyChallengeKey(challengeHash)).Bytes()
+	if err == redis.Nil {
+		return nil, errors.ErrInvalidPasskeyChallenge
+	}
+	if err != nil {
+		return nil, errors.ErrServiceUnavailable
+	}
+
+	var challenge entity.PasskeyChallenge
+	if err := json.Unmarshal(data, &challenge); err != nil {
+		return nil, errors.ErrInvalidPasskeyChallenge
+	}
+	return &challenge, nil
+}
+
+func passkeyChallengeKey(challengeHash string) string {
+	return "passkey:challenge:" + challengeHash
+}
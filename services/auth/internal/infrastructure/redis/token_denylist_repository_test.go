@@ -0,0 +1,65 @@
+package redis
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"minisapi/services/auth/internal/configs"
+	"minisapi/services/auth/internal/infrastructure/jwt"
+)
+
+// TestTokensIssuedInTheRevocationSecond checks that a token issued right
+// after its user's tokens were revoked, in the same second, is accepted
+// while one issued before the revocation is not
+func TestTokensIssuedInTheRevocationSecond(t *testing.T) {
+	manager, err := jwt.NewJWTManager(configs.JWTConfig{
+		Secret:     "test-secret",
+		Expiration: "15m",
+		Issuer:     "https://auth.test",
+		Audience:   []string{"api"},
+	})
+	if err != nil {
+		t.Fatalf("NewJWTManager: %v", err)
+	}
+
+	issue := func() time.Time {
+		token, err := manager.GenerateAccessToken(jwt.NewClaims(1))
+		if err != nil {
+			t.Fatalf("GenerateAccessToken: %v", err)
+		}
+		claims, err := manager.ValidateToken(token)
+		if err != nil {
+			t.Fatalf("ValidateToken: %v", err)
+		}
+		return claims.IssuedAt.Time
+	}
+
+	// Retry until the revocation and both tokens fall in the same second
+	for attempt := 0; attempt < 10; attempt++ {
+		before := issue()
+		time.Sleep(2 * time.Millisecond)
+		revokedAt := time.Now()
+		time.Sleep(2 * time.Millisecond)
+		after := issue()
+		if before.Unix() != revokedAt.Unix() || after.Unix() != revokedAt.Unix() {
+			continue
+		}
+
+		cutoff := strconv.FormatInt(revokedAt.UnixMilli(), 10)
+		if !issuedBefore(before, cutoff) {
+			t.Errorf("token issued at %v before the revocation at %v is accepted", before, revokedAt)
+		}
+		if issuedBefore(after, cutoff) {
+			t.Errorf("token issued at %v after the revocation at %v is denied", after, revokedAt)
+		}
+		return
+	}
+	t.Fatal("could not issue the tokens within the revocation second")
+}
+
+func TestMalformedRevocationCutoffDeniesTokens(t *testing.T) {
+	if !issuedBefore(time.Now(), "not-a-number") {
+		t.Error("malformed cutoff accepts the token")
+	}
+}
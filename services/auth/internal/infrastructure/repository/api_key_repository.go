@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"time"
+
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/pkg/errors"
+
+	"gorm.io/gorm"
+)
+
+type apiKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyRepository(db *gorm.DB) repository.APIKeyRepository {
+	return &apiKeyRepository{db: db}
+}
+
+func (r *apiKeyRepository) Create(key *entity.APIKey) error {
+	if err := r.db.Create(key).Error; err != nil {
+		return errors.ErrDatabase
+	}
+	return nil
+}
+
+func (r *apiKeyRepository) FindByID(id uint) (*entity.APIKey, error) {
+	var key entity.APIKey
+	if err := r.db.First(&key, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrAPIKeyNotFound
+		}
+		return nil, errors.ErrDatabase
+	}
+	return &key, nil
+}
+
+func (r *apiKeyRepository) FindByHash(hash string) (*entity.APIKey, error) {
+	var key entity.APIKey
+	if err := r.db.Where("hash = ?", hash).First(&key).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrAPIKeyNotFound
+		}
+		return nil, errors.ErrDatabase
+	}
+	return &key, nil
+}
+
+func (r *apiKeyRepository) FindByUserID(userID uint) ([]entity.APIKey, error) {
+	var keys []entity.APIKey
+	err := r.db.Where("user_id = ? AND revoked = ?", userID, false).
+		Order("created_at DESC").
+		Find(&keys).Error
+	if err != nil {
+		return nil, errors.ErrDatabase
+	}
+	return keys, nil
+}
+
+func (r *apiKeyRepository) Revoke(id uint) error {
+	result := r.db.Model(&entity.APIKey{}).Where("id = ?", id).Update("revoked", true)
+	if result.Error != nil {
+		return errors.ErrDatabase
+	}
+	if result.RowsAffected == 0 {
+		return errors.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (r *apiKeyRepository) UpdateLastUsed(id uint, at time.Time) error {
+	if err := r.db.Model(&entity.APIKey{}).Where("id = ?", id).Update("last_used_at", at).Error; err != nil {
+		return errors.ErrDatabase
+	}
+	return nil
+}
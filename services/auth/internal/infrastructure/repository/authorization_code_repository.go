@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"time"
+
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/pkg/errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type authorizationCodeRepository struct {
+	db *gorm.DB
+}
+
+func NewAuthorizationCodeRepository(db *gorm.DB) repository.AuthorizationCodeRepository {
+	return &authorizationCodeRepository{db: db}
+}
+
+func (r *authorizationCodeRepository) Create(code *entity.AuthorizationCode) error {
+	if err := r.db.Create(code).Error; err != nil {
+		return errors.ErrDatabase
+	}
+	return nil
+}
+
+// Consume claims the code in a single statement, so that of two concurrent
+// exchanges of the same code only one succeeds
+func (r *authorizationCodeRepository) Consume(hash string) (*entity.AuthorizationCode, error) {
+	var codes []entity.AuthorizationCode
+	result := r.db.Model(&codes).
+		Clauses(clause.Returning{}).
+		Where("code_hash = ? AND used = ?", hash, false).
+		Update("used", true)
+	if result.Error != nil {
+		return nil, errors.ErrDatabase
+	}
+	if result.RowsAffected == 0 || len(codes) == 0 {
+		return nil, errors.ErrInvalidGrant
+	}
+	return &codes[0], nil
+}
+
+func (r *authorizationCodeRepository) CleanupExpired() error {
+	if err := r.db.Where("expires_at < ?", time.Now()).Delete(&entity.AuthorizationCode{}).Error; err != nil {
+		return errors.ErrDatabase
+	}
+	return nil
+}
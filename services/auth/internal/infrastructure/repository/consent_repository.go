@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/pkg/errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type consentRepository struct {
+	db *gorm.DB
+}
+
+func NewConsentRepository(db *gorm.DB) repository.ConsentRepository {
+	return &consentRepository{db: db}
+}
+
+func (r *consentRepository) Find(userID uint, clientID string) (*entity.Consent, error) {
+	var consent entity.Consent
+	if err := r.db.Where("user_id = ? AND client_id = ?", userID, clientID).First(&consent).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrConsentNotFound
+		}
+		return nil, errors.ErrDatabase
+	}
+	return &consent, nil
+}
+
+func (r *consentRepository) Save(consent *entity.Consent) error {
+	err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "client_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"scopes", "updated_at"}),
+	}).Create(consent).Error
+	if err != nil {
+		return errors.ErrDatabase
+	}
+	return nil
+}
+
+func (r *consentRepository) FindByUserID(userID uint) ([]entity.Consent, error) {
+	var consents []entity.Consent
+	if err := r.db.Where("user_id = ?", userID).Order("updated_at DESC").Find(&consents).Error; err != nil {
+		return nil, errors.ErrDatabase
+	}
+	return consents, nil
+}
+
+func (r *consentRepository) Delete(userID uint, clientID string) error {
+	result := r.db.Where("user_id = ? AND client_id = ?", userID, clientID).Delete(&entity.Consent{})
+	if result.Error != nil {
+		return errors.ErrDatabase
+	}
+	if result.RowsAffected == 0 {
+		return errors.ErrConsentNotFound
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"time"
+
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/pkg/errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// invitationReason is recorded on the role grants made by accepting an
+// invitation
+const invitationReason = "Accepted invitation"
+
+type invitationRepository struct {
+	db *gorm.DB
+}
+
+func NewInvitationRepository(db *gorm.DB) repository.InvitationRepository {
+	return &invitationRepository{db: db}
+}
+
+func (r *invitationRepository) Create(invitation *entity.Invitation) error {
+	// The roles already exist; only the links to them are written
+	if err := r.db.Omit("Roles.*").Create(invitation).Error; err != nil {
+		return errors.ErrDatabase
+	}
+	return nil
+}
+
+func (r *invitationRepository) FindByID(id uint) (*entity.Invitation, error) {
+	var invitation entity.Invitation
+	if err := r.db.Preload("Roles").Preload("Organization").First(&invitation, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrInvitationNotFound
+		}
+		return nil, errors.ErrDatabase
+	}
+	return &invitation, nil
+}
+
+func (r *invitationRepository) FindByToken(token string) (*entity.Invitation, error) {
+	var invitation entity.Invitation
+	err := r.db.Preload("Roles").Preload("Organization").Where("token = ?", token).First(&invitation).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrInvitationNotFound
+		}
+		return nil, errors.ErrDatabase
+	}
+	return &invitation, nil
+}
+
+func (r *invitationRepository) ListPending(orgID uint, page, limit int) ([]entity.Invitation, int64, error) {
+	var invitations []entity.Invitation
+	var total int64
+
+	query := withTenant(r.db, orgID).Where("status = ?", entity.InvitationStatusPending)
+	if err := query.Model(&entity.Invitation{}).Count(&total).Error; err != nil {
+		return nil, 0, errors.ErrDatabase
+	}
+
+	offset := (page - 1) * limit
+	err := query.Preload("Roles").
+		Order("created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&invitations).Error
+	if err != nil {
+		return nil, 0, errors.ErrDatabase
+	}
+	return invitations, total, nil
+}
+
+func (r *invitationRepository) Renew(id uint, token string, expiresAt time.Time) error {
+	result := r.db.Model(&entity.Invitation{}).
+		Where("id = ? AND status = ?", id, entity.InvitationStatusPending).
+		Updates(map[string]interface{}{"token": token, "expires_at": expiresAt})
+	if result.Error != nil {
+		return errors.ErrDatabase
+	}
+	if result.RowsAffected == 0 {
+		return errors.ErrInvitationNotPending
+	}
+	return nil
+}
+
+func (r *invitationRepository) Revoke(id uint) error {
+	result := r.db.Model(&entity.Invitation{}).
+		Where("id = ? AND status = ?", id, entity.InvitationStatusPending).
+		Update("status", entity.InvitationStatusRevoked)
+	if result.Error != nil {
+		return errors.ErrDatabase
+	}
+	if result.RowsAffected == 0 {
+		return errors.ErrInvitationNotPending
+	}
+	return nil
+}
+
+// Accept claims the invitation before anything else, so that of two
+// concurrent acceptances only one goes through
+func (r *invitationRepository) Accept(id uint, user *entity.User) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&entity.Invitation{}).
+			Where("id = ? AND status = ? AND expires_at > ?", id, entity.InvitationStatusPending, now).
+			Updates(map[string]interface{}{"status": entity.InvitationStatusAccepted, "accepted_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.ErrInvitationNotPending
+		}
+
+		var invitation entity.Invitation
+		if err := tx.Preload("Roles").First(&invitation, id).Error; err != nil {
+			return err
+		}
+
+		if user.ID == 0 {
+			if err := tx.Create(user).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&invitation).Update("accepted_by", user.ID).Error; err != nil {
+			return err
+		}
+
+		if invitation.OrganizationID != nil {
+			member := entity.OrganizationMember{
+				OrganizationID: *invitation.OrganizationID,
+				UserID:         user.ID,
+				AddedBy:        invitation.InvitedBy,
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&member).Error; err != nil {
+				return err
+			}
+		}
+
+		// Roles deleted since the invitation was made are not granted
+		if len(invitation.Roles) == 0 {
+			return nil
+		}
+		links := make([]entity.UserRole, 0, len(invitation.Roles))
+		for _, role := range invitation.Roles {
+			links = append(links, entity.UserRole{
+				UserID:    user.ID,
+				RoleID:    role.ID,
+				GrantedBy: invitation.InvitedBy,
+				GrantedAt: now,
+				Reason:    invitationReason,
+			})
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "role_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"granted_by", "granted_at", "expires_at", "reason"}),
+		}).Create(&links).Error
+	})
+	if err != nil {
+		if err == errors.ErrInvitationNotPending {
+			return err
+		}
+		return errors.ErrDatabase
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"time"
+
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/pkg/errors"
+
+	"gorm.io/gorm"
+)
+
+type linkedAccountRepository struct {
+	db *gorm.DB
+}
+
+func NewLinkedAccountRepository(db *gorm.DB) repository.LinkedAccountRepository {
+	return &linkedAccountRepository{db: db}
+}
+
+func (r *linkedAccountRepository) Create(account *entity.LinkedAccount) error {
+	if err := r.db.Create(account).Error; err != nil {
+		return errors.ErrDatabase
+	}
+	return nil
+}
+
+func (r *linkedAccountRepository) FindByIdentity(provider, subject string) (*entity.LinkedAccount, error) {
+	var account entity.LinkedAccount
+	if err := r.db.Where("provider = ? AND subject = ?", provider, subject).First(&account).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrLinkedAccountNotFound
+		}
+		return nil, errors.ErrDatabase
+	}
+	return &account, nil
+}
+
+func (r *linkedAccountRepository) FindByUserID(userID uint) ([]entity.LinkedAccount, error) {
+	var accounts []entity.LinkedAccount
+	if err := r.db.Where("user_id = ?", userID).Order("created_at").Find(&accounts).Error; err != nil {
+		return nil, errors.ErrDatabase
+	}
+	return accounts, nil
+}
+
+func (r *linkedAccountRepository) UpdateLastLogin(id uint, email string) error {
+	err := r.db.Model(&entity.LinkedAccount{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"email":         email,
+		"last_login_at": time.Now(),
+	}).Error
+	if err != nil {
+		return errors.ErrDatabase
+	}
+	return nil
+}
+
+func (r *linkedAccountRepository) Delete(userID, id uint) error {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&entity.LinkedAccount{})
+	if result.Error != nil {
+		return errors.ErrDatabase
+	}
+	if result.RowsAffected == 0 {
+		return errors.ErrLinkedAccountNotFound
+	}
+	return nil
+}
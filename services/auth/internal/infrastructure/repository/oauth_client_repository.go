@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/pkg/errors"
+
+	"gorm.io/gorm"
+)
+
+type oauthClientRepository struct {
+	db *gorm.DB
+}
+
+func NewOAuthClientRepository(db *gorm.DB) repository.OAuthClientRepository {
+	return &oauthClientRepository{db: db}
+}
+
+func (r *oauthClientRepository) Create(client *entity.OAuthClient) error {
+	if err := r.db.Create(client).Error; err != nil {
+		return errors.ErrDatabase
+	}
+	return nil
+}
+
+func (r *oauthClientRepository) Update(client *entity.OAuthClient) error {
+	if err := r.db.Save(client).Error; err != nil {
+		return errors.ErrDatabase
+	}
+	return nil
+}
+
+func (r *oauthClientRepository) Delete(id uint) error {
+	result := r.db.Delete(&entity.OAuthClient{}, id)
+	if result.Error != nil {
+		return errors.ErrDatabase
+	}
+	if result.RowsAffected == 0 {
+		return errors.ErrClientNotFound
+	}
+	return nil
+}
+
+func (r *oauthClientRepository) FindByID(id uint) (*entity.OAuthClient, error) {
+	var client entity.OAuthClient
+	if err := r.db.First(&client, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrClientNotFound
+		}
+		return nil, errors.ErrDatabase
+	}
+	return &client, nil
+}
+
+func (r *oauthClientRepository) FindByClientID(clientID string) (*entity.OAuthClient, error) {
+	var client entity.OAuthClient
+	if err := r.db.Where("client_id = ?", clientID).First(&client).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrClientNotFound
+		}
+		return nil, errors.ErrDatabase
+	}
+	return &client, nil
+}
+
+func (r *oauthClientRepository) List(page, limit int) ([]entity.OAuthClient, int64, error) {
+	var clients []entity.OAuthClient
+	var total int64
+
+	if err := r.db.Model(&entity.OAuthClient{}).Count(&total).Error; err != nil {
+		return nil, 0, errors.ErrDatabase
+	}
+
+	offset := (page - 1) * limit
+	if err := r.db.Order("name").Offset(offset).Limit(limit).Find(&clients).Error; err != nil {
+		return nil, 0, errors.ErrDatabase
+	}
+	return clients, total, nil
+}
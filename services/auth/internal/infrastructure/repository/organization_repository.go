@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/pkg/errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type organizationRepository struct {
+	db *gorm.DB
+}
+
+func NewOrganizationRepository(db *gorm.DB) repository.OrganizationRepository {
+	return &organizationRepository{db: db}
+}
+
+func (r *organizationRepository) Create(org *entity.Organization) error {
+	if err := r.db.Create(org).Error; err != nil {
+		return errors.ErrDatabase
+	}
+	return nil
+}
+
+func (r *organizationRepository) Update(org *entity.Organization) error {
+	if err := r.db.Save(org).Error; err != nil {
+		return errors.ErrDatabase
+	}
+	return nil
+}
+
+// Delete removes the organization's roles, with their grants and links,
+// and its memberships and revokes its pending invitations before
+// soft-deleting the organization itself
+func (r *organizationRepository) Delete(id uint) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := ensureExist(tx, &entity.Organization{}, []uint{id}, errors.ErrOrganizationNotFound); err != nil {
+			return err
+		}
+
+		roles := tx.Model(&entity.Role{}).Select("id").Where("organization_id = ?", id)
+		if err := tx.Where("role_id IN (?)", roles).Delete(&entity.UserRole{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role_id IN (?)", roles).Delete(&entity.RolePermission{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role_id IN (?) OR parent_id IN (?)", roles, roles).Delete(&entity.RoleParent{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("organization_id = ?", id).Delete(&entity.Role{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("organization_id = ?", id).Delete(&entity.OrganizationMember{}).Error; err != nil {
+			return err
+		}
+		err := tx.Model(&entity.Invitation{}).
+			Where("organization_id = ? AND status = ?", id, entity.InvitationStatusPending).
+			Update("status", entity.InvitationStatusRevoked).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&entity.Organization{}, id).Error
+	})
+	if err != nil {
+		if err == errors.ErrOrganizationNotFound {
+			return err
+		}
+		return errors.ErrDatabase
+	}
+	return nil
+}
+
+func (r *organizationRepository) FindByID(id uint) (*entity.Organization, error) {
+	var org entity.Organization
+	if err := r.db.First(&org, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrOrganizationNotFound
+		}
+		return nil, errors.ErrDatabase
+	}
+	return &org, nil
+}
+
+func (r *organizationRepository) FindBySlug(slug string) (*entity.Organization, error) {
+	var org entity.Organization
+	if err := r.db.Where("slug = ?", slug).First(&org).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrOrganizationNotFound
+		}
+		return nil, errors.ErrDatabase
+	}
+	return &org, nil
+}
+
+func (r *organizationRepository) List(page, limit int) ([]entity.Organization, int64, error) {
+	var orgs []entity.Organization
+	var total int64
+
+	if err := r.db.Model(&entity.Organization{}).Count(&total).Error; err != nil {
+		return nil, 0, errors.ErrDatabase
+	}
+
+	offset := (page - 1) * limit
+	if err := r.db.Order("name").Offset(offset).Limit(limit).Find(&orgs).Error; err != nil {
+		return nil, 0, errors.ErrDatabase
+	}
+	return orgs, total, nil
+}
+
+// FindByUser returns the organizations the user is a member of
+func (r *organizationRepository) FindByUser(userID uint) ([]entity.Organization, error) {
+	var orgs []entity.Organization
+	err := r.db.Joins("JOIN organization_members ON organizations.id = organization_members.organization_id").
+		Where("organization_members.user_id = ?", userID).
+		Order("organizations.name").
+		Find(&orgs).Error
+	if err != nil {
+		return nil, errors.ErrDatabase
+	}
+	return orgs, nil
+}
+
+// AddMember adds the user to the organization. Adding an existing member
+// does nothing.
+func (r *organizationRepository) AddMember(member *entity.OrganizationMember) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := ensureExist(tx, &entity.Organization{}, []uint{member.OrganizationID}, errors.ErrOrganizationNotFound); err != nil {
+			return err
+		}
+		if err := ensureExist(tx, &entity.User{}, []uint{member.UserID}, errors.ErrUserNotFound); err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(member).Error
+	})
+	if err != nil {
+		if err == errors.ErrOrganizationNotFound || err == errors.ErrUserNotFound {
+			return err
+		}
+		return errors.ErrDatabase
+	}
+	return nil
+}
+
+func (r *organizationRepository) RemoveMember(orgID, userID uint) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("organization_id = ? AND user_id = ?", orgID, userID).Delete(&entity.OrganizationMember{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.ErrNotMember
+		}
+
+		roles := tx.Model(&entity.Role{}).Select("id").Where("organization_id = ?", orgID)
+		return tx.Where("user_id = ? AND role_id IN (?)", userID, roles).Delete(&entity.UserRole{}).Error
+	})
+	if err != nil {
+		if err == errors.ErrNotMember {
+			return err
+		}
+		return errors.ErrDatabase
+	}
+	return nil
+}
+
+func (r *organizationRepository) IsMember(orgID, userID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&entity.OrganizationMember{}).
+		Where("organization_id = ? AND user_id = ?", orgID, userID).
+		Count(&count).Error
+	if err != nil {
+		return false, errors.ErrDatabase
+	}
+	return count > 0, nil
+}
+
+// ListMembers returns a page of the organization's members with their users
+func (r *organizationRepository) ListMembers(orgID uint, page, limit int) ([]entity.OrganizationMember, int64, error) {
+	var members []entity.OrganizationMember
+	var total int64
+
+	query := r.db.Model(&entity.OrganizationMember{}).Where("organization_id = ?", orgID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, errors.ErrDatabase
+	}
+
+	offset := (page - 1) * limit
+	err := r.db.Preload("User").
+		Where("organization_id = ?", orgID).
+		Order("joined_at").
+		Offset(offset).
+		Limit(limit).
+		Find(&members).Error
+	if err != nil {
+		return nil, 0, errors.ErrDatabase
+	}
+	return members, total, nil
+}
+
+func (r *organizationRepository) FindMemberIDs(orgID uint) ([]uint, error) {
+	var ids []uint
+	err := r.db.Model(&entity.OrganizationMember{}).
+		Where("organization_id = ?", orgID).
+		Pluck("user_id", &ids).Error
+	if err != nil {
+		return nil, errors.ErrDatabase
+	}
+	return ids, nil
+}
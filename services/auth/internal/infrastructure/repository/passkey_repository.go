@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"time"
+
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/pkg/errors"
+
+	"gorm.io/gorm"
+)
+
+type passkeyRepository struct {
+	db *gorm.DB
+}
+
+func NewPasskeyRepository(db *gorm.DB) repository.PasskeyRepository {
+	return &passkeyRepository{db: db}
+}
+
+func (r *passkeyRepository) Create(passkey *entity.Passkey) error {
+	if err := r.db.Create(passkey).Error; err != nil {
+		return errors.ErrDatabase
+	}
+	return nil
+}
+
+func (r *passkeyRepository) FindByCredentialID(credentialID string) (*entity.Passkey, error) {
+	var passkey entity.Passkey
+	if err := r.db.Where("credential_id = ?", credentialID).First(&passkey).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrPasskeyNotFound
+		}
+		return nil, errors.ErrDatabase
+	}
+	return &passkey, nil
+}
+
+func (r *passkeyRepository) FindByUserID(userID uint) ([]entity.Passkey, error) {
+	var passkeys []entity.Passkey
+	if err := r.db.Where("user_id = ?", userID).Order("created_at").Find(&passkeys).Error; err != nil {
+		return nil, errors.ErrDatabase
+	}
+	return passkeys, nil
+}
+
+func (r *passkeyRepository) UpdateUsage(id uint, signCount uint32, backedUp bool) error {
+	err := r.db.Model(&entity.Passkey{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"sign_count":   signCount,
+		"backed_up":    backedUp,
+		"last_used_at": time.Now(),
+	}).Error
+	if err != nil {
+		return errors.ErrDatabase
+	}
+	return nil
+}
+
+func (r *passkeyRepository) Rename(userID, id uint, name string) (*entity.Passkey, error) {
+	result := r.db.Model(&entity.Passkey{}).Where("id = ? AND user_id = ?", id, userID).Update("name", name)
+	if result.Error != nil {
+		return nil, errors.ErrDatabase
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.ErrPasskeyNotFound
+	}
+
+	var passkey entity.Passkey
+	if err := r.db.First(&passkey, id).Error; err != nil {
+		return nil, errors.ErrDatabase
+	}
+	return &passkey, nil
+}
+
+func (r *passkeyRepository) Delete(userID, id uint) error {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&entity.Passkey{})
+	if result.Error != nil {
+		return errors.ErrDatabase
+	}
+	if result.RowsAffected == 0 {
+		return errors.ErrPasskeyNotFound
+	}
+	return nil
+}
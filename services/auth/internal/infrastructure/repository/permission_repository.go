@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"time"
+
 	"minisapi/services/auth/internal/domain/entity"
 	"minisapi/services/auth/internal/domain/repository"
 
@@ -90,6 +92,7 @@ func (r *permissionRepository) FindByUser(userID uint) ([]entity.Permission, err
 	err := r.db.Joins("JOIN role_permissions ON permissions.id = role_permissions.permission_id").
 		Joins("JOIN user_roles ON role_permissions.role_id = user_roles.role_id").
 		Where("user_roles.user_id = ?", userID).
+		Where(activeGrant, time.Now()).
 		Find(&permissions).Error
 	return permissions, err
 }
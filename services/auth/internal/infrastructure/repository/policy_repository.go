@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/pkg/errors"
+
+	"gorm.io/gorm"
+)
+
+type policyRepository struct {
+	db *gorm.DB
+}
+
+func NewPolicyRepository(db *gorm.DB) repository.PolicyRepository {
+	return &policyRepository{db: db}
+}
+
+func (r *policyRepository) Create(policy *entity.Policy) error {
+	if err := r.db.Create(policy).Error; err != nil {
+		return errors.ErrDatabase
+	}
+	return nil
+}
+
+func (r *policyRepository) Update(policy *entity.Policy) error {
+	if err := r.db.Save(policy).Error; err != nil {
+		return errors.ErrDatabase
+	}
+	return nil
+}
+
+func (r *policyRepository) Delete(id uint) error {
+	result := r.db.Delete(&entity.Policy{}, id)
+	if result.Error != nil {
+		return errors.ErrDatabase
+	}
+	if result.RowsAffected == 0 {
+		return errors.ErrPolicyNotFound
+	}
+	return nil
+}
+
+func (r *policyRepository) FindByID(id uint) (*entity.Policy, error) {
+	var policy entity.Policy
+	if err := r.db.First(&policy, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrPolicyNotFound
+		}
+		return nil, errors.ErrDatabase
+	}
+	return &policy, nil
+}
+
+func (r *policyRepository) FindByName(name string) (*entity.Policy, error) {
+	var policy entity.Policy
+	if err := r.db.Where("name = ?", name).First(&policy).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrPolicyNotFound
+		}
+		return nil, errors.ErrDatabase
+	}
+	return &policy, nil
+}
+
+func (r *policyRepository) List() ([]entity.Policy, error) {
+	var policies []entity.Policy
+	if err := r.db.Order("name").Find(&policies).Error; err != nil {
+		return nil, errors.ErrDatabase
+	}
+	return policies, nil
+}
+
+func (r *policyRepository) FindEnabled() ([]entity.Policy, error) {
+	var policies []entity.Policy
+	if err := r.db.Where("enabled = ?", true).Order("name").Find(&policies).Error; err != nil {
+		return nil, errors.ErrDatabase
+	}
+	return policies, nil
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/pkg/errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type recoveryCodeRepository struct {
+	db *gorm.DB
+}
+
+func NewRecoveryCodeRepository(db *gorm.DB) repository.RecoveryCodeRepository {
+	return &recoveryCodeRepository{db: db}
+}
+
+// ReplaceForUser discards the user's previous codes and stores the new set
+func (r *recoveryCodeRepository) ReplaceForUser(userID uint, codeHashes []string) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&entity.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		codes := make([]entity.RecoveryCode, 0, len(codeHashes))
+		for _, hash := range codeHashes {
+			codes = append(codes, entity.RecoveryCode{UserID: userID, CodeHash: hash})
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		return tx.Create(&codes).Error
+	})
+	if err != nil {
+		return errors.ErrDatabase
+	}
+	return nil
+}
+
+// Consume marks an unused code as used. It reports whether a code was
+// consumed, so the same code can never be used twice.
+func (r *recoveryCodeRepository) Consume(userID uint, codeHash string) (bool, error) {
+	result := r.db.Model(&entity.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, errors.ErrDatabase
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *recoveryCodeRepository) CountUnused(userID uint) (int64, error) {
+	var count int64
+	if err := r.db.Model(&entity.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error; err != nil {
+		return 0, errors.ErrDatabase
+	}
+	return count, nil
+}
+
+func (r *recoveryCodeRepository) DeleteByUser(userID uint) error {
+	if err := r.db.Where("user_id = ?", userID).Delete(&entity.RecoveryCode{}).Error; err != nil {
+		return errors.ErrDatabase
+	}
+	return nil
+}
+
+func (r *recoveryCodeRepository) FindByUserID(userID uint) ([]entity.RecoveryCode, error) {
+	var codes []entity.RecoveryCode
+	if err := r.db.Where("user_id = ?", userID).Find(&codes).Error; err != nil {
+		return nil, errors.ErrDatabase
+	}
+	return codes, nil
+}
@@ -1,27 +1,67 @@
 package repository
 
 import (
+	"time"
+
 	"minisapi/services/auth/internal/domain/entity"
 	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/pkg/errors"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// activeGrant matches user_roles rows whose grant has not expired
+const activeGrant = "(user_roles.expires_at IS NULL OR user_roles.expires_at > ?)"
+
 type roleRepository struct {
 	db *gorm.DB
+	// organizationID is set when the repository is limited to the roles of
+	// one organization; zero stands for the global roles
+	organizationID *uint
 }
 
 func NewRoleRepository(db *gorm.DB) repository.RoleRepository {
 	return &roleRepository{db: db}
 }
 
+// ForOrganization returns a repository whose statements are limited to the
+// roles of the organization by TenantScope. Roles created through it belong
+// to the organization.
+func (r *roleRepository) ForOrganization(orgID uint) repository.RoleRepository {
+	root := r.db
+	if r.organizationID != nil {
+		root = r.db.Session(&gorm.Session{NewDB: true})
+	}
+	return &roleRepository{db: withTenant(root, orgID), organizationID: &orgID}
+}
+
+// owner returns the organization roles written through the repository
+// belong to, or nil for global roles
+func (r *roleRepository) owner(role *entity.Role) *uint {
+	if r.organizationID == nil {
+		return role.OrganizationID
+	}
+	if *r.organizationID == 0 {
+		return nil
+	}
+	orgID := *r.organizationID
+	return &orgID
+}
+
 func (r *roleRepository) Create(role *entity.Role) error {
-	return r.db.Create(role).Error
+	role.OrganizationID = r.owner(role)
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Parents").Create(role).Error; err != nil {
+			return err
+		}
+		return replaceParents(tx, role)
+	})
 }
 
 func (r *roleRepository) FindByID(id uint) (*entity.Role, error) {
 	var role entity.Role
-	err := r.db.First(&role, id).Error
+	err := r.db.Preload("Parents").First(&role, id).Error
 	return &role, err
 }
 
@@ -45,20 +85,98 @@ func (r *roleRepository) List(page, limit int) ([]entity.Role, int64, error) {
 	return roles, total, err
 }
 
+// Update saves the role. When role.Parents is non-nil the role's parents are
+// replaced, and errors.ErrRoleCycle is returned if the role would end up
+// inheriting from itself.
 func (r *roleRepository) Update(role *entity.Role) error {
-	return r.db.Save(role).Error
+	role.OrganizationID = r.owner(role)
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Save inserts a role it cannot update, so make sure the role is
+		// one this repository may write
+		if err := ensureExist(tx, &entity.Role{}, []uint{role.ID}, errors.ErrRoleNotFound); err != nil {
+			return err
+		}
+
+		if role.Parents != nil {
+			// Concurrent updates linking any of these roles wait for each
+			// other, so each one checks the hierarchy the other committed
+			if err := lockRoles(tx, append([]uint{role.ID}, parentIDs(role)...)); err != nil {
+				return err
+			}
+			graph, err := findHierarchy(tx)
+			if err != nil {
+				return err
+			}
+			if graph.CreatesCycle(role.ID, parentIDs(role)) {
+				return errors.ErrRoleCycle
+			}
+		}
+
+		if err := tx.Omit("Parents").Save(role).Error; err != nil {
+			return err
+		}
+		return replaceParents(tx, role)
+	})
 }
 
 func (r *roleRepository) Delete(id uint) error {
-	return r.db.Delete(&entity.Role{}, id).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := ensureExist(tx, &entity.Role{}, []uint{id}, errors.ErrRoleNotFound); err != nil {
+			return err
+		}
+		if err := tx.Where("role_id = ? OR parent_id = ?", id, id).Delete(&entity.RoleParent{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&entity.Role{}, id).Error
+	})
 }
 
 func (r *roleRepository) AssignPermission(roleID uint, permissionID uint) error {
-	return r.db.Model(&entity.Role{ID: roleID}).Association("Permissions").Append(&entity.Permission{ID: permissionID})
+	return r.AssignPermissions(roleID, []uint{permissionID})
 }
 
 func (r *roleRepository) RemovePermission(roleID uint, permissionID uint) error {
-	return r.db.Model(&entity.Role{ID: roleID}).Association("Permissions").Delete(&entity.Permission{ID: permissionID})
+	return r.RemovePermissions(roleID, []uint{permissionID})
+}
+
+// AssignPermissions grants the permissions to the role. Either all of them are
+// granted or, if the role or any permission does not exist, none are.
+func (r *roleRepository) AssignPermissions(roleID uint, permissionIDs []uint) error {
+	ids := uniqueIDs(permissionIDs)
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := ensureExist(tx, &entity.Role{}, []uint{roleID}, errors.ErrRoleNotFound); err != nil {
+			return err
+		}
+		if err := ensureExist(tx, &entity.Permission{}, ids, errors.ErrPermissionNotFound); err != nil {
+			return err
+		}
+
+		links := make([]entity.RolePermission, 0, len(ids))
+		for _, id := range ids {
+			links = append(links, entity.RolePermission{RoleID: roleID, PermissionID: id})
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&links).Error
+	})
+}
+
+// RemovePermissions revokes the permissions from the role. Permissions the
+// role does not hold are ignored.
+func (r *roleRepository) RemovePermissions(roleID uint, permissionIDs []uint) error {
+	ids := uniqueIDs(permissionIDs)
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := ensureExist(tx, &entity.Role{}, []uint{roleID}, errors.ErrRoleNotFound); err != nil {
+			return err
+		}
+		return tx.Where("role_id = ? AND permission_id IN ?", roleID, ids).Delete(&entity.RolePermission{}).Error
+	})
 }
 
 func (r *roleRepository) FindByPermission(permissionID uint) ([]entity.Role, error) {
@@ -70,17 +188,148 @@ func (r *roleRepository) FindByPermission(permissionID uint) ([]entity.Role, err
 }
 
 func (r *roleRepository) UpdateStatus(id uint, status entity.RoleStatus) error {
-	return r.db.Model(&entity.Role{}).Where("id = ?", id).Update("status", status).Error
+	return r.db.Model(&entity.Role{}).Where("roles.id = ?", id).Update("status", status).Error
 }
 
 func (r *roleRepository) UpdateDescription(id uint, description string) error {
-	return r.db.Model(&entity.Role{}).Where("id = ?", id).Update("description", description).Error
+	return r.db.Model(&entity.Role{}).Where("roles.id = ?", id).Update("description", description).Error
 }
 
 func (r *roleRepository) FindByUser(userID uint) ([]entity.Role, error) {
 	var roles []entity.Role
 	err := r.db.Joins("JOIN user_roles ON roles.id = user_roles.role_id").
 		Where("user_roles.user_id = ?", userID).
+		Where(activeGrant, time.Now()).
 		Find(&roles).Error
 	return roles, err
 }
+
+// NextGrantExpiry returns when the user's first time-bound role grant
+// expires, or nil when none of their active grants expire
+func (r *roleRepository) NextGrantExpiry(userID uint) (*time.Time, error) {
+	var grant entity.UserRole
+	err := r.db.Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Order("expires_at").
+		Limit(1).
+		Find(&grant).Error
+	if err != nil {
+		return nil, err
+	}
+	return grant.ExpiresAt, nil
+}
+
+// FindByIDs loads the given roles with their directly assigned permissions
+func (r *roleRepository) FindByIDs(ids []uint) ([]entity.Role, error) {
+	var roles []entity.Role
+	if len(ids) == 0 {
+		return roles, nil
+	}
+	err := r.db.Preload("Permissions").Where("roles.id IN ?", ids).Find(&roles).Error
+	return roles, err
+}
+
+// FindHierarchy loads the role inheritance graph
+func (r *roleRepository) FindHierarchy() (*entity.RoleGraph, error) {
+	return findHierarchy(r.db)
+}
+
+func findHierarchy(db *gorm.DB) (*entity.RoleGraph, error) {
+	var links []entity.RoleParent
+	if err := db.Find(&links).Error; err != nil {
+		return nil, err
+	}
+	return entity.NewRoleGraph(links), nil
+}
+
+// lockRoles locks the rows of the roles with SELECT ... FOR UPDATE until the
+// transaction ends. Rows are locked in ID order, and the tenant scope is
+// bypassed since parents may be global roles.
+func lockRoles(tx *gorm.DB, ids []uint) error {
+	var locked []uint
+	return tx.Session(&gorm.Session{NewDB: true}).Model(&entity.Role{}).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", uniqueIDs(ids)).
+		Order("id").
+		Pluck("id", &locked).Error
+}
+
+// replaceParents rewrites the role's parent links. The links are written
+// directly rather than through the association, so that saving a role
+// never upserts its parents.
+func replaceParents(tx *gorm.DB, role *entity.Role) error {
+	if role.Parents == nil {
+		return nil
+	}
+
+	if err := tx.Where("role_id = ?", role.ID).Delete(&entity.RoleParent{}).Error; err != nil {
+		return err
+	}
+
+	ids := parentIDs(role)
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := ensureParentsVisible(tx, role, ids); err != nil {
+		return err
+	}
+
+	links := make([]entity.RoleParent, 0, len(ids))
+	for _, id := range ids {
+		links = append(links, entity.RoleParent{RoleID: role.ID, ParentID: id})
+	}
+	return tx.Create(&links).Error
+}
+
+// ensureParentsVisible returns errors.ErrRoleNotFound unless every parent is a
+// global role or a role of the same organization. The check bypasses the
+// tenant scope, which would hide the global parents of organization roles.
+func ensureParentsVisible(tx *gorm.DB, role *entity.Role, ids []uint) error {
+	query := tx.Session(&gorm.Session{NewDB: true}).Model(&entity.Role{}).Where("id IN ?", ids)
+	if role.OrganizationID == nil {
+		query = query.Where("organization_id IS NULL")
+	} else {
+		query = query.Where("(organization_id IS NULL OR organization_id = ?)", *role.OrganizationID)
+	}
+
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return err
+	}
+	if count != int64(len(ids)) {
+		return errors.ErrRoleNotFound
+	}
+	return nil
+}
+
+func parentIDs(role *entity.Role) []uint {
+	ids := make([]uint, 0, len(role.Parents))
+	for _, parent := range role.Parents {
+		ids = append(ids, parent.ID)
+	}
+	return uniqueIDs(ids)
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// ensureExist returns notFound unless a row of the model exists for every ID.
+// The IDs must be unique.
+func ensureExist(tx *gorm.DB, model interface{}, ids []uint, notFound error) error {
+	var count int64
+	if err := tx.Model(model).Where("id IN ?", ids).Count(&count).Error; err != nil {
+		return err
+	}
+	if count != int64(len(ids)) {
+		return notFound
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// dryRunDB builds statements without connecting to a database
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost dbname=test"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatalf("gorm.Open: %v", err)
+	}
+	return db
+}
+
+// TestLockRoles checks that the roles are locked in ID order, including
+// global roles hidden by the tenant scope of an organization
+func TestLockRoles(t *testing.T) {
+	db := dryRunDB(t)
+
+	var queries []string
+	if err := db.Callback().Query().After("gorm:query").Register("test:capture", func(tx *gorm.DB) {
+		queries = append(queries, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+	}); err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	if err := lockRoles(withTenant(db, 7), []uint{3, 1, 3}); err != nil {
+		t.Fatalf("lockRoles: %v", err)
+	}
+
+	want := `SELECT "id" FROM "roles" WHERE id IN (3,1) AND "roles"."deleted_at" IS NULL ORDER BY id FOR UPDATE`
+	if len(queries) != 1 || queries[0] != want {
+		t.Errorf("queries = %q\nwant  %q", queries, want)
+	}
+}
+
+// TestLookupsSkipExpiredGrants checks that the lookups behind authorization
+// only follow role grants that have not expired
+func TestLookupsSkipExpiredGrants(t *testing.T) {
+	db := dryRunDB(t)
+
+	var queries []*gorm.Statement
+	if err := db.Callback().Query().After("gorm:query").Register("test:capture", func(tx *gorm.DB) {
+		queries = append(queries, tx.Statement)
+	}); err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	lookups := map[string]func() error{
+		"roles of a user": func() error {
+			_, err := NewRoleRepository(db).FindByUser(1)
+			return err
+		},
+		"permissions of a user": func() error {
+			_, err := NewPermissionRepository(db).FindByUser(1)
+			return err
+		},
+		"holders of a role": func() error {
+			_, err := NewUserRepository(db).FindByRole(1)
+			return err
+		},
+	}
+
+	for name, lookup := range lookups {
+		t.Run(name, func(t *testing.T) {
+			queries = nil
+			before := time.Now()
+			if err := lookup(); err != nil {
+				t.Fatalf("lookup: %v", err)
+			}
+			if len(queries) != 1 {
+				t.Fatalf("ran %d queries, want 1", len(queries))
+			}
+			assertActiveGrant(t, queries[0], before)
+		})
+	}
+}
+
+// assertActiveGrant checks that the statement only matches grants that are
+// permanent or expire after the given time
+func assertActiveGrant(t *testing.T, stmt *gorm.Statement, before time.Time) {
+	t.Helper()
+	sql := stmt.SQL.String()
+	if !strings.Contains(sql, "(user_roles.expires_at IS NULL OR user_roles.expires_at > $") {
+		t.Fatalf("query does not filter expired grants: %s", sql)
+	}
+	for _, v := range stmt.Vars {
+		if now, ok := v.(time.Time); ok && !now.Before(before) && !now.After(time.Now()) {
+			return
+		}
+	}
+	t.Errorf("query does not compare the expiry with the current time: %s %v", sql, stmt.Vars)
+}
+
+// TestCleanupDeletesOnlyExpiredGrants checks that the expiry sweep keeps
+// permanent grants and those that have yet to expire
+func TestCleanupDeletesOnlyExpiredGrants(t *testing.T) {
+	// Deletes run in a transaction by default, which needs a connection
+	db := dryRunDB(t).Session(&gorm.Session{SkipDefaultTransaction: true})
+
+	var statements []string
+	if err := db.Callback().Delete().After("gorm:delete").Register("test:capture", func(tx *gorm.DB) {
+		statements = append(statements, tx.Statement.SQL.String())
+	}); err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	if err := NewUserRepository(db).CleanupExpiredRoleGrants(); err != nil {
+		t.Fatalf("CleanupExpiredRoleGrants: %v", err)
+	}
+
+	want := `DELETE FROM "user_roles" WHERE expires_at IS NOT NULL AND expires_at <= $1`
+	if len(statements) != 1 || statements[0] != want {
+		t.Errorf("statements = %q\nwant  %q", statements, want)
+	}
+}
@@ -69,15 +69,15 @@ func (r *sessionRepository) CleanupExpired() error {
 
 func (r *sessionRepository) CountActiveSessions(userID uint) (int64, error) {
 	var count int64
-	result := r.db.Model(&entity.Session{}).Where("user_id = ? AND expires_at > ?", userID, time.Now()).Count(&count)
+	result := r.db.Model(&entity.Session{}).Where("user_id = ? AND active = ? AND expires_at > ?", userID, true, time.Now()).Count(&count)
 	if result.Error != nil {
 		return 0, errors.ErrDatabase
 	}
 	return count, nil
 }
 
-func (r *sessionRepository) Deactivate(userID uint) error {
-	result := r.db.Model(&entity.Session{}).Where("user_id = ?", userID).Update("active", false)
+func (r *sessionRepository) Deactivate(id uint) error {
+	result := r.db.Model(&entity.Session{}).Where("id = ?", id).Update("active", false)
 	if result.Error != nil {
 		return errors.ErrDatabase
 	}
@@ -92,6 +92,17 @@ func (r *sessionRepository) DeactivateAll(userID uint) error {
 	return nil
 }
 
+func (r *sessionRepository) DeactivateByTokenIDs(tokenIDs []uint) error {
+	if len(tokenIDs) == 0 {
+		return nil
+	}
+	result := r.db.Model(&entity.Session{}).Where("token_id IN ?", tokenIDs).Update("active", false)
+	if result.Error != nil {
+		return errors.ErrDatabase
+	}
+	return nil
+}
+
 func (r *sessionRepository) Delete(id uint) error {
 	result := r.db.Delete(&entity.Session{}, id)
 	if result.Error != nil {
@@ -133,6 +144,30 @@ func (r *sessionRepository) FindByTokenID(tokenID uint) (*entity.Session, error)
 	return &session, nil
 }
 
+func (r *sessionRepository) FindByFamily(familyID string) (*entity.Session, error) {
+	var session entity.Session
+	result := r.db.Where("family_id = ?", familyID).First(&session)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, errors.ErrSessionNotFound
+		}
+		return nil, errors.ErrDatabase
+	}
+	return &session, nil
+}
+
+// FindActiveByUserID returns the user's active, unexpired sessions, oldest first
+func (r *sessionRepository) FindActiveByUserID(userID uint) ([]entity.Session, error) {
+	var sessions []entity.Session
+	result := r.db.Where("user_id = ? AND active = ? AND expires_at > ?", userID, true, time.Now()).
+		Order("created_at ASC").
+		Find(&sessions)
+	if result.Error != nil {
+		return nil, errors.ErrDatabase
+	}
+	return sessions, nil
+}
+
 func (r *sessionRepository) Update(session *entity.Session) error {
 	result := r.db.Save(session)
 	if result.Error != nil {
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// tenantField is the field that marks a model as owned by an organization
+const tenantField = "OrganizationID"
+
+// TenantScope limits every statement on a model with an OrganizationID field
+// to the rows of the organization. Organization zero stands for the global
+// rows, whose OrganizationID is null. Statements on other models are left
+// alone, so a database handle carrying the scope can be used for the join
+// tables of tenant-owned models too.
+func TenantScope(orgID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		stmt := db.Statement
+
+		model := stmt.Model
+		if model == nil {
+			model = stmt.Dest
+		}
+		if model == nil || stmt.Parse(model) != nil {
+			return db
+		}
+
+		field := stmt.Schema.LookUpField(tenantField)
+		if field == nil {
+			return db
+		}
+
+		column := clause.Column{Table: stmt.Table, Name: field.DBName}
+		if orgID == 0 {
+			return db.Where(clause.Eq{Column: column, Value: nil})
+		}
+		return db.Where(clause.Eq{Column: column, Value: orgID})
+	}
+}
+
+// withTenant returns a handle on db whose statements all carry TenantScope.
+// The handle can be reused for any number of statements.
+func withTenant(db *gorm.DB, orgID uint) *gorm.DB {
+	return db.Scopes(TenantScope(orgID)).Session(&gorm.Session{})
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"testing"
+
+	"minisapi/services/auth/internal/domain/entity"
+
+	"gorm.io/gorm"
+)
+
+func TestTenantScope(t *testing.T) {
+	db := dryRunDB(t)
+
+	tests := []struct {
+		name  string
+		orgID uint
+		query func(tx *gorm.DB) *gorm.DB
+		want  string
+	}{
+		{
+			name:  "organization",
+			orgID: 7,
+			query: func(tx *gorm.DB) *gorm.DB { return tx.Find(&[]entity.Role{}) },
+			want:  `SELECT * FROM "roles" WHERE "roles"."organization_id" = 7 AND "roles"."deleted_at" IS NULL`,
+		},
+		{
+			name:  "global",
+			orgID: 0,
+			query: func(tx *gorm.DB) *gorm.DB { return tx.Find(&[]entity.Role{}) },
+			want:  `SELECT * FROM "roles" WHERE "roles"."organization_id" IS NULL AND "roles"."deleted_at" IS NULL`,
+		},
+		{
+			name:  "organization with conditions",
+			orgID: 7,
+			query: func(tx *gorm.DB) *gorm.DB { return tx.Where("name = ?", "admin").First(&entity.Role{}) },
+			want:  `SELECT * FROM "roles" WHERE name = 'admin' AND "roles"."organization_id" = 7 AND "roles"."deleted_at" IS NULL ORDER BY "roles"."id" LIMIT 1`,
+		},
+		{
+			name:  "model without organization",
+			orgID: 7,
+			query: func(tx *gorm.DB) *gorm.DB { return tx.Find(&[]entity.Permission{}) },
+			want:  `SELECT * FROM "permissions" WHERE "permissions"."deleted_at" IS NULL`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+				return tt.query(tx.Scopes(TenantScope(tt.orgID)))
+			})
+			if got != tt.want {
+				t.Errorf("SQL = %s\nwant  %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestWithTenantIsReusable checks that the scope does not pile up when the
+// handle returned by withTenant runs several statements
+func TestWithTenantIsReusable(t *testing.T) {
+	scoped := withTenant(dryRunDB(t), 7)
+
+	want := `SELECT * FROM "roles" WHERE "roles"."organization_id" = 7 AND "roles"."deleted_at" IS NULL`
+	for i := 0; i < 2; i++ {
+		if got := scoped.ToSQL(func(tx *gorm.DB) *gorm.DB { return tx.Find(&[]entity.Role{}) }); got != want {
+			t.Errorf("statement %d SQL = %s\nwant  %s", i+1, got, want)
+		}
+	}
+}
@@ -95,3 +95,56 @@ func (r *tokenRepository) RevokeByType(userID uint, tokenType entity.TokenType)
 	}
 	return nil
 }
+
+// RevokeIfValid revokes the token only if it is not already revoked. It
+// reports whether this call performed the revocation, so concurrent callers
+// presenting the same token cannot both succeed.
+func (r *tokenRepository) RevokeIfValid(id uint) (bool, error) {
+	result := r.db.Model(&entity.Token{}).Where("id = ? AND revoked = ?", id, false).Update("revoked", true)
+	if result.Error != nil {
+		return false, errors.ErrDatabase
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Rotate claims the token the same way RevokeIfValid does, then stores the
+// replacement and links it to the claimed token. Either all of it is
+// committed or none of it, so a failed rotation does not burn the token.
+func (r *tokenRepository) Rotate(id uint, replacement *entity.Token) (bool, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&entity.Token{}).Where("id = ? AND revoked = ?", id, false).Update("revoked", true)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return errors.ErrTokenRevoked
+		}
+
+		if err := tx.Create(replacement).Error; err != nil {
+			return err
+		}
+		return tx.Model(&entity.Token{}).Where("id = ?", id).Update("replaced_by_id", replacement.ID).Error
+	})
+	if err != nil {
+		if err == errors.ErrTokenRevoked {
+			return false, nil
+		}
+		return false, errors.ErrDatabase
+	}
+	return true, nil
+}
+
+func (r *tokenRepository) FindByFamily(familyID string) ([]entity.Token, error) {
+	var tokens []entity.Token
+	if err := r.db.Where("family_id = ?", familyID).Find(&tokens).Error; err != nil {
+		return nil, errors.ErrDatabase
+	}
+	return tokens, nil
+}
+
+func (r *tokenRepository) RevokeFamily(familyID string) error {
+	if err := r.db.Model(&entity.Token{}).Where("family_id = ?", familyID).Update("revoked", true).Error; err != nil {
+		return errors.ErrDatabase
+	}
+	return nil
+}
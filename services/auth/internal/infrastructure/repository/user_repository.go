@@ -2,12 +2,15 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"minisapi/services/auth/internal/domain/entity"
 	"minisapi/services/auth/internal/domain/repository"
 	"minisapi/services/auth/internal/pkg/errors"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type userRepository struct {
@@ -67,8 +70,10 @@ func (r *userRepository) UpdateEmailVerified(ctx context.Context, id uint, verif
 	return nil
 }
 
+// UpdatePassword also updates soft-deleted users, so that no password is
+// left in plain text for a restore to bring back
 func (r *userRepository) UpdatePassword(id uint, password string) error {
-	result := r.db.Model(&entity.User{}).Where("id = ?", id).Update("password", password)
+	result := r.db.Unscoped().Model(&entity.User{}).Where("id = ?", id).Update("password", password)
 	if result.Error != nil {
 		return errors.ErrDatabase
 	}
@@ -86,6 +91,19 @@ func (r *userRepository) UpdateTwoFactor(ctx context.Context, id uint, enabled b
 	return nil
 }
 
+// AdvanceTwoFactorStep records the TOTP time step of an accepted code. It
+// only succeeds when the step is newer than the last accepted one, so the
+// same code cannot be replayed even by concurrent requests.
+func (r *userRepository) AdvanceTwoFactorStep(ctx context.Context, id uint, step int64) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&entity.User{}).
+		Where("id = ? AND two_factor_last_step < ?", id, step).
+		Update("two_factor_last_step", step)
+	if result.Error != nil {
+		return false, errors.ErrDatabase
+	}
+	return result.RowsAffected == 1, nil
+}
+
 func (r *userRepository) Delete(id uint) error {
 	result := r.db.Delete(&entity.User{}, id)
 	if result.Error != nil {
@@ -110,6 +128,7 @@ func (r *userRepository) FindByRole(roleID uint) ([]entity.User, error) {
 	var users []entity.User
 	result := r.db.Joins("JOIN user_roles ON users.id = user_roles.user_id").
 		Where("user_roles.role_id = ?", roleID).
+		Where(activeGrant, time.Now()).
 		Find(&users)
 	if result.Error != nil {
 		return nil, errors.ErrDatabase
@@ -117,6 +136,64 @@ func (r *userRepository) FindByRole(roleID uint) ([]entity.User, error) {
 	return users, nil
 }
 
+// AssignRoles grants the roles to the user with the metadata of grant. Either
+// all of them are granted or, if the user or any role does not exist, none
+// are. Granting a role the user already holds replaces the earlier grant.
+func (r *userRepository) AssignRoles(userID uint, roleIDs []uint, grant entity.UserRole) error {
+	ids := uniqueIDs(roleIDs)
+	if len(ids) == 0 {
+		return nil
+	}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := ensureExist(tx, &entity.User{}, []uint{userID}, errors.ErrUserNotFound); err != nil {
+			return err
+		}
+		if err := ensureExist(tx, &entity.Role{}, ids, errors.ErrRoleNotFound); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		links := make([]entity.UserRole, 0, len(ids))
+		for _, id := range ids {
+			links = append(links, entity.UserRole{
+				UserID:    userID,
+				RoleID:    id,
+				GrantedBy: grant.GrantedBy,
+				GrantedAt: now,
+				ExpiresAt: grant.ExpiresAt,
+				Reason:    grant.Reason,
+			})
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "role_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"granted_by", "granted_at", "expires_at", "reason"}),
+		}).Create(&links).Error
+	})
+	if err != nil {
+		if err == errors.ErrUserNotFound || err == errors.ErrRoleNotFound {
+			return err
+		}
+		return errors.ErrDatabase
+	}
+	return nil
+}
+
+// RemoveRoles takes the user out of the roles. Roles the user does not hold
+// are ignored.
+func (r *userRepository) RemoveRoles(userID uint, roleIDs []uint) error {
+	ids := uniqueIDs(roleIDs)
+	if len(ids) == 0 {
+		return nil
+	}
+
+	result := r.db.Where("user_id = ? AND role_id IN ?", userID, ids).Delete(&entity.UserRole{})
+	if result.Error != nil {
+		return errors.ErrDatabase
+	}
+	return nil
+}
+
 func (r *userRepository) FindByUsername(username string) (*entity.User, error) {
 	var user entity.User
 	result := r.db.Where("username = ?", username).First(&user)
@@ -129,9 +206,19 @@ func (r *userRepository) FindByUsername(username string) (*entity.User, error) {
 	return &user, nil
 }
 
+// UsernameExists also counts soft-deleted users, since their usernames stay
+// in the unique index until they are purged
+func (r *userRepository) UsernameExists(username string) (bool, error) {
+	var count int64
+	if err := r.db.Unscoped().Model(&entity.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+		return false, errors.ErrDatabase
+	}
+	return count > 0, nil
+}
+
 func (r *userRepository) IncrementFailedLogins(id uint) error {
 	result := r.db.Model(&entity.User{}).Where("id = ?", id).
-		UpdateColumn("failed_login_attempts", gorm.Expr("failed_login_attempts + ?", 1))
+		UpdateColumn("failed_logins", gorm.Expr("failed_logins + ?", 1))
 	if result.Error != nil {
 		return errors.ErrDatabase
 	}
@@ -159,13 +246,20 @@ func (r *userRepository) List(page, limit int) ([]entity.User, int64, error) {
 	return users, count, nil
 }
 
-func (r *userRepository) LockAccount(id uint, duration int) error {
-	// Calculate unlock time based on duration in minutes
-	unlockTime := time.Now().Add(time.Duration(duration) * time.Minute)
+func (r *userRepository) ListAfter(afterID uint, limit int) ([]entity.User, error) {
+	var users []entity.User
+	result := r.db.Unscoped().Where("id > ?", afterID).Order("id").Limit(limit).Find(&users)
+	if result.Error != nil {
+		return nil, errors.ErrDatabase
+	}
+	return users, nil
+}
 
+func (r *userRepository) LockAccount(id uint, duration time.Duration) error {
 	result := r.db.Model(&entity.User{}).Where("id = ?", id).Updates(map[string]interface{}{
-		"locked":       true,
-		"locked_until": unlockTime,
+		// A deactivated account keeps its status while locked
+		"status":       gorm.Expr("CASE WHEN status = ? THEN status ELSE ? END", entity.UserStatusInactive, entity.UserStatusLocked),
+		"locked_until": time.Now().Add(duration),
 	})
 	if result.Error != nil {
 		return errors.ErrDatabase
@@ -175,8 +269,10 @@ func (r *userRepository) LockAccount(id uint, duration int) error {
 
 func (r *userRepository) UnlockAccount(id uint) error {
 	result := r.db.Model(&entity.User{}).Where("id = ?", id).Updates(map[string]interface{}{
-		"locked":       false,
-		"locked_until": nil,
+		// A deactivated account stays inactive when its lock is lifted
+		"status":        gorm.Expr("CASE WHEN status = ? THEN ? ELSE status END", entity.UserStatusLocked, entity.UserStatusActive),
+		"locked_until":  nil,
+		"failed_logins": 0,
 	})
 	if result.Error != nil {
 		return errors.ErrDatabase
@@ -185,7 +281,7 @@ func (r *userRepository) UnlockAccount(id uint) error {
 }
 
 func (r *userRepository) ResetFailedLogins(id uint) error {
-	result := r.db.Model(&entity.User{}).Where("id = ?", id).Update("failed_login_attempts", 0)
+	result := r.db.Model(&entity.User{}).Where("id = ?", id).Update("failed_logins", 0)
 	if result.Error != nil {
 		return errors.ErrDatabase
 	}
@@ -218,3 +314,130 @@ func (r *userRepository) Update(user *entity.User) error {
 	}
 	return nil
 }
+
+// Search returns a page of users matching the filter, with their roles
+func (r *userRepository) Search(filter repository.UserFilter) ([]entity.User, int64, error) {
+	query := r.db.Model(&entity.User{})
+	if filter.Deleted {
+		query = query.Unscoped().Where("users.deleted_at IS NOT NULL")
+	}
+	if filter.Query != "" {
+		like := "%" + likeEscaper.Replace(strings.ToLower(filter.Query)) + "%"
+		query = query.Where(
+			`(LOWER(users.email) LIKE ? ESCAPE '\' OR LOWER(users.username) LIKE ? ESCAPE '\' OR `+
+				`LOWER(users.first_name) LIKE ? ESCAPE '\' OR LOWER(users.last_name) LIKE ? ESCAPE '\')`,
+			like, like, like, like,
+		)
+	}
+	if filter.Status != "" {
+		query = query.Where("users.status = ?", filter.Status)
+	}
+	if filter.RoleID != 0 {
+		query = query.Where("users.id IN (?)", r.db.Table("user_roles").Select("user_id").Where("role_id = ?", filter.RoleID).Where(activeGrant, time.Now()))
+	}
+	if filter.EmailVerified != nil {
+		query = query.Where("users.email_verified = ?", *filter.EmailVerified)
+	}
+
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return nil, 0, errors.ErrDatabase
+	}
+
+	var users []entity.User
+	offset := (filter.Page - 1) * filter.Limit
+	result := query.Preload("Roles").Order("users.id").Limit(filter.Limit).Offset(offset).Find(&users)
+	if result.Error != nil {
+		return nil, 0, errors.ErrDatabase
+	}
+
+	return users, count, nil
+}
+
+// likeEscaper escapes the LIKE wildcards in user input
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (r *userRepository) FindByIDWithRoles(id uint) (*entity.User, error) {
+	var user entity.User
+	result := r.db.Preload("Roles").First(&user, id)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, errors.ErrUserNotFound
+		}
+		return nil, errors.ErrDatabase
+	}
+	return &user, nil
+}
+
+// Restore undoes a soft delete. ErrUserNotFound is returned unless a deleted
+// user with the ID exists.
+func (r *userRepository) Restore(id uint) error {
+	result := r.db.Unscoped().Model(&entity.User{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return errors.ErrDatabase
+	}
+	if result.RowsAffected == 0 {
+		return errors.ErrUserNotFound
+	}
+	return nil
+}
+
+// SetActive activates or deactivates the account, keeping its status in step
+func (r *userRepository) SetActive(id uint, active bool) error {
+	status := entity.UserStatusActive
+	if !active {
+		status = entity.UserStatusInactive
+	}
+
+	result := r.db.Model(&entity.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"active": active,
+		"status": status,
+	})
+	if result.Error != nil {
+		return errors.ErrDatabase
+	}
+	return nil
+}
+
+func (r *userRepository) SetPasswordResetRequired(id uint, required bool) error {
+	result := r.db.Model(&entity.User{}).Where("id = ?", id).Update("password_reset_required", required)
+	if result.Error != nil {
+		return errors.ErrDatabase
+	}
+	return nil
+}
+
+// FindRoleGrants returns the user's role grants, expired ones included, with
+// their roles
+func (r *userRepository) FindRoleGrants(userID uint) ([]entity.UserRole, error) {
+	var grants []entity.UserRole
+	result := r.db.Preload("Role").Where("user_id = ?", userID).Order("granted_at").Find(&grants)
+	if result.Error != nil {
+		return nil, errors.ErrDatabase
+	}
+	return grants, nil
+}
+
+// CleanupExpiredRoleGrants deletes role grants that have expired
+func (r *userRepository) CleanupExpiredRoleGrants() error {
+	result := r.db.Where("expires_at IS NOT NULL AND expires_at <= ?", time.Now()).Delete(&entity.UserRole{})
+	if result.Error != nil {
+		return errors.ErrDatabase
+	}
+	return nil
+}
+
+func (r *userRepository) UpdateAttributes(id uint, attributes map[string]string) error {
+	data, err := json.Marshal(attributes)
+	if err != nil {
+		return errors.ErrInvalidInput
+	}
+
+	result := r.db.Model(&entity.User{}).Where("id = ?", id).Update("attributes", string(data))
+	if result.Error != nil {
+		return errors.ErrDatabase
+	}
+	return nil
+}
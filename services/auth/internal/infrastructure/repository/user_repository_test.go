@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+
+	"minisapi/services/auth/internal/pkg/errors"
+
+	"gorm.io/gorm"
+)
+
+// TestRestoreOnlyMatchesDeletedUsers checks that Restore only clears the
+// deletion of a soft-deleted user and reports ErrUserNotFound when no row
+// matched, as for an unknown ID
+func TestRestoreOnlyMatchesDeletedUsers(t *testing.T) {
+	// Updates run in a transaction by default, which needs a connection
+	db := dryRunDB(t).Session(&gorm.Session{SkipDefaultTransaction: true})
+
+	var statements []string
+	if err := db.Callback().Update().After("gorm:update").Register("test:capture", func(tx *gorm.DB) {
+		statements = append(statements, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+	}); err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	// A dry run affects no rows, like an ID no deleted user has
+	if err := NewUserRepository(db).Restore(99); err != errors.ErrUserNotFound {
+		t.Errorf("Restore = %v, want ErrUserNotFound", err)
+	}
+
+	want := `WHERE id = 99 AND deleted_at IS NOT NULL`
+	if len(statements) != 1 || !strings.HasPrefix(statements[0], `UPDATE "users" SET "deleted_at"=NULL`) ||
+		!strings.HasSuffix(statements[0], want) {
+		t.Errorf("statements = %q, want an update of the deleted user %s", statements, want)
+	}
+}
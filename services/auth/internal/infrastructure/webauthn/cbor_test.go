@@ -0,0 +1,48 @@
+package webauthn
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	// {1: 2, 3: -7, "k": h'0102', "t": true} followed by 0xff
+	data := []byte{0xa4, 0x01, 0x02, 0x03, 0x26, 0x61, 'k', 0x42, 0x01, 0x02, 0x61, 't', 0xf5, 0xff}
+
+	item, rest, err := decodeCBOR(data)
+	if err != nil {
+		t.Fatalf("decodeCBOR: %v", err)
+	}
+	m, err := cborMapOf(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m[int64(1)] != int64(2) || m[int64(3)] != int64(-7) || !bytes.Equal(m["k"].([]byte), []byte{1, 2}) || m["t"] != true {
+		t.Fatalf("decoded %v", m)
+	}
+	if !bytes.Equal(rest, []byte{0xff}) {
+		t.Fatalf("rest = %x, want ff", rest)
+	}
+}
+
+func TestDecodeCBORRejectsMalformedInput(t *testing.T) {
+	tests := map[string][]byte{
+		"truncated string":    {0x45, 0x01, 0x02},
+		"truncated argument":  {0x19, 0x01},
+		"array longer":        {0x9a, 0xff, 0xff, 0xff, 0xff},
+		"indefinite length":   {0x5f, 0x41, 0x01, 0xff},
+		"duplicate map key":   {0xa2, 0x01, 0x01, 0x01, 0x02},
+		"byte string map key": {0xa1, 0x41, 0x01, 0x01},
+		"nested too deeply":   append(bytes.Repeat([]byte{0x81}, maxCBORDepth+2), 0x01),
+		"tag":                 {0xc0, 0x01},
+		"empty":               {},
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := decodeCBOR(data); err == nil {
+				t.Fatal("decodeCBOR accepted malformed input")
+			}
+		})
+	}
+}
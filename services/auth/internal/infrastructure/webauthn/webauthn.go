@@ -0,0 +1,493 @@
+// Package webauthn implements the relying party side of WebAuthn
+// registration and authentication ceremonies for passkeys
+// (https://www.w3.org/TR/webauthn-3/).
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"minisapi/services/auth/internal/configs"
+)
+
+// User verification requirements
+const (
+	UserVerificationRequired    = "required"
+	UserVerificationPreferred   = "preferred"
+	UserVerificationDiscouraged = "discouraged"
+)
+
+// maxCredentialIDLength is the longest credential ID authenticators may use
+const maxCredentialIDLength = 1023
+
+// Authenticator data flags
+const (
+	flagUserPresent    = 0x01
+	flagUserVerified   = 0x04
+	flagBackupEligible = 0x08
+	flagBackedUp       = 0x10
+	flagAttestedData   = 0x40
+	flagExtensionData  = 0x80
+)
+
+// RelyingParty verifies ceremonies for one relying party ID and the origins
+// allowed to use it
+type RelyingParty struct {
+	id      string
+	name    string
+	origins []string
+	timeout time.Duration
+}
+
+// NewRelyingParty creates a relying party from its configuration
+func NewRelyingParty(cfg configs.WebAuthnConfig) *RelyingParty {
+	return &RelyingParty{
+		id:      cfg.RPID,
+		name:    cfg.RPName,
+		origins: cfg.Origins,
+		timeout: cfg.ChallengeTTL,
+	}
+}
+
+// User is the account a credential is registered for. The ID is the user
+// handle, which authenticators return when signing in without a username.
+type User struct {
+	ID          []byte
+	Name        string
+	DisplayName string
+}
+
+// CredentialDescriptor identifies a registered credential
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// NewCredentialDescriptor describes a credential by its base64url ID
+func NewCredentialDescriptor(id string, transports []string) CredentialDescriptor {
+	return CredentialDescriptor{Type: "public-key", ID: id, Transports: transports}
+}
+
+// CreationOptions are the options of navigator.credentials.create, in the
+// JSON form accepted by PublicKeyCredential.parseCreationOptionsFromJSON
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// RequestOptions are the options of navigator.credentials.get, in the JSON
+// form accepted by PublicKeyCredential.parseRequestOptionsFromJSON
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// CreationOptions returns the options to register a discoverable
+// credential for the user. Credentials in exclude are already registered
+// and are not created again on the same authenticator.
+func (rp *RelyingParty) CreationOptions(challenge string, user User, exclude []CredentialDescriptor) *CreationOptions {
+	params := make([]CredentialParameter, 0, len(supportedAlgorithms))
+	for _, alg := range supportedAlgorithms {
+		params = append(params, CredentialParameter{Type: "public-key", Alg: alg})
+	}
+	if exclude == nil {
+		exclude = []CredentialDescriptor{}
+	}
+
+	return &CreationOptions{
+		Challenge: challenge,
+		RP:        RelyingPartyEntity{ID: rp.id, Name: rp.name},
+		User: UserEntity{
+			ID:          base64.RawURLEncoding.EncodeToString(user.ID),
+			Name:        user.Name,
+			DisplayName: user.DisplayName,
+		},
+		PubKeyCredParams:   params,
+		Timeout:            rp.timeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   UserVerificationPreferred,
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions returns the options to sign in with one of the allowed
+// credentials, or with any discoverable credential when allow is empty
+func (rp *RelyingParty) RequestOptions(challenge string, allow []CredentialDescriptor, userVerification string) *RequestOptions {
+	if allow == nil {
+		allow = []CredentialDescriptor{}
+	}
+	return &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          rp.timeout.Milliseconds(),
+		RPID:             rp.id,
+		AllowCredentials: allow,
+		UserVerification: userVerification,
+	}
+}
+
+// RegistrationResponse is the credential returned by
+// navigator.credentials.create, as serialized by PublicKeyCredential.toJSON
+type RegistrationResponse struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject"`
+		Transports        []string `json:"transports"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the credential returned by navigator.credentials.get,
+// as serialized by PublicKeyCredential.toJSON
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+// Credential is a newly registered credential
+type Credential struct {
+	ID []byte
+	// PublicKey is the COSE encoded public key
+	PublicKey  []byte
+	Algorithm  int
+	SignCount  uint32
+	AAGUID     []byte
+	Transports []string
+	// BackupEligible marks credentials that can be synced between devices,
+	// and BackedUp those that currently are
+	BackupEligible bool
+	BackedUp       bool
+}
+
+// Assertion is the outcome of a verified authentication ceremony
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+	BackedUp     bool
+}
+
+// clientData is the client data the authenticator signed over (CollectedClientData)
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// authenticatorData is the parsed authenticator data
+type authenticatorData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+	// Set when flagAttestedData is
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte
+}
+
+// Challenge returns the challenge the response answers, to look up the
+// ceremony it belongs to. The response is not verified.
+func (r *RegistrationResponse) Challenge() (string, error) {
+	data, err := parseClientData(r.Response.ClientDataJSON)
+	if err != nil {
+		return "", err
+	}
+	return data.Challenge, nil
+}
+
+// Challenge returns the challenge the response answers, to look up the
+// ceremony it belongs to. The response is not verified.
+func (r *AssertionResponse) Challenge() (string, error) {
+	data, err := parseClientData(r.Response.ClientDataJSON)
+	if err != nil {
+		return "", err
+	}
+	return data.Challenge, nil
+}
+
+// CredentialID returns the base64url ID of the credential that signed in
+func (r *AssertionResponse) CredentialID() (string, error) {
+	id, err := decodeBase64URL(r.ID)
+	if err != nil || len(id) == 0 || len(id) > maxCredentialIDLength {
+		return "", fmt.Errorf("invalid credential ID")
+	}
+	return base64.RawURLEncoding.EncodeToString(id), nil
+}
+
+// UserHandle returns the user handle the authenticator returned, if any
+func (r *AssertionResponse) UserHandle() ([]byte, error) {
+	return decodeBase64URL(r.Response.UserHandle)
+}
+
+// VerifyRegistration verifies a registration ceremony started with the
+// given challenge and returns the new credential. Attestation is not
+// requested, so attestation statements are ignored and the authenticator
+// is not trusted for anything beyond holding the key.
+func (rp *RelyingParty) VerifyRegistration(r *RegistrationResponse, challenge string, userVerification string) (*Credential, error) {
+	if r.Type != "public-key" {
+		return nil, fmt.Errorf("unexpected credential type %q", r.Type)
+	}
+	if err := rp.verifyClientData(r.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	raw, err := decodeBase64URL(r.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation object")
+	}
+	item, rest, err := decodeCBOR(raw)
+	if err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("invalid attestation object")
+	}
+	attestation, err := cborMapOf(item)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation object")
+	}
+	if _, ok := attestation["fmt"].(string); !ok {
+		return nil, fmt.Errorf("attestation object has no format")
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("attestation object has no authenticator data")
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(authData, userVerification); err != nil {
+		return nil, err
+	}
+	if authData.flags&flagAttestedData == 0 {
+		return nil, fmt.Errorf("authenticator data has no credential")
+	}
+
+	id, err := decodeBase64URL(r.ID)
+	if err != nil || !bytes.Equal(id, authData.credentialID) {
+		return nil, fmt.Errorf("credential ID does not match the authenticator data")
+	}
+
+	key, err := parseCOSEKey(authData.publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:             authData.credentialID,
+		PublicKey:      authData.publicKey,
+		Algorithm:      key.alg,
+		SignCount:      authData.signCount,
+		AAGUID:         authData.aaguid,
+		Transports:     r.Response.Transports,
+		BackupEligible: authData.flags&flagBackupEligible != 0,
+		BackedUp:       authData.flags&flagBackedUp != 0,
+	}, nil
+}
+
+// VerifyAssertion verifies an authentication ceremony started with the
+// given challenge against the stored public key and sign counter of the
+// credential. A counter that does not increase means the credential may
+// have been cloned; authenticators that do not count report zero.
+func (rp *RelyingParty) VerifyAssertion(r *AssertionResponse, challenge string, publicKey []byte, signCount uint32, userVerification string) (*Assertion, error) {
+	if r.Type != "public-key" {
+		return nil, fmt.Errorf("unexpected credential type %q", r.Type)
+	}
+	if err := rp.verifyClientData(r.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return nil, err
+	}
+
+	rawAuthData, err := decodeBase64URL(r.Response.AuthenticatorData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authenticator data")
+	}
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(authData, userVerification); err != nil {
+		return nil, err
+	}
+
+	key, err := parseCOSEKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	clientDataJSON, _ := decodeBase64URL(r.Response.ClientDataJSON)
+	signature, err := decodeBase64URL(r.Response.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature")
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), rawAuthData...), clientDataHash[:]...)
+	if !key.verify(signed, signature) {
+		return nil, fmt.Errorf("invalid signature")
+	}
+
+	if (authData.signCount != 0 || signCount != 0) && authData.signCount <= signCount {
+		return nil, fmt.Errorf("sign counter did not increase")
+	}
+
+	return &Assertion{
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&flagUserVerified != 0,
+		BackedUp:     authData.flags&flagBackedUp != 0,
+	}, nil
+}
+
+// verifyClientData checks the ceremony type, challenge and origin the
+// client collected
+func (rp *RelyingParty) verifyClientData(encoded, ceremony, challenge string) error {
+	data, err := parseClientData(encoded)
+	if err != nil {
+		return err
+	}
+	if data.Type != ceremony {
+		return fmt.Errorf("unexpected ceremony %q", data.Type)
+	}
+	if subtle.ConstantTimeCompare([]byte(data.Challenge), []byte(challenge)) != 1 {
+		return fmt.Errorf("challenge mismatch")
+	}
+	if data.CrossOrigin {
+		return fmt.Errorf("cross-origin ceremonies are not allowed")
+	}
+	for _, origin := range rp.origins {
+		if data.Origin == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("origin %q is not allowed", data.Origin)
+}
+
+// verifyAuthenticatorData checks that the credential is scoped to the
+// relying party and that the user was present, and verified if required
+func (rp *RelyingParty) verifyAuthenticatorData(authData *authenticatorData, userVerification string) error {
+	rpIDHash := sha256.Sum256([]byte(rp.id))
+	if subtle.ConstantTimeCompare(authData.rpIDHash, rpIDHash[:]) != 1 {
+		return fmt.Errorf("credential is scoped to another relying party")
+	}
+	if authData.flags&flagUserPresent == 0 {
+		return fmt.Errorf("user was not present")
+	}
+	if userVerification == UserVerificationRequired && authData.flags&flagUserVerified == 0 {
+		return fmt.Errorf("user was not verified")
+	}
+	if authData.flags&flagBackedUp != 0 && authData.flags&flagBackupEligible == 0 {
+		return fmt.Errorf("credential is backed up but not backup eligible")
+	}
+	return nil
+}
+
+func parseClientData(encoded string) (*clientData, error) {
+	raw, err := decodeBase64URL(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client data")
+	}
+	var data clientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("invalid client data")
+	}
+	return &data, nil
+}
+
+// parseAuthenticatorData parses authenticator data, including the attested
+// credential of a registration
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, fmt.Errorf("authenticator data is too short")
+	}
+	authData := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+
+	if authData.flags&flagAttestedData != 0 {
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("attested credential data is too short")
+		}
+		authData.aaguid = rest[:16]
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength == 0 || idLength > maxCredentialIDLength || len(rest) < idLength {
+			return nil, fmt.Errorf("invalid credential ID length")
+		}
+		authData.credentialID = rest[:idLength]
+		rest = rest[idLength:]
+
+		// The key is as long as its CBOR encoding
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid credential public key: %v", err)
+		}
+		authData.publicKey = rest[:len(rest)-len(after)]
+		rest = after
+	}
+
+	if authData.flags&flagExtensionData != 0 {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid extension data: %v", err)
+		}
+		rest = after
+	}
+
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("trailing authenticator data")
+	}
+	return authData, nil
+}
+
+// decodeBase64URL decodes base64url with or without padding
+func decodeBase64URL(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
@@ -0,0 +1,195 @@
+package webauthn_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"minisapi/services/auth/internal/configs"
+	"minisapi/services/auth/internal/infrastructure/webauthn"
+	"minisapi/services/auth/internal/infrastructure/webauthn/webauthntest"
+)
+
+const testOrigin = "https://app.example.com"
+
+func newTestRelyingParty() *webauthn.RelyingParty {
+	return webauthn.NewRelyingParty(configs.WebAuthnConfig{
+		RPID:         "example.com",
+		RPName:       "Example",
+		Origins:      []string{testOrigin},
+		ChallengeTTL: time.Minute,
+	})
+}
+
+var testUser = webauthn.User{ID: []byte{0, 0, 0, 0, 0, 0, 0, 7}, Name: "jane@example.com", DisplayName: "Jane Doe"}
+
+// register runs a registration ceremony and returns the verified credential
+func register(t *testing.T, rp *webauthn.RelyingParty, authenticator *webauthntest.Authenticator) *webauthn.Credential {
+	t.Helper()
+	resp := authenticator.Register(rp.CreationOptions("register-challenge", testUser, nil))
+	cred, err := rp.VerifyRegistration(resp, "register-challenge", webauthn.UserVerificationPreferred)
+	if err != nil {
+		t.Fatalf("VerifyRegistration: %v", err)
+	}
+	return cred
+}
+
+func TestCeremonies(t *testing.T) {
+	for _, alg := range []int{webauthn.AlgES256, webauthn.AlgEdDSA, webauthn.AlgRS256} {
+		rp := newTestRelyingParty()
+		authenticator := webauthntest.NewAuthenticator(t, testOrigin)
+		authenticator.Algorithm = alg
+
+		cred := register(t, rp, authenticator)
+		if cred.Algorithm != alg || cred.SignCount != 0 || cred.BackupEligible || len(cred.Transports) == 0 {
+			t.Fatalf("credential = %+v, want a device-bound credential with algorithm %d", cred, alg)
+		}
+
+		signCount := cred.SignCount
+		for i := 0; i < 2; i++ {
+			resp := authenticator.SignIn(rp.RequestOptions("login-challenge", nil, webauthn.UserVerificationRequired))
+			if challenge, err := resp.Challenge(); err != nil || challenge != "login-challenge" {
+				t.Fatalf("Challenge = %q, %v", challenge, err)
+			}
+			if handle, err := resp.UserHandle(); err != nil || string(handle) != string(testUser.ID) {
+				t.Fatalf("UserHandle = %v, %v", handle, err)
+			}
+			if id, err := resp.CredentialID(); err != nil || id != base64.RawURLEncoding.EncodeToString(cred.ID) {
+				t.Fatalf("CredentialID = %q, %v", id, err)
+			}
+
+			assertion, err := rp.VerifyAssertion(resp, "login-challenge", cred.PublicKey, signCount, webauthn.UserVerificationRequired)
+			if err != nil {
+				t.Fatalf("VerifyAssertion with algorithm %d: %v", alg, err)
+			}
+			if assertion.SignCount <= signCount || !assertion.UserVerified {
+				t.Fatalf("assertion = %+v, want an increased counter and a verified user", assertion)
+			}
+			signCount = assertion.SignCount
+		}
+	}
+}
+
+func TestSyncedPasskey(t *testing.T) {
+	rp := newTestRelyingParty()
+	authenticator := webauthntest.NewAuthenticator(t, testOrigin)
+	authenticator.Synced = true
+
+	cred := register(t, rp, authenticator)
+	if !cred.BackupEligible || !cred.BackedUp {
+		t.Fatalf("credential = %+v, want a backed up credential", cred)
+	}
+
+	// Synced passkeys do not count signatures
+	for i := 0; i < 2; i++ {
+		resp := authenticator.SignIn(rp.RequestOptions("login-challenge", nil, webauthn.UserVerificationRequired))
+		if _, err := rp.VerifyAssertion(resp, "login-challenge", cred.PublicKey, 0, webauthn.UserVerificationRequired); err != nil {
+			t.Fatalf("VerifyAssertion: %v", err)
+		}
+	}
+}
+
+func TestVerifyRegistrationRejects(t *testing.T) {
+	tests := []struct {
+		name             string
+		modify           func(rp *configs.WebAuthnConfig, authenticator *webauthntest.Authenticator)
+		challenge        string
+		userVerification string
+	}{
+		{"other challenge", nil, "other-challenge", webauthn.UserVerificationPreferred},
+		{"other origin", func(_ *configs.WebAuthnConfig, a *webauthntest.Authenticator) { a.Origin = "https://evil.example.net" }, "register-challenge", webauthn.UserVerificationPreferred},
+		{"other relying party", func(cfg *configs.WebAuthnConfig, _ *webauthntest.Authenticator) { cfg.RPID = "evil.example.net" }, "register-challenge", webauthn.UserVerificationPreferred},
+		{"user not verified", func(_ *configs.WebAuthnConfig, a *webauthntest.Authenticator) { a.VerifiesUser = false }, "register-challenge", webauthn.UserVerificationRequired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticator := webauthntest.NewAuthenticator(t, testOrigin)
+			cfg := configs.WebAuthnConfig{RPID: "example.com", Origins: []string{testOrigin}}
+			if tt.modify != nil {
+				tt.modify(&cfg, authenticator)
+			}
+
+			// The authenticator scopes the credential to the RP ID of the
+			// options, which the verifying relying party may not share
+			resp := authenticator.Register(webauthn.NewRelyingParty(cfg).CreationOptions("register-challenge", testUser, nil))
+			if _, err := newTestRelyingParty().VerifyRegistration(resp, tt.challenge, tt.userVerification); err == nil {
+				t.Fatal("VerifyRegistration accepted an invalid registration")
+			}
+		})
+	}
+
+	t.Run("login response", func(t *testing.T) {
+		rp := newTestRelyingParty()
+		authenticator := webauthntest.NewAuthenticator(t, testOrigin)
+		register(t, rp, authenticator)
+
+		assertion := authenticator.SignIn(rp.RequestOptions("register-challenge", nil, webauthn.UserVerificationPreferred))
+		resp := &webauthn.RegistrationResponse{ID: assertion.ID, Type: assertion.Type}
+		resp.Response.ClientDataJSON = assertion.Response.ClientDataJSON
+		resp.Response.AttestationObject = assertion.Response.AuthenticatorData
+		if _, err := rp.VerifyRegistration(resp, "register-challenge", webauthn.UserVerificationPreferred); err == nil {
+			t.Fatal("VerifyRegistration accepted an assertion")
+		}
+	})
+}
+
+func TestVerifyAssertionRejects(t *testing.T) {
+	rp := newTestRelyingParty()
+	authenticator := webauthntest.NewAuthenticator(t, testOrigin)
+	cred := register(t, rp, authenticator)
+	other := register(t, rp, webauthntest.NewAuthenticator(t, testOrigin))
+
+	signIn := func() *webauthn.AssertionResponse {
+		return authenticator.SignIn(rp.RequestOptions("login-challenge", nil, webauthn.UserVerificationRequired))
+	}
+
+	tests := []struct {
+		name             string
+		resp             func() *webauthn.AssertionResponse
+		publicKey        []byte
+		signCount        uint32
+		challenge        string
+		userVerification string
+	}{
+		{"other challenge", signIn, cred.PublicKey, 0, "other-challenge", webauthn.UserVerificationRequired},
+		{"key of another credential", signIn, other.PublicKey, 0, "login-challenge", webauthn.UserVerificationRequired},
+		{"counter did not increase", signIn, cred.PublicKey, 1000, "login-challenge", webauthn.UserVerificationRequired},
+		{"tampered client data", func() *webauthn.AssertionResponse {
+			resp := signIn()
+			data, _ := base64.RawURLEncoding.DecodeString(resp.Response.ClientDataJSON)
+			var clientData map[string]interface{}
+			_ = json.Unmarshal(data, &clientData)
+			clientData["note"] = "not what was signed"
+			data, _ = json.Marshal(clientData)
+			resp.Response.ClientDataJSON = base64.RawURLEncoding.EncodeToString(data)
+			return resp
+		}, cred.PublicKey, 0, "login-challenge", webauthn.UserVerificationRequired},
+		{"registration response", func() *webauthn.AssertionResponse {
+			reg := webauthntest.NewAuthenticator(t, testOrigin).Register(rp.CreationOptions("login-challenge", testUser, nil))
+			resp := signIn()
+			resp.Response.ClientDataJSON = reg.Response.ClientDataJSON
+			return resp
+		}, cred.PublicKey, 0, "login-challenge", webauthn.UserVerificationRequired},
+		{"user not verified", func() *webauthn.AssertionResponse {
+			authenticator.VerifiesUser = false
+			defer func() { authenticator.VerifiesUser = true }()
+			return signIn()
+		}, cred.PublicKey, 0, "login-challenge", webauthn.UserVerificationRequired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := rp.VerifyAssertion(tt.resp(), tt.challenge, tt.publicKey, tt.signCount, tt.userVerification); err == nil {
+				t.Fatal("VerifyAssertion accepted an invalid assertion")
+			}
+		})
+	}
+
+	// Presence alone is enough when verification is not required
+	authenticator.VerifiesUser = false
+	if _, err := rp.VerifyAssertion(signIn(), "login-challenge", cred.PublicKey, 0, webauthn.UserVerificationDiscouraged); err != nil {
+		t.Fatalf("VerifyAssertion without user verification: %v", err)
+	}
+}
@@ -0,0 +1,264 @@
+// Package webauthntest provides a software authenticator, so that passkey
+// ceremonies can be tested without a browser or security key.
+package webauthntest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"sync"
+	"testing"
+
+	"minisapi/services/auth/internal/infrastructure/webauthn"
+)
+
+// Authenticator is a platform authenticator holding discoverable
+// credentials, as a browser would use it on the given origin
+type Authenticator struct {
+	Origin string
+	// Algorithm is the COSE algorithm of new credentials
+	Algorithm int
+	// VerifiesUser makes the authenticator verify the user, such as with a
+	// PIN or a fingerprint, on every ceremony
+	VerifiesUser bool
+	// Synced makes new credentials backed up passkeys, which report a sign
+	// counter of zero, rather than device-bound ones that count signatures
+	Synced bool
+
+	t           testing.TB
+	mu          sync.Mutex
+	credentials []*credential
+}
+
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	alg        int
+	key        crypto.Signer
+	synced     bool
+	counter    uint32
+}
+
+// NewAuthenticator creates an authenticator that signs with ES256 and
+// verifies the user
+func NewAuthenticator(t testing.TB, origin string) *Authenticator {
+	return &Authenticator{
+		Origin:       origin,
+		Algorithm:    webauthn.AlgES256,
+		VerifiesUser: true,
+		t:            t,
+	}
+}
+
+// Register creates a credential as navigator.credentials.create would. A
+// credential held for the same relying party and user is replaced.
+func (a *Authenticator) Register(options *webauthn.CreationOptions) *webauthn.RegistrationResponse {
+	a.t.Helper()
+
+	offered := false
+	for _, param := range options.PubKeyCredParams {
+		offered = offered || param.Alg == a.Algorithm
+	}
+	if !offered {
+		a.t.Fatalf("algorithm %d is not offered", a.Algorithm)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, excluded := range options.ExcludeCredentials {
+		if a.find(options.RP.ID, excluded.ID) != nil {
+			a.t.Fatalf("authenticator already holds excluded credential %s", excluded.ID)
+		}
+	}
+
+	userHandle, err := base64.RawURLEncoding.DecodeString(options.User.ID)
+	if err != nil || len(userHandle) == 0 || len(userHandle) > 64 {
+		a.t.Fatalf("invalid user handle %q", options.User.ID)
+	}
+
+	cred := &credential{
+		id:         randomBytes(a.t, 32),
+		rpID:       options.RP.ID,
+		userHandle: userHandle,
+		alg:        a.Algorithm,
+		key:        generateKey(a.t, a.Algorithm),
+		synced:     a.Synced,
+	}
+	kept := a.credentials[:0]
+	for _, c := range a.credentials {
+		if c.rpID != cred.rpID || string(c.userHandle) != string(cred.userHandle) {
+			kept = append(kept, c)
+		}
+	}
+	a.credentials = append(kept, cred)
+
+	// The attested credential data: an all-zero AAGUID, the credential ID
+	// and the COSE public key
+	attested := make([]byte, 18, 18+len(cred.id))
+	binary.BigEndian.PutUint16(attested[16:], uint16(len(cred.id)))
+	attested = append(append(attested, cred.id...), coseKey(a.t, cred.alg, cred.key.Public())...)
+
+	authData := a.authenticatorData(cred, 0x40)
+	authData = append(authData, attested...)
+
+	resp := &webauthn.RegistrationResponse{ID: encode(cred.id), Type: "public-key"}
+	resp.Response.ClientDataJSON = encode(a.clientData("webauthn.create", options.Challenge))
+	resp.Response.AttestationObject = encode(encodeCBOR(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	}))
+	resp.Response.Transports = []string{"internal", "hybrid"}
+	return resp
+}
+
+// SignIn signs in as navigator.credentials.get would, with the first
+// allowed credential it holds, or with its newest discoverable credential
+// for the relying party when the options allow any
+func (a *Authenticator) SignIn(options *webauthn.RequestOptions) *webauthn.AssertionResponse {
+	a.t.Helper()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var cred *credential
+	for _, allowed := range options.AllowCredentials {
+		if cred = a.find(options.RPID, allowed.ID); cred != nil {
+			break
+		}
+	}
+	if len(options.AllowCredentials) == 0 {
+		for _, c := range a.credentials {
+			if c.rpID == options.RPID {
+				cred = c
+			}
+		}
+	}
+	if cred == nil {
+		a.t.Fatal("authenticator holds no usable credential")
+	}
+
+	if !cred.synced {
+		cred.counter++
+	}
+	authData := a.authenticatorData(cred, 0)
+	clientData := a.clientData("webauthn.get", options.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+
+	resp := &webauthn.AssertionResponse{ID: encode(cred.id), Type: "public-key"}
+	resp.Response.ClientDataJSON = encode(clientData)
+	resp.Response.AuthenticatorData = encode(authData)
+	resp.Response.Signature = encode(sign(a.t, cred.alg, cred.key, append(authData, clientDataHash[:]...)))
+	resp.Response.UserHandle = encode(cred.userHandle)
+	return resp
+}
+
+func (a *Authenticator) find(rpID, id string) *credential {
+	for _, c := range a.credentials {
+		if c.rpID == rpID && encode(c.id) == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// authenticatorData encodes the RP ID hash, the flags and the counter
+func (a *Authenticator) authenticatorData(cred *credential, flags byte) []byte {
+	flags |= 0x01
+	if a.VerifiesUser {
+		flags |= 0x04
+	}
+	if cred.synced {
+		flags |= 0x08 | 0x10
+	}
+
+	rpIDHash := sha256.Sum256([]byte(cred.rpID))
+	data := append(rpIDHash[:], flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[33:], cred.counter)
+	return data
+}
+
+func (a *Authenticator) clientData(ceremony, challenge string) []byte {
+	data, err := json.Marshal(map[string]interface{}{
+		"type":        ceremony,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	if err != nil {
+		a.t.Fatalf("encode client data: %v", err)
+	}
+	return data
+}
+
+func generateKey(t testing.TB, alg int) crypto.Signer {
+	var key crypto.Signer
+	var err error
+	switch alg {
+	case webauthn.AlgES256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case webauthn.AlgEdDSA:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case webauthn.AlgRS256:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		t.Fatalf("unsupported algorithm %d", alg)
+	}
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return key
+}
+
+// coseKey encodes a public key as a COSE_Key
+func coseKey(t testing.TB, alg int, public crypto.PublicKey) []byte {
+	switch key := public.(type) {
+	case *ecdsa.PublicKey:
+		return encodeCBOR(map[int]interface{}{1: 2, 3: alg, -1: 1, -2: key.X.FillBytes(make([]byte, 32)), -3: key.Y.FillBytes(make([]byte, 32))})
+	case ed25519.PublicKey:
+		return encodeCBOR(map[int]interface{}{1: 1, 3: alg, -1: 6, -2: []byte(key)})
+	case *rsa.PublicKey:
+		return encodeCBOR(map[int]interface{}{1: 3, 3: alg, -1: key.N.Bytes(), -2: big.NewInt(int64(key.E)).Bytes()})
+	default:
+		t.Fatalf("unsupported key %T", public)
+		return nil
+	}
+}
+
+func sign(t testing.TB, alg int, key crypto.Signer, data []byte) []byte {
+	var signature []byte
+	var err error
+	switch alg {
+	case webauthn.AlgEdDSA:
+		signature, err = key.Sign(rand.Reader, data, crypto.Hash(0))
+	default:
+		digest := sha256.Sum256(data)
+		signature, err = key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return signature
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func randomBytes(t testing.TB, n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("generate random bytes: %v", err)
+	}
+	return b
+}
@@ -0,0 +1,64 @@
+package webauthntest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// encodeCBOR encodes the values authenticators produce: integers, byte and
+// text strings, and maps keyed by int or string. Map keys are sorted so
+// the encoding is deterministic.
+func encodeCBOR(value interface{}) []byte {
+	switch v := value.(type) {
+	case int:
+		if v < 0 {
+			return cborHead(1, uint64(-1-v))
+		}
+		return cborHead(0, uint64(v))
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case map[int]interface{}:
+		keys := make([]int, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Ints(keys)
+		out := cborHead(5, uint64(len(v)))
+		for _, key := range keys {
+			out = append(append(out, encodeCBOR(key)...), encodeCBOR(v[key])...)
+		}
+		return out
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		out := cborHead(5, uint64(len(v)))
+		for _, key := range keys {
+			out = append(append(out, encodeCBOR(key)...), encodeCBOR(v[key])...)
+		}
+		return out
+	default:
+		panic(fmt.Sprintf("cbor: unsupported value %T", value))
+	}
+}
+
+func cborHead(major byte, arg uint64) []byte {
+	major <<= 5
+	switch {
+	case arg < 24:
+		return []byte{major | byte(arg)}
+	case arg <= 0xff:
+		return []byte{major | 24, byte(arg)}
+	case arg <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major | 25}, uint16(arg))
+	case arg <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major | 26}, uint32(arg))
+	default:
+		return binary.BigEndian.AppendUint64([]byte{major | 27}, arg)
+	}
+}
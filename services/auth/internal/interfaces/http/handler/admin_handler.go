@@ -0,0 +1,325 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/domain/usecase"
+	"minisapi/services/auth/internal/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxUserPageSize caps the page size of user searches
+const maxUserPageSize = 100
+
+// AdminHandler handles account management requests of administrators
+type AdminHandler struct {
+	userAdminUseCase usecase.UserAdminUseCase
+}
+
+// NewAdminHandler creates a new instance of AdminHandler
+func NewAdminHandler(userAdminUseCase usecase.UserAdminUseCase) *AdminHandler {
+	return &AdminHandler{
+		userAdminUseCase: userAdminUseCase,
+	}
+}
+
+// LockUserRequest represents the lock user request body
+type LockUserRequest struct {
+	// Duration is a Go duration such as "24h"; empty uses the maximum
+	// lockout duration
+	Duration string `json:"duration" example:"24h"`
+}
+
+// ServiceAccountRequest represents the create service account request body
+type ServiceAccountRequest struct {
+	Username string `json:"username" binding:"required,min=3,max=64,alphanum" example:"cideploy"`
+	Name     string `json:"name" binding:"max=255" example:"CI deployments"`
+}
+
+// UserAttributesRequest represents the set user attributes request body
+type UserAttributesRequest struct {
+	Attributes map[string]string `json:"attributes" binding:"required" example:"region:eu"`
+}
+
+// ListUsers searches users. Supported query parameters are q, status,
+// role_id, email_verified, deleted, page and limit.
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	filter := repository.UserFilter{
+		Query:  c.Query("q"),
+		Status: entity.UserStatus(c.Query("status")),
+	}
+
+	var err error
+	if filter.Page, err = strconv.Atoi(c.DefaultQuery("page", "1")); err != nil || filter.Page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrInvalidInput.Error()})
+		return
+	}
+	if filter.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "20")); err != nil || filter.Limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrInvalidInput.Error()})
+		return
+	}
+	if filter.Limit > maxUserPageSize {
+		filter.Limit = maxUserPageSize
+	}
+
+	if value := c.Query("role_id"); value != "" {
+		roleID, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrInvalidInput.Error()})
+			return
+		}
+		filter.RoleID = uint(roleID)
+	}
+	if value := c.Query("email_verified"); value != "" {
+		verified, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrInvalidInput.Error()})
+			return
+		}
+		filter.EmailVerified = &verified
+	}
+	if value := c.Query("deleted"); value != "" {
+		deleted, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrInvalidInput.Error()})
+			return
+		}
+		filter.Deleted = deleted
+	}
+
+	users, total, err := h.userAdminUseCase.SearchUsers(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  users,
+		"total": total,
+		"page":  filter.Page,
+		"limit": filter.Limit,
+	})
+}
+
+// CreateServiceAccount creates an account for automation. It has no
+// password; administrators create API keys for it.
+func (h *AdminHandler) CreateServiceAccount(c *gin.Context) {
+	var req ServiceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrValidation.Error()})
+		return
+	}
+
+	account, err := h.userAdminUseCase.CreateServiceAccount(c.Request.Context(), req.Username, req.Name)
+	if err != nil {
+		if err == errors.ErrUsernameExists {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, account)
+}
+
+// GetUser shows one user with their roles, role grants and active sessions
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	userID, ok := h.userID(c)
+	if !ok {
+		return
+	}
+
+	detail, err := h.userAdminUseCase.GetUser(c.Request.Context(), userID)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	sessions := make([]SessionResponse, 0, len(detail.Sessions))
+	for _, session := range detail.Sessions {
+		sessions = append(sessions, SessionResponse{
+			ID:         session.ID,
+			Device:     session.Device,
+			IP:         session.IP,
+			UserAgent:  session.UserAgent,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":     detail.User,
+		"grants":   detail.Grants,
+		"sessions": sessions,
+	})
+}
+
+// ActivateUser re-enables a deactivated account
+func (h *AdminHandler) ActivateUser(c *gin.Context) {
+	userID, ok := h.userID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.userAdminUseCase.ActivateUser(c.Request.Context(), userID); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account activated"})
+}
+
+// DeactivateUser disables an account and ends its sessions
+func (h *AdminHandler) DeactivateUser(c *gin.Context) {
+	userID, ok := h.otherUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.userAdminUseCase.DeactivateUser(c.Request.Context(), userID); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deactivated"})
+}
+
+// LockUser locks an account and ends its sessions
+func (h *AdminHandler) LockUser(c *gin.Context) {
+	userID, ok := h.otherUserID(c)
+	if !ok {
+		return
+	}
+
+	var req LockUserRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrValidation.Error()})
+			return
+		}
+	}
+
+	var duration time.Duration
+	if req.Duration != "" {
+		var err error
+		if duration, err = time.ParseDuration(req.Duration); err != nil || duration <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrInvalidInput.Error()})
+			return
+		}
+	}
+
+	if err := h.userAdminUseCase.LockUser(c.Request.Context(), userID, duration); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account locked"})
+}
+
+// ForcePasswordReset blocks password logins until the user resets their
+// password through the emailed link
+func (h *AdminHandler) ForcePasswordReset(c *gin.Context) {
+	userID, ok := h.userID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.userAdminUseCase.ForcePasswordReset(c.Request.Context(), userID); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset required"})
+}
+
+// DeleteUser soft-deletes an account and ends its sessions
+func (h *AdminHandler) DeleteUser(c *gin.Context) {
+	userID, ok := h.otherUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.userAdminUseCase.DeleteUser(c.Request.Context(), userID); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted"})
+}
+
+// RestoreUser undoes the soft delete of an account
+func (h *AdminHandler) RestoreUser(c *gin.Context) {
+	userID, ok := h.userID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.userAdminUseCase.RestoreUser(c.Request.Context(), userID); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account restored"})
+}
+
+// SetUserAttributes replaces the attributes access policies refer to, such
+// as the user's region
+func (h *AdminHandler) SetUserAttributes(c *gin.Context) {
+	userID, ok := h.userID(c)
+	if !ok {
+		return
+	}
+
+	var req UserAttributesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrValidation.Error()})
+		return
+	}
+
+	if err := h.userAdminUseCase.SetUserAttributes(c.Request.Context(), userID, req.Attributes); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attributes updated"})
+}
+
+// userID parses the user ID path parameter
+func (h *AdminHandler) userID(c *gin.Context) (uint, bool) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrInvalidInput.Error()})
+		return 0, false
+	}
+	return uint(userID), true
+}
+
+// otherUserID parses the user ID path parameter and refuses the caller's own
+// ID, so administrators cannot lock themselves out
+func (h *AdminHandler) otherUserID(c *gin.Context) (uint, bool) {
+	userID, ok := h.userID(c)
+	if !ok {
+		return 0, false
+	}
+
+	if userID == c.GetUint("user_id") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrCannotModifySelf.Error()})
+		return 0, false
+	}
+	return userID, true
+}
+
+func (h *AdminHandler) respondError(c *gin.Context, err error) {
+	if err == errors.ErrUserNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
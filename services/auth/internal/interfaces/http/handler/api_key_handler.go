@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"minisapi/services/auth/internal/common"
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/domain/service"
+	"minisapi/services/auth/internal/pkg/errors"
+	"minisapi/services/auth/internal/pkg/permission"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHandler handles the API keys of the caller, under the auth routes,
+// and of service accounts, under the admin routes
+type APIKeyHandler struct {
+	apiKeyService service.APIKeyService
+	userRepo      repository.UserRepository
+}
+
+// NewAPIKeyHandler creates a new instance of APIKeyHandler
+func NewAPIKeyHandler(apiKeyService service.APIKeyService, userRepo repository.UserRepository) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: apiKeyService,
+		userRepo:      userRepo,
+	}
+}
+
+// CreateAPIKeyRequest represents the create API key request body
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required,max=100" example:"ci-deploy"`
+	Scopes []string `json:"scopes" binding:"required,min=1" example:"user:read,role:read"`
+	// ExpiresAt limits the key's lifetime; omit it for a key that does not expire
+	ExpiresAt *time.Time `json:"expires_at" example:"2025-01-01T00:00:00Z"`
+}
+
+// Create godoc
+// @Summary Create an API key
+// @Description Create a named API key limited to the scopes. Callers may only include scopes they hold themselves. Under the admin routes the user must be a service account. The key is only returned once.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int false "User ID"
+// @Param request body CreateAPIKeyRequest true "Key details"
+// @Success 201 {object} entity.APIKey
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/auth/api-keys [post]
+// @Router /api/v1/admin/users/{id}/api-keys [post]
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, common.VALIDATION_ERROR)
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, common.VALIDATION_ERROR)
+		return
+	}
+
+	userID, ok := h.keyOwner(c)
+	if !ok {
+		return
+	}
+
+	// A key must not outgrow the credential it was created with, which may
+	// itself be a scoped key
+	granted := callerPermissions(c)
+	for _, scope := range req.Scopes {
+		if _, _, ok := permission.Split(scope); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrInvalidScope.Error()})
+			return
+		}
+		if !granted.Has(scope) {
+			c.JSON(http.StatusForbidden, common.FORBIDDEN)
+			return
+		}
+	}
+
+	key := &entity.APIKey{
+		UserID:    userID,
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+	}
+	raw, err := h.apiKeyService.Create(c.Request.Context(), key)
+	if err != nil {
+		if err == errors.ErrInvalidScope {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"api_key": key,
+		"key":     raw,
+	})
+}
+
+// List godoc
+// @Summary List API keys
+// @Description List the API keys that are not revoked, newest first
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int false "User ID"
+// @Success 200 {array} entity.APIKey
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/auth/api-keys [get]
+// @Router /api/v1/admin/users/{id}/api-keys [get]
+func (h *APIKeyHandler) List(c *gin.Context) {
+	userID, ok := h.keyOwner(c)
+	if !ok {
+		return
+	}
+
+	keys, err := h.apiKeyService.List(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": keys})
+}
+
+// Revoke godoc
+// @Summary Revoke an API key
+// @Description Revoke an API key; requests made with it are refused from then on
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int false "User ID"
+// @Param keyId path int true "API key ID"
+// @Success 200 {object} entity.MessageResponse
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/auth/api-keys/{keyId} [delete]
+// @Router /api/v1/admin/users/{id}/api-keys/{keyId} [delete]
+func (h *APIKeyHandler) Revoke(c *gin.Context) {
+	userID, ok := h.keyOwner(c)
+	if !ok {
+		return
+	}
+	keyID, ok := pathID(c, "keyId")
+	if !ok {
+		return
+	}
+
+	if err := h.apiKeyService.Revoke(c.Request.Context(), userID, keyID); err != nil {
+		if err == errors.ErrAPIKeyNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	c.JSON(http.StatusOK, common.SUCCESS)
+}
+
+// keyOwner returns the service account in the id path parameter on the
+// admin routes, or the caller on their own routes, answering the request if
+// the user does not exist. Administrators only manage the keys of service
+// accounts: a key for a person's account would let them act as that person.
+func (h *APIKeyHandler) keyOwner(c *gin.Context) (uint, bool) {
+	if c.Param("id") == "" {
+		return c.GetUint("user_id"), true
+	}
+
+	userID, ok := pathID(c, "id")
+	if !ok {
+		return 0, false
+	}
+	user, err := h.userRepo.FindByID(userID)
+	if err != nil {
+		if err == errors.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, common.USER_NOT_FOUND)
+			return 0, false
+		}
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return 0, false
+	}
+	if !user.IsServiceAccount() {
+		c.JSON(http.StatusForbidden, common.FORBIDDEN)
+		return 0, false
+	}
+	return userID, true
+}
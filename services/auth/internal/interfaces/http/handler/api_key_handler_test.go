@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/domain/service"
+	"minisapi/services/auth/internal/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestAdminAPIKeysOnlyForServiceAccounts checks that administrators can
+// manage the keys of service accounts but not those of people
+func TestAdminAPIKeysOnlyForServiceAccounts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	users := &userTable{users: map[uint]*entity.User{
+		1: {ID: 1, Username: "ci", Active: true, Type: entity.UserTypeService},
+		2: {ID: 2, Username: "jane", Active: true, Type: entity.UserTypeUser},
+		3: {ID: 3, Username: "admin", Active: true, Type: entity.UserTypeAdmin},
+	}}
+	keys := &memoryAPIKeyService{}
+	h := NewAPIKeyHandler(keys, users)
+
+	router := gin.New()
+	admin := router.Group("/api/v1/admin/users", withClaims(3, "user:read", "user:update", "authz:check"))
+	admin.GET("/:id/api-keys", h.List)
+	admin.POST("/:id/api-keys", h.Create)
+
+	tests := []struct {
+		name   string
+		userID uint
+		want   int
+	}{
+		{"service account", 1, http.StatusCreated},
+		{"person", 2, http.StatusForbidden},
+		{"administrator", 3, http.StatusForbidden},
+		{"unknown user", 99, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := fmt.Sprintf("/api/v1/admin/users/%d/api-keys", tt.userID)
+			if status := serve(router, http.MethodPost, path, map[string]interface{}{"name": "deploy", "scopes": []string{"authz:check"}}); status != tt.want {
+				t.Fatalf("create = %d, want %d", status, tt.want)
+			}
+			if status := serve(router, http.MethodGet, path, nil); tt.want == http.StatusForbidden && status != http.StatusForbidden {
+				t.Fatalf("list = %d, want 403", status)
+			}
+		})
+	}
+
+	if len(keys.created) != 1 || keys.created[0].UserID != 1 {
+		t.Fatalf("created keys = %+v, want one for the service account", keys.created)
+	}
+}
+
+type userTable struct {
+	repository.UserRepository
+	users map[uint]*entity.User
+}
+
+func (r *userTable) FindByID(id uint) (*entity.User, error) {
+	if user, ok := r.users[id]; ok {
+		return user, nil
+	}
+	return nil, errors.ErrUserNotFound
+}
+
+type memoryAPIKeyService struct {
+	service.APIKeyService
+	created []entity.APIKey
+}
+
+func (s *memoryAPIKeyService) Create(ctx context.Context, key *entity.APIKey) (string, error) {
+	key.ID = uint(len(s.created) + 1)
+	s.created = append(s.created, *key)
+	return service.APIKeyPrefix + "test", nil
+}
+
+func (s *memoryAPIKeyService) List(ctx context.Context, userID uint) ([]entity.APIKey, error) {
+	var keys []entity.APIKey
+	for _, key := range s.created {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
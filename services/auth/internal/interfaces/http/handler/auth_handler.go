@@ -1,10 +1,14 @@
 package handler
 
 import (
+	"encoding/base64"
 	"minisapi/services/auth/internal/domain/entity"
 	"minisapi/services/auth/internal/domain/usecase"
+	"minisapi/services/auth/internal/infrastructure/jwt"
 	"minisapi/services/auth/internal/pkg/errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -31,11 +35,21 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+type LoginTwoFactorRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required,max=32"`
+}
+
 type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
 type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=8"`
+}
+
+type ResendVerificationRequest struct {
 	Email string `json:"email" binding:"required,email"`
 }
 
@@ -48,8 +62,22 @@ type ChangePasswordRequest struct {
 	NewPassword string `json:"new_password" binding:"required,min=8"`
 }
 
-type EnableTwoFactorRequest struct {
-	Code string `json:"code" binding:"required,len=6"`
+// SwitchOrganizationRequest names the organization to scope the session to;
+// zero scopes it back to no organization
+type SwitchOrganizationRequest struct {
+	OrganizationID uint `json:"organization_id"`
+}
+
+// VerifyTwoFactorRequest carries the TOTP code confirming enrollment
+type VerifyTwoFactorRequest struct {
+	Code string `json:"code" binding:"required,max=32"`
+}
+
+// DisableTwoFactorRequest carries either a current TOTP or recovery code or
+// the account password
+type DisableTwoFactorRequest struct {
+	Code     string `json:"code" binding:"required_without=Password,max=32"`
+	Password string `json:"password" binding:"required_without=Code"`
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
@@ -81,24 +109,101 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	user, accessToken, refreshToken, err := h.authUseCase.Login(c.Request.Context(), req.Email, req.Password)
+	result, err := h.authUseCase.Login(c.Request.Context(), req.Email, req.Password, clientInfo(c))
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		c.JSON(loginErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if result.MFARequired() {
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required": true,
+			"mfa_token":    result.MFAToken,
+		})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"user":          user,
-		"access_token":  accessToken,
-		"refresh_token": refreshToken,
+		"user":          result.User,
+		"access_token":  result.AccessToken,
+		"refresh_token": result.RefreshToken,
 	})
 }
 
+// LoginTwoFactor exchanges an MFA challenge token and a TOTP or recovery
+// code for access and refresh tokens
+func (h *AuthHandler) LoginTwoFactor(c *gin.Context) {
+	var req LoginTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrValidation.Error()})
+		return
+	}
+
+	result, err := h.authUseCase.LoginTwoFactor(c.Request.Context(), req.MFAToken, req.Code, clientInfo(c))
+	if err != nil {
+		c.JSON(loginErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":          result.User,
+		"access_token":  result.AccessToken,
+		"refresh_token": result.RefreshToken,
+	})
+}
+
+// clientInfo describes the client of the request for session records
+func clientInfo(c *gin.Context) usecase.ClientInfo {
+	return usecase.ClientInfo{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
+
+// loginErrorStatus maps a login failure to its HTTP status
+func loginErrorStatus(err error) int {
+	switch err {
+	case errors.ErrAccountLocked:
+		return http.StatusLocked
+	case errors.ErrTooManySessions, errors.ErrUserInactive, errors.ErrPasswordResetRequired:
+		return http.StatusForbidden
+	case errors.ErrRateLimitExceeded:
+		return http.StatusTooManyRequests
+	case errors.ErrServiceUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusUnauthorized
+	}
+}
+
+// UnlockAccount lifts the lock of an account locked after failed logins
+func (h *AuthHandler) UnlockAccount(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrInvalidInput.Error()})
+		return
+	}
+
+	if err := h.authUseCase.UnlockAccount(c.Request.Context(), uint(userID)); err != nil {
+		if err == errors.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlocked"})
+}
+
 func (h *AuthHandler) Logout(c *gin.Context) {
-	userID := c.GetUint("user_id")
-	refreshToken := c.GetString("refresh_token")
+	claims, ok := c.MustGet("claims").(*jwt.Claims)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errors.ErrUnauthorized.Error()})
+		return
+	}
 
-	if err := h.authUseCase.Logout(c.Request.Context(), userID, refreshToken); err != nil {
+	if err := h.authUseCase.Logout(c.Request.Context(), claims); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -106,6 +211,126 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Logout successful"})
 }
 
+// LogoutAll ends every session of the current user
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	if err := h.authUseCase.LogoutAll(c.Request.Context(), userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out of all sessions"})
+}
+
+// SessionResponse is a session as shown to its owner
+type SessionResponse struct {
+	ID         uint       `json:"id"`
+	Device     string     `json:"device"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	Current    bool       `json:"current"`
+}
+
+// ListSessions lists the active sessions of the current user
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	currentSessionID := c.GetString("session_id")
+
+	sessions, err := h.authUseCase.ListSessions(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, SessionResponse{
+			ID:         session.ID,
+			Device:     session.Device,
+			IP:         session.IP,
+			UserAgent:  session.UserAgent,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.FamilyID != "" && session.FamilyID == currentSessionID,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": response})
+}
+
+// RevokeSession ends one session of the current user
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	sessionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrInvalidInput.Error()})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+
+	if err := h.authUseCase.RevokeSession(c.Request.Context(), userID, uint(sessionID)); err != nil {
+		if err == errors.ErrSessionNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// ListOrganizations lists the organizations the current user is a member of
+func (h *AuthHandler) ListOrganizations(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	orgs, err := h.authUseCase.ListOrganizations(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"organizations": orgs})
+}
+
+// SwitchOrganization exchanges the current access token for one scoped to
+// another organization
+func (h *AuthHandler) SwitchOrganization(c *gin.Context) {
+	var req SwitchOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrValidation.Error()})
+		return
+	}
+
+	claims, ok := c.MustGet("claims").(*jwt.Claims)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errors.ErrUnauthorized.Error()})
+		return
+	}
+
+	accessToken, err := h.authUseCase.SwitchOrganization(c.Request.Context(), claims, req.OrganizationID)
+	if err != nil {
+		switch err {
+		case errors.ErrOrganizationNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.ErrNotMember, errors.ErrOrganizationInactive:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.ErrSessionNotFound, errors.ErrInvalidToken:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"access_token": accessToken})
+}
+
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	var req RefreshTokenRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -113,13 +338,16 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	accessToken, err := h.authUseCase.RefreshToken(c.Request.Context(), req.RefreshToken)
+	accessToken, refreshToken, err := h.authUseCase.RefreshToken(c.Request.Context(), req.RefreshToken)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"access_token": accessToken})
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
+	})
 }
 
 func (h *AuthHandler) ResetPassword(c *gin.Context) {
@@ -129,12 +357,12 @@ func (h *AuthHandler) ResetPassword(c *gin.Context) {
 		return
 	}
 
-	if err := h.authUseCase.ResetPassword(c.Request.Context(), req.Email); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.authUseCase.ResetPassword(c.Request.Context(), req.Token, req.NewPassword); err != nil {
+		c.JSON(tokenErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Password reset email sent"})
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
 }
 
 func (h *AuthHandler) VerifyEmail(c *gin.Context) {
@@ -145,13 +373,38 @@ func (h *AuthHandler) VerifyEmail(c *gin.Context) {
 	}
 
 	if err := h.authUseCase.VerifyEmail(c.Request.Context(), req.Token); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(tokenErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
 }
 
+func (h *AuthHandler) ResendVerificationEmail(c *gin.Context) {
+	var req ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrValidation.Error()})
+		return
+	}
+
+	if err := h.authUseCase.ResendVerificationEmail(c.Request.Context(), req.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
+// tokenErrorStatus maps a failure to use an emailed token to its HTTP status
+func tokenErrorStatus(err error) int {
+	switch err {
+	case errors.ErrInvalidToken, errors.ErrTokenTypeInvalid, errors.ErrTokenRevoked, errors.ErrTokenExpired:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 func (h *AuthHandler) ChangePassword(c *gin.Context) {
 	var req ChangePasswordRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -172,20 +425,41 @@ func (h *AuthHandler) ChangePassword(c *gin.Context) {
 func (h *AuthHandler) EnableTwoFactor(c *gin.Context) {
 	userID := c.GetUint("user_id")
 
-	secret, err := h.authUseCase.EnableTwoFactor(c.Request.Context(), userID)
+	setup, err := h.authUseCase.EnableTwoFactor(c.Request.Context(), userID)
 	if err != nil {
+		if err == errors.ErrTwoFactorEnabled {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"secret": secret})
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           setup.Secret,
+		"provisioning_uri": setup.ProvisioningURI,
+		"qr_code":          "data:image/png;base64," + base64.StdEncoding.EncodeToString(setup.QRCode),
+	})
 }
 
 func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrValidation.Error()})
+		return
+	}
+
 	userID := c.GetUint("user_id")
 
-	if err := h.authUseCase.DisableTwoFactor(c.Request.Context(), userID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.authUseCase.DisableTwoFactor(c.Request.Context(), userID, req.Code, req.Password); err != nil {
+		switch err {
+		case errors.ErrInvalidTwoFactor, errors.ErrInvalidCredentials:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case errors.ErrAccountLocked:
+			c.JSON(http.StatusLocked, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
@@ -193,7 +467,7 @@ func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
 }
 
 func (h *AuthHandler) VerifyTwoFactor(c *gin.Context) {
-	var req EnableTwoFactorRequest
+	var req VerifyTwoFactorRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrValidation.Error()})
 		return
@@ -201,12 +475,21 @@ func (h *AuthHandler) VerifyTwoFactor(c *gin.Context) {
 
 	userID := c.GetUint("user_id")
 
-	if err := h.authUseCase.VerifyTwoFactor(c.Request.Context(), userID, req.Code); err != nil {
+	recoveryCodes, err := h.authUseCase.VerifyTwoFactor(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		if err == errors.ErrTwoFactorEnabled {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Two-factor code verified"})
+	// Recovery codes are only returned once, when enrollment is confirmed
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": recoveryCodes,
+	})
 }
 
 func (h *AuthHandler) ForgotPassword(c *gin.Context) {
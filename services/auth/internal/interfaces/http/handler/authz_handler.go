@@ -0,0 +1,298 @@
+package handler
+
+import (
+	"net/http"
+
+	"minisapi/services/auth/internal/common"
+	"minisapi/services/auth/internal/domain/service"
+	"minisapi/services/auth/internal/infrastructure/jwt"
+	"minisapi/services/auth/internal/pkg/errors"
+	"minisapi/services/auth/internal/pkg/permission"
+	"minisapi/services/auth/internal/pkg/policy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authzCheckPermission allows callers to ask about subjects other than
+// themselves
+const authzCheckPermission = "authz:check"
+
+// maxAuthzChecks caps the number of checks in a batch
+const maxAuthzChecks = 100
+
+// AuthzHandler answers authorization questions of other services
+type AuthzHandler struct {
+	authService   service.AuthService
+	policyService service.PolicyService
+}
+
+// NewAuthzHandler creates a new instance of AuthzHandler
+func NewAuthzHandler(authService service.AuthService, policyService service.PolicyService) *AuthzHandler {
+	return &AuthzHandler{
+		authService:   authService,
+		policyService: policyService,
+	}
+}
+
+// AuthzSubject names the user a check is about: the holder of an access
+// token, or a user ID. When both are empty the caller is the subject.
+type AuthzSubject struct {
+	Token  string `json:"token"`
+	UserID uint   `json:"user_id" example:"42"`
+	// OrganizationID is the organization the subject acts in, whose role
+	// grants count too. A token subject acts in the organization of its
+	// token, and the caller by default in that of their own token.
+	OrganizationID uint `json:"organization_id" example:"7"`
+	// Environment is exposed to policies as environment.<name>, such as
+	// the "ip" the subject's request came from
+	Environment map[string]interface{} `json:"environment"`
+}
+
+// AuthzCheck is one resource:action question
+type AuthzCheck struct {
+	Permission string `json:"permission" binding:"required" example:"notifications:send"`
+	// ResourceAttributes are exposed to policies as resource.<name>, such
+	// as "owner_id"
+	ResourceAttributes map[string]interface{} `json:"resource_attributes"`
+}
+
+// AuthzCheckRequest represents the check request body
+type AuthzCheckRequest struct {
+	AuthzSubject
+	AuthzCheck
+}
+
+// AuthzBatchRequest represents the batch check request body
+type AuthzBatchRequest struct {
+	AuthzSubject
+	Checks []AuthzCheck `json:"checks" binding:"required,min=1,dive"`
+}
+
+// AuthzResult is the answer to one check
+type AuthzResult struct {
+	Permission string `json:"permission" example:"notifications:send"`
+	Allowed    bool   `json:"allowed"`
+	Reason     string `json:"reason" example:"granted notifications:send by role"`
+}
+
+// AuthzCheckResponse represents the check response
+type AuthzCheckResponse struct {
+	// UserID is the subject; it is zero when the token was rejected
+	UserID uint `json:"user_id"`
+	AuthzResult
+}
+
+// AuthzBatchResponse represents the batch check response
+type AuthzBatchResponse struct {
+	// UserID is the subject; it is zero when the token was rejected
+	UserID uint `json:"user_id"`
+	// Allowed is true when every check is allowed
+	Allowed bool          `json:"allowed"`
+	Results []AuthzResult `json:"results"`
+}
+
+// Check godoc
+// @Summary Check an authorization
+// @Description Decide whether a subject may perform an action on a resource, with roles and access policies. Asking about a subject other than the caller requires the authz:check permission.
+// @Tags authz
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body AuthzCheckRequest true "Subject and permission"
+// @Success 200 {object} AuthzCheckResponse
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/authz/check [post]
+func (h *AuthzHandler) Check(c *gin.Context) {
+	var req AuthzCheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, common.VALIDATION_ERROR)
+		return
+	}
+
+	userID, results, ok := h.check(c, req.AuthzSubject, []AuthzCheck{req.AuthzCheck})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, AuthzCheckResponse{UserID: userID, AuthzResult: results[0]})
+}
+
+// CheckBatch godoc
+// @Summary Check several authorizations
+// @Description Decide several resource:action pairs for one subject at once. Asking about a subject other than the caller requires the authz:check permission.
+// @Tags authz
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body AuthzBatchRequest true "Subject and permissions"
+// @Success 200 {object} AuthzBatchResponse
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/authz/check-batch [post]
+func (h *AuthzHandler) CheckBatch(c *gin.Context) {
+	var req AuthzBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, common.VALIDATION_ERROR)
+		return
+	}
+	if len(req.Checks) > maxAuthzChecks {
+		c.JSON(http.StatusBadRequest, common.VALIDATION_ERROR)
+		return
+	}
+
+	userID, results, ok := h.check(c, req.AuthzSubject, req.Checks)
+	if !ok {
+		return
+	}
+
+	allowed := true
+	for _, result := range results {
+		allowed = allowed && result.Allowed
+	}
+
+	c.JSON(http.StatusOK, AuthzBatchResponse{UserID: userID, Allowed: allowed, Results: results})
+}
+
+// check answers the checks for the subject. It writes the response and
+// returns false when the request is malformed or not permitted.
+func (h *AuthzHandler) check(c *gin.Context, subject AuthzSubject, checks []AuthzCheck) (uint, []AuthzResult, bool) {
+	for _, check := range checks {
+		if _, _, ok := permission.Split(check.Permission); !ok {
+			c.JSON(http.StatusBadRequest, common.INVALID_PERMISSION)
+			return 0, nil, false
+		}
+	}
+
+	userID, orgID, reason, ok := h.subjectID(c, subject)
+	if !ok {
+		return 0, nil, false
+	}
+
+	// A rejected token denies everything
+	if reason != "" {
+		return 0, deniedResults(checks, reason), true
+	}
+
+	// Callers asking about themselves with an API key are answered within
+	// the key's scopes
+	var scopes []string
+	if subject.Token == "" && userID == c.GetUint("user_id") {
+		if claims, ok := c.MustGet("claims").(*jwt.Claims); ok {
+			scopes = claims.KeyScopes()
+		}
+	}
+
+	reqs := make([]service.AccessRequest, 0, len(checks))
+	for _, check := range checks {
+		resource, action, _ := permission.Split(check.Permission)
+		reqs = append(reqs, service.AccessRequest{
+			SubjectID:          userID,
+			OrganizationID:     orgID,
+			Scopes:             scopes,
+			Resource:           resource,
+			Action:             action,
+			ResourceAttributes: check.ResourceAttributes,
+			Environment:        subject.Environment,
+		})
+	}
+
+	decisions, err := h.policyService.AuthorizeBatch(c.Request.Context(), reqs)
+	if err == errors.ErrUserNotFound {
+		return userID, deniedResults(checks, "subject not found"), true
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return 0, nil, false
+	}
+
+	return userID, decisionResults(checks, decisions), true
+}
+
+// subjectID resolves the subject of a check and the organization it acts in.
+// For a rejected token it returns the reason instead of a user ID.
+func (h *AuthzHandler) subjectID(c *gin.Context, subject AuthzSubject) (uint, uint, string, bool) {
+	callerID := c.GetUint("user_id")
+
+	var userID uint
+	orgID := subject.OrganizationID
+	switch {
+	case subject.Token != "" && (subject.UserID != 0 || subject.OrganizationID != 0):
+		c.JSON(http.StatusBadRequest, common.PARAMS_ERROR)
+		return 0, 0, "", false
+	case subject.Token != "":
+		claims, err := h.authService.ValidateToken(subject.Token)
+		if err != nil {
+			return h.rejectToken(c, "invalid token")
+		}
+		if userID, err = claims.UserID(); err != nil {
+			return h.rejectToken(c, "invalid token")
+		}
+
+		revoked, err := h.authService.IsAccessRevoked(c.Request.Context(), claims)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, common.SERVICE_UNAVAILABLE)
+			return 0, 0, "", false
+		}
+		if revoked {
+			return h.rejectToken(c, "token has been revoked")
+		}
+		orgID = claims.OrganizationID
+	case subject.UserID != 0:
+		userID = subject.UserID
+	default:
+		userID = callerID
+		if orgID == 0 {
+			if claims, ok := c.MustGet("claims").(*jwt.Claims); ok {
+				orgID = claims.OrganizationID
+			}
+		}
+	}
+
+	if userID != callerID && !h.mayCheckOthers(c) {
+		c.JSON(http.StatusForbidden, common.FORBIDDEN)
+		return 0, 0, "", false
+	}
+	return userID, orgID, "", true
+}
+
+// rejectToken denies the checks of a token that is not accepted. Only
+// callers allowed to check others learn why, so the API cannot be used to
+// probe tokens.
+func (h *AuthzHandler) rejectToken(c *gin.Context, reason string) (uint, uint, string, bool) {
+	if !h.mayCheckOthers(c) {
+		c.JSON(http.StatusForbidden, common.FORBIDDEN)
+		return 0, 0, "", false
+	}
+	return 0, 0, reason, true
+}
+
+func (h *AuthzHandler) mayCheckOthers(c *gin.Context) bool {
+	value, _ := c.Get("claims")
+	claims, ok := value.(*jwt.Claims)
+	return ok && permission.NewSet(claims.Permissions).Has(authzCheckPermission)
+}
+
+func deniedResults(checks []AuthzCheck, reason string) []AuthzResult {
+	results := make([]AuthzResult, 0, len(checks))
+	for _, check := range checks {
+		results = append(results, AuthzResult{Permission: check.Permission, Reason: reason})
+	}
+	return results
+}
+
+func decisionResults(checks []AuthzCheck, decisions []*policy.Decision) []AuthzResult {
+	results := make([]AuthzResult, 0, len(checks))
+	for i, check := range checks {
+		results = append(results, AuthzResult{
+			Permission: check.Permission,
+			Allowed:    decisions[i].Allowed,
+			Reason:     decisions[i].Reason,
+		})
+	}
+	return results
+}
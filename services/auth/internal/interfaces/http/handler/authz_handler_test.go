@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"minisapi/services/auth/internal/domain/service"
+	"minisapi/services/auth/internal/infrastructure/jwt"
+	"minisapi/services/auth/internal/pkg/errors"
+	"minisapi/services/auth/internal/pkg/permission"
+	"minisapi/services/auth/internal/pkg/policy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestAuthzSubjects checks who a check is about and that only callers
+// holding authz:check may ask about anyone but themselves or learn why a
+// token was rejected
+func TestAuthzSubjects(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions []string
+		body        map[string]interface{}
+		want        int
+		subject     uint
+		reason      string
+	}{
+		{"caller", nil, map[string]interface{}{}, http.StatusOK, 1, "granted"},
+		{"caller by ID", nil, map[string]interface{}{"user_id": 1}, http.StatusOK, 1, "granted"},
+		{"other user", nil, map[string]interface{}{"user_id": 2}, http.StatusForbidden, 0, ""},
+		{"other user with authz:check", []string{"authz:check"}, map[string]interface{}{"user_id": 2}, http.StatusOK, 2, "denied"},
+		{"token of the caller", nil, map[string]interface{}{"token": "token-1"}, http.StatusOK, 1, "granted"},
+		{"token of another user", nil, map[string]interface{}{"token": "token-2"}, http.StatusForbidden, 0, ""},
+		{"token of another user with authz:check", []string{"authz:check"}, map[string]interface{}{"token": "token-2"}, http.StatusOK, 2, "denied"},
+		{"invalid token", nil, map[string]interface{}{"token": "forged"}, http.StatusForbidden, 0, ""},
+		{"invalid token with authz:check", []string{"authz:check"}, map[string]interface{}{"token": "forged"}, http.StatusOK, 0, "invalid token"},
+		{"revoked token with authz:check", []string{"authz:check"}, map[string]interface{}{"token": "revoked"}, http.StatusOK, 0, "token has been revoked"},
+		{"token and user ID", []string{"authz:check"}, map[string]interface{}{"token": "token-2", "user_id": 2}, http.StatusBadRequest, 0, ""},
+		{"unknown user", []string{"authz:check"}, map[string]interface{}{"user_id": 99}, http.StatusOK, 99, "subject not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, _ := newAuthzRouter(tt.permissions...)
+			tt.body["permission"] = "user:read"
+
+			var resp AuthzCheckResponse
+			if status := postJSON(router, "/api/v1/authz/check", tt.body, &resp); status != tt.want {
+				t.Fatalf("status = %d, want %d", status, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			if resp.UserID != tt.subject {
+				t.Errorf("subject = %d, want %d", resp.UserID, tt.subject)
+			}
+			if resp.Reason != tt.reason || resp.Allowed != (tt.reason == "granted") {
+				t.Errorf("result = %+v, want reason %q", resp.AuthzResult, tt.reason)
+			}
+		})
+	}
+}
+
+// TestAuthzCheckBatch checks that a batch is answered in order, allowed only
+// when every check is, and decided in one policy evaluation
+func TestAuthzCheckBatch(t *testing.T) {
+	router, policies := newAuthzRouter()
+
+	var resp AuthzBatchResponse
+	body := map[string]interface{}{"checks": []AuthzCheck{{Permission: "user:read"}, {Permission: "user:delete"}}}
+	if status := postJSON(router, "/api/v1/authz/check-batch", body, &resp); status != http.StatusOK {
+		t.Fatalf("status = %d, want 200", status)
+	}
+
+	want := []AuthzResult{
+		{Permission: "user:read", Allowed: true, Reason: "granted"},
+		{Permission: "user:delete", Reason: "denied"},
+	}
+	if resp.UserID != 1 || resp.Allowed || !reflect.DeepEqual(resp.Results, want) {
+		t.Errorf("response = %+v, want %+v", resp, want)
+	}
+	if policies.calls != 1 {
+		t.Errorf("policies evaluated %d times, want once", policies.calls)
+	}
+}
+
+func TestAuthzRejectsMalformedChecks(t *testing.T) {
+	router, policies := newAuthzRouter()
+
+	tooMany := make([]AuthzCheck, maxAuthzChecks+1)
+	for i := range tooMany {
+		tooMany[i] = AuthzCheck{Permission: fmt.Sprintf("resource%d:read", i)}
+	}
+
+	tests := []struct {
+		name string
+		path string
+		body interface{}
+	}{
+		{"missing permission", "/api/v1/authz/check", map[string]interface{}{}},
+		{"permission without action", "/api/v1/authz/check", map[string]interface{}{"permission": "user"}},
+		{"empty batch", "/api/v1/authz/check-batch", map[string]interface{}{"checks": []AuthzCheck{}}},
+		{"batch too large", "/api/v1/authz/check-batch", map[string]interface{}{"checks": tooMany}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := postJSON(router, tt.path, tt.body, nil); status != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400", status)
+			}
+		})
+	}
+	if policies.calls != 0 {
+		t.Errorf("policies evaluated %d times for malformed checks", policies.calls)
+	}
+}
+
+// newAuthzRouter serves the authz routes to user 1 holding the permissions.
+// Users 1 and 2 exist; only user 1 holds user:read.
+func newAuthzRouter(permissions ...string) (*gin.Engine, *grantTable) {
+	gin.SetMode(gin.TestMode)
+	revoked := jwt.NewClaims(1)
+	revoked.ID = "revoked"
+	tokens := &tokenTable{
+		tokens: map[string]*jwt.Claims{
+			"token-1": jwt.NewClaims(1),
+			"token-2": jwt.NewClaims(2),
+			"revoked": revoked,
+		},
+	}
+	policies := &grantTable{grants: map[uint][]string{1: {"user:read"}, 2: nil}}
+	h := NewAuthzHandler(tokens, policies)
+
+	router := gin.New()
+	authz := router.Group("/api/v1/authz", withClaims(1, permissions...))
+	authz.POST("/check", h.Check)
+	authz.POST("/check-batch", h.CheckBatch)
+	return router, policies
+}
+
+// postJSON posts the body to the router, decodes the response into out when
+// it is not nil and returns the status code
+func postJSON(router http.Handler, path string, body, out interface{}) int {
+	var payload bytes.Buffer
+	_ = json.NewEncoder(&payload).Encode(body)
+	req := httptest.NewRequest(http.MethodPost, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if out != nil {
+		_ = json.Unmarshal(rec.Body.Bytes(), out)
+	}
+	return rec.Code
+}
+
+type tokenTable struct {
+	service.AuthService
+	tokens map[string]*jwt.Claims
+}
+
+func (s *tokenTable) ValidateToken(token string) (*jwt.Claims, error) {
+	if claims, ok := s.tokens[token]; ok {
+		return claims, nil
+	}
+	return nil, fmt.Errorf("invalid token")
+}
+
+func (s *tokenTable) IsAccessRevoked(_ context.Context, claims *jwt.Claims) (bool, error) {
+	return claims.ID == "revoked", nil
+}
+
+// grantTable decides checks from a fixed set of permissions per user
+type grantTable struct {
+	service.PolicyService
+	grants map[uint][]string
+	calls  int
+}
+
+func (s *grantTable) AuthorizeBatch(_ context.Context, reqs []service.AccessRequest) ([]*policy.Decision, error) {
+	s.calls++
+	decisions := make([]*policy.Decision, 0, len(reqs))
+	for _, req := range reqs {
+		grants, ok := s.grants[req.SubjectID]
+		if !ok {
+			return nil, errors.ErrUserNotFound
+		}
+		if permission.NewSet(grants).Has(permission.Key(req.Resource, req.Action)) {
+			decisions = append(decisions, &policy.Decision{Allowed: true, Reason: "granted"})
+		} else {
+			decisions = append(decisions, &policy.Decision{Reason: "denied"})
+		}
+	}
+	return decisions, nil
+}
@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"net/http"
+
+	"minisapi/services/auth/internal/common"
+	"minisapi/services/auth/internal/domain/usecase"
+	"minisapi/services/auth/internal/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FederationHandler handles sign-in with external identity providers and
+// the identities linked to accounts
+type FederationHandler struct {
+	federationUseCase usecase.FederationUseCase
+}
+
+// NewFederationHandler creates a new instance of FederationHandler
+func NewFederationHandler(federationUseCase usecase.FederationUseCase) *FederationHandler {
+	return &FederationHandler{
+		federationUseCase: federationUseCase,
+	}
+}
+
+// FederationCallbackRequest carries the parameters a provider sent the
+// user back to the callback page with
+type FederationCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+// ListProviders godoc
+// @Summary List identity providers
+// @Description List the external providers users can sign in with
+// @Tags federation
+// @Produce json
+// @Success 200 {array} usecase.IdentityProvider
+// @Router /api/v1/auth/federation/providers [get]
+func (h *FederationHandler) ListProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": h.federationUseCase.Providers()})
+}
+
+// BeginLogin godoc
+// @Summary Start signing in with an identity provider
+// @Description Get the URL to send the browser to. The callback page must check that the state it comes back with is the one returned here.
+// @Tags federation
+// @Produce json
+// @Param provider path string true "Provider ID"
+// @Success 200 {object} usecase.FederationRedirect
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 503 {object} entity.ErrorResponse
+// @Router /api/v1/auth/federation/{provider}/authorize [post]
+func (h *FederationHandler) BeginLogin(c *gin.Context) {
+	redirect, err := h.federationUseCase.BeginLogin(c.Request.Context(), c.Param("provider"))
+	if err != nil {
+		c.JSON(federationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, redirect)
+}
+
+// CompleteLogin godoc
+// @Summary Complete signing in with an identity provider
+// @Description Exchange the code and state the provider sent back for access and refresh tokens, or for an MFA token when the user has two-factor authentication enabled. A new identity is linked to the account with the same verified email, or gets a new account.
+// @Tags federation
+// @Accept json
+// @Produce json
+// @Param request body FederationCallbackRequest true "Callback parameters"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 409 {object} entity.ErrorResponse
+// @Router /api/v1/auth/federation/callback [post]
+func (h *FederationHandler) CompleteLogin(c *gin.Context) {
+	var req FederationCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrValidation.Error()})
+		return
+	}
+
+	result, err := h.federationUseCase.CompleteLogin(c.Request.Context(), req.Code, req.State, clientInfo(c))
+	if err != nil {
+		c.JSON(federationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if result.MFARequired() {
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required": true,
+			"mfa_token":    result.MFAToken,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":          result.User,
+		"access_token":  result.AccessToken,
+		"refresh_token": result.RefreshToken,
+	})
+}
+
+// ListLinkedAccounts godoc
+// @Summary List linked accounts
+// @Description List the external identities the user can sign in with
+// @Tags federation
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} entity.LinkedAccount
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/auth/linked-accounts [get]
+func (h *FederationHandler) ListLinkedAccounts(c *gin.Context) {
+	accounts, err := h.federationUseCase.ListLinkedAccounts(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": accounts})
+}
+
+// BeginLink godoc
+// @Summary Start linking an identity provider
+// @Description Get the URL to send the browser to for linking an identity at the provider to the user's account
+// @Tags federation
+// @Produce json
+// @Security Bearer
+// @Param provider path string true "Provider ID"
+// @Success 200 {object} usecase.FederationRedirect
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 503 {object} entity.ErrorResponse
+// @Router /api/v1/auth/linked-accounts/{provider}/authorize [post]
+func (h *FederationHandler) BeginLink(c *gin.Context) {
+	redirect, err := h.federationUseCase.BeginLink(c.Request.Context(), c.GetUint("user_id"), c.Param("provider"))
+	if err != nil {
+		c.JSON(federationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, redirect)
+}
+
+// CompleteLink godoc
+// @Summary Complete linking an identity provider
+// @Description Link the identity the provider sent back to the account of the user who started the link
+// @Tags federation
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body FederationCallbackRequest true "Callback parameters"
+// @Success 201 {object} entity.LinkedAccount
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 409 {object} entity.ErrorResponse
+// @Router /api/v1/auth/linked-accounts/callback [post]
+func (h *FederationHandler) CompleteLink(c *gin.Context) {
+	var req FederationCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrValidation.Error()})
+		return
+	}
+
+	account, err := h.federationUseCase.CompleteLink(c.Request.Context(), c.GetUint("user_id"), req.Code, req.State)
+	if err != nil {
+		c.JSON(federationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, account)
+}
+
+// UnlinkAccount godoc
+// @Summary Unlink an account
+// @Description Remove an external identity from the user's account
+// @Tags federation
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Linked account ID"
+// @Success 200 {object} entity.MessageResponse
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/auth/linked-accounts/{id} [delete]
+func (h *FederationHandler) UnlinkAccount(c *gin.Context) {
+	accountID, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.federationUseCase.UnlinkAccount(c.Request.Context(), c.GetUint("user_id"), accountID); err != nil {
+		if err == errors.ErrLinkedAccountNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	c.JSON(http.StatusOK, common.SUCCESS)
+}
+
+// federationErrorStatus maps a federated sign-in failure to its HTTP status
+func federationErrorStatus(err error) int {
+	switch err {
+	case errors.ErrProviderNotFound:
+		return http.StatusNotFound
+	case errors.ErrAccountLinkRequired, errors.ErrIdentityLinked:
+		return http.StatusConflict
+	case errors.ErrDatabase:
+		return http.StatusInternalServerError
+	default:
+		return loginErrorStatus(err)
+	}
+}
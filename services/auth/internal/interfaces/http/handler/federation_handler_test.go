@@ -0,0 +1,631 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"minisapi/services/auth/internal/configs"
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/domain/usecase"
+	"minisapi/services/auth/internal/infrastructure/federation"
+	"minisapi/services/auth/internal/infrastructure/federation/federationtest"
+	"minisapi/services/auth/internal/infrastructure/jwt"
+	"minisapi/services/auth/internal/interfaces/http/middleware"
+	"minisapi/services/auth/internal/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testProviderID = "acme"
+
+// TestFederatedLogin signs users in through a local mock provider and checks
+// the account linking rules
+func TestFederatedLogin(t *testing.T) {
+	s := newFederationServer(t)
+	verified := s.users.add(&entity.User{Email: "jane@example.com", Active: true, EmailVerified: true})
+	unverified := s.users.add(&entity.User{Email: "mallory@example.com", Active: true})
+	withTOTP := s.users.add(&entity.User{Email: "otto@example.com", Active: true, EmailVerified: true, TwoFactorEnabled: true})
+
+	// A new identity gets a new account and our usual tokens
+	status, body := s.login(federationtest.Claims{"sub": "u-1", "email": "New.User@example.com", "email_verified": true, "given_name": "New", "family_name": "User"})
+	if status != http.StatusOK {
+		t.Fatalf("first login = %d %v", status, body)
+	}
+	created := s.users.byEmail["new.user@example.com"]
+	if created == nil || !created.EmailVerified || created.FirstName != "New" || created.Username != "new.user" {
+		t.Fatalf("account created for the identity = %+v", created)
+	}
+	s.checkTokens(body, created.ID, jwt.AuthMethodFederated)
+
+	// The identity keeps signing in to the same account
+	if status, body := s.login(federationtest.Claims{"sub": "u-1", "email": "renamed@example.com", "email_verified": true}); status != http.StatusOK {
+		t.Fatalf("second login = %d %v", status, body)
+	} else {
+		s.checkTokens(body, created.ID, jwt.AuthMethodFederated)
+	}
+	if len(s.users.byID) != 4 {
+		t.Fatalf("%d users, want no account created on the second login", len(s.users.byID))
+	}
+
+	// A verified email links the identity to the existing account
+	if status, body := s.login(federationtest.Claims{"sub": "u-2", "email": "jane@example.com", "email_verified": true}); status != http.StatusOK {
+		t.Fatalf("login with a known verified email = %d %v", status, body)
+	} else {
+		s.checkTokens(body, verified.ID, jwt.AuthMethodFederated)
+	}
+	if account := s.accounts.find(testProviderID, "u-2"); account == nil || account.UserID != verified.ID {
+		t.Fatalf("identity linked to %+v, want user %d", account, verified.ID)
+	}
+
+	// Accounts with an unverified email are never linked automatically
+	if status, body := s.login(federationtest.Claims{"sub": "u-3", "email": "mallory@example.com", "email_verified": true}); status != http.StatusConflict {
+		t.Fatalf("login with the email of an unverified account = %d %v, want 409", status, body)
+	}
+	if s.accounts.find(testProviderID, "u-3") != nil {
+		t.Fatalf("identity was linked to unverified user %d", unverified.ID)
+	}
+
+	// Unverified emails neither link nor create accounts
+	if status, body := s.login(federationtest.Claims{"sub": "u-4", "email": "jane@example.com"}); status != http.StatusUnauthorized {
+		t.Fatalf("login with an unverified email = %d %v, want 401", status, body)
+	}
+
+	// Two-factor authentication still applies, and the second factor is
+	// recorded next to the federated login
+	status, body = s.login(federationtest.Claims{"sub": "u-5", "email": "otto@example.com", "email_verified": true})
+	if status != http.StatusOK || body["mfa_required"] != true {
+		t.Fatalf("login of a user with 2FA = %d %v, want mfa_required", status, body)
+	}
+	userID, methods, err := s.authService.ValidateMFAChallenge(body["mfa_token"].(string))
+	if err != nil || userID != withTOTP.ID || len(methods) != 1 || methods[0] != jwt.AuthMethodFederated {
+		t.Fatalf("MFA challenge = %d %v %v", userID, methods, err)
+	}
+
+	// New accounts take the preferred username, made unique when taken
+	if status, body := s.login(federationtest.Claims{"sub": "u-6", "email": "nu@example.com", "email_verified": true, "preferred_username": "New.User"}); status != http.StatusOK {
+		t.Fatalf("login with a taken preferred username = %d %v", status, body)
+	}
+	if other := s.users.byEmail["nu@example.com"]; other == nil || !strings.HasPrefix(other.Username, "new.user-") {
+		t.Fatalf("account created with a taken preferred username = %+v", other)
+	}
+}
+
+func TestFederatedLoginState(t *testing.T) {
+	s := newFederationServer(t)
+	claims := federationtest.Claims{"sub": "u-1", "email": "jane@example.com", "email_verified": true}
+
+	redirect := s.begin("/api/v1/auth/federation/" + testProviderID + "/authorize")
+	callback := s.issuer.SignIn(redirect.AuthorizationURL, claims)
+	if status, body := s.callback("/api/v1/auth/federation/callback", callback, ""); status != http.StatusOK {
+		t.Fatalf("callback = %d %v", status, body)
+	}
+
+	// A state can only be used once
+	if status, _ := s.callback("/api/v1/auth/federation/callback", callback, ""); status != http.StatusUnauthorized {
+		t.Fatalf("replayed callback = %d, want 401", status)
+	}
+
+	// A state that was never issued is refused
+	callback = s.issuer.SignIn(redirect.AuthorizationURL, claims)
+	callback.Set("state", "forged")
+	if status, _ := s.callback("/api/v1/auth/federation/callback", callback, ""); status != http.StatusUnauthorized {
+		t.Fatalf("callback with a forged state = %d, want 401", status)
+	}
+
+	if status, _ := s.post("/api/v1/auth/federation/unknown/authorize", nil, "", nil); status != http.StatusNotFound {
+		t.Fatalf("unknown provider = %d, want 404", status)
+	}
+}
+
+func TestLinkAccount(t *testing.T) {
+	s := newFederationServer(t)
+	jane := s.users.add(&entity.User{Email: "jane@example.com", Active: true, EmailVerified: true})
+	john := s.users.add(&entity.User{Email: "john@example.com", Active: true, EmailVerified: true})
+	janeToken := s.accessToken(jane.ID)
+	johnToken := s.accessToken(john.ID)
+
+	// The identity's email does not have to match the account's
+	claims := federationtest.Claims{"sub": "work-1", "email": "jane.doe@work.example.com", "email_verified": true}
+	redirect := s.beginAs("/api/v1/auth/linked-accounts/"+testProviderID+"/authorize", janeToken)
+	callback := s.issuer.SignIn(redirect.AuthorizationURL, claims)
+
+	// Only the user who started the link can complete it
+	if status, _ := s.callback("/api/v1/auth/linked-accounts/callback", callback, johnToken); status != http.StatusUnauthorized {
+		t.Fatalf("link completed by another user = %d, want 401", status)
+	}
+
+	redirect = s.beginAs("/api/v1/auth/linked-accounts/"+testProviderID+"/authorize", janeToken)
+	callback = s.issuer.SignIn(redirect.AuthorizationURL, claims)
+	if status, body := s.callback("/api/v1/auth/linked-accounts/callback", callback, janeToken); status != http.StatusCreated {
+		t.Fatalf("link = %d %v", status, body)
+	}
+
+	// A link state does not sign anyone in
+	redirect = s.beginAs("/api/v1/auth/linked-accounts/"+testProviderID+"/authorize", janeToken)
+	callback = s.issuer.SignIn(redirect.AuthorizationURL, claims)
+	if status, _ := s.callback("/api/v1/auth/federation/callback", callback, ""); status != http.StatusUnauthorized {
+		t.Fatalf("login with a link state = %d, want 401", status)
+	}
+
+	// The linked identity signs in to Jane's account
+	if status, body := s.login(claims); status != http.StatusOK {
+		t.Fatalf("login with the linked identity = %d %v", status, body)
+	} else {
+		s.checkTokens(body, jane.ID, jwt.AuthMethodFederated)
+	}
+
+	// An identity linked to Jane cannot be linked to John
+	redirect = s.beginAs("/api/v1/auth/linked-accounts/"+testProviderID+"/authorize", johnToken)
+	callback = s.issuer.SignIn(redirect.AuthorizationURL, claims)
+	if status, _ := s.callback("/api/v1/auth/linked-accounts/callback", callback, johnToken); status != http.StatusConflict {
+		t.Fatalf("link of an identity linked to another user = %d, want 409", status)
+	}
+
+	// Linking needs a recent login, with the second factor when it is on
+	otto := s.users.add(&entity.User{Email: "otto@example.com", Active: true, EmailVerified: true, TwoFactorEnabled: true})
+	authorize := "/api/v1/auth/linked-accounts/" + testProviderID + "/authorize"
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"login an hour ago", s.loginToken(john.ID, time.Now().Add(-time.Hour), jwt.AuthMethodPassword), http.StatusForbidden},
+		{"password only with 2FA enabled", s.loginToken(otto.ID, time.Now(), jwt.AuthMethodPassword), http.StatusForbidden},
+		{"second factor with 2FA enabled", s.loginToken(otto.ID, time.Now(), jwt.AuthMethodPassword, jwt.AuthMethodOTP), http.StatusOK},
+	}
+	for _, tt := range tests {
+		if status, _ := s.post(authorize, nil, tt.token, nil); status != tt.want {
+			t.Errorf("link after a %s = %d, want %d", tt.name, status, tt.want)
+		}
+	}
+
+	// Unlinking
+	account := s.accounts.find(testProviderID, "work-1")
+	path := "/api/v1/auth/linked-accounts/" + jsonNumber(account.ID)
+	if status := s.delete(path, johnToken); status != http.StatusNotFound {
+		t.Fatalf("unlink by another user = %d, want 404", status)
+	}
+	if status := s.delete(path, janeToken); status != http.StatusOK {
+		t.Fatalf("unlink = %d, want 200", status)
+	}
+	if s.accounts.find(testProviderID, "work-1") != nil {
+		t.Fatal("identity is still linked")
+	}
+}
+
+// loginServer serves routes in-process with the real auth use case over
+// in-memory repositories, and calls them as a client would
+type loginServer struct {
+	t                *testing.T
+	server           *httptest.Server
+	router           *gin.Engine
+	users            *memoryUserRepo
+	sessions         *memorySessionRepo
+	jwtManager       *jwt.JWTManager
+	authService      *fakeAuthService
+	authUseCase      usecase.AuthUseCase
+	authMiddleware   *middleware.AuthMiddleware
+	reauthMiddleware *middleware.ReauthMiddleware
+}
+
+func newLoginServer(t *testing.T) *loginServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	jwtManager, err := jwt.NewJWTManager(configs.JWTConfig{
+		Secret:     "test-secret",
+		Expiration: "1h",
+		Issuer:     "minisapi-auth",
+		Audience:   []string{"minisapi"},
+	})
+	if err != nil {
+		t.Fatalf("NewJWTManager: %v", err)
+	}
+
+	users := &memoryUserRepo{byID: map[uint]*entity.User{}, byEmail: map[string]*entity.User{}}
+	sessions := &memorySessionRepo{}
+	authService := &fakeAuthService{jwtManager: jwtManager, revokedSessions: map[string]bool{}}
+	authUseCase := usecase.NewAuthUseCase(
+		users,
+		&memoryTokenRepo{},
+		sessions,
+		nil,
+		&memoryAttemptRepo{counts: map[string]int64{}},
+		nil,
+		authService,
+		configs.LockoutConfig{MaxAttempts: 3, IPMaxAttempts: 100, Window: time.Minute, Duration: time.Minute, MaxDuration: time.Hour, ResetAfter: time.Hour},
+		configs.EmailConfig{},
+		configs.SessionConfig{},
+	)
+
+	router := gin.New()
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	return &loginServer{
+		t:                t,
+		server:           server,
+		router:           router,
+		users:            users,
+		sessions:         sessions,
+		jwtManager:       jwtManager,
+		authService:      authService,
+		authUseCase:      authUseCase,
+		authMiddleware:   middleware.NewAuthMiddleware(authService, nil),
+		reauthMiddleware: middleware.NewReauthMiddleware(sessions, users, configs.SessionConfig{ReauthMaxAge: 10 * time.Minute}),
+	}
+}
+
+func (s *loginServer) post(path string, body interface{}, accessToken string, out interface{}) (int, error) {
+	s.t.Helper()
+	return s.send(http.MethodPost, path, body, accessToken, out)
+}
+
+func (s *loginServer) delete(path, accessToken string) int {
+	s.t.Helper()
+	status, _ := s.send(http.MethodDelete, path, nil, accessToken, nil)
+	return status
+}
+
+func (s *loginServer) send(method, path string, body interface{}, accessToken string, out interface{}) (int, error) {
+	s.t.Helper()
+	var payload io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		payload = bytes.NewReader(data)
+	}
+	req := mustRequest(s.t, method, s.server.URL+path, payload)
+	req.Header.Set("Content-Type", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		s.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode, nil
+}
+
+// checkTokens verifies that a login answer carries our usual tokens for a
+// session of the user started with the given methods
+func (s *loginServer) checkTokens(body map[string]interface{}, userID uint, authMethods ...string) {
+	s.t.Helper()
+	accessToken, _ := body["access_token"].(string)
+	if refresh, _ := body["refresh_token"].(string); refresh == "" {
+		s.t.Fatalf("login answer has no refresh token: %v", body)
+	}
+	claims, err := s.jwtManager.ValidateToken(accessToken)
+	if err != nil {
+		s.t.Fatalf("access token: %v", err)
+	}
+	if id, _ := claims.UserID(); id != userID || strings.Join(claims.AuthMethods, " ") != strings.Join(authMethods, " ") || claims.SessionID == "" {
+		s.t.Fatalf("access token claims = %+v, want a session of user %d with %v", claims, userID, authMethods)
+	}
+	if claims.AuthLevel != jwt.AuthLevelFor(authMethods) {
+		s.t.Fatalf("acr = %q, want %q", claims.AuthLevel, jwt.AuthLevelFor(authMethods))
+	}
+}
+
+// accessToken returns an access token of a password login that just
+// happened
+func (s *loginServer) accessToken(userID uint) string {
+	s.t.Helper()
+	return s.loginToken(userID, time.Now(), jwt.AuthMethodPassword)
+}
+
+// loginToken returns an access token of a session started at loginAt with
+// the given methods
+func (s *loginServer) loginToken(userID uint, loginAt time.Time, authMethods ...string) string {
+	s.t.Helper()
+	claims := jwt.NewClaims(userID)
+	claims.SessionID = randomString(s.t)
+	claims.AuthMethods = authMethods
+	claims.AuthLevel = jwt.AuthLevelFor(authMethods)
+	s.sessions.sessions = append(s.sessions.sessions, entity.Session{
+		CreatedAt: loginAt,
+		UserID:    userID,
+		FamilyID:  claims.SessionID,
+		ExpiresAt: loginAt.Add(24 * time.Hour),
+		Active:    true,
+	})
+	token, err := s.jwtManager.GenerateAccessToken(claims)
+	if err != nil {
+		s.t.Fatalf("GenerateAccessToken: %v", err)
+	}
+	return token
+}
+
+// federationServer serves the federation endpoints against a mock provider
+type federationServer struct {
+	*loginServer
+	issuer   *federationtest.Issuer
+	accounts *memoryLinkedAccountRepo
+}
+
+func newFederationServer(t *testing.T) *federationServer {
+	t.Helper()
+	s := newLoginServer(t)
+
+	issuer := federationtest.NewIssuer(t, "our-client", "our-secret")
+	cfg := configs.FederationConfig{
+		Providers:   []configs.FederationProvider{issuer.Provider(testProviderID)},
+		CallbackURL: "https://app.example.com/auth/callback",
+		StateTTL:    time.Minute,
+	}
+	registry, err := federation.NewRegistry(cfg)
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+
+	accounts := &memoryLinkedAccountRepo{}
+	federationUseCase := usecase.NewFederationUseCase(registry, &memoryStateRepo{states: map[string]*entity.FederationState{}}, accounts, s.users, s.authUseCase, s.authService, cfg)
+
+	h := NewFederationHandler(federationUseCase)
+	s.router.POST("/api/v1/auth/federation/:provider/authorize", h.BeginLogin)
+	s.router.POST("/api/v1/auth/federation/callback", h.CompleteLogin)
+	linked := s.router.Group("/api/v1/auth/linked-accounts", s.authMiddleware.Authenticate())
+	linked.POST("/:provider/authorize", s.reauthMiddleware.RequireRecentLogin(), h.BeginLink)
+	linked.POST("/callback", s.reauthMiddleware.RequireRecentLogin(), h.CompleteLink)
+	linked.DELETE("/:id", h.UnlinkAccount)
+
+	return &federationServer{loginServer: s, issuer: issuer, accounts: accounts}
+}
+
+// login signs in at the provider with the given claims and completes the
+// sign-in as the callback page would
+func (s *federationServer) login(claims federationtest.Claims) (int, map[string]interface{}) {
+	s.t.Helper()
+	redirect := s.begin("/api/v1/auth/federation/" + testProviderID + "/authorize")
+	return s.callback("/api/v1/auth/federation/callback", s.issuer.SignIn(redirect.AuthorizationURL, claims), "")
+}
+
+func (s *federationServer) begin(path string) *usecase.FederationRedirect {
+	return s.beginAs(path, "")
+}
+
+func (s *federationServer) beginAs(path, accessToken string) *usecase.FederationRedirect {
+	s.t.Helper()
+	var redirect usecase.FederationRedirect
+	if status, _ := s.post(path, nil, accessToken, &redirect); status != http.StatusOK {
+		s.t.Fatalf("POST %s = %d", path, status)
+	}
+	return &redirect
+}
+
+func (s *federationServer) callback(path string, params url.Values, accessToken string) (int, map[string]interface{}) {
+	s.t.Helper()
+	var body map[string]interface{}
+	status, _ := s.post(path, map[string]string{"code": params.Get("code"), "state": params.Get("state")}, accessToken, &body)
+	return status, body
+}
+
+func jsonNumber(id uint) string {
+	data, _ := json.Marshal(id)
+	return string(data)
+}
+
+// Token issuing of the fake auth service, backed by the real JWT manager
+
+func (s *fakeAuthService) GenerateTokens(user *entity.User, sessionID string, authMethods []string, orgID uint) (string, string, error) {
+	claims := jwt.NewClaims(user.ID)
+	claims.SessionID = sessionID
+	claims.AuthMethods = authMethods
+	claims.AuthLevel = jwt.AuthLevelFor(authMethods)
+	accessToken, err := s.jwtManager.GenerateAccessToken(claims)
+	if err != nil {
+		return "", "", err
+	}
+	return accessToken, "refresh-" + sessionID, nil
+}
+
+func (s *fakeAuthService) RefreshTokenTTL() time.Duration {
+	return s.jwtManager.RefreshTokenTTL()
+}
+
+func (s *fakeAuthService) HashPassword(password string) (string, error) {
+	return "hashed:" + password, nil
+}
+
+func (s *fakeAuthService) GenerateMFAChallenge(user *entity.User, authMethods []string) (string, error) {
+	return s.jwtManager.GenerateChallengeToken(user.ID, jwt.PurposeMFAPending, authMethods, time.Minute)
+}
+
+func (s *fakeAuthService) ValidateMFAChallenge(token string) (uint, []string, error) {
+	claims, err := s.jwtManager.ValidateChallengeToken(token, jwt.PurposeMFAPending)
+	if err != nil {
+		return 0, nil, errors.ErrInvalidToken
+	}
+	userID, err := claims.UserID()
+	return userID, claims.AuthMethods, err
+}
+
+type memoryUserRepo struct {
+	repository.UserRepository
+	byID    map[uint]*entity.User
+	byEmail map[string]*entity.User
+}
+
+func (r *memoryUserRepo) add(user *entity.User) *entity.User {
+	user.ID = uint(len(r.byID) + 1)
+	r.byID[user.ID] = user
+	r.byEmail[user.Email] = user
+	return user
+}
+
+func (r *memoryUserRepo) Create(user *entity.User) error {
+	r.add(user)
+	return nil
+}
+
+func (r *memoryUserRepo) FindByID(id uint) (*entity.User, error) {
+	if user, ok := r.byID[id]; ok {
+		return user, nil
+	}
+	return nil, errors.ErrUserNotFound
+}
+
+func (r *memoryUserRepo) FindByEmail(email string) (*entity.User, error) {
+	if user, ok := r.byEmail[email]; ok {
+		return user, nil
+	}
+	return nil, errors.ErrUserNotFound
+}
+
+func (r *memoryUserRepo) UsernameExists(username string) (bool, error) {
+	for _, user := range r.byID {
+		if user.Username == username {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryUserRepo) UpdateLastLogin(id uint, ip string) error {
+	return nil
+}
+
+func (r *memoryUserRepo) IncrementFailedLogins(id uint) error {
+	r.byID[id].FailedLogins++
+	return nil
+}
+
+func (r *memoryUserRepo) ResetFailedLogins(id uint) error {
+	r.byID[id].FailedLogins = 0
+	return nil
+}
+
+func (r *memoryUserRepo) LockAccount(id uint, duration time.Duration) error {
+	r.byID[id].LockAccount(duration)
+	return nil
+}
+
+type memoryLinkedAccountRepo struct {
+	repository.LinkedAccountRepository
+	accounts []*entity.LinkedAccount
+}
+
+func (r *memoryLinkedAccountRepo) find(provider, subject string) *entity.LinkedAccount {
+	for _, account := range r.accounts {
+		if account.Provider == provider && account.Subject == subject {
+			return account
+		}
+	}
+	return nil
+}
+
+func (r *memoryLinkedAccountRepo) Create(account *entity.LinkedAccount) error {
+	account.ID = uint(len(r.accounts) + 1)
+	r.accounts = append(r.accounts, account)
+	return nil
+}
+
+func (r *memoryLinkedAccountRepo) FindByIdentity(provider, subject string) (*entity.LinkedAccount, error) {
+	if account := r.find(provider, subject); account != nil {
+		return account, nil
+	}
+	return nil, errors.ErrLinkedAccountNotFound
+}
+
+func (r *memoryLinkedAccountRepo) UpdateLastLogin(id uint, email string) error {
+	return nil
+}
+
+func (r *memoryLinkedAccountRepo) Delete(userID, id uint) error {
+	for i, account := range r.accounts {
+		if account.ID == id && account.UserID == userID {
+			r.accounts = append(r.accounts[:i], r.accounts[i+1:]...)
+			return nil
+		}
+	}
+	return errors.ErrLinkedAccountNotFound
+}
+
+type memoryStateRepo struct {
+	states map[string]*entity.FederationState
+}
+
+func (r *memoryStateRepo) Save(ctx context.Context, stateHash string, state *entity.FederationState, ttl time.Duration) error {
+	r.states[stateHash] = state
+	return nil
+}
+
+func (r *memoryStateRepo) Consume(ctx context.Context, stateHash string) (*entity.FederationState, error) {
+	state, ok := r.states[stateHash]
+	if !ok {
+		return nil, errors.ErrInvalidFederationState
+	}
+	delete(r.states, stateHash)
+	return state, nil
+}
+
+type memoryTokenRepo struct {
+	repository.TokenRepository
+	tokens []*entity.Token
+}
+
+func (r *memoryTokenRepo) Create(token *entity.Token) error {
+	token.ID = uint(len(r.tokens) + 1)
+	r.tokens = append(r.tokens, token)
+	return nil
+}
+
+type memorySessionRepo struct {
+	repository.SessionRepository
+	sessions []entity.Session
+}
+
+func (r *memorySessionRepo) Create(session *entity.Session) error {
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+	r.sessions = append(r.sessions, *session)
+	return nil
+}
+
+func (r *memorySessionRepo) FindByFamily(familyID string) (*entity.Session, error) {
+	for i := range r.sessions {
+		if r.sessions[i].FamilyID == familyID {
+			return &r.sessions[i], nil
+		}
+	}
+	return nil, errors.ErrSessionNotFound
+}
+
+func (r *memorySessionRepo) FindActiveByUserID(userID uint) ([]entity.Session, error) {
+	return nil, nil
+}
+
+// memoryAttemptRepo counts login attempts; counters never expire
+type memoryAttemptRepo struct {
+	counts map[string]int64
+}
+
+func (r *memoryAttemptRepo) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	r.counts[key]++
+	return r.counts[key], nil
+}
+
+func (r *memoryAttemptRepo) Get(ctx context.Context, key string) (int64, error) {
+	return r.counts[key], nil
+}
+
+func (r *memoryAttemptRepo) Reset(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		delete(r.counts, key)
+	}
+	return nil
+}
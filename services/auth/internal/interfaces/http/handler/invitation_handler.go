@@ -0,0 +1,311 @@
+package handler
+
+import (
+	"net/http"
+
+	"minisapi/services/auth/internal/common"
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/domain/service"
+	"minisapi/services/auth/internal/domain/usecase"
+	"minisapi/services/auth/internal/pkg/errors"
+	"minisapi/services/auth/internal/pkg/permission"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InvitationHandler handles invitations to global roles, under the admin
+// routes, and to organizations, under the routes of the organization in the
+// id path parameter
+type InvitationHandler struct {
+	invitationUseCase usecase.InvitationUseCase
+	roleRepo          repository.RoleRepository
+	authService       service.AuthService
+}
+
+// NewInvitationHandler creates a new instance of InvitationHandler
+func NewInvitationHandler(
+	invitationUseCase usecase.InvitationUseCase,
+	roleRepo repository.RoleRepository,
+	authService service.AuthService,
+) *InvitationHandler {
+	return &InvitationHandler{
+		invitationUseCase: invitationUseCase,
+		roleRepo:          roleRepo,
+		authService:       authService,
+	}
+}
+
+// InviteRequest represents the create invitation request body
+type InviteRequest struct {
+	Email   string `json:"email" binding:"required,email" example:"jane@example.com"`
+	RoleIDs []uint `json:"role_ids" example:"1,2"`
+}
+
+// AcceptInvitationRequest represents the accept invitation request body. The
+// password and names are only required when the invited email has no account.
+type AcceptInvitationRequest struct {
+	Token     string `json:"token" binding:"required"`
+	Password  string `json:"password" binding:"omitempty,min=8"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// Invite godoc
+// @Summary Invite a user
+// @Description Email an invitation with a preset set of roles. Callers may only include roles whose effective permissions they hold themselves, within the organization for organization invitations.
+// @Tags invitations
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int false "Organization ID"
+// @Param request body InviteRequest true "Invitee and roles"
+// @Success 201 {object} entity.Invitation
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/admin/invitations [post]
+// @Router /api/v1/organizations/{id}/invitations [post]
+func (h *InvitationHandler) Invite(c *gin.Context) {
+	var req InviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, common.VALIDATION_ERROR)
+		return
+	}
+
+	orgID, ok := invitationScope(c)
+	if !ok {
+		return
+	}
+
+	roles, ok := h.grantableRoles(c, orgID, req.RoleIDs)
+	if !ok {
+		return
+	}
+
+	invitedBy := c.GetUint("user_id")
+	invitation := &entity.Invitation{
+		Email:     req.Email,
+		InvitedBy: &invitedBy,
+		Roles:     roles,
+	}
+	if orgID != 0 {
+		invitation.OrganizationID = &orgID
+	}
+
+	if err := h.invitationUseCase.Invite(c.Request.Context(), invitation); err != nil {
+		switch err {
+		case errors.ErrOrganizationNotFound:
+			c.JSON(http.StatusNotFound, common.ORGANIZATION_NOT_FOUND)
+		case errors.ErrOrganizationInactive:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.ErrAlreadyMember:
+			c.JSON(http.StatusBadRequest, common.ALREADY_MEMBER)
+		default:
+			c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, invitation)
+}
+
+// List godoc
+// @Summary List pending invitations
+// @Description Get a paginated list of the pending invitations to global roles, or to the organization
+// @Tags invitations
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int false "Organization ID"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of items per page" default(10)
+// @Success 200 {array} entity.Invitation
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/admin/invitations [get]
+// @Router /api/v1/organizations/{id}/invitations [get]
+func (h *InvitationHandler) List(c *gin.Context) {
+	orgID, ok := invitationScope(c)
+	if !ok {
+		return
+	}
+
+	page, limit := pagination(c)
+	invitations, total, err := h.invitationUseCase.ListPending(c.Request.Context(), orgID, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  invitations,
+		"total": total,
+	})
+}
+
+// Resend godoc
+// @Summary Resend an invitation
+// @Description Email a new link for a pending invitation. The previous link stops working and the expiry starts over.
+// @Tags invitations
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int false "Organization ID"
+// @Param invitationId path int true "Invitation ID"
+// @Success 200 {object} entity.MessageResponse
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/admin/invitations/{invitationId}/resend [post]
+// @Router /api/v1/organizations/{id}/invitations/{invitationId}/resend [post]
+func (h *InvitationHandler) Resend(c *gin.Context) {
+	orgID, ok := invitationScope(c)
+	if !ok {
+		return
+	}
+	invitationID, ok := pathID(c, "invitationId")
+	if !ok {
+		return
+	}
+
+	if err := h.invitationUseCase.Resend(c.Request.Context(), orgID, invitationID); err != nil {
+		invitationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, common.SUCCESS)
+}
+
+// Revoke godoc
+// @Summary Revoke an invitation
+// @Description Withdraw a pending invitation so that its link stops working
+// @Tags invitations
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int false "Organization ID"
+// @Param invitationId path int true "Invitation ID"
+// @Success 200 {object} entity.MessageResponse
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/admin/invitations/{invitationId} [delete]
+// @Router /api/v1/organizations/{id}/invitations/{invitationId} [delete]
+func (h *InvitationHandler) Revoke(c *gin.Context) {
+	orgID, ok := invitationScope(c)
+	if !ok {
+		return
+	}
+	invitationID, ok := pathID(c, "invitationId")
+	if !ok {
+		return
+	}
+
+	if err := h.invitationUseCase.Revoke(c.Request.Context(), orgID, invitationID); err != nil {
+		invitationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, common.SUCCESS)
+}
+
+// Accept godoc
+// @Summary Accept an invitation
+// @Description Redeem an invitation token. The account with the invited email is linked, or created from the password and names when there is none, and the invitation's membership and roles are granted.
+// @Tags invitations
+// @Accept json
+// @Produce json
+// @Param request body AcceptInvitationRequest true "Invitation token and account details"
+// @Success 200 {object} entity.User
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/auth/accept-invitation [post]
+func (h *InvitationHandler) Accept(c *gin.Context) {
+	var req AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrValidation.Error()})
+		return
+	}
+
+	signup := usecase.InvitationSignup{
+		Password:  req.Password,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+	}
+	user, err := h.invitationUseCase.Accept(c.Request.Context(), req.Token, signup)
+	if err != nil {
+		switch err {
+		case errors.ErrValidation, errors.ErrOrganizationInactive:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(tokenErrorStatus(err), gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Invitation accepted",
+		"user":    user,
+	})
+}
+
+// grantableRoles loads the roles of an invitation, answering the request if
+// one of them is not a role of the organization, or a global role for
+// organization zero, or grants a permission the caller does not hold there
+func (h *InvitationHandler) grantableRoles(c *gin.Context, orgID uint, roleIDs []uint) ([]entity.Role, bool) {
+	roleRepo := h.roleRepo.ForOrganization(orgID)
+	granted := organizationPermissions(c, orgID)
+
+	roles := make([]entity.Role, 0, len(roleIDs))
+	for _, id := range roleIDs {
+		role, err := roleRepo.FindByID(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.INVALID_ROLE)
+			return nil, false
+		}
+
+		permissions, err := h.authService.GetEffectivePermissions(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+			return nil, false
+		}
+		for _, p := range permissions {
+			if !granted.Has(permission.Key(p.Permission.Resource, p.Permission.Action)) {
+				c.JSON(http.StatusForbidden, common.FORBIDDEN)
+				return nil, false
+			}
+		}
+		roles = append(roles, *role)
+	}
+	return roles, true
+}
+
+// invitationScope returns the organization in the id path parameter, or zero
+// on the admin routes, which have none
+func invitationScope(c *gin.Context) (uint, bool) {
+	if c.Param("id") == "" {
+		return 0, true
+	}
+	return pathID(c, "id")
+}
+
+// invitationError answers a request that failed on an existing invitation
+func invitationError(c *gin.Context, err error) {
+	switch err {
+	case errors.ErrInvitationNotFound:
+		c.JSON(http.StatusNotFound, common.INVITATION_NOT_FOUND)
+	case errors.ErrInvitationNotPending:
+		c.JSON(http.StatusBadRequest, common.INVITATION_NOT_PENDING)
+	default:
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+	}
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"net/http"
+
+	"minisapi/services/auth/internal/infrastructure/jwt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWKSHandler publishes the public keys used to verify issued tokens
+type JWKSHandler struct {
+	jwtManager *jwt.JWTManager
+}
+
+// NewJWKSHandler creates a new instance of JWKSHandler
+func NewJWKSHandler(jwtManager *jwt.JWTManager) *JWKSHandler {
+	return &JWKSHandler{
+		jwtManager: jwtManager,
+	}
+}
+
+// Keys godoc
+// @Summary JSON Web Key Set
+// @Description Get the public keys that verify access tokens issued by this service
+// @Tags auth
+// @Produce json
+// @Success 200 {object} jwt.JWKS
+// @Router /.well-known/jwks.json [get]
+func (h *JWKSHandler) Keys(c *gin.Context) {
+	// Verifiers may cache the set, but not for longer than a retiring key
+	// is kept around after rotation
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.jwtManager.JWKS())
+}
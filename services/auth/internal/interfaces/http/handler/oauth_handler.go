@@ -0,0 +1,462 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"minisapi/services/auth/internal/common"
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/service"
+	"minisapi/services/auth/internal/domain/usecase"
+	"minisapi/services/auth/internal/pkg/errors"
+	"minisapi/services/auth/internal/pkg/permission"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Grants supported by the token endpoint
+const (
+	grantTypeClientCredentials = "client_credentials"
+	grantTypeAuthorizationCode = "authorization_code"
+)
+
+// trustClientPermission lets a caller register clients that skip consent
+const trustClientPermission = "client:trust"
+
+// OAuthHandler handles the OAuth2 token endpoint and the registry of the
+// clients allowed to use it
+type OAuthHandler struct {
+	clientService service.OAuthClientService
+	oidcUseCase   usecase.OIDCUseCase
+}
+
+// NewOAuthHandler creates a new instance of OAuthHandler
+func NewOAuthHandler(clientService service.OAuthClientService, oidcUseCase usecase.OIDCUseCase) *OAuthHandler {
+	return &OAuthHandler{
+		clientService: clientService,
+		oidcUseCase:   oidcUseCase,
+	}
+}
+
+// OAuthClientRequest represents the register and update OAuth client request body
+type OAuthClientRequest struct {
+	Name        string   `json:"name" binding:"required,max=255" example:"notification-service"`
+	Description string   `json:"description" binding:"max=255" example:"Sends emails and SMS"`
+	Scopes      []string `json:"scopes" example:"authz:check"`
+	// Audiences are needed for the client_credentials grant and redirect
+	// URIs for the authorization code flow; a client needs at least one
+	Audiences    []string `json:"audiences" example:"notification"`
+	RedirectURIs []string `json:"redirect_uris" example:"https://app.example.com/callback"`
+	Public       bool     `json:"public" example:"false"`
+	SkipConsent  bool     `json:"skip_consent" example:"false"`
+	// Active is ignored on registration; new clients are always active
+	Active *bool `json:"active" example:"true"`
+}
+
+// Token godoc
+// @Summary Issue OAuth2 tokens
+// @Description Issue tokens for the client_credentials grant (RFC 6749 section 4.4) or the authorization_code grant of OpenID Connect. The client authenticates with HTTP Basic or with client_id and client_secret in the form; public clients send client_id only. For client_credentials, scope is space-separated and defaults to all of the client's scopes, and audience defaults to the client's first audience. For authorization_code, code, redirect_uri and the PKCE code_verifier are required.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "client_credentials or authorization_code"
+// @Param scope formData string false "Space-separated scopes"
+// @Param audience formData string false "Service the token is for"
+// @Param code formData string false "Authorization code"
+// @Param redirect_uri formData string false "Redirect URI of the authorization request"
+// @Param code_verifier formData string false "PKCE code verifier"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /oauth/token [post]
+func (h *OAuthHandler) Token(c *gin.Context) {
+	// Token responses must never be cached (RFC 6749 section 5.1)
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	grantType := c.PostForm("grant_type")
+	if grantType != grantTypeClientCredentials && grantType != grantTypeAuthorizationCode {
+		oauthError(c, http.StatusBadRequest, "unsupported_grant_type", "only client_credentials and authorization_code are supported")
+		return
+	}
+
+	clientID, secret, ok := clientCredentials(c)
+	if !ok {
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "client authentication is required")
+		return
+	}
+
+	client, err := h.clientService.Authenticate(c.Request.Context(), clientID, secret)
+	if err != nil {
+		tokenError(c, err)
+		return
+	}
+
+	if grantType == grantTypeAuthorizationCode {
+		tokens, err := h.oidcUseCase.ExchangeCode(c.Request.Context(), client,
+			c.PostForm("code"), c.PostForm("redirect_uri"), c.PostForm("code_verifier"))
+		if err != nil {
+			tokenError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"access_token": tokens.AccessToken,
+			"id_token":     tokens.IDToken,
+			"token_type":   "Bearer",
+			"expires_in":   int(tokens.ExpiresIn.Seconds()),
+			"scope":        strings.Join(tokens.Scopes, " "),
+		})
+		return
+	}
+
+	scopes := strings.Fields(c.PostForm("scope"))
+	token, err := h.clientService.IssueToken(c.Request.Context(), client, scopes, c.PostForm("audience"))
+	if err != nil {
+		tokenError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token": token.AccessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(token.ExpiresIn.Seconds()),
+		"scope":        strings.Join(token.Scopes, " "),
+	})
+}
+
+// clientCredentials reads the client credentials from HTTP Basic
+// authentication, whose parts are form-encoded (RFC 6749 section 2.3.1), or
+// from the request body. Public clients only send their client ID.
+func clientCredentials(c *gin.Context) (string, string, bool) {
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		id, idErr := url.QueryUnescape(id)
+		secret, secretErr := url.QueryUnescape(secret)
+		if idErr != nil || secretErr != nil {
+			return "", "", false
+		}
+		return id, secret, id != ""
+	}
+
+	id, secret := c.PostForm("client_id"), c.PostForm("client_secret")
+	return id, secret, id != ""
+}
+
+// tokenError answers a failed token request
+func tokenError(c *gin.Context, err error) {
+	code := oauthErrorCode(err)
+	switch code {
+	case "invalid_client":
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		oauthError(c, http.StatusUnauthorized, code, err.Error())
+	case "server_error":
+		oauthError(c, http.StatusInternalServerError, code, errors.ErrInternalServer.Error())
+	case "temporarily_unavailable":
+		oauthError(c, http.StatusServiceUnavailable, code, err.Error())
+	default:
+		oauthError(c, http.StatusBadRequest, code, err.Error())
+	}
+}
+
+// oauthErrorCode returns the OAuth 2.0 error code (RFC 6749, OpenID
+// Connect Core and RFC 8707) that stands for an error
+func oauthErrorCode(err error) string {
+	switch err {
+	case errors.ErrInvalidClient:
+		return "invalid_client"
+	case errors.ErrUnauthorizedClient:
+		return "unauthorized_client"
+	case errors.ErrInvalidGrant:
+		return "invalid_grant"
+	case errors.ErrScopeNotAllowed:
+		return "invalid_scope"
+	case errors.ErrAudienceNotAllowed:
+		return "invalid_target"
+	case errors.ErrInvalidAuthRequest, errors.ErrInvalidRedirectURI:
+		return "invalid_request"
+	case errors.ErrUnsupportedResponseType:
+		return "unsupported_response_type"
+	case errors.ErrAccessDenied:
+		return "access_denied"
+	case errors.ErrConsentRequired:
+		return "consent_required"
+	case errors.ErrLoginRequired:
+		return "login_required"
+	case errors.ErrOIDCUnavailable:
+		return "temporarily_unavailable"
+	default:
+		return "server_error"
+	}
+}
+
+// oauthError answers with an RFC 6749 error response
+func oauthError(c *gin.Context, status int, code, description string) {
+	c.JSON(status, gin.H{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+// RegisterClient godoc
+// @Summary Register an OAuth2 client
+// @Description Register a client with the scopes and audiences it may request and the redirect URIs of its sign-in flow. The caller must hold every scope it gives the client, and client:trust to let it skip consent. The client secret is only returned once; public clients get none.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body OAuthClientRequest true "Client details"
+// @Success 201 {object} entity.OAuthClient
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/admin/oauth-clients [post]
+func (h *OAuthHandler) RegisterClient(c *gin.Context) {
+	var req OAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, common.VALIDATION_ERROR)
+		return
+	}
+	if !checkClientGrants(c, nil, req) {
+		return
+	}
+
+	client := &entity.OAuthClient{
+		Name:         req.Name,
+		Description:  req.Description,
+		Scopes:       req.Scopes,
+		Audiences:    req.Audiences,
+		RedirectURIs: req.RedirectURIs,
+		Public:       req.Public,
+		SkipConsent:  req.SkipConsent,
+		Active:       true,
+	}
+	secret, err := h.clientService.Register(c.Request.Context(), client)
+	if err != nil {
+		clientError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"client":        client,
+		"client_secret": secret,
+	})
+}
+
+// ListClients godoc
+// @Summary List OAuth2 clients
+// @Description Get a paginated list of the registered clients
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of items per page" default(10)
+// @Success 200 {array} entity.OAuthClient
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/admin/oauth-clients [get]
+func (h *OAuthHandler) ListClients(c *gin.Context) {
+	page, limit := pagination(c)
+
+	clients, total, err := h.clientService.List(c.Request.Context(), page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  clients,
+		"total": total,
+	})
+}
+
+// GetClient godoc
+// @Summary Get an OAuth2 client
+// @Description Get a registered client by ID
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Client ID"
+// @Success 200 {object} entity.OAuthClient
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Router /api/v1/admin/oauth-clients/{id} [get]
+func (h *OAuthHandler) GetClient(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	client, err := h.clientService.Get(c.Request.Context(), id)
+	if err != nil {
+		clientError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, client)
+}
+
+// UpdateClient godoc
+// @Summary Update an OAuth2 client
+// @Description Update a client's name, description, scopes, audiences and redirect URIs, or deactivate it. Scopes it does not have yet must be held by the caller, and letting it skip consent takes client:trust. A client made public loses its secret; one made confidential gets one by rotating it. Tokens already issued stay valid until they expire.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Client ID"
+// @Param request body OAuthClientRequest true "Client details"
+// @Success 200 {object} entity.OAuthClient
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/admin/oauth-clients/{id} [put]
+func (h *OAuthHandler) UpdateClient(c *gin.Context) {
+	var req OAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, common.VALIDATION_ERROR)
+		return
+	}
+
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	client, err := h.clientService.Get(c.Request.Context(), id)
+	if err != nil {
+		clientError(c, err)
+		return
+	}
+	if !checkClientGrants(c, client, req) {
+		return
+	}
+
+	client.Name = req.Name
+	client.Description = req.Description
+	client.Scopes = req.Scopes
+	client.Audiences = req.Audiences
+	client.RedirectURIs = req.RedirectURIs
+	client.Public = req.Public
+	client.SkipConsent = req.SkipConsent
+	if req.Active != nil {
+		client.Active = *req.Active
+	}
+
+	if err := h.clientService.Update(c.Request.Context(), client); err != nil {
+		clientError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, client)
+}
+
+// RotateClientSecret godoc
+// @Summary Rotate an OAuth2 client secret
+// @Description Replace a client's secret. The old secret stops working at once; the new one is only returned once. Public clients have no secret.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Client ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/admin/oauth-clients/{id}/rotate-secret [post]
+func (h *OAuthHandler) RotateClientSecret(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	secret, err := h.clientService.RotateSecret(c.Request.Context(), id)
+	if err != nil {
+		clientError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"client_secret": secret})
+}
+
+// DeleteClient godoc
+// @Summary Delete an OAuth2 client
+// @Description Delete a client so that it can no longer obtain tokens
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Client ID"
+// @Success 200 {object} entity.MessageResponse
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/admin/oauth-clients/{id} [delete]
+func (h *OAuthHandler) DeleteClient(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.clientService.Delete(c.Request.Context(), id); err != nil {
+		clientError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, common.SUCCESS)
+}
+
+// checkClientGrants answers 400 or 403 unless the caller may give the client
+// what the request asks for. A client must not outgrow the credential that
+// registers it: the caller needs every scope the client did not have yet,
+// and client:trust to let it skip consent.
+func checkClientGrants(c *gin.Context, current *entity.OAuthClient, req OAuthClientRequest) bool {
+	granted := callerPermissions(c)
+	held := permission.NewSet(nil)
+	trusted := false
+	if current != nil {
+		held = permission.NewSet(current.Scopes)
+		trusted = current.SkipConsent
+	}
+
+	for _, scope := range req.Scopes {
+		if _, _, ok := permission.Split(scope); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrInvalidScope.Error()})
+			return false
+		}
+		if !held.Has(scope) && !granted.Has(scope) {
+			c.JSON(http.StatusForbidden, common.FORBIDDEN)
+			return false
+		}
+	}
+
+	if req.SkipConsent && !trusted && !granted.Has(trustClientPermission) {
+		c.JSON(http.StatusForbidden, common.FORBIDDEN)
+		return false
+	}
+	return true
+}
+
+// clientError answers a failed client registry request
+func clientError(c *gin.Context, err error) {
+	switch err {
+	case errors.ErrClientNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.ErrInvalidScope, errors.ErrInvalidRedirectURI, errors.ErrValidation:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+	}
+}
@@ -0,0 +1,238 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"minisapi/services/auth/internal/configs"
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/domain/service"
+	"minisapi/services/auth/internal/infrastructure/jwt"
+	"minisapi/services/auth/internal/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRegisterClientWithinCallerPermissions(t *testing.T) {
+	s := newClientServer(t)
+
+	tests := []struct {
+		name        string
+		permissions []string
+		scopes      []string
+		skipConsent bool
+		want        int
+	}{
+		{"scopes held", []string{"client:create", "authz:check"}, []string{"authz:check"}, false, http.StatusCreated},
+		{"scopes covered by a wildcard", []string{"client:create", "user:*"}, []string{"user:read"}, false, http.StatusCreated},
+		{"scope not held", []string{"client:create", "authz:check"}, []string{"authz:check", "user:delete"}, false, http.StatusForbidden},
+		{"malformed scope", []string{"client:create", "*:*"}, []string{"authz"}, false, http.StatusBadRequest},
+		{"skip consent without trust", []string{"client:create"}, nil, true, http.StatusForbidden},
+		{"skip consent with trust", []string{"client:create", "client:trust"}, nil, true, http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := serve(s.admin(tt.permissions...), http.MethodPost, "/api/v1/admin/oauth-clients", map[string]interface{}{
+				"name":          "app",
+				"scopes":        tt.scopes,
+				"audiences":     []string{"notification"},
+				"redirect_uris": []string{"https://app.example.com/callback"},
+				"skip_consent":  tt.skipConsent,
+			})
+			if status != tt.want {
+				t.Fatalf("register = %d, want %d", status, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateClientWithinCallerPermissions(t *testing.T) {
+	s := newClientServer(t)
+	client := &entity.OAuthClient{Name: "billing", Scopes: []string{"user:delete"}, Audiences: []string{"billing"}, Active: true}
+	if _, err := s.clientService.Register(context.Background(), client); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	path := fmt.Sprintf("/api/v1/admin/oauth-clients/%d", client.ID)
+	router := s.admin("client:update", "authz:check")
+
+	update := func(scopes []string, skipConsent bool) int {
+		return serve(router, http.MethodPut, path, map[string]interface{}{
+			"name":         "billing",
+			"scopes":       scopes,
+			"audiences":    []string{"billing"},
+			"skip_consent": skipConsent,
+		})
+	}
+
+	// Scopes the client already has need not be held by the caller
+	if status := update([]string{"user:delete", "authz:check"}, false); status != http.StatusOK {
+		t.Fatalf("update with held and existing scopes = %d, want 200", status)
+	}
+	if status := update([]string{"user:delete", "role:assign"}, false); status != http.StatusForbidden {
+		t.Fatalf("update adding a scope not held = %d, want 403", status)
+	}
+	if status := update([]string{"user:delete"}, true); status != http.StatusForbidden {
+		t.Fatalf("update skipping consent without trust = %d, want 403", status)
+	}
+
+	stored, _ := s.clientService.Get(context.Background(), client.ID)
+	if strings.Join(stored.Scopes, " ") != "user:delete authz:check" || stored.SkipConsent {
+		t.Fatalf("stored client = %v skip_consent %v, want the first update only", stored.Scopes, stored.SkipConsent)
+	}
+}
+
+func TestClientCredentialsGrant(t *testing.T) {
+	s := newClientServer(t)
+	client := &entity.OAuthClient{Name: "notification", Scopes: []string{"authz:check", "user:read"}, Audiences: []string{"notification", "billing"}, Active: true}
+	secret, err := s.clientService.Register(context.Background(), client)
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	public := &entity.OAuthClient{Name: "spa", Audiences: []string{"notification"}, RedirectURIs: []string{"https://app.example.com/callback"}, Public: true, Active: true}
+	if _, err := s.clientService.Register(context.Background(), public); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	status, body := s.token(client.ClientID, secret, url.Values{"grant_type": {"client_credentials"}, "scope": {"authz:check"}, "audience": {"billing"}})
+	if status != http.StatusOK || body["token_type"] != "Bearer" || body["scope"] != "authz:check" {
+		t.Fatalf("token = %d %v", status, body)
+	}
+	claims, err := s.jwtManager.ValidateScopedToken(body["access_token"].(string), "billing")
+	if err != nil {
+		t.Fatalf("client token: %v", err)
+	}
+	if claims.Subject != client.ClientID || claims.ClientID != client.ClientID || claims.Scope != "authz:check" {
+		t.Fatalf("client token claims = %+v", claims)
+	}
+
+	tests := []struct {
+		name      string
+		clientID  string
+		secret    string
+		form      url.Values
+		status    int
+		wantError string
+	}{
+		{"wrong secret", client.ClientID, "wrong", url.Values{"grant_type": {"client_credentials"}}, http.StatusUnauthorized, "invalid_client"},
+		{"unknown client", "svc_unknown", secret, url.Values{"grant_type": {"client_credentials"}}, http.StatusUnauthorized, "invalid_client"},
+		{"scope not allowed", client.ClientID, secret, url.Values{"grant_type": {"client_credentials"}, "scope": {"user:delete"}}, http.StatusBadRequest, "invalid_scope"},
+		{"audience not allowed", client.ClientID, secret, url.Values{"grant_type": {"client_credentials"}, "audience": {"payments"}}, http.StatusBadRequest, "invalid_target"},
+		{"unsupported grant", client.ClientID, secret, url.Values{"grant_type": {"password"}}, http.StatusBadRequest, "unsupported_grant_type"},
+		{"public client", public.ClientID, "", url.Values{"grant_type": {"client_credentials"}}, http.StatusBadRequest, "unauthorized_client"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := s.token(tt.clientID, tt.secret, tt.form)
+			if status != tt.status || body["error"] != tt.wantError {
+				t.Fatalf("token = %d %v, want %d %s", status, body, tt.status, tt.wantError)
+			}
+		})
+	}
+}
+
+// clientServer serves the client registry and the token endpoint over an
+// in-memory registry
+type clientServer struct {
+	t             *testing.T
+	handler       *OAuthHandler
+	clientService service.OAuthClientService
+	jwtManager    *jwt.JWTManager
+}
+
+func newClientServer(t *testing.T) *clientServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	jwtManager, err := jwt.NewJWTManager(configs.JWTConfig{
+		Secret:     "test-secret",
+		Expiration: "15m",
+		Issuer:     "https://auth.test",
+		Audience:   []string{"minisapi"},
+	})
+	if err != nil {
+		t.Fatalf("NewJWTManager: %v", err)
+	}
+	clientService := service.NewOAuthClientService(
+		&memoryClientRepo{clients: map[uint]*entity.OAuthClient{}},
+		jwtManager,
+		configs.OAuthConfig{ClientTokenTTL: 5 * time.Minute},
+	)
+
+	return &clientServer{t: t, handler: NewOAuthHandler(clientService, nil), clientService: clientService, jwtManager: jwtManager}
+}
+
+// admin returns the client registry routes as seen by a caller granted the
+// permissions
+func (s *clientServer) admin(permissions ...string) *gin.Engine {
+	router := gin.New()
+	clients := router.Group("/api/v1/admin/oauth-clients", withClaims(1, permissions...))
+	clients.POST("", s.handler.RegisterClient)
+	clients.PUT("/:id", s.handler.UpdateClient)
+	return router
+}
+
+func (s *clientServer) token(clientID, secret string, form url.Values) (int, map[string]interface{}) {
+	s.t.Helper()
+	router := gin.New()
+	router.POST("/oauth/token", s.handler.Token)
+
+	req := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(secret))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		s.t.Fatalf("decode token response: %v", err)
+	}
+	return rec.Code, body
+}
+
+// memoryClientRepo is an in-memory client registry. Clients are copied in
+// and out, as a database would.
+type memoryClientRepo struct {
+	repository.OAuthClientRepository
+	clients map[uint]*entity.OAuthClient
+}
+
+func (r *memoryClientRepo) Create(client *entity.OAuthClient) error {
+	client.ID = uint(len(r.clients) + 1)
+	stored := *client
+	r.clients[client.ID] = &stored
+	return nil
+}
+
+func (r *memoryClientRepo) Update(client *entity.OAuthClient) error {
+	stored := *client
+	r.clients[client.ID] = &stored
+	return nil
+}
+
+func (r *memoryClientRepo) FindByID(id uint) (*entity.OAuthClient, error) {
+	if client, ok := r.clients[id]; ok {
+		found := *client
+		return &found, nil
+	}
+	return nil, errors.ErrClientNotFound
+}
+
+func (r *memoryClientRepo) FindByClientID(clientID string) (*entity.OAuthClient, error) {
+	for _, client := range r.clients {
+		if client.ClientID == clientID {
+			found := *client
+			return &found, nil
+		}
+	}
+	return nil, errors.ErrClientNotFound
+}
@@ -0,0 +1,295 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"minisapi/services/auth/internal/common"
+	"minisapi/services/auth/internal/domain/usecase"
+	"minisapi/services/auth/internal/infrastructure/jwt"
+	"minisapi/services/auth/internal/pkg/errors"
+	"minisapi/services/auth/internal/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OIDCHandler handles the OpenID Connect provider endpoints and the
+// consents users gave to relying parties
+type OIDCHandler struct {
+	oidcUseCase usecase.OIDCUseCase
+}
+
+// NewOIDCHandler creates a new instance of OIDCHandler
+func NewOIDCHandler(oidcUseCase usecase.OIDCUseCase) *OIDCHandler {
+	return &OIDCHandler{
+		oidcUseCase: oidcUseCase,
+	}
+}
+
+// AuthorizationParams are the parameters of an authorization request
+type AuthorizationParams struct {
+	ResponseType        string `form:"response_type" json:"response_type" example:"code"`
+	ClientID            string `form:"client_id" json:"client_id" example:"svc_0123456789abcdef"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri" example:"https://app.example.com/callback"`
+	Scope               string `form:"scope" json:"scope" example:"openid profile email"`
+	State               string `form:"state" json:"state"`
+	Nonce               string `form:"nonce" json:"nonce"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method" example:"S256"`
+	Prompt              string `form:"prompt" json:"prompt" example:"consent"`
+}
+
+func (p AuthorizationParams) request() usecase.AuthorizationRequest {
+	return usecase.AuthorizationRequest{
+		ResponseType:        p.ResponseType,
+		ClientID:            p.ClientID,
+		RedirectURI:         p.RedirectURI,
+		Scope:               p.Scope,
+		State:               p.State,
+		Nonce:               p.Nonce,
+		CodeChallenge:       p.CodeChallenge,
+		CodeChallengeMethod: p.CodeChallengeMethod,
+		Prompt:              p.Prompt,
+	}
+}
+
+// AuthorizeRequest represents the request the login page sends once the
+// user has signed in, and again with their answer on the consent screen
+type AuthorizeRequest struct {
+	AuthorizationParams
+	// Approve is the user's answer on the consent screen; omit it until
+	// the user has been asked
+	Approve *bool `json:"approve" example:"true"`
+}
+
+// Discovery godoc
+// @Summary OpenID Connect discovery
+// @Description Get the OpenID Provider metadata
+// @Tags oidc
+// @Produce json
+// @Success 200 {object} usecase.ProviderMetadata
+// @Failure 503 {object} map[string]interface{}
+// @Router /.well-known/openid-configuration [get]
+func (h *OIDCHandler) Discovery(c *gin.Context) {
+	metadata, err := h.oidcUseCase.Metadata()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, metadata)
+}
+
+// BeginAuthorization godoc
+// @Summary Start an OpenID Connect authorization
+// @Description Validate an authorization code request (PKCE with S256 is required) and send the user agent to the login page with the request. Errors are reported to the redirect URI, unless the client or redirect URI is invalid.
+// @Tags oidc
+// @Param response_type query string true "Must be code"
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string true "Registered redirect URI"
+// @Param scope query string true "Space-separated scopes, including openid"
+// @Param state query string false "Opaque value returned to the client"
+// @Param nonce query string false "Value returned in the ID token"
+// @Param code_challenge query string true "PKCE code challenge"
+// @Param code_challenge_method query string true "Must be S256"
+// @Param prompt query string false "none or consent"
+// @Success 302
+// @Failure 400 {object} map[string]interface{}
+// @Router /oauth/authorize [get]
+func (h *OIDCHandler) BeginAuthorization(c *gin.Context) {
+	var params AuthorizationParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		oauthError(c, http.StatusBadRequest, "invalid_request", errors.ErrInvalidAuthRequest.Error())
+		return
+	}
+
+	loginURL, err := h.oidcUseCase.CheckAuthorization(c.Request.Context(), params.request())
+	if err != nil {
+		if redirect, ok := authorizationErrorRedirect(params, err); ok {
+			c.Redirect(http.StatusFound, redirect)
+			return
+		}
+		authorizationError(c, err)
+		return
+	}
+
+	c.Redirect(http.StatusFound, loginURL)
+}
+
+// Authorize godoc
+// @Summary Authorize a relying party
+// @Description Called by the login page with the user's access token and the authorization request. Answers with the client and scopes when the user has to consent, and otherwise with the URL to send the user agent back to, carrying either the authorization code or an error.
+// @Tags oidc
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body AuthorizeRequest true "Authorization request"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /api/v1/oauth/authorize [post]
+func (h *OIDCHandler) Authorize(c *gin.Context) {
+	var req AuthorizeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, common.VALIDATION_ERROR)
+		return
+	}
+
+	claims, ok := c.MustGet("claims").(*jwt.Claims)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errors.ErrUnauthorized.Error()})
+		return
+	}
+
+	result, err := h.oidcUseCase.Authorize(c.Request.Context(), claims, req.request(), req.Approve)
+	if err != nil {
+		if redirect, ok := authorizationErrorRedirect(req.AuthorizationParams, err); ok {
+			c.JSON(http.StatusOK, gin.H{"redirect_to": redirect})
+			return
+		}
+		authorizationError(c, err)
+		return
+	}
+
+	if result.ConsentRequired {
+		c.JSON(http.StatusOK, gin.H{
+			"consent_required": true,
+			"client": gin.H{
+				"client_id":   result.Client.ClientID,
+				"name":        result.Client.Name,
+				"description": result.Client.Description,
+			},
+			"scopes": result.Scopes,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"redirect_to": result.RedirectURI})
+}
+
+// authorizationErrorRedirect returns the redirect URI carrying the error.
+// Errors about the client or redirect URI, and server errors, are never
+// redirected.
+func authorizationErrorRedirect(params AuthorizationParams, err error) (string, bool) {
+	switch err {
+	case errors.ErrInvalidClient, errors.ErrInvalidRedirectURI, errors.ErrLoginRequired:
+		return "", false
+	}
+	code := oauthErrorCode(err)
+	if code == "server_error" {
+		return "", false
+	}
+
+	query := url.Values{"error": {code}, "error_description": {err.Error()}}
+	if params.State != "" {
+		query.Set("state", params.State)
+	}
+	return utils.AppendQuery(params.RedirectURI, query), true
+}
+
+// authorizationError answers an authorization request that cannot be
+// redirected back to the client
+func authorizationError(c *gin.Context, err error) {
+	switch err {
+	case errors.ErrInvalidClient, errors.ErrInvalidRedirectURI:
+		oauthError(c, http.StatusBadRequest, oauthErrorCode(err), err.Error())
+	case errors.ErrLoginRequired:
+		oauthError(c, http.StatusUnauthorized, oauthErrorCode(err), err.Error())
+	default:
+		oauthError(c, http.StatusInternalServerError, "server_error", errors.ErrInternalServer.Error())
+	}
+}
+
+// UserInfo godoc
+// @Summary OpenID Connect userinfo
+// @Description Get the claims about the user that the access token's scopes release. Only access tokens issued at the token endpoint for the authorization code grant are accepted.
+// @Tags oidc
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} usecase.UserInfo
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Router /oauth/userinfo [get]
+// @Router /oauth/userinfo [post]
+func (h *OIDCHandler) UserInfo(c *gin.Context) {
+	token, ok := bearerToken(c)
+	if !ok {
+		c.Header("WWW-Authenticate", `Bearer`)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errors.ErrUnauthorized.Error()})
+		return
+	}
+
+	info, err := h.oidcUseCase.UserInfo(c.Request.Context(), token)
+	if err != nil {
+		switch err {
+		case errors.ErrInvalidToken, errors.ErrTokenRevoked:
+			// RFC 6750 section 3
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			oauthError(c, http.StatusUnauthorized, "invalid_token", err.Error())
+		case errors.ErrForbidden:
+			c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+			oauthError(c, http.StatusForbidden, "insufficient_scope", err.Error())
+		default:
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": errors.ErrServiceUnavailable.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+// bearerToken reads the access token from the Authorization header
+func bearerToken(c *gin.Context) (string, bool) {
+	parts := strings.Split(c.GetHeader("Authorization"), " ")
+	if len(parts) != 2 || parts[0] != "Bearer" || parts[1] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// ListConsents godoc
+// @Summary List consents
+// @Description List the relying parties the user has allowed to sign them in, with the scopes they allowed
+// @Tags oidc
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} entity.Consent
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/auth/consents [get]
+func (h *OIDCHandler) ListConsents(c *gin.Context) {
+	consents, err := h.oidcUseCase.ListConsents(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": consents})
+}
+
+// RevokeConsent godoc
+// @Summary Revoke a consent
+// @Description Revoke the consent given to a relying party, so that it has to ask again
+// @Tags oidc
+// @Produce json
+// @Security Bearer
+// @Param clientId path string true "Client ID"
+// @Success 200 {object} entity.MessageResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/auth/consents/{clientId} [delete]
+func (h *OIDCHandler) RevokeConsent(c *gin.Context) {
+	err := h.oidcUseCase.RevokeConsent(c.Request.Context(), c.GetUint("user_id"), c.Param("clientId"))
+	if err != nil {
+		if err == errors.ErrConsentNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	c.JSON(http.StatusOK, common.SUCCESS)
+}
@@ -0,0 +1,573 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"minisapi/services/auth/internal/configs"
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/domain/service"
+	"minisapi/services/auth/internal/domain/usecase"
+	"minisapi/services/auth/internal/infrastructure/jwt"
+	"minisapi/services/auth/internal/interfaces/http/middleware"
+	"minisapi/services/auth/internal/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+	gojwt "github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testLoginURL    = "https://login.example.com/authorize"
+	testRedirectURI = "https://app.example.com/callback"
+	testSessionID   = "5f0c6f43-52a4-4f7e-9d67-0d4c1f7e5b2a"
+)
+
+// TestOIDCAuthorizationCodeFlow drives the whole authorization code flow
+// the way a relying party and the login page would, against the provider
+// served in-process
+func TestOIDCAuthorizationCodeFlow(t *testing.T) {
+	p := newTestProvider(t)
+	rp := &relyingParty{t: t, provider: p, clientID: p.client.ClientID, secret: p.secret}
+
+	metadata := rp.discover()
+	if metadata.Issuer != p.server.URL {
+		t.Fatalf("issuer = %q, want %q", metadata.Issuer, p.server.URL)
+	}
+
+	// First sign-in: the user is asked for consent
+	params := rp.authorize(metadata, "openid profile email")
+	var answer map[string]interface{}
+	status := p.loginPage(params, nil, p.userToken, &answer)
+	if status != http.StatusOK || answer["consent_required"] != true {
+		t.Fatalf("authorize = %d %v, want consent_required", status, answer)
+	}
+	approve := true
+	p.loginPage(params, &approve, p.userToken, &answer)
+	code := rp.callback(answer, params.Get("state"))
+
+	tokens := rp.exchange(metadata, code, testRedirectURI, rp.verifier)
+	idToken := rp.verifyIDToken(metadata, tokens["id_token"].(string))
+	if idToken.Nonce != rp.nonce || idToken.Subject != "42" || idToken.Email != "jane@example.com" ||
+		idToken.AccessTokenHash != jwt.AccessTokenHash(tokens["access_token"].(string)) {
+		t.Fatalf("unexpected ID token claims: %+v", idToken)
+	}
+	if idToken.SessionID != testSessionID || idToken.AuthTime == 0 {
+		t.Fatalf("ID token does not describe the login session: %+v", idToken)
+	}
+
+	// Both tokens come from the same issuer; the access token is only for
+	// the userinfo endpoint
+	accessClaims := &jwt.Claims{}
+	if _, _, err := gojwt.NewParser().ParseUnverified(tokens["access_token"].(string), accessClaims); err != nil {
+		t.Fatalf("parse access token: %v", err)
+	}
+	if accessClaims.Issuer != idToken.Issuer || len(accessClaims.Audience) != 1 || accessClaims.Audience[0] != metadata.UserInfoEndpoint {
+		t.Fatalf("access token iss %q aud %v, want iss %q aud %q", accessClaims.Issuer, accessClaims.Audience, idToken.Issuer, metadata.UserInfoEndpoint)
+	}
+
+	info := rp.userInfo(metadata, tokens["access_token"].(string))
+	if info["sub"] != "42" || info["email"] != "jane@example.com" || info["preferred_username"] != "jane" {
+		t.Fatalf("unexpected userinfo: %v", info)
+	}
+
+	// Codes are single-use
+	if status, body := rp.tokenRequest(metadata, code, testRedirectURI, rp.verifier); status != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Fatalf("replayed code = %d %v, want invalid_grant", status, body)
+	}
+
+	// Access tokens issued to relying parties are not accepted as user
+	// credentials by the rest of the API
+	if status := p.loginPage(params, nil, tokens["access_token"].(string), &answer); status != http.StatusUnauthorized {
+		t.Fatalf("authorize with a relying party token = %d, want 401", status)
+	}
+
+	// Second sign-in: consent was remembered
+	params = rp.authorize(metadata, "openid email")
+	p.loginPage(params, nil, p.userToken, &answer)
+	code = rp.callback(answer, params.Get("state"))
+
+	// The PKCE verifier of another request does not redeem the code
+	if status, body := rp.tokenRequest(metadata, code, testRedirectURI, strings.Repeat("a", 43)); status != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Fatalf("wrong verifier = %d %v, want invalid_grant", status, body)
+	}
+
+	// Ending the login session revokes the tokens issued from it
+	params = rp.authorize(metadata, "openid")
+	p.loginPage(params, nil, p.userToken, &answer)
+	tokens = rp.exchange(metadata, rp.callback(answer, params.Get("state")), testRedirectURI, rp.verifier)
+	p.authService.revokedSessions[testSessionID] = true
+	req, _ := http.NewRequest(http.MethodGet, metadata.UserInfoEndpoint, nil)
+	req.Header.Set("Authorization", "Bearer "+tokens["access_token"].(string))
+	if resp := rp.do(req, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("userinfo after the session ended = %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestOIDCAuthorizationErrors(t *testing.T) {
+	p := newTestProvider(t)
+	rp := &relyingParty{t: t, provider: p, clientID: p.client.ClientID, secret: p.secret}
+	metadata := rp.discover()
+
+	tests := []struct {
+		name      string
+		mutate    func(url.Values)
+		status    int
+		wantError string
+	}{
+		{"unregistered redirect uri", func(v url.Values) { v.Set("redirect_uri", "https://evil.example.com/") }, http.StatusBadRequest, "invalid_request"},
+		{"unknown client", func(v url.Values) { v.Set("client_id", "svc_unknown") }, http.StatusBadRequest, "invalid_client"},
+		{"missing openid scope", func(v url.Values) { v.Set("scope", "profile") }, http.StatusFound, "invalid_scope"},
+		{"unsupported scope", func(v url.Values) { v.Set("scope", "openid user:delete") }, http.StatusFound, "invalid_scope"},
+		{"plain pkce", func(v url.Values) { v.Set("code_challenge_method", "plain") }, http.StatusFound, "invalid_request"},
+		{"implicit flow", func(v url.Values) { v.Set("response_type", "token") }, http.StatusFound, "unsupported_response_type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := rp.authorizationParams("openid")
+			tt.mutate(params)
+
+			resp := rp.do(mustRequest(t, http.MethodGet, metadata.AuthorizationEndpoint+"?"+params.Encode(), nil), nil)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if tt.status == http.StatusFound {
+				location, _ := url.Parse(resp.Header.Get("Location"))
+				if !strings.HasPrefix(location.String(), testRedirectURI) || location.Query().Get("error") != tt.wantError ||
+					location.Query().Get("state") != params.Get("state") {
+					t.Fatalf("redirect = %s, want %s error with state", location, tt.wantError)
+				}
+			}
+		})
+	}
+
+	// Denying consent sends the user back with access_denied
+	params := rp.authorize(metadata, "openid")
+	deny := false
+	var answer map[string]interface{}
+	p.loginPage(params, &deny, p.userToken, &answer)
+	location, _ := url.Parse(answer["redirect_to"].(string))
+	if location.Query().Get("error") != "access_denied" {
+		t.Fatalf("redirect = %s, want access_denied", location)
+	}
+
+	// prompt=none cannot show the consent screen
+	params = rp.authorize(metadata, "openid")
+	params.Set("prompt", "none")
+	p.loginPage(params, nil, p.userToken, &answer)
+	location, _ = url.Parse(answer["redirect_to"].(string))
+	if location.Query().Get("error") != "consent_required" {
+		t.Fatalf("redirect = %s, want consent_required", location)
+	}
+}
+
+// TestOIDCRequiresAsymmetricKeys checks that a provider signing with the
+// shared secret refuses the flow, since relying parties could only verify
+// its ID tokens with the secret that also signs every access token
+func TestOIDCRequiresAsymmetricKeys(t *testing.T) {
+	p := newTestProviderWithKeys(t, nil)
+	rp := &relyingParty{t: t, provider: p, clientID: p.client.ClientID, secret: p.secret}
+
+	var body map[string]interface{}
+	if resp := rp.do(mustRequest(t, http.MethodGet, p.server.URL+"/.well-known/openid-configuration", nil), &body); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("discovery = %d %v, want 503", resp.StatusCode, body)
+	}
+
+	// The error goes back to the client once its redirect URI is trusted
+	params := rp.authorizationParams("openid")
+	resp := rp.do(mustRequest(t, http.MethodGet, p.server.URL+"/oauth/authorize?"+params.Encode(), nil), nil)
+	location, _ := url.Parse(resp.Header.Get("Location"))
+	if resp.StatusCode != http.StatusFound || location.Query().Get("error") != "temporarily_unavailable" {
+		t.Fatalf("authorization = %d to %s, want temporarily_unavailable", resp.StatusCode, location)
+	}
+	var answer map[string]interface{}
+	p.loginPage(params, nil, p.userToken, &answer)
+	redirect, _ := answer["redirect_to"].(string)
+	if location, _ := url.Parse(redirect); location == nil || location.Query().Get("error") != "temporarily_unavailable" {
+		t.Fatalf("login page authorization = %v, want temporarily_unavailable", answer)
+	}
+
+	status, body := rp.tokenRequest(&usecase.ProviderMetadata{TokenEndpoint: p.server.URL + "/oauth/token"}, "code", testRedirectURI, rp.verifier)
+	if status != http.StatusServiceUnavailable || body["error"] != "temporarily_unavailable" {
+		t.Fatalf("token request = %d %v, want temporarily_unavailable", status, body)
+	}
+
+	if _, err := p.jwtManager.GenerateIDToken(jwt.NewIDTokenClaims("42", p.client.ClientID), time.Minute); err == nil {
+		t.Fatal("ID token signed with the shared secret")
+	}
+}
+
+// relyingParty is a minimal OpenID Connect client
+type relyingParty struct {
+	t        *testing.T
+	provider *testProvider
+	clientID string
+	secret   string
+	verifier string
+	nonce    string
+}
+
+func (rp *relyingParty) do(req *http.Request, out interface{}) *http.Response {
+	rp.t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Do(req)
+	if err != nil {
+		rp.t.Fatalf("%s %s: %v", req.Method, req.URL, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			rp.t.Fatalf("%s %s: decode response: %v", req.Method, req.URL, err)
+		}
+	}
+	return resp
+}
+
+func (rp *relyingParty) discover() *usecase.ProviderMetadata {
+	var metadata usecase.ProviderMetadata
+	rp.do(mustRequest(rp.t, http.MethodGet, rp.provider.server.URL+"/.well-known/openid-configuration", nil), &metadata)
+	return &metadata
+}
+
+func (rp *relyingParty) authorizationParams(scope string) url.Values {
+	rp.verifier = randomString(rp.t)
+	rp.nonce = randomString(rp.t)
+	challenge := sha256.Sum256([]byte(rp.verifier))
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {rp.clientID},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {scope},
+		"state":                 {randomString(rp.t)},
+		"nonce":                 {rp.nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+// authorize starts an authorization and returns the parameters the login
+// page receives
+func (rp *relyingParty) authorize(metadata *usecase.ProviderMetadata, scope string) url.Values {
+	rp.t.Helper()
+	params := rp.authorizationParams(scope)
+	resp := rp.do(mustRequest(rp.t, http.MethodGet, metadata.AuthorizationEndpoint+"?"+params.Encode(), nil), nil)
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if resp.StatusCode != http.StatusFound || err != nil || !strings.HasPrefix(location.String(), testLoginURL) {
+		rp.t.Fatalf("authorization = %d to %q, want redirect to the login page", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	return location.Query()
+}
+
+// callback checks the authorization response and returns its code
+func (rp *relyingParty) callback(answer map[string]interface{}, state string) string {
+	rp.t.Helper()
+	redirect, _ := answer["redirect_to"].(string)
+	location, err := url.Parse(redirect)
+	if err != nil || !strings.HasPrefix(redirect, testRedirectURI) {
+		rp.t.Fatalf("authorization answer = %v, want redirect to the client", answer)
+	}
+	query := location.Query()
+	if query.Get("state") != state || query.Get("iss") != rp.provider.server.URL || query.Get("code") == "" {
+		rp.t.Fatalf("unexpected authorization response: %s", redirect)
+	}
+	return query.Get("code")
+}
+
+func (rp *relyingParty) tokenRequest(metadata *usecase.ProviderMetadata, code, redirectURI, verifier string) (int, map[string]interface{}) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	}
+	req := mustRequest(rp.t, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(rp.clientID), url.QueryEscape(rp.secret))
+
+	var body map[string]interface{}
+	resp := rp.do(req, &body)
+	return resp.StatusCode, body
+}
+
+func (rp *relyingParty) exchange(metadata *usecase.ProviderMetadata, code, redirectURI, verifier string) map[string]interface{} {
+	rp.t.Helper()
+	status, body := rp.tokenRequest(metadata, code, redirectURI, verifier)
+	if status != http.StatusOK {
+		rp.t.Fatalf("token request = %d %v", status, body)
+	}
+	return body
+}
+
+// verifyIDToken checks the ID token against the keys published at jwks_uri
+func (rp *relyingParty) verifyIDToken(metadata *usecase.ProviderMetadata, idToken string) *jwt.IDTokenClaims {
+	rp.t.Helper()
+	var jwks jwt.JWKS
+	rp.do(mustRequest(rp.t, http.MethodGet, metadata.JWKSURI, nil), &jwks)
+
+	claims := &jwt.IDTokenClaims{}
+	_, err := gojwt.ParseWithClaims(idToken, claims, func(token *gojwt.Token) (interface{}, error) {
+		for _, key := range jwks.Keys {
+			if key.Kid == token.Header["kid"] {
+				x, err := base64.RawURLEncoding.DecodeString(key.X)
+				return ed25519.PublicKey(x), err
+			}
+		}
+		return nil, errors.ErrInvalidToken
+	}, gojwt.WithIssuer(metadata.Issuer), gojwt.WithAudience(rp.clientID), gojwt.WithExpirationRequired())
+	if err != nil {
+		rp.t.Fatalf("ID token does not verify: %v", err)
+	}
+	return claims
+}
+
+func (rp *relyingParty) userInfo(metadata *usecase.ProviderMetadata, accessToken string) map[string]interface{} {
+	rp.t.Helper()
+	req := mustRequest(rp.t, http.MethodGet, metadata.UserInfoEndpoint, nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	var info map[string]interface{}
+	if resp := rp.do(req, &info); resp.StatusCode != http.StatusOK {
+		rp.t.Fatalf("userinfo = %d %v", resp.StatusCode, info)
+	}
+	return info
+}
+
+// testProvider serves the provider endpoints in-process with in-memory
+// repositories
+type testProvider struct {
+	t           *testing.T
+	server      *httptest.Server
+	client      *entity.OAuthClient
+	secret      string
+	userToken   string
+	authService *fakeAuthService
+	jwtManager  *jwt.JWTManager
+}
+
+// loginPage posts the authorization request as the login page would once
+// the user has signed in, and returns the status code
+func (p *testProvider) loginPage(params url.Values, approve *bool, accessToken string, out *map[string]interface{}) int {
+	p.t.Helper()
+	body := map[string]interface{}{}
+	for key := range params {
+		body[key] = params.Get(key)
+	}
+	if approve != nil {
+		body["approve"] = *approve
+	}
+	payload, _ := json.Marshal(body)
+
+	req := mustRequest(p.t, http.MethodPost, p.server.URL+"/api/v1/oauth/authorize", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		p.t.Fatalf("authorize: %v", err)
+	}
+	defer resp.Body.Close()
+	*out = map[string]interface{}{}
+	_ = json.NewDecoder(resp.Body).Decode(out)
+	return resp.StatusCode
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+	return newTestProviderWithKeys(t, []string{writeSigningKey(t)})
+}
+
+// newTestProviderWithKeys serves a provider that signs with the given key
+// files, or with the shared secret when there are none
+func newTestProviderWithKeys(t *testing.T, keyFiles []string) *testProvider {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	jwtManager, err := jwt.NewJWTManager(configs.JWTConfig{
+		Secret:         "test-secret",
+		Expiration:     "1h",
+		Issuer:         server.URL,
+		Audience:       []string{"minisapi"},
+		ActiveKeyFiles: keyFiles,
+	})
+	if err != nil {
+		t.Fatalf("NewJWTManager: %v", err)
+	}
+
+	cfg := configs.OAuthConfig{
+		ClientTokenTTL: 5 * time.Minute,
+		LoginURL:       testLoginURL,
+		CodeTTL:        time.Minute,
+		TokenTTL:       time.Hour,
+	}
+
+	user := &entity.User{ID: 42, Email: "jane@example.com", Username: "jane", FirstName: "Jane", LastName: "Doe", Active: true, EmailVerified: true}
+	clientRepo := &memoryClientRepo{clients: map[uint]*entity.OAuthClient{}}
+	authService := &fakeAuthService{jwtManager: jwtManager, revokedSessions: map[string]bool{}}
+	oidcUseCase := usecase.NewOIDCUseCase(
+		clientRepo,
+		&fakeCodeRepo{codes: map[string]*entity.AuthorizationCode{}},
+		&fakeConsentRepo{consents: map[string]*entity.Consent{}},
+		&fakeUserRepo{user: user},
+		&fakeSessionRepo{session: &entity.Session{UserID: user.ID, FamilyID: testSessionID, Active: true, CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}},
+		authService,
+		jwtManager,
+		cfg,
+	)
+	clientService := service.NewOAuthClientService(clientRepo, jwtManager, cfg)
+
+	oauth := NewOAuthHandler(clientService, oidcUseCase)
+	oidc := NewOIDCHandler(oidcUseCase)
+	authMiddleware := middleware.NewAuthMiddleware(authService, nil)
+	router.GET("/.well-known/jwks.json", NewJWKSHandler(jwtManager).Keys)
+	router.GET("/.well-known/openid-configuration", oidc.Discovery)
+	router.GET("/oauth/authorize", oidc.BeginAuthorization)
+	router.POST("/oauth/token", oauth.Token)
+	router.GET("/oauth/userinfo", oidc.UserInfo)
+	router.POST("/api/v1/oauth/authorize", authMiddleware.Authenticate(), oidc.Authorize)
+
+	client := &entity.OAuthClient{Name: "Wiki", RedirectURIs: []string{testRedirectURI}, Active: true}
+	secret, err := clientService.Register(context.Background(), client)
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	claims := jwt.NewClaims(user.ID)
+	claims.SessionID = testSessionID
+	claims.AuthMethods = []string{jwt.AuthMethodPassword}
+	userToken, err := jwtManager.GenerateAccessToken(claims)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+
+	return &testProvider{t: t, server: server, client: client, secret: secret, userToken: userToken, authService: authService, jwtManager: jwtManager}
+}
+
+func writeSigningKey(t *testing.T) string {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "signing.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func randomString(t *testing.T) string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func mustRequest(t *testing.T, method, target string, body io.Reader) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+// In-memory fakes. Embedded interfaces leave the methods the flow does not
+// use unimplemented.
+
+type fakeCodeRepo struct {
+	repository.AuthorizationCodeRepository
+	codes map[string]*entity.AuthorizationCode
+}
+
+func (r *fakeCodeRepo) Create(code *entity.AuthorizationCode) error {
+	r.codes[code.CodeHash] = code
+	return nil
+}
+
+func (r *fakeCodeRepo) Consume(hash string) (*entity.AuthorizationCode, error) {
+	code, ok := r.codes[hash]
+	if !ok || code.Used {
+		return nil, errors.ErrInvalidGrant
+	}
+	code.Used = true
+	return code, nil
+}
+
+type fakeConsentRepo struct {
+	repository.ConsentRepository
+	consents map[string]*entity.Consent
+}
+
+func (r *fakeConsentRepo) Find(userID uint, clientID string) (*entity.Consent, error) {
+	if consent, ok := r.consents[clientID]; ok && consent.UserID == userID {
+		return consent, nil
+	}
+	return nil, errors.ErrConsentNotFound
+}
+
+func (r *fakeConsentRepo) Save(consent *entity.Consent) error {
+	r.consents[consent.ClientID] = consent
+	return nil
+}
+
+type fakeUserRepo struct {
+	repository.UserRepository
+	user *entity.User
+}
+
+func (r *fakeUserRepo) FindByID(id uint) (*entity.User, error) {
+	if id != r.user.ID {
+		return nil, errors.ErrUserNotFound
+	}
+	return r.user, nil
+}
+
+type fakeSessionRepo struct {
+	repository.SessionRepository
+	session *entity.Session
+}
+
+func (r *fakeSessionRepo) FindByFamily(familyID string) (*entity.Session, error) {
+	if familyID != r.session.FamilyID {
+		return nil, errors.ErrSessionNotFound
+	}
+	return r.session, nil
+}
+
+type fakeAuthService struct {
+	service.AuthService
+	jwtManager      *jwt.JWTManager
+	revokedSessions map[string]bool
+}
+
+func (s *fakeAuthService) ValidateToken(token string) (*jwt.Claims, error) {
+	return s.jwtManager.ValidateToken(token)
+}
+
+func (s *fakeAuthService) IsAccessRevoked(ctx context.Context, claims *jwt.Claims) (bool, error) {
+	return s.revokedSessions[claims.SessionID], nil
+}
@@ -0,0 +1,754 @@
+package handler
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"minisapi/services/auth/internal/common"
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/domain/service"
+	"minisapi/services/auth/internal/infrastructure/jwt"
+	"minisapi/services/auth/internal/pkg/errors"
+	"minisapi/services/auth/internal/pkg/permission"
+
+	"github.com/gin-gonic/gin"
+)
+
+// slugPattern matches lowercase words joined by single hyphens
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// OrganizationHandler handles organizations, their members and their roles
+type OrganizationHandler struct {
+	orgRepo        repository.OrganizationRepository
+	roleRepo       repository.RoleRepository
+	permissionRepo repository.PermissionRepository
+	userRepo       repository.UserRepository
+	authService    service.AuthService
+}
+
+// NewOrganizationHandler creates a new instance of OrganizationHandler
+func NewOrganizationHandler(
+	orgRepo repository.OrganizationRepository,
+	roleRepo repository.RoleRepository,
+	permissionRepo repository.PermissionRepository,
+	userRepo repository.UserRepository,
+	authService service.AuthService,
+) *OrganizationHandler {
+	return &OrganizationHandler{
+		orgRepo:        orgRepo,
+		roleRepo:       roleRepo,
+		permissionRepo: permissionRepo,
+		userRepo:       userRepo,
+		authService:    authService,
+	}
+}
+
+// CreateOrganizationRequest represents the create organization request body
+type CreateOrganizationRequest struct {
+	Name        string `json:"name" binding:"required,max=255" example:"Acme Corp"`
+	Slug        string `json:"slug" binding:"required,max=100" example:"acme"`
+	Description string `json:"description" binding:"max=255" example:"Acme Corporation"`
+}
+
+// UpdateOrganizationRequest represents the update organization request body
+type UpdateOrganizationRequest struct {
+	Name        string                    `json:"name" binding:"required,max=255" example:"Acme Corp"`
+	Description string                    `json:"description" binding:"max=255" example:"Acme Corporation"`
+	Status      entity.OrganizationStatus `json:"status" binding:"omitempty,oneof=active inactive" example:"active"`
+}
+
+// AddMemberRequest represents the add member request body
+type AddMemberRequest struct {
+	UserID uint `json:"user_id" binding:"required" example:"42"`
+}
+
+// OrganizationRoleRequest represents the create organization role request body
+type OrganizationRoleRequest struct {
+	Name        string `json:"name" binding:"required,max=255" example:"billing-admin"`
+	Description string `json:"description" binding:"max=255" example:"Manages the organization's billing"`
+	Permissions []uint `json:"permissions" example:"1,2"`
+}
+
+// MemberRoleIDsRequest represents a request to take a member out of roles
+type MemberRoleIDsRequest struct {
+	RoleIDs []uint `json:"role_ids" binding:"required,min=1" example:"1,2"`
+}
+
+// Create godoc
+// @Summary Create an organization
+// @Description Create a tenant organization. Requires the global organization:create permission.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body CreateOrganizationRequest true "Organization details"
+// @Success 201 {object} entity.Organization
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/organizations [post]
+func (h *OrganizationHandler) Create(c *gin.Context) {
+	var req CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !slugPattern.MatchString(req.Slug) {
+		c.JSON(http.StatusBadRequest, common.VALIDATION_ERROR)
+		return
+	}
+
+	if _, err := h.orgRepo.FindBySlug(req.Slug); err == nil {
+		c.JSON(http.StatusBadRequest, common.ORGANIZATION_EXISTS)
+		return
+	}
+
+	org := &entity.Organization{
+		Name:        req.Name,
+		Slug:        req.Slug,
+		Description: req.Description,
+		Status:      entity.OrganizationStatusActive,
+	}
+	if err := h.orgRepo.Create(org); err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	c.JSON(http.StatusCreated, org)
+}
+
+// List godoc
+// @Summary List organizations
+// @Description Get a paginated list of organizations. Requires the global organization:read permission.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of items per page" default(10)
+// @Success 200 {array} entity.Organization
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/organizations [get]
+func (h *OrganizationHandler) List(c *gin.Context) {
+	page, limit := pagination(c)
+
+	orgs, total, err := h.orgRepo.List(page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  orgs,
+		"total": total,
+	})
+}
+
+// Get godoc
+// @Summary Get an organization
+// @Description Get an organization by ID
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Organization ID"
+// @Success 200 {object} entity.Organization
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Router /api/v1/organizations/{id} [get]
+func (h *OrganizationHandler) Get(c *gin.Context) {
+	org, ok := h.findOrganization(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, org)
+}
+
+// Update godoc
+// @Summary Update an organization
+// @Description Update an organization's name, description and status. Deactivating an organization revokes the access tokens of its members.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Organization ID"
+// @Param request body UpdateOrganizationRequest true "Organization details"
+// @Success 200 {object} entity.Organization
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/organizations/{id} [put]
+func (h *OrganizationHandler) Update(c *gin.Context) {
+	var req UpdateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, common.VALIDATION_ERROR)
+		return
+	}
+
+	org, ok := h.findOrganization(c)
+	if !ok {
+		return
+	}
+
+	deactivated := false
+	if req.Status != "" && req.Status != org.Status {
+		deactivated = req.Status == entity.OrganizationStatusInactive
+		org.Status = req.Status
+	}
+	org.Name = req.Name
+	org.Description = req.Description
+
+	if err := h.orgRepo.Update(org); err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	// Tokens scoped to the organization must stop working with it
+	if deactivated {
+		memberIDs, err := h.orgRepo.FindMemberIDs(org.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+			return
+		}
+		if err := h.authService.RevokeUserAccess(c.Request.Context(), memberIDs...); err != nil {
+			c.JSON(http.StatusServiceUnavailable, common.SERVICE_UNAVAILABLE)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, org)
+}
+
+// Delete godoc
+// @Summary Delete an organization
+// @Description Delete an organization with its memberships and roles. Requires the global organization:delete permission.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Organization ID"
+// @Success 200 {object} entity.MessageResponse
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/organizations/{id} [delete]
+func (h *OrganizationHandler) Delete(c *gin.Context) {
+	orgID, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	// Members are looked up before their memberships are gone
+	memberIDs, err := h.orgRepo.FindMemberIDs(orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	if err := h.orgRepo.Delete(orgID); err != nil {
+		if err == errors.ErrOrganizationNotFound {
+			c.JSON(http.StatusNotFound, common.ORGANIZATION_NOT_FOUND)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	h.revokeAccess(c, memberIDs...)
+}
+
+// ListMembers godoc
+// @Summary List the members of an organization
+// @Description Get a paginated list of the organization's members
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Organization ID"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of items per page" default(10)
+// @Success 200 {array} entity.OrganizationMember
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/organizations/{id}/members [get]
+func (h *OrganizationHandler) ListMembers(c *gin.Context) {
+	org, ok := h.findOrganization(c)
+	if !ok {
+		return
+	}
+
+	page, limit := pagination(c)
+	members, total, err := h.orgRepo.ListMembers(org.ID, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  members,
+		"total": total,
+	})
+}
+
+// AddMember godoc
+// @Summary Add a member to an organization
+// @Description Make a user a member of the organization, so that they can switch to it and be granted its roles. Requires the global organization:update and user:read permissions; administrators of the organization invite members instead.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Organization ID"
+// @Param request body AddMemberRequest true "User to add"
+// @Success 201 {object} entity.OrganizationMember
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/organizations/{id}/members [post]
+func (h *OrganizationHandler) AddMember(c *gin.Context) {
+	orgID, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req AddMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, common.VALIDATION_ERROR)
+		return
+	}
+
+	addedBy := c.GetUint("user_id")
+	member := &entity.OrganizationMember{
+		OrganizationID: orgID,
+		UserID:         req.UserID,
+		AddedBy:        &addedBy,
+	}
+	if err := h.orgRepo.AddMember(member); err != nil {
+		switch err {
+		case errors.ErrOrganizationNotFound:
+			c.JSON(http.StatusNotFound, common.ORGANIZATION_NOT_FOUND)
+		case errors.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, common.USER_NOT_FOUND)
+		default:
+			c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, member)
+}
+
+// RemoveMember godoc
+// @Summary Remove a member from an organization
+// @Description End a membership together with the user's grants of the organization's roles
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Organization ID"
+// @Param userId path int true "User ID"
+// @Success 200 {object} entity.MessageResponse
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/organizations/{id}/members/{userId} [delete]
+func (h *OrganizationHandler) RemoveMember(c *gin.Context) {
+	orgID, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	userID, ok := pathID(c, "userId")
+	if !ok {
+		return
+	}
+
+	if err := h.orgRepo.RemoveMember(orgID, userID); err != nil {
+		if err == errors.ErrNotMember {
+			c.JSON(http.StatusBadRequest, common.NOT_MEMBER)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	h.revokeAccess(c, userID)
+}
+
+// ListRoles godoc
+// @Summary List the roles of an organization
+// @Description Get a paginated list of the roles scoped to the organization
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Organization ID"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of items per page" default(10)
+// @Success 200 {array} entity.Role
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/organizations/{id}/roles [get]
+func (h *OrganizationHandler) ListRoles(c *gin.Context) {
+	org, ok := h.findOrganization(c)
+	if !ok {
+		return
+	}
+
+	page, limit := pagination(c)
+	roles, total, err := h.roleRepo.ForOrganization(org.ID).List(page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  roles,
+		"total": total,
+	})
+}
+
+// CreateRole godoc
+// @Summary Create an organization role
+// @Description Create a role scoped to the organization. Its permissions only hold within the organization, and callers may only include permissions they hold there themselves.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Organization ID"
+// @Param request body OrganizationRoleRequest true "Role details"
+// @Success 201 {object} entity.Role
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/organizations/{id}/roles [post]
+func (h *OrganizationHandler) CreateRole(c *gin.Context) {
+	var req OrganizationRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, common.VALIDATION_ERROR)
+		return
+	}
+
+	org, ok := h.findOrganization(c)
+	if !ok {
+		return
+	}
+
+	roleRepo := h.roleRepo.ForOrganization(org.ID)
+	if _, err := roleRepo.FindByName(req.Name); err == nil {
+		c.JSON(http.StatusBadRequest, common.ROLE_EXISTS)
+		return
+	}
+
+	role := &entity.Role{
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: make([]entity.Permission, 0, len(req.Permissions)),
+	}
+
+	granted := organizationPermissions(c, org.ID)
+	for _, permID := range req.Permissions {
+		perm, err := h.permissionRepo.FindByID(permID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.INVALID_PERMISSION)
+			return
+		}
+		if !granted.Has(permission.Key(perm.Resource, perm.Action)) {
+			c.JSON(http.StatusForbidden, common.FORBIDDEN)
+			return
+		}
+		role.Permissions = append(role.Permissions, *perm)
+	}
+
+	if err := roleRepo.Create(role); err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	c.JSON(http.StatusCreated, role)
+}
+
+// DeleteRole godoc
+// @Summary Delete an organization role
+// @Description Delete a role of the organization and revoke the access tokens of its holders
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Organization ID"
+// @Param roleId path int true "Role ID"
+// @Success 200 {object} entity.MessageResponse
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/organizations/{id}/roles/{roleId} [delete]
+func (h *OrganizationHandler) DeleteRole(c *gin.Context) {
+	orgID, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	roleID, ok := pathID(c, "roleId")
+	if !ok {
+		return
+	}
+
+	roleRepo := h.roleRepo.ForOrganization(orgID)
+	if _, err := roleRepo.FindByID(roleID); err != nil {
+		c.JSON(http.StatusNotFound, common.ROLE_NOT_FOUND)
+		return
+	}
+
+	// Other roles of the organization may inherit from the role, so their
+	// holders lose permissions too
+	holders, err := findHolders(h.roleRepo, h.userRepo, roleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	if err := roleRepo.Delete(roleID); err != nil {
+		if err == errors.ErrRoleNotFound {
+			c.JSON(http.StatusNotFound, common.ROLE_NOT_FOUND)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	userIDs := make([]uint, 0, len(holders))
+	for _, user := range holders {
+		userIDs = append(userIDs, user.ID)
+	}
+	h.revokeAccess(c, userIDs...)
+}
+
+// AssignMemberRoles godoc
+// @Summary Grant organization roles to a member
+// @Description Grant roles of the organization to one of its members. Callers may only grant roles whose effective permissions they hold within the organization themselves.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Organization ID"
+// @Param userId path int true "User ID"
+// @Param request body RoleIDsRequest true "Role IDs and grant terms"
+// @Success 200 {object} entity.MessageResponse
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/organizations/{id}/members/{userId}/roles [post]
+func (h *OrganizationHandler) AssignMemberRoles(c *gin.Context) {
+	var req RoleIDsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, common.VALIDATION_ERROR)
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, common.VALIDATION_ERROR)
+		return
+	}
+
+	orgID, userID, ok := h.memberFromPath(c)
+	if !ok {
+		return
+	}
+
+	if !h.ensureOrganizationRoles(c, orgID, req.RoleIDs) {
+		return
+	}
+
+	granted := organizationPermissions(c, orgID)
+	for _, id := range req.RoleIDs {
+		permissions, err := h.authService.GetEffectivePermissions(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+			return
+		}
+		for _, p := range permissions {
+			if !granted.Has(permission.Key(p.Permission.Resource, p.Permission.Action)) {
+				c.JSON(http.StatusForbidden, common.FORBIDDEN)
+				return
+			}
+		}
+	}
+
+	grantedBy := c.GetUint("user_id")
+	grant := entity.UserRole{
+		GrantedBy: &grantedBy,
+		ExpiresAt: req.ExpiresAt,
+		Reason:    req.Reason,
+	}
+	if err := h.userRepo.AssignRoles(userID, req.RoleIDs, grant); err != nil {
+		switch err {
+		case errors.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, common.USER_NOT_FOUND)
+		case errors.ErrRoleNotFound:
+			c.JSON(http.StatusBadRequest, common.INVALID_ROLE)
+		default:
+			c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		}
+		return
+	}
+
+	h.revokeAccess(c, userID)
+}
+
+// RemoveMemberRoles godoc
+// @Summary Take a member out of organization roles
+// @Description Revoke roles of the organization from one of its members
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Organization ID"
+// @Param userId path int true "User ID"
+// @Param request body MemberRoleIDsRequest true "Role IDs"
+// @Success 200 {object} entity.MessageResponse
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/organizations/{id}/members/{userId}/roles [delete]
+func (h *OrganizationHandler) RemoveMemberRoles(c *gin.Context) {
+	var req MemberRoleIDsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, common.VALIDATION_ERROR)
+		return
+	}
+
+	orgID, userID, ok := h.memberFromPath(c)
+	if !ok {
+		return
+	}
+
+	if !h.ensureOrganizationRoles(c, orgID, req.RoleIDs) {
+		return
+	}
+
+	if err := h.userRepo.RemoveRoles(userID, req.RoleIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	h.revokeAccess(c, userID)
+}
+
+// findOrganization loads the organization in the id path parameter,
+// answering the request if it cannot
+func (h *OrganizationHandler) findOrganization(c *gin.Context) (*entity.Organization, bool) {
+	orgID, ok := pathID(c, "id")
+	if !ok {
+		return nil, false
+	}
+
+	org, err := h.orgRepo.FindByID(orgID)
+	if err != nil {
+		if err == errors.ErrOrganizationNotFound {
+			c.JSON(http.StatusNotFound, common.ORGANIZATION_NOT_FOUND)
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return nil, false
+	}
+	return org, true
+}
+
+// memberFromPath parses the organization and user path parameters and makes
+// sure the user is a member, answering the request if not
+func (h *OrganizationHandler) memberFromPath(c *gin.Context) (uint, uint, bool) {
+	orgID, ok := pathID(c, "id")
+	if !ok {
+		return 0, 0, false
+	}
+	userID, ok := pathID(c, "userId")
+	if !ok {
+		return 0, 0, false
+	}
+
+	member, err := h.orgRepo.IsMember(orgID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return 0, 0, false
+	}
+	if !member {
+		c.JSON(http.StatusBadRequest, common.NOT_MEMBER)
+		return 0, 0, false
+	}
+	return orgID, userID, true
+}
+
+// ensureOrganizationRoles makes sure every role belongs to the organization,
+// so that global roles cannot be granted or revoked through it
+func (h *OrganizationHandler) ensureOrganizationRoles(c *gin.Context, orgID uint, roleIDs []uint) bool {
+	roleRepo := h.roleRepo.ForOrganization(orgID)
+	for _, id := range roleIDs {
+		if _, err := roleRepo.FindByID(id); err != nil {
+			c.JSON(http.StatusBadRequest, common.INVALID_ROLE)
+			return false
+		}
+	}
+	return true
+}
+
+// organizationPermissions returns the permissions the caller holds within the
+// organization, or their global permissions for organization zero. Grants of
+// the organization's roles only count while the caller's token is scoped to it.
+func organizationPermissions(c *gin.Context, orgID uint) *permission.Set {
+	claims, ok := c.MustGet("claims").(*jwt.Claims)
+	if !ok {
+		return permission.NewSet(nil)
+	}
+	if claims.OrganizationID == orgID {
+		return permission.NewSet(claims.ScopedPermissions())
+	}
+	return permission.NewSet(claims.Permissions)
+}
+
+// revokeAccess drops the cached permissions and revokes the access tokens of
+// users whose organization grants changed, then answers the request
+func (h *OrganizationHandler) revokeAccess(c *gin.Context, userIDs ...uint) {
+	if err := h.authService.InvalidateUserPermissions(c.Request.Context(), userIDs...); err != nil {
+		c.JSON(http.StatusServiceUnavailable, common.SERVICE_UNAVAILABLE)
+		return
+	}
+	if err := h.authService.RevokeUserAccess(c.Request.Context(), userIDs...); err != nil {
+		c.JSON(http.StatusServiceUnavailable, common.SERVICE_UNAVAILABLE)
+		return
+	}
+
+	c.JSON(http.StatusOK, common.SUCCESS)
+}
+
+// pagination reads the page and limit query parameters
+func pagination(c *gin.Context) (int, int) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 10
+	}
+	return page, limit
+}
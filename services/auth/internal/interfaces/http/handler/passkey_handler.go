@@ -0,0 +1,314 @@
+package handler
+
+import (
+	"net/http"
+
+	"minisapi/services/auth/internal/common"
+	"minisapi/services/auth/internal/domain/usecase"
+	"minisapi/services/auth/internal/infrastructure/webauthn"
+	"minisapi/services/auth/internal/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PasskeyHandler handles WebAuthn passkey registration, sign-in with
+// passkeys and the passkeys registered to accounts
+type PasskeyHandler struct {
+	passkeyUseCase usecase.PasskeyUseCase
+}
+
+// NewPasskeyHandler creates a new instance of PasskeyHandler
+func NewPasskeyHandler(passkeyUseCase usecase.PasskeyUseCase) *PasskeyHandler {
+	return &PasskeyHandler{
+		passkeyUseCase: passkeyUseCase,
+	}
+}
+
+// RegisterPasskeyRequest carries the credential created by
+// navigator.credentials.create and the name to list it under
+type RegisterPasskeyRequest struct {
+	Name       string                         `json:"name" binding:"max=100"`
+	Credential *webauthn.RegistrationResponse `json:"credential" binding:"required"`
+}
+
+// PasskeyLoginRequest carries the credential returned by
+// navigator.credentials.get
+type PasskeyLoginRequest struct {
+	Credential *webauthn.AssertionResponse `json:"credential" binding:"required"`
+}
+
+// PasskeyTwoFactorOptionsRequest carries the MFA token of a login waiting
+// for its second factor
+type PasskeyTwoFactorOptionsRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+// PasskeyTwoFactorRequest carries the MFA token of a login waiting for its
+// second factor and the credential returned by navigator.credentials.get
+type PasskeyTwoFactorRequest struct {
+	MFAToken   string                      `json:"mfa_token" binding:"required"`
+	Credential *webauthn.AssertionResponse `json:"credential" binding:"required"`
+}
+
+// RenamePasskeyRequest carries the new name of a passkey
+type RenamePasskeyRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// ListPasskeys godoc
+// @Summary List passkeys
+// @Description List the passkeys the user registered
+// @Tags passkeys
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} entity.Passkey
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/v1/auth/passkeys [get]
+func (h *PasskeyHandler) ListPasskeys(c *gin.Context) {
+	passkeys, err := h.passkeyUseCase.ListPasskeys(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": passkeys})
+}
+
+// BeginRegistration godoc
+// @Summary Start registering a passkey
+// @Description Get the options to pass to navigator.credentials.create. Requires a recent login, with the second factor when two-factor authentication is enabled.
+// @Tags passkeys
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} webauthn.CreationOptions
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 503 {object} entity.ErrorResponse
+// @Router /api/v1/auth/passkeys/register/options [post]
+func (h *PasskeyHandler) BeginRegistration(c *gin.Context) {
+	options, err := h.passkeyUseCase.BeginRegistration(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(passkeyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, options)
+}
+
+// FinishRegistration godoc
+// @Summary Register a passkey
+// @Description Store the passkey created with the options of the registration the user started
+// @Tags passkeys
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body RegisterPasskeyRequest true "Created credential"
+// @Success 201 {object} entity.Passkey
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 409 {object} entity.ErrorResponse
+// @Router /api/v1/auth/passkeys [post]
+func (h *PasskeyHandler) FinishRegistration(c *gin.Context) {
+	var req RegisterPasskeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrValidation.Error()})
+		return
+	}
+
+	passkey, err := h.passkeyUseCase.FinishRegistration(c.Request.Context(), c.GetUint("user_id"), req.Name, req.Credential)
+	if err != nil {
+		c.JSON(passkeyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, passkey)
+}
+
+// RenamePasskey godoc
+// @Summary Rename a passkey
+// @Tags passkeys
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Passkey ID"
+// @Param request body RenamePasskeyRequest true "New name"
+// @Success 200 {object} entity.Passkey
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Router /api/v1/auth/passkeys/{id} [patch]
+func (h *PasskeyHandler) RenamePasskey(c *gin.Context) {
+	passkeyID, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req RenamePasskeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrValidation.Error()})
+		return
+	}
+
+	passkey, err := h.passkeyUseCase.RenamePasskey(c.Request.Context(), c.GetUint("user_id"), passkeyID, req.Name)
+	if err != nil {
+		c.JSON(passkeyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, passkey)
+}
+
+// DeletePasskey godoc
+// @Summary Delete a passkey
+// @Description Remove a passkey from the user's account. It can no longer be used to sign in. Requires a recent login.
+// @Tags passkeys
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Passkey ID"
+// @Success 200 {object} entity.MessageResponse
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Router /api/v1/auth/passkeys/{id} [delete]
+func (h *PasskeyHandler) DeletePasskey(c *gin.Context) {
+	passkeyID, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.passkeyUseCase.DeletePasskey(c.Request.Context(), c.GetUint("user_id"), passkeyID); err != nil {
+		c.JSON(passkeyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, common.SUCCESS)
+}
+
+// BeginLogin godoc
+// @Summary Start signing in with a passkey
+// @Description Get the options to pass to navigator.credentials.get. Any passkey registered for this service can answer them; no username is needed.
+// @Tags passkeys
+// @Produce json
+// @Success 200 {object} webauthn.RequestOptions
+// @Failure 503 {object} entity.ErrorResponse
+// @Router /api/v1/auth/passkeys/login/options [post]
+func (h *PasskeyHandler) BeginLogin(c *gin.Context) {
+	options, err := h.passkeyUseCase.BeginLogin(c.Request.Context())
+	if err != nil {
+		c.JSON(passkeyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, options)
+}
+
+// FinishLogin godoc
+// @Summary Sign in with a passkey
+// @Description Exchange the credential returned by navigator.credentials.get for access and refresh tokens
+// @Tags passkeys
+// @Accept json
+// @Produce json
+// @Param request body PasskeyLoginRequest true "Returned credential"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 423 {object} entity.ErrorResponse
+// @Router /api/v1/auth/passkeys/login [post]
+func (h *PasskeyHandler) FinishLogin(c *gin.Context) {
+	var req PasskeyLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrValidation.Error()})
+		return
+	}
+
+	result, err := h.passkeyUseCase.FinishLogin(c.Request.Context(), req.Credential, clientInfo(c))
+	if err != nil {
+		c.JSON(passkeyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":          result.User,
+		"access_token":  result.AccessToken,
+		"refresh_token": result.RefreshToken,
+	})
+}
+
+// BeginTwoFactor godoc
+// @Summary Start completing a login with a passkey
+// @Description Get the options to pass to navigator.credentials.get to present one of the user's passkeys as second factor
+// @Tags passkeys
+// @Accept json
+// @Produce json
+// @Param request body PasskeyTwoFactorOptionsRequest true "MFA token"
+// @Success 200 {object} webauthn.RequestOptions
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Router /api/v1/auth/login/2fa/passkey/options [post]
+func (h *PasskeyHandler) BeginTwoFactor(c *gin.Context) {
+	var req PasskeyTwoFactorOptionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrValidation.Error()})
+		return
+	}
+
+	options, err := h.passkeyUseCase.BeginTwoFactor(c.Request.Context(), req.MFAToken)
+	if err != nil {
+		c.JSON(passkeyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, options)
+}
+
+// FinishTwoFactor godoc
+// @Summary Complete a login with a passkey
+// @Description Exchange an MFA token and the credential returned by navigator.credentials.get for access and refresh tokens
+// @Tags passkeys
+// @Accept json
+// @Produce json
+// @Param request body PasskeyTwoFactorRequest true "MFA token and returned credential"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 423 {object} entity.ErrorResponse
+// @Failure 429 {object} entity.ErrorResponse
+// @Router /api/v1/auth/login/2fa/passkey [post]
+func (h *PasskeyHandler) FinishTwoFactor(c *gin.Context) {
+	var req PasskeyTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrValidation.Error()})
+		return
+	}
+
+	result, err := h.passkeyUseCase.FinishTwoFactor(c.Request.Context(), req.MFAToken, req.Credential, clientInfo(c))
+	if err != nil {
+		c.JSON(passkeyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":          result.User,
+		"access_token":  result.AccessToken,
+		"refresh_token": result.RefreshToken,
+	})
+}
+
+// passkeyErrorStatus maps a passkey failure to its HTTP status
+func passkeyErrorStatus(err error) int {
+	switch err {
+	case errors.ErrPasskeyNotFound, errors.ErrNoPasskeys:
+		return http.StatusNotFound
+	case errors.ErrPasskeyExists:
+		return http.StatusConflict
+	case errors.ErrDatabase:
+		return http.StatusInternalServerError
+	default:
+		return loginErrorStatus(err)
+	}
+}
@@ -0,0 +1,449 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"minisapi/services/auth/internal/configs"
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/usecase"
+	"minisapi/services/auth/internal/infrastructure/jwt"
+	"minisapi/services/auth/internal/infrastructure/webauthn"
+	"minisapi/services/auth/internal/infrastructure/webauthn/webauthntest"
+	"minisapi/services/auth/internal/pkg/errors"
+)
+
+const passkeyOrigin = "https://app.example.com"
+
+// TestPasskeyLogin registers passkeys through the API and signs in with
+// them without a password
+func TestPasskeyLogin(t *testing.T) {
+	s := newPasskeyServer(t)
+	jane := s.users.add(&entity.User{Email: "jane@example.com", FirstName: "Jane", LastName: "Doe", Active: true, EmailVerified: true})
+	otto := s.users.add(&entity.User{Email: "otto@example.com", Active: true, EmailVerified: true, TwoFactorEnabled: true})
+	janesPhone := webauthntest.NewAuthenticator(t, passkeyOrigin)
+	ottosKey := webauthntest.NewAuthenticator(t, passkeyOrigin)
+
+	passkey := s.register(jane.ID, janesPhone, "Phone")
+	if passkey.UserID != jane.ID || passkey.Name != "Phone" || len(passkey.Transports) == 0 {
+		t.Fatalf("registered passkey = %+v", passkey)
+	}
+	s.register(otto.ID, ottosKey, "")
+	if passkeys := s.passkeys.byUser(otto.ID); len(passkeys) != 1 || passkeys[0].Name != "Passkey" {
+		t.Fatalf("otto's passkeys = %+v, want one with the default name", passkeys)
+	}
+
+	// A passkey proves possession and the user's verification, so it
+	// signs in at aal2 without asking for TOTP
+	status, body := s.login(janesPhone)
+	if status != http.StatusOK {
+		t.Fatalf("login = %d %v", status, body)
+	}
+	s.checkTokens(body, jane.ID, jwt.AuthMethodPasskey)
+	if status, body := s.login(ottosKey); status != http.StatusOK {
+		t.Fatalf("login with 2FA enabled = %d %v", status, body)
+	} else {
+		s.checkTokens(body, otto.ID, jwt.AuthMethodPasskey)
+	}
+	if stored := s.passkeys.byUser(jane.ID)[0]; stored.SignCount == 0 || stored.LastUsedAt == nil {
+		t.Fatalf("stored passkey = %+v, want its use recorded", stored)
+	}
+
+	// A challenge completes a single ceremony
+	options := s.loginOptions()
+	resp := janesPhone.SignIn(options)
+	if status, body := s.finishLogin(resp); status != http.StatusOK {
+		t.Fatalf("login = %d %v", status, body)
+	}
+	if status, _ := s.finishLogin(resp); status != http.StatusUnauthorized {
+		t.Fatalf("replayed login = %d, want 401", status)
+	}
+
+	// Passwordless logins need the authenticator to verify the user
+	janesPhone.VerifiesUser = false
+	if status, _ := s.login(janesPhone); status != http.StatusUnauthorized {
+		t.Fatalf("login without user verification = %d, want 401", status)
+	}
+	janesPhone.VerifiesUser = true
+
+	// An inactive account cannot sign in with its passkey
+	jane.Active = false
+	if status, _ := s.login(janesPhone); status != http.StatusForbidden {
+		t.Fatalf("login of an inactive user = %d, want 403", status)
+	}
+	jane.Active = true
+
+	if status, _ := s.post("/api/v1/auth/passkeys/login", map[string]interface{}{}, "", nil); status != http.StatusBadRequest {
+		t.Fatalf("login without a credential = %d, want 400", status)
+	}
+}
+
+// TestPasskeyTwoFactor completes password logins with a passkey as second
+// factor
+func TestPasskeyTwoFactor(t *testing.T) {
+	s := newPasskeyServer(t)
+	jane := s.users.add(&entity.User{Email: "jane@example.com", Active: true, EmailVerified: true, TwoFactorEnabled: true})
+	mallory := s.users.add(&entity.User{Email: "mallory@example.com", Active: true, EmailVerified: true, TwoFactorEnabled: true})
+	noPasskey := s.users.add(&entity.User{Email: "otto@example.com", Active: true, EmailVerified: true, TwoFactorEnabled: true})
+	janesKey := webauthntest.NewAuthenticator(t, passkeyOrigin)
+	mallorysKey := webauthntest.NewAuthenticator(t, passkeyOrigin)
+	s.register(jane.ID, janesKey, "Security key")
+	s.register(mallory.ID, mallorysKey, "")
+
+	// The key only has to be present when it serves as second factor
+	janesKey.VerifiesUser = false
+	mfaToken := s.mfaToken(jane)
+	options := s.twoFactorOptions(mfaToken)
+	if len(options.AllowCredentials) != 1 || options.UserVerification != webauthn.UserVerificationPreferred {
+		t.Fatalf("options = %+v, want jane's passkey", options)
+	}
+	status, body := s.finishTwoFactor(mfaToken, janesKey.SignIn(options))
+	if status != http.StatusOK {
+		t.Fatalf("second factor = %d %v", status, body)
+	}
+	s.checkTokens(body, jane.ID, jwt.AuthMethodPassword, jwt.AuthMethodPasskey)
+
+	// Someone else's passkey does not complete jane's login
+	options = s.twoFactorOptions(mfaToken)
+	options.AllowCredentials = nil
+	if status, _ := s.finishTwoFactor(mfaToken, mallorysKey.SignIn(options)); status != http.StatusUnauthorized {
+		t.Fatalf("second factor with mallory's passkey = %d, want 401", status)
+	}
+
+	// Nor does a challenge issued for another login
+	options = s.twoFactorOptions(s.mfaToken(mallory))
+	if status, _ := s.finishTwoFactor(mfaToken, mallorysKey.SignIn(options)); status != http.StatusUnauthorized {
+		t.Fatalf("second factor with another login's challenge = %d, want 401", status)
+	}
+
+	// Failures count towards the lockout as wrong TOTP codes do
+	if jane.FailedLogins != 2 {
+		t.Fatalf("failed logins = %d, want 2", jane.FailedLogins)
+	}
+	options = s.twoFactorOptions(mfaToken)
+	options.AllowCredentials = nil
+	if status, _ := s.finishTwoFactor(mfaToken, mallorysKey.SignIn(options)); status != http.StatusUnauthorized {
+		t.Fatalf("third failure = %d, want 401", status)
+	}
+	if status, _ := s.finishTwoFactor(mfaToken, janesKey.SignIn(s.twoFactorOptions(mfaToken))); status != http.StatusLocked {
+		t.Fatalf("second factor of a locked account = %d, want 423", status)
+	}
+
+	if status, _ := s.post("/api/v1/auth/login/2fa/passkey/options", map[string]string{"mfa_token": s.mfaToken(noPasskey)}, "", nil); status != http.StatusNotFound {
+		t.Fatalf("options for a user without passkeys = %d, want 404", status)
+	}
+	if status, _ := s.post("/api/v1/auth/login/2fa/passkey/options", map[string]string{"mfa_token": "not-a-token"}, "", nil); status != http.StatusUnauthorized {
+		t.Fatalf("options with an invalid MFA token = %d, want 401", status)
+	}
+}
+
+// TestManagePasskeys lists, renames and deletes passkeys
+func TestManagePasskeys(t *testing.T) {
+	s := newPasskeyServer(t)
+	jane := s.users.add(&entity.User{Email: "jane@example.com", Active: true, EmailVerified: true})
+	mallory := s.users.add(&entity.User{Email: "mallory@example.com", Active: true, EmailVerified: true})
+	phone := webauthntest.NewAuthenticator(t, passkeyOrigin)
+	laptop := webauthntest.NewAuthenticator(t, passkeyOrigin)
+	s.register(jane.ID, phone, "Phone")
+	passkey := s.register(jane.ID, laptop, "Laptop")
+
+	// Options exclude the passkeys the user already has
+	var options webauthn.CreationOptions
+	if status, _ := s.post("/api/v1/auth/passkeys/register/options", nil, s.accessToken(jane.ID), &options); status != http.StatusOK || len(options.ExcludeCredentials) != 2 {
+		t.Fatalf("registration options = %d %+v, want both passkeys excluded", status, options)
+	}
+
+	var list struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	if status, _ := s.send(http.MethodGet, "/api/v1/auth/passkeys", nil, s.accessToken(jane.ID), &list); status != http.StatusOK || len(list.Data) != 2 {
+		t.Fatalf("list = %d %v, want 2 passkeys", status, list.Data)
+	}
+	for _, field := range []string{"public_key", "sign_count"} {
+		if _, ok := list.Data[0][field]; ok {
+			t.Fatalf("listed passkey exposes %s: %v", field, list.Data[0])
+		}
+	}
+
+	path := "/api/v1/auth/passkeys/" + jsonNumber(passkey.ID)
+	var renamed entity.Passkey
+	if status, _ := s.send(http.MethodPatch, path, map[string]string{"name": "  Work laptop "}, s.accessToken(jane.ID), &renamed); status != http.StatusOK || renamed.Name != "Work laptop" {
+		t.Fatalf("rename = %d %+v", status, renamed)
+	}
+	if status, _ := s.send(http.MethodPatch, path, map[string]string{"name": "Mine"}, s.accessToken(mallory.ID), nil); status != http.StatusNotFound {
+		t.Fatalf("rename of another user's passkey = %d, want 404", status)
+	}
+	if status, _ := s.send(http.MethodPatch, path, map[string]string{"name": ""}, s.accessToken(jane.ID), nil); status != http.StatusBadRequest {
+		t.Fatalf("rename to nothing = %d, want 400", status)
+	}
+
+	stale := s.loginToken(jane.ID, time.Now().Add(-time.Hour), jwt.AuthMethodPassword)
+	if status := s.delete(path, stale); status != http.StatusForbidden {
+		t.Fatalf("delete with an old login = %d, want 403", status)
+	}
+	if status := s.delete(path, s.accessToken(mallory.ID)); status != http.StatusNotFound {
+		t.Fatalf("delete of another user's passkey = %d, want 404", status)
+	}
+	if status := s.delete(path, s.accessToken(jane.ID)); status != http.StatusOK {
+		t.Fatalf("delete = %d", status)
+	}
+	if status := s.delete(path, s.accessToken(jane.ID)); status != http.StatusNotFound {
+		t.Fatalf("second delete = %d, want 404", status)
+	}
+
+	// A deleted passkey no longer signs in, the others still do
+	if status, _ := s.login(laptop); status != http.StatusUnauthorized {
+		t.Fatalf("login with a deleted passkey = %d, want 401", status)
+	}
+	if status, _ := s.login(phone); status != http.StatusOK {
+		t.Fatalf("login with the remaining passkey = %d", status)
+	}
+
+	// A registration cannot be completed twice or by another user
+	var creation webauthn.CreationOptions
+	s.post("/api/v1/auth/passkeys/register/options", nil, s.accessToken(jane.ID), &creation)
+	resp := webauthntest.NewAuthenticator(t, passkeyOrigin).Register(&creation)
+	if status, _ := s.post("/api/v1/auth/passkeys", map[string]interface{}{"credential": resp}, s.accessToken(mallory.ID), nil); status != http.StatusUnauthorized {
+		t.Fatalf("registration completed by another user = %d, want 401", status)
+	}
+	if status, _ := s.post("/api/v1/auth/passkeys", map[string]interface{}{"credential": resp}, s.accessToken(jane.ID), nil); status != http.StatusUnauthorized {
+		t.Fatalf("replayed registration = %d, want 401", status)
+	}
+	if status, _ := s.send(http.MethodGet, "/api/v1/auth/passkeys", nil, "", nil); status != http.StatusUnauthorized {
+		t.Fatalf("list without a token = %d, want 401", status)
+	}
+}
+
+// TestRegisterPasskeyNeedsRecentLogin checks that a passkey, which signs in
+// without a second factor, can only be added right after a full login
+func TestRegisterPasskeyNeedsRecentLogin(t *testing.T) {
+	s := newPasskeyServer(t)
+	jane := s.users.add(&entity.User{Email: "jane@example.com", Active: true, EmailVerified: true})
+	otto := s.users.add(&entity.User{Email: "otto@example.com", Active: true, EmailVerified: true, TwoFactorEnabled: true})
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"login an hour ago", s.loginToken(jane.ID, time.Now().Add(-time.Hour), jwt.AuthMethodPassword), http.StatusForbidden},
+		{"password only with 2FA enabled", s.loginToken(otto.ID, time.Now(), jwt.AuthMethodPassword), http.StatusForbidden},
+		{"second factor with 2FA enabled", s.loginToken(otto.ID, time.Now(), jwt.AuthMethodPassword, jwt.AuthMethodOTP), http.StatusOK},
+		{"passkey login with 2FA enabled", s.loginToken(otto.ID, time.Now(), jwt.AuthMethodPasskey), http.StatusOK},
+		{"recent password login", s.loginToken(jane.ID, time.Now(), jwt.AuthMethodPassword), http.StatusOK},
+	}
+	for _, tt := range tests {
+		if status, _ := s.post("/api/v1/auth/passkeys/register/options", nil, tt.token, nil); status != tt.want {
+			t.Errorf("registration options after a %s = %d, want %d", tt.name, status, tt.want)
+		}
+	}
+
+	// The check is repeated when the registration completes
+	var options webauthn.CreationOptions
+	if status, _ := s.post("/api/v1/auth/passkeys/register/options", nil, s.accessToken(jane.ID), &options); status != http.StatusOK {
+		t.Fatalf("registration options = %d", status)
+	}
+	resp := webauthntest.NewAuthenticator(t, passkeyOrigin).Register(&options)
+	stale := s.loginToken(jane.ID, time.Now().Add(-time.Hour), jwt.AuthMethodPassword)
+	if status, _ := s.post("/api/v1/auth/passkeys", map[string]interface{}{"credential": resp}, stale, nil); status != http.StatusForbidden {
+		t.Fatalf("registration completed with an old login = %d, want 403", status)
+	}
+	if len(s.passkeys.passkeys) != 0 {
+		t.Fatalf("passkeys = %+v, want none registered", s.passkeys.passkeys)
+	}
+}
+
+// passkeyServer serves the passkey endpoints for a relying party on
+// example.com
+type passkeyServer struct {
+	*loginServer
+	passkeys *memoryPasskeyRepo
+}
+
+func newPasskeyServer(t *testing.T) *passkeyServer {
+	t.Helper()
+	s := newLoginServer(t)
+
+	cfg := configs.WebAuthnConfig{
+		RPID:         "example.com",
+		RPName:       "Example",
+		Origins:      []string{passkeyOrigin},
+		ChallengeTTL: time.Minute,
+	}
+	passkeys := &memoryPasskeyRepo{}
+	challenges := &memoryPasskeyChallengeRepo{challenges: map[string]*entity.PasskeyChallenge{}}
+	passkeyUseCase := usecase.NewPasskeyUseCase(webauthn.NewRelyingParty(cfg), challenges, passkeys, s.users, s.authUseCase, s.authService, cfg)
+
+	h := NewPasskeyHandler(passkeyUseCase)
+	s.router.POST("/api/v1/auth/passkeys/login/options", h.BeginLogin)
+	s.router.POST("/api/v1/auth/passkeys/login", h.FinishLogin)
+	s.router.POST("/api/v1/auth/login/2fa/passkey/options", h.BeginTwoFactor)
+	s.router.POST("/api/v1/auth/login/2fa/passkey", h.FinishTwoFactor)
+	protected := s.router.Group("/api/v1/auth/passkeys", s.authMiddleware.Authenticate())
+	protected.GET("", h.ListPasskeys)
+	protected.POST("/register/options", s.reauthMiddleware.RequireRecentLogin(), h.BeginRegistration)
+	protected.POST("", s.reauthMiddleware.RequireRecentLogin(), h.FinishRegistration)
+	protected.PATCH("/:id", h.RenamePasskey)
+	protected.DELETE("/:id", s.reauthMiddleware.RequireRecentLogin(), h.DeletePasskey)
+
+	return &passkeyServer{loginServer: s, passkeys: passkeys}
+}
+
+// register creates a passkey for the user on the authenticator, as the
+// account settings page would right after a login
+func (s *passkeyServer) register(userID uint, authenticator *webauthntest.Authenticator, name string) *entity.Passkey {
+	s.t.Helper()
+	accessToken := s.accessToken(userID)
+	if s.users.byID[userID].TwoFactorEnabled {
+		accessToken = s.loginToken(userID, time.Now(), jwt.AuthMethodPassword, jwt.AuthMethodOTP)
+	}
+
+	var options webauthn.CreationOptions
+	if status, err := s.post("/api/v1/auth/passkeys/register/options", nil, accessToken, &options); status != http.StatusOK || err != nil {
+		s.t.Fatalf("registration options = %d %v", status, err)
+	}
+	var passkey entity.Passkey
+	req := map[string]interface{}{"name": name, "credential": authenticator.Register(&options)}
+	if status, err := s.post("/api/v1/auth/passkeys", req, accessToken, &passkey); status != http.StatusCreated || err != nil {
+		s.t.Fatalf("registration = %d %v", status, err)
+	}
+	return &passkey
+}
+
+func (s *passkeyServer) loginOptions() *webauthn.RequestOptions {
+	s.t.Helper()
+	var options webauthn.RequestOptions
+	if status, err := s.post("/api/v1/auth/passkeys/login/options", nil, "", &options); status != http.StatusOK || err != nil {
+		s.t.Fatalf("login options = %d %v", status, err)
+	}
+	return &options
+}
+
+// login signs in with the authenticator's passkey, as the login page would
+func (s *passkeyServer) login(authenticator *webauthntest.Authenticator) (int, map[string]interface{}) {
+	s.t.Helper()
+	return s.finishLogin(authenticator.SignIn(s.loginOptions()))
+}
+
+func (s *passkeyServer) finishLogin(resp *webauthn.AssertionResponse) (int, map[string]interface{}) {
+	s.t.Helper()
+	var body map[string]interface{}
+	status, _ := s.post("/api/v1/auth/passkeys/login", map[string]interface{}{"credential": resp}, "", &body)
+	return status, body
+}
+
+// mfaToken is the token of a password login waiting for its second factor
+func (s *passkeyServer) mfaToken(user *entity.User) string {
+	s.t.Helper()
+	token, err := s.authService.GenerateMFAChallenge(user, []string{jwt.AuthMethodPassword})
+	if err != nil {
+		s.t.Fatalf("GenerateMFAChallenge: %v", err)
+	}
+	return token
+}
+
+func (s *passkeyServer) twoFactorOptions(mfaToken string) *webauthn.RequestOptions {
+	s.t.Helper()
+	var options webauthn.RequestOptions
+	if status, err := s.post("/api/v1/auth/login/2fa/passkey/options", map[string]string{"mfa_token": mfaToken}, "", &options); status != http.StatusOK || err != nil {
+		s.t.Fatalf("second factor options = %d %v", status, err)
+	}
+	return &options
+}
+
+func (s *passkeyServer) finishTwoFactor(mfaToken string, resp *webauthn.AssertionResponse) (int, map[string]interface{}) {
+	s.t.Helper()
+	var body map[string]interface{}
+	status, _ := s.post("/api/v1/auth/login/2fa/passkey", map[string]interface{}{"mfa_token": mfaToken, "credential": resp}, "", &body)
+	return status, body
+}
+
+type memoryPasskeyRepo struct {
+	passkeys []*entity.Passkey
+}
+
+func (r *memoryPasskeyRepo) byUser(userID uint) []entity.Passkey {
+	var passkeys []entity.Passkey
+	for _, passkey := range r.passkeys {
+		if passkey.UserID == userID {
+			passkeys = append(passkeys, *passkey)
+		}
+	}
+	return passkeys
+}
+
+func (r *memoryPasskeyRepo) Create(passkey *entity.Passkey) error {
+	if _, err := r.FindByCredentialID(passkey.CredentialID); err == nil {
+		return errors.ErrPasskeyExists
+	}
+	passkey.ID = uint(len(r.passkeys) + 1)
+	stored := *passkey
+	r.passkeys = append(r.passkeys, &stored)
+	return nil
+}
+
+func (r *memoryPasskeyRepo) FindByCredentialID(credentialID string) (*entity.Passkey, error) {
+	for _, passkey := range r.passkeys {
+		if passkey.CredentialID == credentialID {
+			found := *passkey
+			return &found, nil
+		}
+	}
+	return nil, errors.ErrPasskeyNotFound
+}
+
+func (r *memoryPasskeyRepo) FindByUserID(userID uint) ([]entity.Passkey, error) {
+	return r.byUser(userID), nil
+}
+
+func (r *memoryPasskeyRepo) UpdateUsage(id uint, signCount uint32, backedUp bool) error {
+	for _, passkey := range r.passkeys {
+		if passkey.ID == id {
+			now := time.Now()
+			passkey.SignCount, passkey.BackedUp, passkey.LastUsedAt = signCount, backedUp, &now
+			return nil
+		}
+	}
+	return errors.ErrPasskeyNotFound
+}
+
+func (r *memoryPasskeyRepo) Rename(userID, id uint, name string) (*entity.Passkey, error) {
+	for _, passkey := range r.passkeys {
+		if passkey.ID == id && passkey.UserID == userID {
+			passkey.Name = name
+			renamed := *passkey
+			return &renamed, nil
+		}
+	}
+	return nil, errors.ErrPasskeyNotFound
+}
+
+func (r *memoryPasskeyRepo) Delete(userID, id uint) error {
+	for i, passkey := range r.passkeys {
+		if passkey.ID == id && passkey.UserID == userID {
+			r.passkeys = append(r.passkeys[:i], r.passkeys[i+1:]...)
+			return nil
+		}
+	}
+	return errors.ErrPasskeyNotFound
+}
+
+type memoryPasskeyChallengeRepo struct {
+	challenges map[string]*entity.PasskeyChallenge
+}
+
+func (r *memoryPasskeyChallengeRepo) Save(ctx context.Context, challengeHash string, challenge *entity.PasskeyChallenge, ttl time.Duration) error {
+	r.challenges[challengeHash] = challenge
+	return nil
+}
+
+func (r *memoryPasskeyChallengeRepo) Consume(ctx context.Context, challengeHash string) (*entity.PasskeyChallenge, error) {
+	challenge, ok := r.challenges[challengeHash]
+	if !ok {
+		return nil, errors.ErrInvalidPasskeyChallenge
+	}
+	delete(r.challenges, challengeHash)
+	return challenge, nil
+}
@@ -6,8 +6,9 @@ import (
 
 	"minisapi/services/auth/internal/common"
 	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/domain/service"
 	"minisapi/services/auth/internal/enums"
-	"minisapi/services/auth/internal/repository"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,15 +16,41 @@ import (
 // PermissionHandler handles permission-related requests
 type PermissionHandler struct {
 	permissionRepo repository.PermissionRepository
+	roleRepo       repository.RoleRepository
+	userRepo       repository.UserRepository
+	authService    service.AuthService
 }
 
 // NewPermissionHandler creates a new instance of PermissionHandler
-func NewPermissionHandler(permissionRepo repository.PermissionRepository) *PermissionHandler {
+func NewPermissionHandler(
+	permissionRepo repository.PermissionRepository,
+	roleRepo repository.RoleRepository,
+	userRepo repository.UserRepository,
+	authService service.AuthService,
+) *PermissionHandler {
 	return &PermissionHandler{
 		permissionRepo: permissionRepo,
+		roleRepo:       roleRepo,
+		userRepo:       userRepo,
+		authService:    authService,
 	}
 }
 
+// findHolders returns the users holding the permission through any role,
+// including roles that inherit it
+func (h *PermissionHandler) findHolders(permissionID uint) ([]entity.User, error) {
+	roles, err := h.roleRepo.FindByPermission(permissionID)
+	if err != nil {
+		return nil, err
+	}
+
+	roleIDs := make([]uint, 0, len(roles))
+	for _, role := range roles {
+		roleIDs = append(roleIDs, role.ID)
+	}
+	return findHolders(h.roleRepo, h.userRepo, roleIDs...)
+}
+
 // CreatePermissionRequest represents the create permission request body
 type CreatePermissionRequest struct {
 	Name        string `json:"name" binding:"required" example:"create_user"`
@@ -141,7 +168,7 @@ func (h *PermissionHandler) Get(c *gin.Context) {
 
 // Update godoc
 // @Summary Update a permission
-// @Description Update a permission's details
+// @Description Update a permission's details.
 // @Tags permissions
 // @Accept json
 // @Produce json
@@ -183,17 +210,29 @@ func (h *PermissionHandler) Update(c *gin.Context) {
 	permission.Resource = string(resource)
 	permission.Action = string(action)
 
+	holders, err := h.findHolders(permission.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
 	if err := h.permissionRepo.Update(permission); err != nil {
 		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
 		return
 	}
 
+	// Every role holding the permission now grants something else
+	if err := revokeHolderAccess(c, h.authService, holders); err != nil {
+		c.JSON(http.StatusServiceUnavailable, common.SERVICE_UNAVAILABLE)
+		return
+	}
+
 	c.JSON(http.StatusOK, permission)
 }
 
 // Delete godoc
 // @Summary Delete a permission
-// @Description Delete a permission by ID
+// @Description Delete a permission by ID.
 // @Tags permissions
 // @Accept json
 // @Produce json
@@ -212,10 +251,23 @@ func (h *PermissionHandler) Delete(c *gin.Context) {
 		return
 	}
 
+	// The holders are found first, as deleting the permission drops its
+	// role grants
+	holders, err := h.findHolders(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
 	if err := h.permissionRepo.Delete(uint(id)); err != nil {
 		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
 		return
 	}
 
+	if err := revokeHolderAccess(c, h.authService, holders); err != nil {
+		c.JSON(http.StatusServiceUnavailable, common.SERVICE_UNAVAILABLE)
+		return
+	}
+
 	c.JSON(http.StatusOK, common.SUCCESS)
 }
@@ -0,0 +1,399 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"minisapi/services/auth/internal/common"
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/domain/service"
+	"minisapi/services/auth/internal/pkg/errors"
+	"minisapi/services/auth/internal/pkg/policy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Policy sources
+const (
+	PolicySourceDatabase = "database"
+	PolicySourceFile     = "file"
+)
+
+// PolicyHandler handles access policy requests
+type PolicyHandler struct {
+	policyRepo    repository.PolicyRepository
+	policyService service.PolicyService
+}
+
+// NewPolicyHandler creates a new instance of PolicyHandler
+func NewPolicyHandler(policyRepo repository.PolicyRepository, policyService service.PolicyService) *PolicyHandler {
+	return &PolicyHandler{
+		policyRepo:    policyRepo,
+		policyService: policyService,
+	}
+}
+
+// PolicyRequest represents the create and update policy request body
+type PolicyRequest struct {
+	Name        string             `json:"name" binding:"required,max=255" example:"own-profile"`
+	Description string             `json:"description" binding:"max=255" example:"Users can read and update their own profile"`
+	Effect      policy.Effect      `json:"effect" binding:"required" example:"allow"`
+	Permissions []string           `json:"permissions" binding:"required" example:"user:read,user:update"`
+	Conditions  []policy.Condition `json:"conditions"`
+	// Enabled defaults to true
+	Enabled *bool `json:"enabled"`
+}
+
+// ExplainRequest represents the explain request body
+type ExplainRequest struct {
+	// UserID is the subject; it defaults to the caller
+	UserID             uint                   `json:"user_id" example:"42"`
+	Resource           string                 `json:"resource" binding:"required" example:"user"`
+	Action             string                 `json:"action" binding:"required" example:"read"`
+	ResourceAttributes map[string]interface{} `json:"resource_attributes"`
+	Environment        map[string]interface{} `json:"environment"`
+	// Policies are evaluated in place of the active policies of the same
+	// name, so unsaved changes can be tried out
+	Policies []policy.Policy `json:"policies"`
+}
+
+// PolicyResponse represents a policy from the database or the policy file.
+// Policies from the file have no ID and cannot be changed through the API.
+type PolicyResponse struct {
+	ID          uint               `json:"id,omitempty"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Effect      policy.Effect      `json:"effect"`
+	Permissions []string           `json:"permissions"`
+	Conditions  []policy.Condition `json:"conditions"`
+	Enabled     bool               `json:"enabled"`
+	Source      string             `json:"source" example:"database"`
+}
+
+// rule validates the request as a policy
+func (r *PolicyRequest) rule() (policy.Policy, error) {
+	rule := policy.Policy{
+		Name:        r.Name,
+		Description: r.Description,
+		Effect:      r.Effect,
+		Permissions: r.Permissions,
+		Conditions:  r.Conditions,
+	}
+	return rule, rule.Validate()
+}
+
+// isFilePolicy reports whether the policy file defines a policy of that name
+func (h *PolicyHandler) isFilePolicy(name string) bool {
+	for _, p := range h.policyService.FilePolicies() {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Create godoc
+// @Summary Create a new policy
+// @Description Create an attribute-based access policy
+// @Tags policies
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body PolicyRequest true "Policy details"
+// @Success 201 {object} entity.Policy
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/policies [post]
+func (h *PolicyHandler) Create(c *gin.Context) {
+	var req PolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, common.VALIDATION_ERROR)
+		return
+	}
+
+	rule, err := req.rule()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": http.StatusBadRequest})
+		return
+	}
+
+	// Names are unique across the database and the policy file
+	if h.isFilePolicy(req.Name) {
+		c.JSON(http.StatusBadRequest, common.POLICY_EXISTS)
+		return
+	}
+	if _, err := h.policyRepo.FindByName(req.Name); err == nil {
+		c.JSON(http.StatusBadRequest, common.POLICY_EXISTS)
+		return
+	} else if err != errors.ErrPolicyNotFound {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	p := &entity.Policy{
+		Name:        rule.Name,
+		Description: rule.Description,
+		Effect:      rule.Effect,
+		Permissions: rule.Permissions,
+		Conditions:  rule.Conditions,
+		Enabled:     req.Enabled == nil || *req.Enabled,
+	}
+	if err := h.policyRepo.Create(p); err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	c.JSON(http.StatusCreated, p)
+}
+
+// List godoc
+// @Summary List all policies
+// @Description Get the policies of the policy file followed by those stored in the database
+// @Tags policies
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} PolicyResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/policies [get]
+func (h *PolicyHandler) List(c *gin.Context) {
+	stored, err := h.policyRepo.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	filePolicies := h.policyService.FilePolicies()
+	response := make([]PolicyResponse, 0, len(filePolicies)+len(stored))
+	for _, p := range filePolicies {
+		response = append(response, PolicyResponse{
+			Name:        p.Name,
+			Description: p.Description,
+			Effect:      p.Effect,
+			Permissions: p.Permissions,
+			Conditions:  p.Conditions,
+			Enabled:     true,
+			Source:      PolicySourceFile,
+		})
+	}
+	for _, p := range stored {
+		response = append(response, PolicyResponse{
+			ID:          p.ID,
+			Name:        p.Name,
+			Description: p.Description,
+			Effect:      p.Effect,
+			Permissions: p.Permissions,
+			Conditions:  p.Conditions,
+			Enabled:     p.Enabled,
+			Source:      PolicySourceDatabase,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  response,
+		"total": len(response),
+	})
+}
+
+// Get godoc
+// @Summary Get a policy by ID
+// @Description Get a policy stored in the database
+// @Tags policies
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Policy ID"
+// @Success 200 {object} entity.Policy
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Router /api/policies/{id} [get]
+func (h *PolicyHandler) Get(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, common.PARAMS_ERROR)
+		return
+	}
+
+	p, err := h.policyRepo.FindByID(uint(id))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, p)
+}
+
+// Update godoc
+// @Summary Update a policy
+// @Description Replace a policy stored in the database
+// @Tags policies
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Policy ID"
+// @Param request body PolicyRequest true "Policy details"
+// @Success 200 {object} entity.Policy
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/policies/{id} [put]
+func (h *PolicyHandler) Update(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, common.PARAMS_ERROR)
+		return
+	}
+
+	var req PolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, common.VALIDATION_ERROR)
+		return
+	}
+
+	rule, err := req.rule()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": http.StatusBadRequest})
+		return
+	}
+
+	p, err := h.policyRepo.FindByID(uint(id))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	if req.Name != p.Name {
+		if h.isFilePolicy(req.Name) {
+			c.JSON(http.StatusBadRequest, common.POLICY_EXISTS)
+			return
+		}
+		if _, err := h.policyRepo.FindByName(req.Name); err == nil {
+			c.JSON(http.StatusBadRequest, common.POLICY_EXISTS)
+			return
+		} else if err != errors.ErrPolicyNotFound {
+			c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+			return
+		}
+	}
+
+	p.Name = rule.Name
+	p.Description = rule.Description
+	p.Effect = rule.Effect
+	p.Permissions = rule.Permissions
+	p.Conditions = rule.Conditions
+	if req.Enabled != nil {
+		p.Enabled = *req.Enabled
+	}
+
+	if err := h.policyRepo.Update(p); err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	c.JSON(http.StatusOK, p)
+}
+
+// Delete godoc
+// @Summary Delete a policy
+// @Description Delete a policy stored in the database
+// @Tags policies
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Policy ID"
+// @Success 200 {object} entity.MessageResponse
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/policies/{id} [delete]
+func (h *PolicyHandler) Delete(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, common.PARAMS_ERROR)
+		return
+	}
+
+	if err := h.policyRepo.Delete(uint(id)); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, common.SUCCESS)
+}
+
+// Explain godoc
+// @Summary Explain an access decision
+// @Description Evaluate an access request without performing it and report the RBAC grant and the outcome of every policy and condition. Policies in the request are tried out in place of the active policies of the same name.
+// @Tags policies
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body ExplainRequest true "Access request"
+// @Success 200 {object} policy.Decision
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/policies/explain [post]
+func (h *PolicyHandler) Explain(c *gin.Context) {
+	var req ExplainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, common.VALIDATION_ERROR)
+		return
+	}
+
+	seen := make(map[string]bool, len(req.Policies))
+	for i := range req.Policies {
+		if err := req.Policies[i].Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": http.StatusBadRequest})
+			return
+		}
+		if seen[req.Policies[i].Name] {
+			c.JSON(http.StatusBadRequest, common.POLICY_EXISTS)
+			return
+		}
+		seen[req.Policies[i].Name] = true
+	}
+
+	if req.UserID == 0 {
+		req.UserID = c.GetUint("user_id")
+	}
+
+	decision, err := h.policyService.Authorize(c.Request.Context(), service.AccessRequest{
+		SubjectID:          req.UserID,
+		Resource:           req.Resource,
+		Action:             req.Action,
+		ResourceAttributes: req.ResourceAttributes,
+		Environment:        req.Environment,
+		Policies:           req.Policies,
+	})
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, decision)
+}
+
+func (h *PolicyHandler) respondError(c *gin.Context, err error) {
+	switch err {
+	case errors.ErrPolicyNotFound:
+		c.JSON(http.StatusNotFound, common.POLICY_NOT_FOUND)
+	case errors.ErrUserNotFound:
+		c.JSON(http.StatusNotFound, common.USER_NOT_FOUND)
+	default:
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+	}
+}
@@ -0,0 +1,477 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"minisapi/services/auth/internal/common"
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/infrastructure/jwt"
+	"minisapi/services/auth/internal/pkg/errors"
+	"minisapi/services/auth/internal/pkg/permission"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PermissionIDsRequest represents a bulk role-permission assignment request body
+type PermissionIDsRequest struct {
+	PermissionIDs []uint `json:"permission_ids" binding:"required,min=1" example:"1,2,3"`
+}
+
+// RoleGrantRequest represents the optional terms of a user-role grant
+type RoleGrantRequest struct {
+	// ExpiresAt makes the grant temporary; omit it for a permanent grant
+	ExpiresAt *time.Time `json:"expires_at" example:"2025-01-01T00:00:00Z"`
+	Reason    string     `json:"reason" binding:"max=255" example:"On-call escalation"`
+}
+
+// RoleIDsRequest represents a bulk user-role assignment request body
+type RoleIDsRequest struct {
+	RoleIDs []uint `json:"role_ids" binding:"required,min=1" example:"1,2"`
+	RoleGrantRequest
+}
+
+// pathID parses a numeric path parameter, answering 400 if it is malformed
+func pathID(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, common.PARAMS_ERROR)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// callerPermissions returns the permissions granted to the authenticated caller
+func callerPermissions(c *gin.Context) *permission.Set {
+	claims, ok := c.MustGet("claims").(*jwt.Claims)
+	if !ok {
+		return permission.NewSet(nil)
+	}
+	return permission.NewSet(claims.Permissions)
+}
+
+// AssignPermission godoc
+// @Summary Grant a permission to a role
+// @Description Grant a permission to a role. Requires the role:assign permission and the permission itself.
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Role ID"
+// @Param permId path int true "Permission ID"
+// @Success 200 {object} entity.MessageResponse
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/roles/{id}/permissions/{permId} [post]
+func (h *RoleHandler) AssignPermission(c *gin.Context) {
+	roleID, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	permissionID, ok := pathID(c, "permId")
+	if !ok {
+		return
+	}
+
+	h.assignPermissions(c, roleID, []uint{permissionID})
+}
+
+// AssignPermissions godoc
+// @Summary Grant permissions to a role
+// @Description Grant several permissions to a role at once; either all are granted or none. Requires the role:assign permission and the permissions themselves.
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Role ID"
+// @Param request body PermissionIDsRequest true "Permission IDs"
+// @Success 200 {object} entity.MessageResponse
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/roles/{id}/permissions [post]
+func (h *RoleHandler) AssignPermissions(c *gin.Context) {
+	roleID, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req PermissionIDsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, common.VALIDATION_ERROR)
+		return
+	}
+
+	h.assignPermissions(c, roleID, req.PermissionIDs)
+}
+
+// RemovePermission godoc
+// @Summary Revoke a permission from a role
+// @Description Revoke a permission from a role. Requires the role:remove permission.
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Role ID"
+// @Param permId path int true "Permission ID"
+// @Success 200 {object} entity.MessageResponse
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/roles/{id}/permissions/{permId} [delete]
+func (h *RoleHandler) RemovePermission(c *gin.Context) {
+	roleID, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	permissionID, ok := pathID(c, "permId")
+	if !ok {
+		return
+	}
+
+	h.removePermissions(c, roleID, []uint{permissionID})
+}
+
+// RemovePermissions godoc
+// @Summary Revoke permissions from a role
+// @Description Revoke several permissions from a role at once. Requires the role:remove permission.
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Role ID"
+// @Param request body PermissionIDsRequest true "Permission IDs"
+// @Success 200 {object} entity.MessageResponse
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/roles/{id}/permissions [delete]
+func (h *RoleHandler) RemovePermissions(c *gin.Context) {
+	roleID, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req PermissionIDsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, common.VALIDATION_ERROR)
+		return
+	}
+
+	h.removePermissions(c, roleID, req.PermissionIDs)
+}
+
+// AssignUserRole godoc
+// @Summary Assign a role to a user
+// @Description Assign a role to a user, optionally until expires_at. Requires the role:assign permission and every permission the role grants.
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "User ID"
+// @Param roleId path int true "Role ID"
+// @Param request body RoleGrantRequest false "Grant terms"
+// @Success 200 {object} entity.MessageResponse
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/users/{id}/roles/{roleId} [post]
+func (h *RoleHandler) AssignUserRole(c *gin.Context) {
+	userID, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	roleID, ok := pathID(c, "roleId")
+	if !ok {
+		return
+	}
+
+	var req RoleGrantRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, common.VALIDATION_ERROR)
+			return
+		}
+	}
+
+	h.assignUserRoles(c, userID, []uint{roleID}, req)
+}
+
+// AssignUserRoles godoc
+// @Summary Assign roles to a user
+// @Description Assign several roles to a user at once, optionally until expires_at; either all are assigned or none. Requires the role:assign permission and every permission the roles grant.
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "User ID"
+// @Param request body RoleIDsRequest true "Role IDs"
+// @Success 200 {object} entity.MessageResponse
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/users/{id}/roles [post]
+func (h *RoleHandler) AssignUserRoles(c *gin.Context) {
+	userID, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req RoleIDsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, common.VALIDATION_ERROR)
+		return
+	}
+
+	h.assignUserRoles(c, userID, req.RoleIDs, req.RoleGrantRequest)
+}
+
+// RemoveUserRole godoc
+// @Summary Remove a role from a user
+// @Description Remove a role from a user. Requires the role:remove permission.
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "User ID"
+// @Param roleId path int true "Role ID"
+// @Success 200 {object} entity.MessageResponse
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/users/{id}/roles/{roleId} [delete]
+func (h *RoleHandler) RemoveUserRole(c *gin.Context) {
+	userID, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	roleID, ok := pathID(c, "roleId")
+	if !ok {
+		return
+	}
+
+	h.removeUserRoles(c, userID, []uint{roleID})
+}
+
+// RemoveUserRoles godoc
+// @Summary Remove roles from a user
+// @Description Remove several roles from a user at once. Requires the role:remove permission.
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "User ID"
+// @Param request body RoleIDsRequest true "Role IDs"
+// @Success 200 {object} entity.MessageResponse
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/users/{id}/roles [delete]
+func (h *RoleHandler) RemoveUserRoles(c *gin.Context) {
+	userID, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req RoleIDsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, common.VALIDATION_ERROR)
+		return
+	}
+
+	h.removeUserRoles(c, userID, req.RoleIDs)
+}
+
+// assignPermissions grants the permissions to the role. Callers may only grant
+// permissions they hold themselves.
+func (h *RoleHandler) assignPermissions(c *gin.Context, roleID uint, permissionIDs []uint) {
+	if _, err := h.roleRepo.FindByID(roleID); err != nil {
+		c.JSON(http.StatusNotFound, common.ROLE_NOT_FOUND)
+		return
+	}
+
+	granted := callerPermissions(c)
+	for _, id := range permissionIDs {
+		perm, err := h.permissionRepo.FindByID(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.INVALID_PERMISSION)
+			return
+		}
+		if !granted.Has(permission.Key(perm.Resource, perm.Action)) {
+			c.JSON(http.StatusForbidden, common.FORBIDDEN)
+			return
+		}
+	}
+
+	if err := h.roleRepo.AssignPermissions(roleID, permissionIDs); err != nil {
+		switch err {
+		case errors.ErrRoleNotFound:
+			c.JSON(http.StatusNotFound, common.ROLE_NOT_FOUND)
+		case errors.ErrPermissionNotFound:
+			c.JSON(http.StatusBadRequest, common.INVALID_PERMISSION)
+		default:
+			c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		}
+		return
+	}
+
+	h.revokeRoleHolders(c, roleID)
+}
+
+// removePermissions revokes the permissions from the role
+func (h *RoleHandler) removePermissions(c *gin.Context, roleID uint, permissionIDs []uint) {
+	if _, err := h.roleRepo.FindByID(roleID); err != nil {
+		c.JSON(http.StatusNotFound, common.ROLE_NOT_FOUND)
+		return
+	}
+
+	if err := h.roleRepo.RemovePermissions(roleID, permissionIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	h.revokeRoleHolders(c, roleID)
+}
+
+// revokeRoleHolders revokes the access tokens of everyone holding the role
+// after its permissions changed, then answers the request
+func (h *RoleHandler) revokeRoleHolders(c *gin.Context, roleID uint) {
+	holders, err := findHolders(h.roleRepo, h.userRepo, roleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	if err := revokeHolderAccess(c, h.authService, holders); err != nil {
+		c.JSON(http.StatusServiceUnavailable, common.SERVICE_UNAVAILABLE)
+		return
+	}
+
+	c.JSON(http.StatusOK, common.SUCCESS)
+}
+
+// assignUserRoles grants the roles to the user on the given terms. Callers may
+// only assign roles whose effective permissions they hold themselves, and
+// roles of an organization only to its members.
+func (h *RoleHandler) assignUserRoles(c *gin.Context, userID uint, roleIDs []uint, terms RoleGrantRequest) {
+	if terms.ExpiresAt != nil && !terms.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, common.VALIDATION_ERROR)
+		return
+	}
+
+	if _, err := h.userRepo.FindByID(userID); err != nil {
+		if err == errors.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, common.USER_NOT_FOUND)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	granted := callerPermissions(c)
+	for _, id := range roleIDs {
+		role, err := h.roleRepo.FindByID(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.INVALID_ROLE)
+			return
+		}
+
+		// Roles of an organization are only granted to its members
+		if role.OrganizationID != nil {
+			member, err := h.orgRepo.IsMember(*role.OrganizationID, userID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+				return
+			}
+			if !member {
+				c.JSON(http.StatusBadRequest, common.NOT_MEMBER)
+				return
+			}
+		}
+
+		permissions, err := h.authService.GetEffectivePermissions(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+			return
+		}
+		for _, p := range permissions {
+			if !granted.Has(permission.Key(p.Permission.Resource, p.Permission.Action)) {
+				c.JSON(http.StatusForbidden, common.FORBIDDEN)
+				return
+			}
+		}
+	}
+
+	grantedBy := c.GetUint("user_id")
+	grant := entity.UserRole{
+		GrantedBy: &grantedBy,
+		ExpiresAt: terms.ExpiresAt,
+		Reason:    terms.Reason,
+	}
+
+	if err := h.userRepo.AssignRoles(userID, roleIDs, grant); err != nil {
+		switch err {
+		case errors.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, common.USER_NOT_FOUND)
+		case errors.ErrRoleNotFound:
+			c.JSON(http.StatusBadRequest, common.INVALID_ROLE)
+		default:
+			c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		}
+		return
+	}
+
+	h.revokeUserAccess(c, userID)
+}
+
+// removeUserRoles takes the user out of the roles
+func (h *RoleHandler) removeUserRoles(c *gin.Context, userID uint, roleIDs []uint) {
+	if _, err := h.userRepo.FindByID(userID); err != nil {
+		if err == errors.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, common.USER_NOT_FOUND)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	if err := h.userRepo.RemoveRoles(userID, roleIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	h.revokeUserAccess(c, userID)
+}
+
+// revokeUserAccess drops the user's cached permissions and revokes their
+// access tokens after their roles changed, then answers the request
+func (h *RoleHandler) revokeUserAccess(c *gin.Context, userID uint) {
+	if err := h.authService.InvalidateUserPermissions(c.Request.Context(), userID); err != nil {
+		c.JSON(http.StatusServiceUnavailable, common.SERVICE_UNAVAILABLE)
+		return
+	}
+	if err := h.authService.RevokeUserAccess(c.Request.Context(), userID); err != nil {
+		c.JSON(http.StatusServiceUnavailable, common.SERVICE_UNAVAILABLE)
+		return
+	}
+
+	c.JSON(http.StatusOK, common.SUCCESS)
+}
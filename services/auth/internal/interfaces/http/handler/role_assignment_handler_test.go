@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"minisapi/services/auth/internal/domain/entity"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/domain/service"
+	"minisapi/services/auth/internal/infrastructure/jwt"
+	"minisapi/services/auth/internal/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestPermissionGrantsAreBoundedByTheCaller checks that callers may only grant
+// permissions they hold, and that the holders of the role lose their tokens
+func TestPermissionGrantsAreBoundedByTheCaller(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		body    interface{}
+		want    int
+		granted []uint
+	}{
+		{"held through a wildcard", "/api/roles/10/permissions/1", nil, http.StatusOK, []uint{1}},
+		{"not held", "/api/roles/10/permissions/2", nil, http.StatusForbidden, nil},
+		{"bulk with one not held", "/api/roles/10/permissions", PermissionIDsRequest{PermissionIDs: []uint{1, 2}}, http.StatusForbidden, nil},
+		{"unknown permission", "/api/roles/10/permissions/99", nil, http.StatusBadRequest, nil},
+		{"unknown role", "/api/roles/99/permissions/1", nil, http.StatusNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newAssignmentServer("role:assign", "user:*")
+			if status := serve(s.router, http.MethodPost, tt.path, tt.body); status != tt.want {
+				t.Fatalf("status = %d, want %d", status, tt.want)
+			}
+			if got := s.roles.granted[10]; !reflect.DeepEqual(got, tt.granted) {
+				t.Fatalf("granted permissions = %v, want %v", got, tt.granted)
+			}
+			if tt.want == http.StatusOK && !reflect.DeepEqual(s.auth.revokedUsers(), []uint{5, 6}) {
+				t.Errorf("revoked users = %v, want the holders of the role and its inheritor", s.auth.revokedUsers())
+			}
+			if tt.want != http.StatusOK && len(s.auth.revoked) != 0 {
+				t.Errorf("revoked users = %v after a rejected grant", s.auth.revoked)
+			}
+		})
+	}
+}
+
+// TestRoleAssignmentsAreBoundedByTheCaller checks that callers may only
+// assign roles whose effective permissions they hold
+func TestRoleAssignmentsAreBoundedByTheCaller(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		body     interface{}
+		want     int
+		assigned []uint
+	}{
+		{"within bounds", "/api/users/7/roles/10", nil, http.StatusOK, []uint{10}},
+		{"inherits a permission not held", "/api/users/7/roles/11", nil, http.StatusForbidden, nil},
+		{"bulk with one out of bounds", "/api/users/7/roles", RoleIDsRequest{RoleIDs: []uint{10, 11}}, http.StatusForbidden, nil},
+		{"unknown role", "/api/users/7/roles/99", nil, http.StatusBadRequest, nil},
+		{"unknown user", "/api/users/99/roles/10", nil, http.StatusNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newAssignmentServer("role:assign", "user:*")
+			if status := serve(s.router, http.MethodPost, tt.path, tt.body); status != tt.want {
+				t.Fatalf("status = %d, want %d", status, tt.want)
+			}
+			if got := s.users.assigned[7]; !reflect.DeepEqual(got, tt.assigned) {
+				t.Fatalf("assigned roles = %v, want %v", got, tt.assigned)
+			}
+			if tt.want == http.StatusOK && !reflect.DeepEqual(s.auth.revokedUsers(), []uint{7}) {
+				t.Errorf("revoked users = %v, want the assignee", s.auth.revokedUsers())
+			}
+		})
+	}
+}
+
+// assignmentServer serves the assignment routes of a RoleHandler backed by
+// in-memory repositories. Role 11 inherits from role 10 and adds role:delete;
+// user 5 holds role 10 and user 6 holds role 11.
+type assignmentServer struct {
+	router *gin.Engine
+	roles  *roleTable
+	users  *roleHolderTable
+	auth   *effectivePermissionService
+}
+
+func newAssignmentServer(permissions ...string) *assignmentServer {
+	gin.SetMode(gin.TestMode)
+	userRead := entity.Permission{ID: 1, Resource: "user", Action: "read"}
+	roleDelete := entity.Permission{ID: 2, Resource: "role", Action: "delete"}
+
+	s := &assignmentServer{
+		roles: &roleTable{
+			roles: map[uint]*entity.Role{
+				10: {ID: 10, Name: "support"},
+				11: {ID: 11, Name: "moderator"},
+			},
+			links:   []entity.RoleParent{{RoleID: 11, ParentID: 10}},
+			granted: make(map[uint][]uint),
+		},
+		users: &roleHolderTable{
+			users: map[uint]*entity.User{
+				5: {ID: 5, Username: "jane"},
+				6: {ID: 6, Username: "john"},
+				7: {ID: 7, Username: "joe"},
+			},
+			holders:  map[uint][]uint{10: {5}, 11: {6}},
+			assigned: make(map[uint][]uint),
+		},
+		auth: &effectivePermissionService{effective: map[uint][]entity.Permission{
+			10: {userRead},
+			11: {userRead, roleDelete},
+		}},
+	}
+	catalog := &permissionTable{permissions: map[uint]*entity.Permission{1: &userRead, 2: &roleDelete}}
+	h := NewRoleHandler(s.roles, catalog, s.users, nil, s.auth)
+
+	s.router = gin.New()
+	api := s.router.Group("/api", withClaims(1, permissions...))
+	api.POST("/roles/:id/permissions", h.AssignPermissions)
+	api.POST("/roles/:id/permissions/:permId", h.AssignPermission)
+	api.POST("/users/:id/roles", h.AssignUserRoles)
+	api.POST("/users/:id/roles/:roleId", h.AssignUserRole)
+	return s
+}
+
+// withClaims stands in for AuthMiddleware.Authenticate, authenticating
+// every request as the user with the given permissions
+func withClaims(userID uint, permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := jwt.NewClaims(userID)
+		claims.Permissions = permissions
+		c.Set("user_id", userID)
+		c.Set("claims", claims)
+		c.Next()
+	}
+}
+
+// serve sends a JSON request to the router and returns the status code
+func serve(router http.Handler, method, path string, body interface{}) int {
+	var payload bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&payload).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+type roleTable struct {
+	repository.RoleRepository
+	roles   map[uint]*entity.Role
+	links   []entity.RoleParent
+	granted map[uint][]uint
+}
+
+func (r *roleTable) FindByID(id uint) (*entity.Role, error) {
+	if role, ok := r.roles[id]; ok {
+		return role, nil
+	}
+	return nil, errors.ErrRoleNotFound
+}
+
+func (r *roleTable) FindHierarchy() (*entity.RoleGraph, error) {
+	return entity.NewRoleGraph(r.links), nil
+}
+
+func (r *roleTable) AssignPermissions(roleID uint, permissionIDs []uint) error {
+	r.granted[roleID] = append(r.granted[roleID], permissionIDs...)
+	return nil
+}
+
+type permissionTable struct {
+	repository.PermissionRepository
+	permissions map[uint]*entity.Permission
+}
+
+func (r *permissionTable) FindByID(id uint) (*entity.Permission, error) {
+	if permission, ok := r.permissions[id]; ok {
+		return permission, nil
+	}
+	return nil, errors.ErrPermissionNotFound
+}
+
+type roleHolderTable struct {
+	repository.UserRepository
+	users    map[uint]*entity.User
+	holders  map[uint][]uint
+	assigned map[uint][]uint
+}
+
+func (r *roleHolderTable) FindByID(id uint) (*entity.User, error) {
+	if user, ok := r.users[id]; ok {
+		return user, nil
+	}
+	return nil, errors.ErrUserNotFound
+}
+
+func (r *roleHolderTable) FindByRole(roleID uint) ([]entity.User, error) {
+	var users []entity.User
+	for _, id := range r.holders[roleID] {
+		users = append(users, *r.users[id])
+	}
+	return users, nil
+}
+
+func (r *roleHolderTable) AssignRoles(userID uint, roleIDs []uint, _ entity.UserRole) error {
+	r.assigned[userID] = append(r.assigned[userID], roleIDs...)
+	return nil
+}
+
+type effectivePermissionService struct {
+	service.AuthService
+	effective map[uint][]entity.Permission
+	revoked   []uint
+}
+
+func (s *effectivePermissionService) GetEffectivePermissions(roleID uint) ([]service.EffectivePermission, error) {
+	var permissions []service.EffectivePermission
+	for _, p := range s.effective[roleID] {
+		permissions = append(permissions, service.EffectivePermission{Permission: p})
+	}
+	return permissions, nil
+}
+
+func (s *effectivePermissionService) InvalidateUserPermissions(context.Context, ...uint) error {
+	return nil
+}
+
+func (s *effectivePermissionService) RevokeUserAccess(_ context.Context, userIDs ...uint) error {
+	s.revoked = append(s.revoked, userIDs...)
+	return nil
+}
+
+// revokedUsers returns the IDs of the users whose access was revoked, sorted
+func (s *effectivePermissionService) revokedUsers() []uint {
+	users := append([]uint(nil), s.revoked...)
+	sort.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+	return users
+}
@@ -7,6 +7,8 @@ import (
 	"minisapi/services/auth/internal/common"
 	"minisapi/services/auth/internal/domain/entity"
 	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/domain/service"
+	"minisapi/services/auth/internal/pkg/errors"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,21 +17,108 @@ import (
 type RoleHandler struct {
 	roleRepo       repository.RoleRepository
 	permissionRepo repository.PermissionRepository
+	userRepo       repository.UserRepository
+	orgRepo        repository.OrganizationRepository
+	authService    service.AuthService
 }
 
 // NewRoleHandler creates a new instance of RoleHandler
-func NewRoleHandler(roleRepo repository.RoleRepository, permissionRepo repository.PermissionRepository) *RoleHandler {
+func NewRoleHandler(
+	roleRepo repository.RoleRepository,
+	permissionRepo repository.PermissionRepository,
+	userRepo repository.UserRepository,
+	orgRepo repository.OrganizationRepository,
+	authService service.AuthService,
+) *RoleHandler {
 	return &RoleHandler{
 		roleRepo:       roleRepo,
 		permissionRepo: permissionRepo,
+		userRepo:       userRepo,
+		orgRepo:        orgRepo,
+		authService:    authService,
 	}
 }
 
+// findHolders returns the users holding any of the roles, directly or
+// through a role that inherits from it
+func findHolders(roleRepo repository.RoleRepository, userRepo repository.UserRepository, roleIDs ...uint) ([]entity.User, error) {
+	if len(roleIDs) == 0 {
+		return nil, nil
+	}
+
+	graph, err := roleRepo.FindHierarchy()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[uint]bool)
+	var holders []entity.User
+	for _, roleID := range roleIDs {
+		for _, id := range graph.Inheritors(roleID) {
+			users, err := userRepo.FindByRole(id)
+			if err != nil {
+				return nil, err
+			}
+			for _, user := range users {
+				if !seen[user.ID] {
+					seen[user.ID] = true
+					holders = append(holders, user)
+				}
+			}
+		}
+	}
+	return holders, nil
+}
+
+// findParents loads the roles with the given IDs for use as parents of the
+// role. A role may only inherit from global roles and roles of its own
+// organization; other parents yield errors.ErrInvalidRole.
+func (h *RoleHandler) findParents(role *entity.Role, ids []uint) ([]entity.Role, error) {
+	parents := make([]entity.Role, 0, len(ids))
+	for _, id := range ids {
+		parent, err := h.roleRepo.FindByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if parent.OrganizationID != nil &&
+			(role.OrganizationID == nil || *parent.OrganizationID != *role.OrganizationID) {
+			return nil, errors.ErrInvalidRole
+		}
+		parents = append(parents, *parent)
+	}
+	return parents, nil
+}
+
+// revokeHolderAccess drops the cached permissions and revokes the access
+// tokens of the given users, whose roles and permissions are out of date
+// after a role or permission change
+func revokeHolderAccess(c *gin.Context, authService service.AuthService, holders []entity.User) error {
+	userIDs := make([]uint, 0, len(holders))
+	for _, user := range holders {
+		userIDs = append(userIDs, user.ID)
+	}
+	if err := authService.InvalidateUserPermissions(c.Request.Context(), userIDs...); err != nil {
+		return err
+	}
+	return authService.RevokeUserAccess(c.Request.Context(), userIDs...)
+}
+
 // CreateRoleRequest represents the create role request body
 type CreateRoleRequest struct {
 	Name        string `json:"name" binding:"required" example:"admin"`
 	Description string `json:"description" example:"Administrator role with full access"`
 	Permissions []uint `json:"permissions" example:"[1,2,3]"`
+	Parents     []uint `json:"parents" example:"[4]"`
+}
+
+// EffectivePermissionResponse represents a permission held by a role, with
+// the chain of roles it was inherited through
+type EffectivePermissionResponse struct {
+	ID       uint     `json:"id"`
+	Name     string   `json:"name"`
+	Resource string   `json:"resource"`
+	Action   string   `json:"action"`
+	Path     []string `json:"path" example:"admin,editor"`
 }
 
 // Create godoc
@@ -53,8 +142,8 @@ func (h *RoleHandler) Create(c *gin.Context) {
 		return
 	}
 
-	// Check if role name already exists
-	if _, err := h.roleRepo.FindByName(req.Name); err == nil {
+	// Check if role name already exists among the global roles
+	if _, err := h.roleRepo.ForOrganization(0).FindByName(req.Name); err == nil {
 		c.JSON(http.StatusBadRequest, common.ROLE_EXISTS)
 		return
 	}
@@ -79,7 +168,24 @@ func (h *RoleHandler) Create(c *gin.Context) {
 		role.Permissions = permissions
 	}
 
+	if len(req.Parents) > 0 {
+		parents, err := h.findParents(role, req.Parents)
+		if err == errors.ErrInvalidRole {
+			c.JSON(http.StatusBadRequest, common.INVALID_ROLE_PARENT)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.INVALID_ROLE)
+			return
+		}
+		role.Parents = parents
+	}
+
 	if err := h.roleRepo.Create(role); err != nil {
+		if err == errors.ErrRoleNotFound {
+			c.JSON(http.StatusBadRequest, common.INVALID_ROLE)
+			return
+		}
 		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
 		return
 	}
@@ -149,7 +255,7 @@ func (h *RoleHandler) Get(c *gin.Context) {
 
 // Update godoc
 // @Summary Update a role
-// @Description Update a role's details and permissions
+// @Description Update a role's details, permissions and parent roles
 // @Tags roles
 // @Accept json
 // @Produce json
@@ -199,11 +305,44 @@ func (h *RoleHandler) Update(c *gin.Context) {
 		role.Permissions = permissions
 	}
 
+	// Replace parents if provided; an empty list clears them
+	if req.Parents != nil {
+		parents, err := h.findParents(role, req.Parents)
+		if err == errors.ErrInvalidRole {
+			c.JSON(http.StatusBadRequest, common.INVALID_ROLE_PARENT)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.INVALID_ROLE)
+			return
+		}
+		role.Parents = parents
+	}
+
 	if err := h.roleRepo.Update(role); err != nil {
+		if err == errors.ErrRoleCycle {
+			c.JSON(http.StatusBadRequest, common.ROLE_CYCLE)
+			return
+		}
+		if err == errors.ErrRoleNotFound {
+			c.JSON(http.StatusBadRequest, common.INVALID_ROLE)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	holders, err := findHolders(h.roleRepo, h.userRepo, role.ID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
 		return
 	}
 
+	if err := revokeHolderAccess(c, h.authService, holders); err != nil {
+		c.JSON(http.StatusServiceUnavailable, common.SERVICE_UNAVAILABLE)
+		return
+	}
+
 	c.JSON(http.StatusOK, role)
 }
 
@@ -219,6 +358,7 @@ func (h *RoleHandler) Update(c *gin.Context) {
 // @Failure 400 {object} entity.ErrorResponse
 // @Failure 401 {object} entity.ErrorResponse
 // @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
 // @Failure 500 {object} entity.ErrorResponse
 // @Router /api/roles/{id} [delete]
 func (h *RoleHandler) Delete(c *gin.Context) {
@@ -228,10 +368,75 @@ func (h *RoleHandler) Delete(c *gin.Context) {
 		return
 	}
 
+	// Holders are looked up before the role and its assignments are gone
+	holders, err := findHolders(h.roleRepo, h.userRepo, uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
 	if err := h.roleRepo.Delete(uint(id)); err != nil {
+		if err == errors.ErrRoleNotFound {
+			c.JSON(http.StatusNotFound, common.ROLE_NOT_FOUND)
+			return
+		}
 		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
 		return
 	}
 
+	if err := revokeHolderAccess(c, h.authService, holders); err != nil {
+		c.JSON(http.StatusServiceUnavailable, common.SERVICE_UNAVAILABLE)
+		return
+	}
+
 	c.JSON(http.StatusOK, common.SUCCESS)
 }
+
+// EffectivePermissions godoc
+// @Summary Get a role's effective permissions
+// @Description Get every permission a role holds, directly or inherited from its parent roles, with the role path each was inherited through
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Role ID"
+// @Success 200 {array} EffectivePermissionResponse
+// @Failure 400 {object} entity.ErrorResponse
+// @Failure 401 {object} entity.ErrorResponse
+// @Failure 403 {object} entity.ErrorResponse
+// @Failure 404 {object} entity.ErrorResponse
+// @Failure 500 {object} entity.ErrorResponse
+// @Router /api/roles/{id}/effective-permissions [get]
+func (h *RoleHandler) EffectivePermissions(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, common.PARAMS_ERROR)
+		return
+	}
+
+	if _, err := h.roleRepo.FindByID(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, common.ROLE_NOT_FOUND)
+		return
+	}
+
+	permissions, err := h.authService.GetEffectivePermissions(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.DB_ERROR)
+		return
+	}
+
+	response := make([]EffectivePermissionResponse, 0, len(permissions))
+	for _, p := range permissions {
+		response = append(response, EffectivePermissionResponse{
+			ID:       p.Permission.ID,
+			Name:     p.Permission.Name,
+			Resource: p.Permission.Resource,
+			Action:   p.Permission.Action,
+			Path:     p.Path,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": response,
+	})
+}
@@ -2,25 +2,37 @@ package middleware
 
 import (
 	"minisapi/services/auth/internal/domain/service"
+	"minisapi/services/auth/internal/infrastructure/jwt"
 	"minisapi/services/auth/internal/pkg/errors"
+	"minisapi/services/auth/internal/pkg/permission"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
 type AuthMiddleware struct {
-	authService service.AuthService
+	authService   service.AuthService
+	apiKeyService service.APIKeyService
 }
 
-func NewAuthMiddleware(authService service.AuthService) *AuthMiddleware {
+func NewAuthMiddleware(authService service.AuthService, apiKeyService service.APIKeyService) *AuthMiddleware {
 	return &AuthMiddleware{
-		authService: authService,
+		authService:   authService,
+		apiKeyService: apiKeyService,
 	}
 }
 
+// Authenticate accepts a Bearer access token, or an API key either in the
+// X-API-Key header or as the Bearer token
 func (m *AuthMiddleware) Authenticate() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+			m.authenticateAPIKey(c, apiKey)
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": errors.ErrUnauthorized.Error()})
@@ -37,24 +49,89 @@ func (m *AuthMiddleware) Authenticate() gin.HandlerFunc {
 		}
 
 		token := parts[1]
-		userID, err := m.authService.ValidateToken(token)
+		if service.IsAPIKey(token) {
+			m.authenticateAPIKey(c, token)
+			return
+		}
+
+		claims, err := m.authService.ValidateToken(token)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": errors.ErrUnauthorized.Error()})
+			c.Abort()
+			return
+		}
+
+		userID, err := claims.UserID()
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": errors.ErrUnauthorized.Error()})
 			c.Abort()
 			return
 		}
 
-		// Set user ID in context
+		// Reject tokens revoked by logout, session revocation, password
+		// or role changes before their expiry
+		revoked, err := m.authService.IsAccessRevoked(c.Request.Context(), claims)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": errors.ErrServiceUnavailable.Error()})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": errors.ErrTokenRevoked.Error()})
+			c.Abort()
+			return
+		}
+
+		// Set user ID and token claims in context
 		c.Set("user_id", userID)
+		c.Set("session_id", claims.SessionID)
+		c.Set("claims", claims)
 		c.Next()
 	}
 }
 
+// authenticateAPIKey authenticates the request with an API key. Keys are
+// checked against the database on every request, so they are not subject to
+// the access token denylist.
+func (m *AuthMiddleware) authenticateAPIKey(c *gin.Context, apiKey string) {
+	claims, err := m.apiKeyService.Authenticate(c.Request.Context(), apiKey)
+	if err != nil {
+		switch err {
+		case errors.ErrInvalidToken, errors.ErrTokenRevoked, errors.ErrTokenExpired, errors.ErrUnauthorized:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": errors.ErrUnauthorized.Error()})
+		default:
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": errors.ErrServiceUnavailable.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errors.ErrUnauthorized.Error()})
+		c.Abort()
+		return
+	}
+
+	c.Set("user_id", userID)
+	c.Set("claims", claims)
+	c.Next()
+}
+
+// claimsFromContext returns the token claims set by Authenticate
+func claimsFromContext(c *gin.Context) (*jwt.Claims, bool) {
+	value, exists := c.Get("claims")
+	if !exists {
+		return nil, false
+	}
+	claims, ok := value.(*jwt.Claims)
+	return claims, ok
+}
+
 func (m *AuthMiddleware) RequireRole(roles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.GetUint("user_id")
-		userRoles, err := m.authService.GetUserRoles(userID)
-		if err != nil {
+		claims, ok := claimsFromContext(c)
+		if !ok {
 			c.JSON(http.StatusForbidden, gin.H{"error": errors.ErrForbidden.Error()})
 			c.Abort()
 			return
@@ -63,13 +140,8 @@ func (m *AuthMiddleware) RequireRole(roles ...string) gin.HandlerFunc {
 		// Check if user has any of the required roles
 		hasRole := false
 		for _, role := range roles {
-			for _, userRole := range userRoles {
-				if role == userRole {
-					hasRole = true
-					break
-				}
-			}
-			if hasRole {
+			if claims.HasRole(role) {
+				hasRole = true
 				break
 			}
 		}
@@ -86,24 +158,48 @@ func (m *AuthMiddleware) RequireRole(roles ...string) gin.HandlerFunc {
 
 func (m *AuthMiddleware) RequirePermission(permissions ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.GetUint("user_id")
-		userPermissions, err := m.authService.GetUserPermissions(userID)
-		if err != nil {
+		claims, ok := claimsFromContext(c)
+		if !ok {
 			c.JSON(http.StatusForbidden, gin.H{"error": errors.ErrForbidden.Error()})
 			c.Abort()
 			return
 		}
 
 		// Check if user has all required permissions
-		for _, permission := range permissions {
-			hasPermission := false
-			for _, userPermission := range userPermissions {
-				if permission == userPermission {
-					hasPermission = true
-					break
-				}
+		granted := permission.NewSet(claims.Permissions)
+		for _, required := range permissions {
+			if !granted.Has(required) {
+				c.JSON(http.StatusForbidden, gin.H{"error": errors.ErrForbidden.Error()})
+				c.Abort()
+				return
 			}
-			if !hasPermission {
+		}
+
+		c.Next()
+	}
+}
+
+// RequireOrganizationPermission requires permissions on the organization
+// whose ID is in the path parameter. Global grants cover every organization;
+// the grants of an organization's own roles only count while the access
+// token is scoped to that organization.
+func (m *AuthMiddleware) RequireOrganizationPermission(param string, permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := claimsFromContext(c)
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": errors.ErrForbidden.Error()})
+			c.Abort()
+			return
+		}
+
+		grants := claims.Permissions
+		if claims.OrganizationID != 0 && c.Param(param) == strconv.FormatUint(uint64(claims.OrganizationID), 10) {
+			grants = claims.ScopedPermissions()
+		}
+
+		granted := permission.NewSet(grants)
+		for _, required := range permissions {
+			if !granted.Has(required) {
 				c.JSON(http.StatusForbidden, gin.H{"error": errors.ErrForbidden.Error()})
 				c.Abort()
 				return
@@ -114,17 +210,36 @@ func (m *AuthMiddleware) RequirePermission(permissions ...string) gin.HandlerFun
 	}
 }
 
+// RequireLogin refuses requests made with an API key. Keys act for their
+// user within their scopes but must not manage the account itself, such as
+// its credentials, sessions or other keys, or a leaked key would hand over
+// the whole account.
+func (m *AuthMiddleware) RequireLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := claimsFromContext(c)
+		if !ok || claims.IsAPIKey() {
+			c.JSON(http.StatusForbidden, gin.H{"error": errors.ErrAPIKeyNotAllowed.Error()})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireTwoFactor requires that the access token was issued after a second
+// factor was presented. Sessions that only passed the password check must
+// log in again with two-factor authentication to reach the route.
 func (m *AuthMiddleware) RequireTwoFactor() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.GetUint("user_id")
-		enabled, err := m.authService.IsTwoFactorEnabled(userID)
-		if err != nil {
+		claims, ok := claimsFromContext(c)
+		if !ok {
 			c.JSON(http.StatusForbidden, gin.H{"error": errors.ErrForbidden.Error()})
 			c.Abort()
 			return
 		}
 
-		if !enabled {
+		if !claims.IsMultiFactor() {
 			c.JSON(http.StatusForbidden, gin.H{"error": errors.ErrTwoFactorRequired.Error()})
 			c.Abort()
 			return
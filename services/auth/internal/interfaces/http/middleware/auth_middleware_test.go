@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"minisapi/services/auth/internal/domain/service"
+	"minisapi/services/auth/internal/infrastructure/jwt"
+	"minisapi/services/auth/internal/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestAPIKeysCannotManageTheAccount checks that an API key reaches the routes
+// its scopes cover but none of the account management routes
+func TestAPIKeysCannotManageTheAccount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := NewAuthMiddleware(&fakeAuthService{}, &fakeAPIKeyService{})
+
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router := gin.New()
+	protected := router.Group("/api/v1", m.Authenticate())
+	auth := protected.Group("/auth", m.RequireLogin())
+	auth.POST("/change-password", ok)
+	auth.POST("/api-keys", ok)
+	protected.GET("/reports", m.RequirePermission("reports:read"), ok)
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		value  string
+		want   int
+	}{
+		{"key changes the password", "/api/v1/auth/change-password", "X-API-Key", "mk_reports", http.StatusForbidden},
+		{"key creates a key", "/api/v1/auth/api-keys", "X-API-Key", "mk_reports", http.StatusForbidden},
+		{"key as bearer token creates a key", "/api/v1/auth/api-keys", "Authorization", "Bearer mk_reports", http.StatusForbidden},
+		{"key within its scopes", "/api/v1/reports", "X-API-Key", "mk_reports", http.StatusOK},
+		{"login changes the password", "/api/v1/auth/change-password", "Authorization", "Bearer session", http.StatusOK},
+		{"login creates a key", "/api/v1/auth/api-keys", "Authorization", "Bearer session", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := http.MethodPost
+			if tt.path == "/api/v1/reports" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tt.path, nil)
+			req.Header.Set(tt.header, tt.value)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("%s %s = %d, want %d", method, tt.path, rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+// fakeAuthService accepts the access token "session" of user 1
+type fakeAuthService struct {
+	service.AuthService
+}
+
+func (s *fakeAuthService) ValidateToken(token string) (*jwt.Claims, error) {
+	if token != "session" {
+		return nil, errors.ErrInvalidToken
+	}
+	claims := jwt.NewClaims(1)
+	claims.AuthMethods = []string{jwt.AuthMethodPassword}
+	return claims, nil
+}
+
+func (s *fakeAuthService) IsAccessRevoked(ctx context.Context, claims *jwt.Claims) (bool, error) {
+	return false, nil
+}
+
+// fakeAPIKeyService accepts the key "mk_reports" of user 1, scoped to
+// reports:read
+type fakeAPIKeyService struct {
+	service.APIKeyService
+}
+
+func (s *fakeAPIKeyService) Authenticate(ctx context.Context, raw string) (*jwt.Claims, error) {
+	if raw != "mk_reports" {
+		return nil, errors.ErrInvalidToken
+	}
+	claims := jwt.NewClaims(1)
+	claims.Permissions = []string{"reports:read"}
+	claims.AuthMethods = []string{jwt.AuthMethodAPIKey}
+	return claims, nil
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"minisapi/services/auth/internal/configs"
+	"minisapi/services/auth/internal/domain/repository"
+	"minisapi/services/auth/internal/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReauthMiddleware guards routes that add a way to sign in to the account.
+// Whoever holds a stolen access token could otherwise turn it into a
+// credential of their own that outlives the token and skips the second
+// factor.
+type ReauthMiddleware struct {
+	sessionRepo repository.SessionRepository
+	userRepo    repository.UserRepository
+	maxAge      time.Duration
+}
+
+func NewReauthMiddleware(sessionRepo repository.SessionRepository, userRepo repository.UserRepository, cfg configs.SessionConfig) *ReauthMiddleware {
+	return &ReauthMiddleware{
+		sessionRepo: sessionRepo,
+		userRepo:    userRepo,
+		maxAge:      cfg.ReauthMaxAge,
+	}
+}
+
+// RequireRecentLogin requires a login, not an API key, whose session started
+// within the reauthentication window and, for users with two-factor
+// authentication enabled, passed the second factor
+func (m *ReauthMiddleware) RequireRecentLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := claimsFromContext(c)
+		if !ok || claims.IsAPIKey() {
+			c.JSON(http.StatusForbidden, gin.H{"error": errors.ErrAPIKeyNotAllowed.Error()})
+			c.Abort()
+			return
+		}
+
+		userID, err := claims.UserID()
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": errors.ErrUnauthorized.Error()})
+			c.Abort()
+			return
+		}
+
+		session, err := m.sessionRepo.FindByFamily(claims.SessionID)
+		if err != nil && err != errors.ErrSessionNotFound {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": errors.ErrInternalServer.Error()})
+			c.Abort()
+			return
+		}
+		if err != nil || session.UserID != userID || !session.IsValid() || time.Since(session.CreatedAt) > m.maxAge {
+			c.JSON(http.StatusForbidden, gin.H{"error": errors.ErrReauthRequired.Error()})
+			c.Abort()
+			return
+		}
+
+		user, err := m.userRepo.FindByID(userID)
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": errors.ErrReauthRequired.Error()})
+			c.Abort()
+			return
+		}
+		if user.TwoFactorEnabled && !claims.IsMultiFactor() {
+			c.JSON(http.StatusForbidden, gin.H{"error": errors.ErrTwoFactorRequired.Error()})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
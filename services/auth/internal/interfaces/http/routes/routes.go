@@ -8,12 +8,19 @@ import (
 	"minisapi/services/auth/internal/configs"
 	"minisapi/services/auth/internal/domain/service"
 	"minisapi/services/auth/internal/domain/usecase"
+	"minisapi/services/auth/internal/infrastructure/cache"
+	"minisapi/services/auth/internal/infrastructure/email"
+	"minisapi/services/auth/internal/infrastructure/federation"
+	"minisapi/services/auth/internal/infrastructure/jobs"
 	"minisapi/services/auth/internal/infrastructure/jwt"
 	"minisapi/services/auth/internal/infrastructure/redis"
 	"minisapi/services/auth/internal/infrastructure/repository"
+	"minisapi/services/auth/internal/infrastructure/webauthn"
 	"minisapi/services/auth/internal/interfaces/http/handler"
 	"minisapi/services/auth/internal/interfaces/http/middleware"
+	"minisapi/services/auth/internal/pkg/encryption"
 	"minisapi/services/auth/internal/pkg/logger"
+	"minisapi/services/auth/internal/pkg/password"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/time/rate"
@@ -22,6 +29,9 @@ import (
 
 type Server struct {
 	httpServer *http.Server
+	cleanupJob *jobs.CleanupJob
+	jobsCtx    context.Context
+	stopJobs   context.CancelFunc
 }
 
 func NewServer(cfg *configs.Config, db *gorm.DB) *Server {
@@ -31,11 +41,27 @@ func NewServer(cfg *configs.Config, db *gorm.DB) *Server {
 	sessionRepo := repository.NewSessionRepository(db)
 	roleRepo := repository.NewRoleRepository(db)
 	permissionRepo := repository.NewPermissionRepository(db)
+	recoveryCodeRepo := repository.NewRecoveryCodeRepository(db)
+	policyRepo := repository.NewPolicyRepository(db)
+	orgRepo := repository.NewOrganizationRepository(db)
+	invitationRepo := repository.NewInvitationRepository(db)
+	apiKeyRepo := repository.NewAPIKeyRepository(db)
+	oauthClientRepo := repository.NewOAuthClientRepository(db)
+	codeRepo := repository.NewAuthorizationCodeRepository(db)
+	consentRepo := repository.NewConsentRepository(db)
+	linkedAccountRepo := repository.NewLinkedAccountRepository(db)
+	passkeyRepo := repository.NewPasskeyRepository(db)
 
 	// Initialize Redis client
-	if _, err := redis.NewRedisClient(cfg.Redis); err != nil {
+	redisClient, err := redis.NewRedisClient(cfg.Redis)
+	if err != nil {
 		panic(fmt.Sprintf("Failed to connect to Redis: %v", err))
 	}
+	attemptRepo := redis.NewLoginAttemptRepository(redisClient)
+	denylistRepo := redis.NewTokenDenylistRepository(redisClient)
+	permCacheRepo := cache.NewPermissionCacheRepository(cache.NewRedisCacheFromClient(redisClient))
+	federationStateRepo := redis.NewFederationStateRepository(redisClient)
+	passkeyChallengeRepo := redis.NewPasskeyChallengeRepository(redisClient)
 
 	// Initialize JWT manager
 	jwtManager, err := jwt.NewJWTManager(cfg.JWT)
@@ -43,94 +69,94 @@ func NewServer(cfg *configs.Config, db *gorm.DB) *Server {
 		panic(fmt.Sprintf("Failed to initialize JWT manager: %v", err))
 	}
 
-	// Initialize auth service
-	authService := service.NewAuthService(jwtManager)
+	// Initialize password hasher
+	hasher, err := password.NewHasher(cfg.Password)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to initialize password hasher: %v", err))
+	}
 
-	// Initialize use cases
-	authUseCase := usecase.NewAuthUseCase(userRepo, tokenRepo, sessionRepo, authService)
+	// Hash the passwords stored in plain text before passwords were hashed
+	if _, err := jobs.HashPlaintextPasswords(userRepo, hasher); err != nil {
+		panic(fmt.Sprintf("Failed to hash plaintext passwords: %v", err))
+	}
 
-	// Initialize handlers
-	authHandler := handler.NewAuthHandler(authUseCase)
-	healthHandler := handler.NewHealthHandler(db)
-	roleHandler := handler.NewRoleHandler(roleRepo, permissionRepo)
-	permissionHandler := handler.NewPermissionHandler(permissionRepo)
+	// Initialize cipher for secrets stored at rest
+	cipher, err := encryption.NewCipher(cfg.TwoFactor.EncryptionKey)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to initialize cipher: %v", err))
+	}
 
-	// Initialize middleware
-	authMiddleware := middleware.NewAuthMiddleware(authService)
-	rateLimiter := middleware.NewIPRateLimiter(rate.Limit(10), 100)
+	// Initialize email service
+	emailService := email.NewEmailService(&cfg.Email)
 
-	log, err := logger.NewLogger("auth-service")
+	// Initialize auth service
+	authService := service.NewAuthService(jwtManager, hasher, cipher, emailService, cfg.TwoFactor, roleRepo, permissionRepo, denylistRepo, permCacheRepo, cfg.Redis.PermissionCacheTTL)
+
+	// Initialize policy service
+	policyService, err := service.NewPolicyService(policyRepo, userRepo, authService, cfg.Policy)
 	if err != nil {
-		panic(fmt.Sprintf("Failed to initialize logger: %v", err))
+		panic(fmt.Sprintf("Failed to load policies: %v", err))
 	}
-	loggerMiddleware := middleware.NewLoggerMiddleware(log)
-
-	// Initialize router
-	router := gin.Default()
 
-	// Global middleware
-	router.Use(gin.Recovery())
-	router.Use(loggerMiddleware.Logger())
-	router.Use(middleware.RateLimit(rateLimiter))
+	// Initialize API key service
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo, userRepo, authService)
 
-	// Health check
-	router.GET("/health", healthHandler.Check)
+	// Initialize OAuth client service
+	oauthClientService := service.NewOAuthClientService(oauthClientRepo, jwtManager, cfg.OAuth)
 
-	// Public routes
-	public := router.Group("/api/v1/auth")
-	{
-		public.POST("/register", authHandler.Register)
-		public.POST("/login", authHandler.Login)
-		public.POST("/refresh", authHandler.RefreshToken)
-		public.POST("/reset-password", authHandler.ResetPassword)
-		public.POST("/verify-email", authHandler.VerifyEmail)
+	// Initialize external identity providers
+	identityProviders, err := federation.NewRegistry(cfg.Federation)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to configure identity providers: %v", err))
 	}
 
-	// Protected routes
-	protected := router.Group("/api/v1")
-	protected.Use(authMiddleware.Authenticate())
-	{
-		// Auth routes
-		auth := protected.Group("/auth")
-		{
-			auth.POST("/logout", authHandler.Logout)
-			auth.POST("/change-password", authHandler.ChangePassword)
-			auth.POST("/enable-2fa", authHandler.EnableTwoFactor)
-			auth.POST("/disable-2fa", authHandler.DisableTwoFactor)
-			auth.POST("/verify-2fa", authHandler.VerifyTwoFactor)
-		}
+	// Initialize WebAuthn relying party
+	relyingParty := webauthn.NewRelyingParty(cfg.WebAuthn)
 
-		// Role routes
-		roles := protected.Group("/roles")
-		roles.Use(authMiddleware.RequireRole("admin"))
-		{
-			roles.POST("", roleHandler.Create)
-			roles.GET("", roleHandler.List)
-			roles.GET("/:id", roleHandler.Get)
-			roles.PUT("/:id", roleHandler.Update)
-			roles.DELETE("/:id", roleHandler.Delete)
-		}
+	// Initialize use cases
+	authUseCase := usecase.NewAuthUseCase(userRepo, tokenRepo, sessionRepo, recoveryCodeRepo, attemptRepo, orgRepo, authService, cfg.Lockout, cfg.Email, cfg.Session)
+	userAdminUseCase := usecase.NewUserAdminUseCase(userRepo, authUseCase, cfg.Lockout)
+	invitationUseCase := usecase.NewInvitationUseCase(invitationRepo, userRepo, orgRepo, authService, cfg.Email)
+	oidcUseCase := usecase.NewOIDCUseCase(oauthClientRepo, codeRepo, consentRepo, userRepo, sessionRepo, authService, jwtManager, cfg.OAuth)
+	federationUseCase := usecase.NewFederationUseCase(identityProviders, federationStateRepo, linkedAccountRepo, userRepo, authUseCase, authService, cfg.Federation)
+	passkeyUseCase := usecase.NewPasskeyUseCase(relyingParty, passkeyChallengeRepo, passkeyRepo, userRepo, authUseCase, authService, cfg.WebAuthn)
 
-		// Permission routes
-		permissions := protected.Group("/permissions")
-		permissions.Use(authMiddleware.RequireRole("admin"))
-		{
-			permissions.POST("", permissionHandler.Create)
-			permissions.GET("", permissionHandler.List)
-			permissions.GET("/:id", permissionHandler.Get)
-			permissions.PUT("/:id", permissionHandler.Update)
-			permissions.DELETE("/:id", permissionHandler.Delete)
-		}
+	// Initialize handlers
+	handlers := &handler.Handlers{
+		Auth:         handler.NewAuthHandler(authUseCase),
+		Admin:        handler.NewAdminHandler(userAdminUseCase),
+		APIKey:       handler.NewAPIKeyHandler(apiKeyService, userRepo),
+		Authz:        handler.NewAuthzHandler(authService, policyService),
+		Role:         handler.NewRoleHandler(roleRepo, permissionRepo, userRepo, orgRepo, authService),
+		Permission:   handler.NewPermissionHandler(permissionRepo, roleRepo, userRepo, authService),
+		Policy:       handler.NewPolicyHandler(policyRepo, policyService),
+		Organization: handler.NewOrganizationHandler(orgRepo, roleRepo, permissionRepo, userRepo, authService),
+		Invitation:   handler.NewInvitationHandler(invitationUseCase, roleRepo, authService),
+		OAuth:        handler.NewOAuthHandler(oauthClientService, oidcUseCase),
+		OIDC:         handler.NewOIDCHandler(oidcUseCase),
+		Federation:   handler.NewFederationHandler(federationUseCase),
+		Passkey:      handler.NewPasskeyHandler(passkeyUseCase),
+		Health:       handler.NewHealthHandler(db),
+		JWKS:         handler.NewJWKSHandler(jwtManager),
 	}
 
-	// Admin routes
-	admin := router.Group("/api/v1/admin")
-	admin.Use(authMiddleware.Authenticate())
-	admin.Use(authMiddleware.RequireRole("admin"))
-	{
-		// Add admin routes here
+	// Initialize middleware
+	authMiddleware := middleware.NewAuthMiddleware(authService, apiKeyService)
+	policyMiddleware := middleware.NewPolicyMiddleware(policyService, userRepo)
+	reauthMiddleware := middleware.NewReauthMiddleware(sessionRepo, userRepo, cfg.Session)
+
+	log, err := logger.NewLogger(cfg.Log.Level)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to initialize logger: %v", err))
+	}
+	if !jwtManager.Asymmetric() {
+		log.Logger.Warn("OpenID Connect is unavailable until JWT_ACTIVE_KEY_FILES configures an asymmetric signing key")
 	}
 
+	// Initialize router
+	router := gin.Default()
+	SetupRoutes(router, handlers, authMiddleware, policyMiddleware, reauthMiddleware, log)
+
 	// Initialize HTTP server
 	httpServer := &http.Server{
 		Addr:           fmt.Sprintf(":%s", cfg.Server.Port),
@@ -138,62 +164,79 @@ func NewServer(cfg *configs.Config, db *gorm.DB) *Server {
 		MaxHeaderBytes: 1 << 20, // 1MB
 	}
 
+	// Background jobs run until the server shuts down
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+
 	return &Server{
 		httpServer: httpServer,
+		cleanupJob: jobs.NewCleanupJob(tokenRepo, sessionRepo, userRepo, codeRepo),
+		jobsCtx:    jobsCtx,
+		stopJobs:   stopJobs,
 	}
 }
 
 func (s *Server) Start() error {
+	go s.cleanupJob.Start(s.jobsCtx)
+
 	return s.httpServer.ListenAndServe()
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
+	s.stopJobs()
 	return s.httpServer.Shutdown(ctx)
 }
 
 func SetupRoutes(
 	router *gin.Engine,
-	authHandler *handler.AuthHandler,
-	roleHandler *handler.RoleHandler,
-	permissionHandler *handler.PermissionHandler,
-	healthHandler *handler.HealthHandler,
+	handlers *handler.Handlers,
+	authMiddleware *middleware.AuthMiddleware,
+	policyMiddleware *middleware.PolicyMiddleware,
+	reauthMiddleware *middleware.ReauthMiddleware,
 	logger *logger.Logger,
 ) {
 	// Initialize middleware
 	rateLimiter := middleware.NewIPRateLimiter(rate.Limit(10), 100)
 	loggerMiddleware := middleware.NewLoggerMiddleware(logger)
 
-	// Initialize JWT manager and auth service
-	cfg, err := configs.LoadConfig()
-	if err != nil {
-		panic(fmt.Sprintf("Failed to load config: %v", err))
-	}
-	jwtManager, err := jwt.NewJWTManager(cfg.JWT)
-	if err != nil {
-		panic(fmt.Sprintf("Failed to initialize JWT manager: %v", err))
-	}
-	authService := service.NewAuthService(jwtManager)
-	authMiddleware := middleware.NewAuthMiddleware(authService)
-
 	// Global middleware
 	router.Use(gin.Recovery())
 	router.Use(loggerMiddleware.Logger())
 	router.Use(middleware.RateLimit(rateLimiter))
 
 	// Health check
-	router.GET("/health", healthHandler.Check)
+	router.GET("/health", handlers.Health.Check)
+
+	// Public signing keys
+	router.GET("/.well-known/jwks.json", handlers.JWKS.Keys)
+
+	// OAuth2 and OpenID Connect provider endpoints
+	router.GET("/.well-known/openid-configuration", handlers.OIDC.Discovery)
+	router.GET("/oauth/authorize", handlers.OIDC.BeginAuthorization)
+	router.POST("/oauth/token", handlers.OAuth.Token)
+	router.GET("/oauth/userinfo", handlers.OIDC.UserInfo)
+	router.POST("/oauth/userinfo", handlers.OIDC.UserInfo)
 
 	// Public routes
 	public := router.Group("/api/v1")
 	{
 		auth := public.Group("/auth")
 		{
-			auth.POST("/register", authHandler.Register)
-			auth.POST("/login", authHandler.Login)
-			auth.POST("/refresh", authHandler.RefreshToken)
-			auth.POST("/forgot-password", authHandler.ForgotPassword)
-			auth.POST("/reset-password", authHandler.ResetPassword)
-			auth.POST("/verify-email", authHandler.VerifyEmail)
+			auth.POST("/register", handlers.Auth.Register)
+			auth.POST("/login", handlers.Auth.Login)
+			auth.POST("/login/2fa", handlers.Auth.LoginTwoFactor)
+			auth.POST("/refresh", handlers.Auth.RefreshToken)
+			auth.POST("/forgot-password", handlers.Auth.ForgotPassword)
+			auth.POST("/reset-password", handlers.Auth.ResetPassword)
+			auth.POST("/verify-email", handlers.Auth.VerifyEmail)
+			auth.POST("/resend-verification", handlers.Auth.ResendVerificationEmail)
+			auth.POST("/accept-invitation", handlers.Invitation.Accept)
+			auth.GET("/federation/providers", handlers.Federation.ListProviders)
+			auth.POST("/federation/:provider/authorize", handlers.Federation.BeginLogin)
+			auth.POST("/federation/callback", handlers.Federation.CompleteLogin)
+			auth.POST("/passkeys/login/options", handlers.Passkey.BeginLogin)
+			auth.POST("/passkeys/login", handlers.Passkey.FinishLogin)
+			auth.POST("/login/2fa/passkey/options", handlers.Passkey.BeginTwoFactor)
+			auth.POST("/login/2fa/passkey", handlers.Passkey.FinishTwoFactor)
 		}
 	}
 
@@ -201,36 +244,164 @@ func SetupRoutes(
 	protected := router.Group("/api/v1")
 	protected.Use(authMiddleware.Authenticate())
 	{
-		// Auth routes
+		// Auth routes manage the account, so API keys cannot reach them
 		auth := protected.Group("/auth")
+		auth.Use(authMiddleware.RequireLogin())
 		{
-			auth.POST("/logout", authHandler.Logout)
-			auth.POST("/change-password", authHandler.ChangePassword)
-			auth.POST("/enable-2fa", authHandler.EnableTwoFactor)
-			auth.POST("/disable-2fa", authHandler.DisableTwoFactor)
-			auth.POST("/verify-2fa", authHandler.VerifyTwoFactor)
+			auth.POST("/logout", handlers.Auth.Logout)
+			auth.POST("/logout-all", handlers.Auth.LogoutAll)
+			auth.GET("/sessions", handlers.Auth.ListSessions)
+			auth.DELETE("/sessions/:id", handlers.Auth.RevokeSession)
+			auth.POST("/change-password", handlers.Auth.ChangePassword)
+			auth.POST("/enable-2fa", handlers.Auth.EnableTwoFactor)
+			auth.POST("/disable-2fa", authMiddleware.RequireTwoFactor(), handlers.Auth.DisableTwoFactor)
+			auth.POST("/verify-2fa", handlers.Auth.VerifyTwoFactor)
+			auth.GET("/organizations", handlers.Auth.ListOrganizations)
+			auth.POST("/organizations/switch", handlers.Auth.SwitchOrganization)
+			auth.GET("/api-keys", handlers.APIKey.List)
+			auth.POST("/api-keys", handlers.APIKey.Create)
+			auth.DELETE("/api-keys/:keyId", handlers.APIKey.Revoke)
+			auth.GET("/consents", handlers.OIDC.ListConsents)
+			auth.DELETE("/consents/:clientId", handlers.OIDC.RevokeConsent)
+			auth.GET("/linked-accounts", handlers.Federation.ListLinkedAccounts)
+			auth.POST("/linked-accounts/:provider/authorize", reauthMiddleware.RequireRecentLogin(), handlers.Federation.BeginLink)
+			auth.POST("/linked-accounts/callback", reauthMiddleware.RequireRecentLogin(), handlers.Federation.CompleteLink)
+			auth.DELETE("/linked-accounts/:id", handlers.Federation.UnlinkAccount)
+			auth.GET("/passkeys", handlers.Passkey.ListPasskeys)
+			auth.POST("/passkeys/register/options", reauthMiddleware.RequireRecentLogin(), handlers.Passkey.BeginRegistration)
+			auth.POST("/passkeys", reauthMiddleware.RequireRecentLogin(), handlers.Passkey.FinishRegistration)
+			auth.PATCH("/passkeys/:id", handlers.Passkey.RenamePasskey)
+			auth.DELETE("/passkeys/:id", reauthMiddleware.RequireRecentLogin(), handlers.Passkey.DeletePasskey)
+		}
+
+		// Sign-in to relying parties, called by the login page
+		protected.POST("/oauth/authorize", authMiddleware.RequireLogin(), handlers.OIDC.Authorize)
+
+		// Authorization decisions for other services
+		authz := protected.Group("/authz")
+		{
+			authz.POST("/check", handlers.Authz.Check)
+			authz.POST("/check-batch", handlers.Authz.CheckBatch)
 		}
 
 		// Role routes
 		roles := protected.Group("/roles")
 		roles.Use(authMiddleware.RequireRole("admin"))
 		{
-			roles.POST("", roleHandler.Create)
-			roles.GET("", roleHandler.List)
-			roles.GET("/:id", roleHandler.Get)
-			roles.PUT("/:id", roleHandler.Update)
-			roles.DELETE("/:id", roleHandler.Delete)
+			roles.POST("", handlers.Role.Create)
+			roles.GET("", handlers.Role.List)
+			roles.GET("/:id", handlers.Role.Get)
+			roles.PUT("/:id", handlers.Role.Update)
+			roles.DELETE("/:id", handlers.Role.Delete)
+			roles.GET("/:id/effective-permissions", handlers.Role.EffectivePermissions)
+		}
+
+		// Role assignment routes
+		assignments := protected.Group("")
+		{
+			assign := authMiddleware.RequirePermission("role:assign")
+			remove := authMiddleware.RequirePermission("role:remove")
+
+			assignments.POST("/roles/:id/permissions", assign, handlers.Role.AssignPermissions)
+			assignments.DELETE("/roles/:id/permissions", remove, handlers.Role.RemovePermissions)
+			assignments.POST("/roles/:id/permissions/:permId", assign, handlers.Role.AssignPermission)
+			assignments.DELETE("/roles/:id/permissions/:permId", remove, handlers.Role.RemovePermission)
+			assignments.POST("/users/:id/roles", assign, handlers.Role.AssignUserRoles)
+			assignments.DELETE("/users/:id/roles", remove, handlers.Role.RemoveUserRoles)
+			assignments.POST("/users/:id/roles/:roleId", assign, handlers.Role.AssignUserRole)
+			assignments.DELETE("/users/:id/roles/:roleId", remove, handlers.Role.RemoveUserRole)
 		}
 
 		// Permission routes
 		permissions := protected.Group("/permissions")
 		permissions.Use(authMiddleware.RequireRole("admin"))
 		{
-			permissions.POST("", permissionHandler.Create)
-			permissions.GET("", permissionHandler.List)
-			permissions.GET("/:id", permissionHandler.Get)
-			permissions.PUT("/:id", permissionHandler.Update)
-			permissions.DELETE("/:id", permissionHandler.Delete)
+			permissions.POST("", handlers.Permission.Create)
+			permissions.GET("", handlers.Permission.List)
+			permissions.GET("/:id", handlers.Permission.Get)
+			permissions.PUT("/:id", handlers.Permission.Update)
+			permissions.DELETE("/:id", handlers.Permission.Delete)
 		}
+
+		// Policy routes
+		policies := protected.Group("/policies")
+		{
+			policies.POST("", authMiddleware.RequirePermission("policy:create"), handlers.Policy.Create)
+			policies.GET("", authMiddleware.RequirePermission("policy:read"), handlers.Policy.List)
+			policies.POST("/explain", authMiddleware.RequirePermission("policy:read"), handlers.Policy.Explain)
+			policies.GET("/:id", authMiddleware.RequirePermission("policy:read"), handlers.Policy.Get)
+			policies.PUT("/:id", authMiddleware.RequirePermission("policy:update"), handlers.Policy.Update)
+			policies.DELETE("/:id", authMiddleware.RequirePermission("policy:delete"), handlers.Policy.Delete)
+		}
+
+		// Organization routes. Creating, listing and deleting organizations
+		// and adding members directly takes global permissions; everything
+		// else within one also accepts the grants of a token scoped to it.
+		organizations := protected.Group("/organizations")
+		{
+			read := authMiddleware.RequireOrganizationPermission("id", "organization:read")
+			update := authMiddleware.RequireOrganizationPermission("id", "organization:update")
+
+			organizations.POST("", authMiddleware.RequirePermission("organization:create"), handlers.Organization.Create)
+			organizations.GET("", authMiddleware.RequirePermission("organization:read"), handlers.Organization.List)
+			organizations.GET("/:id", read, handlers.Organization.Get)
+			organizations.PUT("/:id", update, handlers.Organization.Update)
+			organizations.DELETE("/:id", authMiddleware.RequirePermission("organization:delete"), handlers.Organization.Delete)
+			organizations.GET("/:id/members", read, handlers.Organization.ListMembers)
+			// Adding any user by ID is for platform administrators, who
+			// may read users anyway: the answer tells which IDs exist
+			organizations.POST("/:id/members", authMiddleware.RequirePermission("organization:update", "user:read"), handlers.Organization.AddMember)
+			organizations.DELETE("/:id/members/:userId", update, handlers.Organization.RemoveMember)
+			organizations.POST("/:id/members/:userId/roles", update, handlers.Organization.AssignMemberRoles)
+			organizations.DELETE("/:id/members/:userId/roles", update, handlers.Organization.RemoveMemberRoles)
+			organizations.GET("/:id/roles", read, handlers.Organization.ListRoles)
+			organizations.POST("/:id/roles", update, handlers.Organization.CreateRole)
+			organizations.DELETE("/:id/roles/:roleId", update, handlers.Organization.DeleteRole)
+			organizations.GET("/:id/invitations", read, handlers.Invitation.List)
+			organizations.POST("/:id/invitations", update, handlers.Invitation.Invite)
+			organizations.POST("/:id/invitations/:invitationId/resend", update, handlers.Invitation.Resend)
+			organizations.DELETE("/:id/invitations/:invitationId", update, handlers.Invitation.Revoke)
+		}
+	}
+
+	// Admin routes, each authorized by the permission it needs
+	admin := router.Group("/api/v1/admin")
+	admin.Use(authMiddleware.Authenticate())
+	{
+		users := admin.Group("/users")
+		users.GET("", authMiddleware.RequirePermission("user:read"), handlers.Admin.ListUsers)
+		// Reading a user also goes through the policies, so that e.g. users
+		// can read their own account or support staff users of their region
+		users.GET("/:id", policyMiddleware.Authorize("user", "read", policyMiddleware.UserFromParam("id")), handlers.Admin.GetUser)
+		users.PUT("/:id/attributes", authMiddleware.RequirePermission("user:update"), handlers.Admin.SetUserAttributes)
+		users.POST("/:id/activate", authMiddleware.RequirePermission("user:activate"), handlers.Admin.ActivateUser)
+		users.POST("/:id/deactivate", authMiddleware.RequirePermission("user:deactivate"), handlers.Admin.DeactivateUser)
+		users.POST("/:id/lock", authMiddleware.RequirePermission("user:update"), handlers.Admin.LockUser)
+		users.POST("/:id/unlock", authMiddleware.RequirePermission("user:update"), handlers.Auth.UnlockAccount)
+		users.POST("/:id/force-password-reset", authMiddleware.RequirePermission("user:update"), handlers.Admin.ForcePasswordReset)
+		users.DELETE("/:id", authMiddleware.RequirePermission("user:delete"), handlers.Admin.DeleteUser)
+		users.POST("/:id/restore", authMiddleware.RequirePermission("user:delete"), handlers.Admin.RestoreUser)
+		users.GET("/:id/api-keys", authMiddleware.RequirePermission("user:read"), handlers.APIKey.List)
+		users.POST("/:id/api-keys", authMiddleware.RequirePermission("user:update"), handlers.APIKey.Create)
+		users.DELETE("/:id/api-keys/:keyId", authMiddleware.RequirePermission("user:update"), handlers.APIKey.Revoke)
+
+		// Service accounts, whose API keys are managed under /users/:id/api-keys
+		admin.POST("/service-accounts", authMiddleware.RequirePermission("user:create"), handlers.Admin.CreateServiceAccount)
+
+		// Invitations to global roles
+		invitations := admin.Group("/invitations")
+		invitations.GET("", authMiddleware.RequirePermission("user:read"), handlers.Invitation.List)
+		invitations.POST("", authMiddleware.RequirePermission("user:create"), handlers.Invitation.Invite)
+		invitations.POST("/:invitationId/resend", authMiddleware.RequirePermission("user:create"), handlers.Invitation.Resend)
+		invitations.DELETE("/:invitationId", authMiddleware.RequirePermission("user:create"), handlers.Invitation.Revoke)
+
+		// OAuth2 clients allowed to use the client_credentials grant
+		clients := admin.Group("/oauth-clients")
+		clients.GET("", authMiddleware.RequirePermission("client:read"), handlers.OAuth.ListClients)
+		clients.POST("", authMiddleware.RequirePermission("client:create"), handlers.OAuth.RegisterClient)
+		clients.GET("/:id", authMiddleware.RequirePermission("client:read"), handlers.OAuth.GetClient)
+		clients.PUT("/:id", authMiddleware.RequirePermission("client:update"), handlers.OAuth.UpdateClient)
+		clients.POST("/:id/rotate-secret", authMiddleware.RequirePermission("client:update"), handlers.OAuth.RotateClientSecret)
+		clients.DELETE("/:id", authMiddleware.RequirePermission("client:delete"), handlers.OAuth.DeleteClient)
 	}
 }
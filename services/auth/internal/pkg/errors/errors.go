@@ -12,21 +12,27 @@ var (
 	ErrInvalidPassword    = errors.New("invalid password")
 	ErrPasswordHash       = errors.New("failed to hash password")
 	ErrInvalidTwoFactor   = errors.New("invalid two factor code")
+	ErrTwoFactorEnabled   = errors.New("two factor authentication is already enabled")
+	ErrTwoFactorDisabled  = errors.New("two factor authentication is not enabled")
 
 	// User errors
-	ErrUsernameExists    = errors.New("username already exists")
-	ErrEmailExists       = errors.New("email already exists")
-	ErrUserNotFound      = errors.New("user not found")
-	ErrUserInactive      = errors.New("user is inactive")
-	ErrUserDeleted       = errors.New("user has been deleted")
-	ErrEmailNotVerified  = errors.New("email not verified")
-	ErrTwoFactorRequired = errors.New("two factor authentication required")
+	ErrUsernameExists        = errors.New("username already exists")
+	ErrEmailExists           = errors.New("email already exists")
+	ErrUserNotFound          = errors.New("user not found")
+	ErrUserInactive          = errors.New("user is inactive")
+	ErrUserDeleted           = errors.New("user has been deleted")
+	ErrEmailNotVerified      = errors.New("email not verified")
+	ErrTwoFactorRequired     = errors.New("two factor authentication required")
+	ErrReauthRequired        = errors.New("sign in again to continue")
+	ErrPasswordResetRequired = errors.New("password reset required")
+	ErrCannotModifySelf      = errors.New("cannot perform this action on your own account")
 
 	// Role errors
 	ErrRoleNotFound = errors.New("role not found")
 	ErrRoleExists   = errors.New("role already exists")
 	ErrInvalidRole  = errors.New("invalid role")
 	ErrRoleInUse    = errors.New("role is in use")
+	ErrRoleCycle    = errors.New("role cannot inherit from itself")
 
 	// Permission errors
 	ErrPermissionNotFound = errors.New("permission not found")
@@ -34,6 +40,63 @@ var (
 	ErrInvalidPermission  = errors.New("invalid permission")
 	ErrPermissionDenied   = errors.New("permission denied")
 
+	// Policy errors
+	ErrPolicyNotFound = errors.New("policy not found")
+	ErrPolicyExists   = errors.New("policy already exists")
+	// ErrResourceNotFound is returned when the resource a policy is
+	// evaluated against does not exist
+	ErrResourceNotFound = errors.New("resource not found")
+
+	// Organization errors
+	ErrOrganizationNotFound = errors.New("organization not found")
+	ErrOrganizationExists   = errors.New("organization already exists")
+	ErrOrganizationInactive = errors.New("organization is inactive")
+	ErrNotMember            = errors.New("user is not a member of the organization")
+	ErrAlreadyMember        = errors.New("user is already a member of the organization")
+
+	// Invitation errors
+	ErrInvitationNotFound   = errors.New("invitation not found")
+	ErrInvitationNotPending = errors.New("invitation is no longer pending")
+
+	// API key errors
+	ErrAPIKeyNotFound   = errors.New("api key not found")
+	ErrInvalidScope     = errors.New("invalid api key scope")
+	ErrAPIKeyNotAllowed = errors.New("api keys cannot be used for this request")
+
+	// OAuth client errors
+	ErrClientNotFound     = errors.New("oauth client not found")
+	ErrInvalidClient      = errors.New("invalid client credentials")
+	ErrScopeNotAllowed    = errors.New("scope not allowed for client")
+	ErrAudienceNotAllowed = errors.New("audience not allowed for client")
+	ErrUnauthorizedClient = errors.New("client is not allowed to use this grant")
+
+	// OpenID Connect errors
+	ErrInvalidRedirectURI      = errors.New("invalid redirect uri")
+	ErrInvalidAuthRequest      = errors.New("invalid authorization request")
+	ErrUnsupportedResponseType = errors.New("unsupported response type")
+	ErrInvalidGrant            = errors.New("invalid or expired authorization code")
+	ErrLoginRequired           = errors.New("login required")
+	ErrConsentRequired         = errors.New("consent required")
+	ErrAccessDenied            = errors.New("access denied by the user")
+	ErrConsentNotFound         = errors.New("consent not found")
+	ErrOIDCUnavailable         = errors.New("openid connect requires an asymmetric signing key")
+
+	// Federation errors
+	ErrProviderNotFound       = errors.New("identity provider not found")
+	ErrInvalidFederationState = errors.New("invalid or expired sign-in state")
+	ErrFederationFailed       = errors.New("sign-in with the identity provider failed")
+	ErrEmailUnverified        = errors.New("the identity provider did not verify the email address")
+	ErrAccountLinkRequired    = errors.New("an account with this email already exists; sign in and link the provider from your account")
+	ErrIdentityLinked         = errors.New("this identity is already linked to another account")
+	ErrLinkedAccountNotFound  = errors.New("linked account not found")
+
+	// Passkey errors
+	ErrPasskeyNotFound         = errors.New("passkey not found")
+	ErrPasskeyExists           = errors.New("passkey is already registered")
+	ErrInvalidPasskeyChallenge = errors.New("invalid or expired passkey challenge")
+	ErrPasskeyVerification     = errors.New("passkey verification failed")
+	ErrNoPasskeys              = errors.New("no passkeys are registered")
+
 	// Session errors
 	ErrSessionNotFound = errors.New("session not found")
 	ErrSessionExpired  = errors.New("session has expired")
@@ -0,0 +1,125 @@
+package password
+
+import (
+	"fmt"
+
+	"minisapi/services/auth/internal/configs"
+)
+
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+// Algorithm is a password hashing scheme. Encoded hashes carry the
+// algorithm identifier and its parameters so they can be verified and
+// upgraded without any outside state.
+type Algorithm interface {
+	// Name returns the algorithm identifier used in configuration
+	Name() string
+	// Hash returns the encoded hash of the password
+	Hash(password string) (string, error)
+	// Verify reports whether the password matches the encoded hash
+	Verify(password, encoded string) (bool, error)
+	// Recognizes reports whether the encoded hash was produced by this algorithm
+	Recognizes(encoded string) bool
+	// NeedsRehash reports whether the encoded hash uses different parameters
+	NeedsRehash(encoded string) bool
+}
+
+// Hasher hashes new passwords with the preferred algorithm and verifies
+// hashes produced by any of the registered algorithms.
+type Hasher struct {
+	preferred  Algorithm
+	algorithms []Algorithm
+	dummy      string
+}
+
+// NewHasher creates a hasher from the password configuration
+func NewHasher(cfg configs.PasswordConfig) (*Hasher, error) {
+	bcryptAlg, err := NewBcrypt(cfg.BcryptCost)
+	if err != nil {
+		return nil, err
+	}
+
+	argon2Alg, err := NewArgon2id(Argon2Params{
+		Memory:      cfg.Argon2Memory,
+		Iterations:  cfg.Argon2Iterations,
+		Parallelism: cfg.Argon2Parallelism,
+		SaltLength:  cfg.Argon2SaltLength,
+		KeyLength:   cfg.Argon2KeyLength,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h := &Hasher{algorithms: []Algorithm{bcryptAlg, argon2Alg}}
+	for _, alg := range h.algorithms {
+		if alg.Name() == cfg.Algorithm {
+			h.preferred = alg
+		}
+	}
+	if h.preferred == nil {
+		return nil, fmt.Errorf("unsupported password hash algorithm: %q", cfg.Algorithm)
+	}
+
+	h.dummy, err = h.preferred.Hash("dummy password")
+	if err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// Hash hashes the password with the preferred algorithm
+func (h *Hasher) Hash(password string) (string, error) {
+	return h.preferred.Hash(password)
+}
+
+// Verify checks the password against an encoded hash of any registered algorithm
+func (h *Hasher) Verify(password, encoded string) (bool, error) {
+	alg := h.identify(encoded)
+	if alg == nil {
+		return false, fmt.Errorf("unrecognized password hash format")
+	}
+	return alg.Verify(password, encoded)
+}
+
+// VerifyDummy checks the password against a fixed hash of the preferred
+// algorithm. Logins for unknown accounts call it so that they take as long
+// as those for known accounts.
+func (h *Hasher) VerifyDummy(password string) {
+	_, _ = h.preferred.Verify(password, h.dummy)
+}
+
+// NeedsRehash reports whether the encoded hash should be replaced because
+// it was produced by another algorithm or with outdated parameters
+func (h *Hasher) NeedsRehash(encoded string) bool {
+	alg := h.identify(encoded)
+	if alg == nil || alg.Name() != h.preferred.Name() {
+		return true
+	}
+	return alg.NeedsRehash(encoded)
+}
+
+// Recognizes reports whether the encoded value is a hash of any registered
+// algorithm, rather than, for instance, a password stored in plain text
+func (h *Hasher) Recognizes(encoded string) bool {
+	return h.identify(encoded) != nil
+}
+
+// Verify checks the password against an encoded hash without a configured
+// hasher. Encoded hashes carry their own parameters, so none are needed.
+func Verify(password, encoded string) (bool, error) {
+	h := &Hasher{algorithms: []Algorithm{&bcryptAlgorithm{}, &argon2idAlgorithm{}}}
+	return h.Verify(password, encoded)
+}
+
+func (h *Hasher) identify(encoded string) Algorithm {
+	for _, alg := range h.algorithms {
+		if alg.Recognizes(encoded) {
+			return alg
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"minisapi/services/auth/internal/configs"
+)
+
+// testConfig keeps the hashing cheap; the parameters are not meant to be safe
+func testConfig(algorithm string) configs.PasswordConfig {
+	return configs.PasswordConfig{
+		Algorithm:         algorithm,
+		BcryptCost:        4,
+		Argon2Memory:      1024,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 1,
+		Argon2SaltLength:  16,
+		Argon2KeyLength:   32,
+	}
+}
+
+func newTestHasher(t *testing.T, algorithm string) *Hasher {
+	t.Helper()
+	h, err := NewHasher(testConfig(algorithm))
+	if err != nil {
+		t.Fatalf("NewHasher(%q): %v", algorithm, err)
+	}
+	return h
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmBcrypt, AlgorithmArgon2id} {
+		t.Run(algorithm, func(t *testing.T) {
+			h := newTestHasher(t, algorithm)
+
+			encoded, err := h.Hash("correct horse")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if again, _ := h.Hash("correct horse"); again == encoded {
+				t.Error("two hashes of the same password are equal, want a fresh salt")
+			}
+
+			tests := []struct {
+				password string
+				want     bool
+			}{
+				{"correct horse", true},
+				{"correct horse ", false},
+				{"Correct horse", false},
+				{"", false},
+			}
+			for _, tt := range tests {
+				ok, err := h.Verify(tt.password, encoded)
+				if err != nil || ok != tt.want {
+					t.Errorf("Verify(%q) = %v, %v, want %v", tt.password, ok, err, tt.want)
+				}
+			}
+
+			// Hashes carry their parameters, so no hasher is needed to verify
+			if ok, err := Verify("correct horse", encoded); err != nil || !ok {
+				t.Errorf("package Verify = %v, %v, want true", ok, err)
+			}
+			if h.NeedsRehash(encoded) {
+				t.Error("fresh hash needs a rehash")
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	argon2Hasher := newTestHasher(t, AlgorithmArgon2id)
+	bcryptHasher := newTestHasher(t, AlgorithmBcrypt)
+
+	bcryptHash, err := bcryptHasher.Hash("secret")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	argon2Hash, err := argon2Hasher.Hash("secret")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	stronger := testConfig(AlgorithmArgon2id)
+	stronger.Argon2Iterations = 2
+	stronger.BcryptCost = 5
+	strongerArgon2, err := NewHasher(stronger)
+	if err != nil {
+		t.Fatalf("NewHasher: %v", err)
+	}
+	stronger.Algorithm = AlgorithmBcrypt
+	strongerBcrypt, err := NewHasher(stronger)
+	if err != nil {
+		t.Fatalf("NewHasher: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		hasher  *Hasher
+		encoded string
+		want    bool
+	}{
+		{"same algorithm and parameters", argon2Hasher, argon2Hash, false},
+		{"other algorithm", argon2Hasher, bcryptHash, true},
+		{"other algorithm back", bcryptHasher, argon2Hash, true},
+		{"other argon2id parameters", strongerArgon2, argon2Hash, true},
+		{"other bcrypt cost", strongerBcrypt, bcryptHash, true},
+		{"unrecognized hash", argon2Hasher, "plaintext", true},
+		{"malformed argon2id hash", argon2Hasher, "$argon2id$v=19$m=1024,t=1,p=1$c2FsdA", true},
+		{"malformed bcrypt hash", bcryptHasher, "$2a$xx$", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hasher.NeedsRehash(tt.encoded); got != tt.want {
+				t.Errorf("NeedsRehash(%q) = %v, want %v", tt.encoded, got, tt.want)
+			}
+		})
+	}
+
+	// Old hashes keep working until they are upgraded
+	if ok, err := argon2Hasher.Verify("secret", bcryptHash); err != nil || !ok {
+		t.Errorf("Verify of a bcrypt hash with an argon2id hasher = %v, %v, want true", ok, err)
+	}
+}
+
+func TestVerifyMalformedHashes(t *testing.T) {
+	h := newTestHasher(t, AlgorithmArgon2id)
+
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"empty", ""},
+		{"plaintext", "secret"},
+		{"unknown algorithm", "$scrypt$ln=15,r=8,p=1$c2FsdHNhbHQ$a2V5"},
+		{"missing key", "$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHQ"},
+		{"empty key", "$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHQ$"},
+		{"extra segment", "$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5$x"},
+		{"malformed version", "$argon2id$version$m=1024,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5"},
+		{"unsupported version", "$argon2id$v=16$m=1024,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5"},
+		{"malformed parameters", "$argon2id$v=19$m=1024$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5"},
+		{"malformed salt", "$argon2id$v=19$m=1024,t=1,p=1$not*base64$a2V5a2V5a2V5a2V5"},
+		{"malformed key", "$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHQ$not*base64"},
+		{"truncated bcrypt", "$2a$04$abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := h.Verify("secret", tt.encoded)
+			if ok || err == nil {
+				t.Errorf("Verify(%q) = %v, %v, want an error", tt.encoded, ok, err)
+			}
+		})
+	}
+}
+
+func TestNewHasherRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *configs.PasswordConfig)
+		want   string
+	}{
+		{"unknown algorithm", func(cfg *configs.PasswordConfig) { cfg.Algorithm = "md5" }, "unsupported"},
+		{"bcrypt cost too low", func(cfg *configs.PasswordConfig) { cfg.BcryptCost = 3 }, "bcrypt cost"},
+		{"bcrypt cost too high", func(cfg *configs.PasswordConfig) { cfg.BcryptCost = 32 }, "bcrypt cost"},
+		{"no argon2id memory", func(cfg *configs.PasswordConfig) { cfg.Argon2Memory = 0 }, "argon2id"},
+		{"no argon2id iterations", func(cfg *configs.PasswordConfig) { cfg.Argon2Iterations = 0 }, "argon2id"},
+		{"short argon2id salt", func(cfg *configs.PasswordConfig) { cfg.Argon2SaltLength = 4 }, "argon2id"},
+		{"short argon2id key", func(cfg *configs.PasswordConfig) { cfg.Argon2KeyLength = 8 }, "argon2id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(AlgorithmArgon2id)
+			tt.modify(&cfg)
+			if _, err := NewHasher(cfg); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewHasher() = %v, want an error about %s", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package permission
+
+import (
+	"strings"
+)
+
+const (
+	// Wildcard matches any resource segment or any action
+	Wildcard = "*"
+
+	resourceSeparator = "."
+	actionSeparator   = ":"
+)
+
+// Key returns the resource:action form of a permission
+func Key(resource, action string) string {
+	return resource + actionSeparator + action
+}
+
+// Split splits a resource:action permission into its parts
+func Split(permission string) (resource, action string, ok bool) {
+	i := strings.LastIndex(permission, actionSeparator)
+	if i <= 0 || i == len(permission)-1 {
+		return "", "", false
+	}
+	return permission[:i], permission[i+1:], true
+}
+
+// Match reports whether a granted permission covers a required one.
+//
+// Resources are hierarchical, with segments separated by dots: a grant on
+// "notifications" covers "notifications.email" and anything below it. A "*"
+// segment in the granted resource matches any single segment, and a "*"
+// action matches any action, so "*:*" covers everything. A "*" in the
+// required permission is only covered by a "*" grant at the same position.
+func Match(granted, required string) bool {
+	grantedResource, grantedAction, ok := Split(granted)
+	if !ok {
+		return false
+	}
+	requiredResource, requiredAction, ok := Split(required)
+	if !ok {
+		return false
+	}
+
+	if grantedAction != Wildcard && grantedAction != requiredAction {
+		return false
+	}
+
+	return matchResource(grantedResource, requiredResource)
+}
+
+func matchResource(granted, required string) bool {
+	if granted == Wildcard {
+		return true
+	}
+
+	grantedSegments := strings.Split(granted, resourceSeparator)
+	requiredSegments := strings.Split(required, resourceSeparator)
+
+	// A grant never covers a resource above it
+	if len(grantedSegments) > len(requiredSegments) {
+		return false
+	}
+
+	for i, segment := range grantedSegments {
+		if segment == "" {
+			return false
+		}
+		if segment != Wildcard && segment != requiredSegments[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Set evaluates required permissions against a set of granted ones
+type Set struct {
+	exact  map[string]bool
+	grants []string
+}
+
+// NewSet creates a set from resource:action grants
+func NewSet(grants []string) *Set {
+	s := &Set{exact: make(map[string]bool, len(grants))}
+	for _, grant := range grants {
+		if s.exact[grant] {
+			continue
+		}
+		s.exact[grant] = true
+		s.grants = append(s.grants, grant)
+	}
+	return s
+}
+
+// Has reports whether any grant covers the required resource:action permission
+func (s *Set) Has(required string) bool {
+	// Most checks are satisfied by an exact grant
+	if s.exact[required] {
+		_, _, ok := Split(required)
+		return ok
+	}
+
+	for _, grant := range s.grants {
+		if Match(grant, required) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether the set grants the action on the resource
+func (s *Set) Allows(resource, action string) bool {
+	return s.Has(Key(resource, action))
+}
@@ -0,0 +1,73 @@
+package permission
+
+import (
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		granted  string
+		required string
+		want     bool
+	}{
+		{"exact match", "user:read", "user:read", true},
+		{"different action", "user:read", "user:update", false},
+		{"different resource", "user:read", "role:read", false},
+		{"wildcard action", "user:*", "user:delete", true},
+		{"wildcard action other resource", "user:*", "role:delete", false},
+		{"wildcard resource", "*:read", "role:read", true},
+		{"wildcard resource other action", "*:read", "role:update", false},
+		{"wildcard everything", "*:*", "notifications.email:send", true},
+		{"parent covers child", "notifications:send", "notifications.email:send", true},
+		{"parent covers grandchild", "notifications:send", "notifications.email.bulk:send", true},
+		{"child does not cover parent", "notifications.email:send", "notifications:send", false},
+		{"child does not cover sibling", "notifications.email:send", "notifications.sms:send", false},
+		{"prefix is not a parent", "notification:send", "notifications.email:send", false},
+		{"wildcard segment", "notifications.*:send", "notifications.sms:send", true},
+		{"wildcard segment covers deeper", "notifications.*:send", "notifications.sms.bulk:send", true},
+		{"wildcard segment needs a segment", "notifications.*:send", "notifications:send", false},
+		{"inner wildcard segment", "tenants.*.billing:read", "tenants.acme.billing:read", true},
+		{"inner wildcard segment mismatch", "tenants.*.billing:read", "tenants.acme.users:read", false},
+		{"required wildcard needs wildcard grant", "user:read", "user:*", false},
+		{"required wildcard with wildcard grant", "user:*", "user:*", true},
+		{"malformed grant", "user", "user:read", false},
+		{"malformed required", "user:read", "user", false},
+		{"empty action", "user:", "user:", false},
+		{"empty resource segment", "notifications.:send", "notifications.email:send", false},
+		{"case sensitive", "User:read", "user:read", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Match(tt.granted, tt.required); got != tt.want {
+				t.Errorf("Match(%q, %q) = %v, want %v", tt.granted, tt.required, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSet(t *testing.T) {
+	set := NewSet([]string{"user:read", "notifications:send", "reports.*:export", "user:read"})
+
+	tests := []struct {
+		resource string
+		action   string
+		want     bool
+	}{
+		{"user", "read", true},
+		{"user", "update", false},
+		{"notifications.email", "send", true},
+		{"reports.monthly", "export", true},
+		{"reports", "export", false},
+		{"role", "read", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(Key(tt.resource, tt.action), func(t *testing.T) {
+			if got := set.Allows(tt.resource, tt.action); got != tt.want {
+				t.Errorf("Allows(%q, %q) = %v, want %v", tt.resource, tt.action, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File is the layout of a YAML policy file:
+//
+//	policies:
+//	  - name: own-profile
+//	    effect: allow
+//	    permissions: ["user:read", "user:update"]
+//	    conditions:
+//	      - attribute: resource.owner_id
+//	        operator: eq
+//	        value_from: subject.id
+type File struct {
+	Policies []Policy `yaml:"policies"`
+}
+
+// LoadFile reads and validates the policies of a YAML file
+func LoadFile(path string) ([]Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %v", err)
+	}
+	return Parse(data)
+}
+
+// Parse decodes and validates YAML policies
+func Parse(data []byte) ([]Policy, error) {
+	var file File
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse policies: %v", err)
+	}
+
+	seen := make(map[string]bool, len(file.Policies))
+	for i := range file.Policies {
+		if err := file.Policies[i].Validate(); err != nil {
+			return nil, err
+		}
+		if seen[file.Policies[i].Name] {
+			return nil, fmt.Errorf("duplicate policy %q", file.Policies[i].Name)
+		}
+		seen[file.Policies[i].Name] = true
+	}
+
+	return file.Policies, nil
+}
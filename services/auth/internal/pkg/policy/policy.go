@@ -0,0 +1,321 @@
+package policy
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"minisapi/services/auth/internal/pkg/permission"
+)
+
+// Effect is what a policy does to a request it matches
+type Effect string
+
+const (
+	EffectAllow Effect = "allow"
+	EffectDeny  Effect = "deny"
+)
+
+// Operator compares an attribute with a value
+type Operator string
+
+const (
+	OpEquals         Operator = "eq"
+	OpNotEquals      Operator = "ne"
+	OpIn             Operator = "in"
+	OpNotIn          Operator = "not_in"
+	OpContains       Operator = "contains"
+	OpExists         Operator = "exists"
+	OpGreaterThan    Operator = "gt"
+	OpGreaterOrEqual Operator = "gte"
+	OpLessThan       Operator = "lt"
+	OpLessOrEqual    Operator = "lte"
+)
+
+// Attribute namespaces. Attributes are flat keys such as "subject.id",
+// "resource.owner_id" or "environment.ip".
+const (
+	SubjectPrefix     = "subject."
+	ResourcePrefix    = "resource."
+	EnvironmentPrefix = "environment."
+)
+
+// Condition tests one attribute of a request. The attribute is compared with
+// Value, or with the attribute named by ValueFrom when that is set.
+type Condition struct {
+	Attribute string      `json:"attribute" yaml:"attribute"`
+	Operator  Operator    `json:"operator" yaml:"operator"`
+	Value     interface{} `json:"value,omitempty" yaml:"value,omitempty"`
+	ValueFrom string      `json:"value_from,omitempty" yaml:"value_from,omitempty"`
+}
+
+// Policy allows or denies the permissions it lists when all of its
+// conditions hold. Permissions are resource:action patterns matched like
+// RBAC grants, so "user:*" covers every action on users.
+type Policy struct {
+	Name        string      `json:"name" yaml:"name"`
+	Description string      `json:"description,omitempty" yaml:"description,omitempty"`
+	Effect      Effect      `json:"effect" yaml:"effect"`
+	Permissions []string    `json:"permissions" yaml:"permissions"`
+	Conditions  []Condition `json:"conditions,omitempty" yaml:"conditions,omitempty"`
+}
+
+// Validate checks that the policy is well formed
+func (p *Policy) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("policy name is required")
+	}
+	if p.Effect != EffectAllow && p.Effect != EffectDeny {
+		return fmt.Errorf("policy %q: effect must be %q or %q", p.Name, EffectAllow, EffectDeny)
+	}
+	if len(p.Permissions) == 0 {
+		return fmt.Errorf("policy %q: at least one permission is required", p.Name)
+	}
+	for _, pattern := range p.Permissions {
+		if _, _, ok := permission.Split(pattern); !ok {
+			return fmt.Errorf("policy %q: invalid permission %q", p.Name, pattern)
+		}
+	}
+	for _, c := range p.Conditions {
+		if err := c.validate(); err != nil {
+			return fmt.Errorf("policy %q: %v", p.Name, err)
+		}
+	}
+	return nil
+}
+
+func (c *Condition) validate() error {
+	if !hasNamespace(c.Attribute) {
+		return fmt.Errorf("attribute %q must start with subject., resource. or environment.", c.Attribute)
+	}
+	if c.ValueFrom != "" && !hasNamespace(c.ValueFrom) {
+		return fmt.Errorf("value_from %q must start with subject., resource. or environment.", c.ValueFrom)
+	}
+
+	switch c.Operator {
+	case OpExists:
+		return nil
+	case OpEquals, OpNotEquals, OpContains, OpGreaterThan, OpGreaterOrEqual, OpLessThan, OpLessOrEqual:
+	case OpIn, OpNotIn:
+		if c.ValueFrom == "" && !isList(c.Value) {
+			return fmt.Errorf("operator %q on %q needs a list value", c.Operator, c.Attribute)
+		}
+	default:
+		return fmt.Errorf("unknown operator %q on %q", c.Operator, c.Attribute)
+	}
+
+	if c.Value == nil && c.ValueFrom == "" {
+		return fmt.Errorf("condition on %q needs a value or value_from", c.Attribute)
+	}
+	return nil
+}
+
+func hasNamespace(attribute string) bool {
+	return strings.HasPrefix(attribute, SubjectPrefix) ||
+		strings.HasPrefix(attribute, ResourcePrefix) ||
+		strings.HasPrefix(attribute, EnvironmentPrefix)
+}
+
+// Attributes are the facts a request is evaluated against
+type Attributes map[string]interface{}
+
+// Request asks whether a subject may perform an action on a resource
+type Request struct {
+	Resource string
+	Action   string
+	// Permissions are the subject's RBAC grants
+	Permissions []string
+	Attributes  Attributes
+}
+
+// ConditionResult is the outcome of one condition
+type ConditionResult struct {
+	Condition
+	Actual   interface{} `json:"actual"`
+	Expected interface{} `json:"expected,omitempty"`
+	Passed   bool        `json:"passed"`
+}
+
+// PolicyResult is the outcome of one policy. A policy applies when one of its
+// permissions covers the request, and matches when it applies and all of its
+// conditions pass.
+type PolicyResult struct {
+	Name       string            `json:"name"`
+	Effect     Effect            `json:"effect"`
+	Applies    bool              `json:"applies"`
+	Matched    bool              `json:"matched"`
+	Conditions []ConditionResult `json:"conditions,omitempty"`
+}
+
+// Decision is the outcome of an evaluation with the reasoning behind it
+type Decision struct {
+	Allowed     bool           `json:"allowed"`
+	Reason      string         `json:"reason"`
+	RBACGranted bool           `json:"rbac_granted"`
+	Policies    []PolicyResult `json:"policies"`
+}
+
+// Evaluate decides a request. Policies are layered on RBAC:
+//
+//   - a matching deny policy denies, whatever else applies
+//   - otherwise an RBAC grant of the permission allows
+//   - otherwise a matching allow policy allows
+//   - otherwise the request is denied
+//
+// Every policy is evaluated so the decision can be explained.
+func Evaluate(policies []Policy, req Request) *Decision {
+	required := permission.Key(req.Resource, req.Action)
+	decision := &Decision{
+		RBACGranted: permission.NewSet(req.Permissions).Has(required),
+		Policies:    make([]PolicyResult, 0, len(policies)),
+	}
+
+	var deniedBy, allowedBy string
+	for i := range policies {
+		result := evaluatePolicy(&policies[i], required, req.Attributes)
+		decision.Policies = append(decision.Policies, result)
+
+		if !result.Matched {
+			continue
+		}
+		if result.Effect == EffectDeny && deniedBy == "" {
+			deniedBy = result.Name
+		}
+		if result.Effect == EffectAllow && allowedBy == "" {
+			allowedBy = result.Name
+		}
+	}
+
+	switch {
+	case deniedBy != "":
+		decision.Reason = fmt.Sprintf("denied by policy %q", deniedBy)
+	case decision.RBACGranted:
+		decision.Allowed = true
+		decision.Reason = fmt.Sprintf("granted %s by role", required)
+	case allowedBy != "":
+		decision.Allowed = true
+		decision.Reason = fmt.Sprintf("allowed by policy %q", allowedBy)
+	default:
+		decision.Reason = fmt.Sprintf("no role or policy grants %s", required)
+	}
+
+	return decision
+}
+
+func evaluatePolicy(p *Policy, required string, attrs Attributes) PolicyResult {
+	result := PolicyResult{Name: p.Name, Effect: p.Effect}
+
+	for _, pattern := range p.Permissions {
+		if permission.Match(pattern, required) {
+			result.Applies = true
+			break
+		}
+	}
+	if !result.Applies {
+		return result
+	}
+
+	result.Matched = true
+	for _, c := range p.Conditions {
+		outcome := evaluateCondition(c, attrs)
+		result.Conditions = append(result.Conditions, outcome)
+		if !outcome.Passed {
+			result.Matched = false
+		}
+	}
+	return result
+}
+
+func evaluateCondition(c Condition, attrs Attributes) ConditionResult {
+	actual, present := attrs[c.Attribute]
+	result := ConditionResult{Condition: c, Actual: actual}
+
+	if c.Operator == OpExists {
+		result.Passed = present && actual != nil
+		return result
+	}
+
+	expected := c.Value
+	if c.ValueFrom != "" {
+		expected = attrs[c.ValueFrom]
+	}
+	result.Expected = expected
+
+	// A missing attribute never satisfies a comparison, so that a policy
+	// cannot match by accident when a resolver did not run
+	if !present || actual == nil || expected == nil {
+		return result
+	}
+
+	switch c.Operator {
+	case OpEquals:
+		result.Passed = equal(actual, expected)
+	case OpNotEquals:
+		result.Passed = !equal(actual, expected)
+	case OpIn:
+		result.Passed = contains(expected, actual)
+	case OpNotIn:
+		result.Passed = isList(expected) && !contains(expected, actual)
+	case OpContains:
+		result.Passed = contains(actual, expected)
+	case OpGreaterThan, OpGreaterOrEqual, OpLessThan, OpLessOrEqual:
+		result.Passed = compare(c.Operator, actual, expected)
+	}
+	return result
+}
+
+// equal compares scalars by their string form, so that the number 5 from a
+// YAML file equals the ID "5" taken from a route parameter
+func equal(a, b interface{}) bool {
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+// contains reports whether list has an element equal to value
+func contains(list, value interface{}) bool {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return false
+	}
+	for i := 0; i < v.Len(); i++ {
+		if equal(v.Index(i).Interface(), value) {
+			return true
+		}
+	}
+	return false
+}
+
+func isList(value interface{}) bool {
+	if value == nil {
+		return false
+	}
+	kind := reflect.ValueOf(value).Kind()
+	return kind == reflect.Slice || kind == reflect.Array
+}
+
+func compare(op Operator, a, b interface{}) bool {
+	x, ok := number(a)
+	if !ok {
+		return false
+	}
+	y, ok := number(b)
+	if !ok {
+		return false
+	}
+
+	switch op {
+	case OpGreaterThan:
+		return x > y
+	case OpGreaterOrEqual:
+		return x >= y
+	case OpLessThan:
+		return x < y
+	default:
+		return x <= y
+	}
+}
+
+func number(value interface{}) (float64, bool) {
+	n, err := strconv.ParseFloat(fmt.Sprint(value), 64)
+	return n, err == nil
+}
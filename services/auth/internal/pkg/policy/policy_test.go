@@ -0,0 +1,181 @@
+package policy
+
+import (
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	ownerCanUpdate := Policy{
+		Name:        "owner-can-update",
+		Effect:      EffectAllow,
+		Permissions: []string{"document:update"},
+		Conditions:  []Condition{{Attribute: "resource.owner_id", Operator: OpEquals, ValueFrom: "subject.id"}},
+	}
+	noSuspended := Policy{
+		Name:        "no-suspended",
+		Effect:      EffectDeny,
+		Permissions: []string{"*:*"},
+		Conditions:  []Condition{{Attribute: "subject.suspended", Operator: OpEquals, Value: true}},
+	}
+	officeHours := Policy{
+		Name:        "office-hours",
+		Effect:      EffectDeny,
+		Permissions: []string{"document:*"},
+		Conditions:  []Condition{{Attribute: "environment.hour", Operator: OpGreaterOrEqual, Value: 18}},
+	}
+	policies := []Policy{ownerCanUpdate, noSuspended, officeHours}
+
+	tests := []struct {
+		name        string
+		permissions []string
+		attrs       Attributes
+		wantAllow   bool
+		wantReason  string
+	}{
+		{"role grant", []string{"document:*"}, Attributes{"subject.id": 1, "resource.owner_id": 2}, true, "granted document:update by role"},
+		{"allow policy", nil, Attributes{"subject.id": 1, "resource.owner_id": "1"}, true, `allowed by policy "owner-can-update"`},
+		{"no grant", nil, Attributes{"subject.id": 1, "resource.owner_id": 2}, false, "no role or policy grants document:update"},
+		{"deny overrides role grant", []string{"*:*"}, Attributes{"subject.suspended": true}, false, `denied by policy "no-suspended"`},
+		{"deny overrides allow policy", nil, Attributes{"subject.id": 1, "resource.owner_id": 1, "environment.hour": 20}, false, `denied by policy "office-hours"`},
+		{"first deny is reported", nil, Attributes{"subject.suspended": true, "environment.hour": 20}, false, `denied by policy "no-suspended"`},
+		{"deny condition not met", []string{"document:update"}, Attributes{"subject.suspended": false, "environment.hour": 9}, true, "granted document:update by role"},
+		{"missing attribute does not deny", []string{"document:update"}, Attributes{}, true, "granted document:update by role"},
+		{"missing attribute does not allow", nil, Attributes{"subject.id": 1}, false, "no role or policy grants document:update"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := Evaluate(policies, Request{
+				Resource:    "document",
+				Action:      "update",
+				Permissions: tt.permissions,
+				Attributes:  tt.attrs,
+			})
+			if decision.Allowed != tt.wantAllow || decision.Reason != tt.wantReason {
+				t.Errorf("decision = %v %q, want %v %q", decision.Allowed, decision.Reason, tt.wantAllow, tt.wantReason)
+			}
+			if len(decision.Policies) != len(policies) {
+				t.Errorf("explained %d policies, want %d", len(decision.Policies), len(policies))
+			}
+		})
+	}
+}
+
+func TestEvaluateOnlyAppliesMatchingPermissions(t *testing.T) {
+	decision := Evaluate([]Policy{{
+		Name:        "deny-reports",
+		Effect:      EffectDeny,
+		Permissions: []string{"reports:*"},
+	}}, Request{Resource: "document", Action: "read", Permissions: []string{"document:read"}})
+
+	if !decision.Allowed {
+		t.Errorf("decision = %q, want allowed", decision.Reason)
+	}
+	if result := decision.Policies[0]; result.Applies || result.Matched {
+		t.Errorf("policy result = %+v, want it not to apply", result)
+	}
+}
+
+func TestConditions(t *testing.T) {
+	attrs := Attributes{
+		"subject.id":          5,
+		"subject.roles":       []string{"admin", "editor"},
+		"subject.level":       "3",
+		"subject.name":        "alice",
+		"subject.nil":         nil,
+		"resource.owner_id":   "5",
+		"resource.tags":       []interface{}{"public", 7},
+		"environment.ip":      "10.0.0.1",
+		"environment.allowed": []string{"10.0.0.1", "10.0.0.2"},
+	}
+
+	tests := []struct {
+		name      string
+		condition Condition
+		want      bool
+	}{
+		{"eq", Condition{Attribute: "subject.name", Operator: OpEquals, Value: "alice"}, true},
+		{"eq mismatch", Condition{Attribute: "subject.name", Operator: OpEquals, Value: "bob"}, false},
+		{"eq number and string", Condition{Attribute: "subject.id", Operator: OpEquals, Value: "5"}, true},
+		{"eq value_from", Condition{Attribute: "resource.owner_id", Operator: OpEquals, ValueFrom: "subject.id"}, true},
+		{"eq missing value_from", Condition{Attribute: "resource.owner_id", Operator: OpEquals, ValueFrom: "subject.missing"}, false},
+		{"ne", Condition{Attribute: "subject.name", Operator: OpNotEquals, Value: "bob"}, true},
+		{"ne equal", Condition{Attribute: "subject.id", Operator: OpNotEquals, Value: 5}, false},
+		{"ne missing attribute", Condition{Attribute: "subject.missing", Operator: OpNotEquals, Value: "bob"}, false},
+		{"in", Condition{Attribute: "subject.name", Operator: OpIn, Value: []interface{}{"alice", "bob"}}, true},
+		{"in absent", Condition{Attribute: "subject.name", Operator: OpIn, Value: []interface{}{"bob"}}, false},
+		{"in value_from", Condition{Attribute: "environment.ip", Operator: OpIn, ValueFrom: "environment.allowed"}, true},
+		{"in scalar value", Condition{Attribute: "subject.name", Operator: OpIn, Value: "alice"}, false},
+		{"not_in", Condition{Attribute: "subject.name", Operator: OpNotIn, Value: []string{"bob"}}, true},
+		{"not_in present", Condition{Attribute: "subject.name", Operator: OpNotIn, Value: []string{"alice"}}, false},
+		{"not_in scalar value", Condition{Attribute: "subject.name", Operator: OpNotIn, Value: "bob"}, false},
+		{"not_in missing attribute", Condition{Attribute: "subject.missing", Operator: OpNotIn, Value: []string{"bob"}}, false},
+		{"contains", Condition{Attribute: "subject.roles", Operator: OpContains, Value: "admin"}, true},
+		{"contains absent", Condition{Attribute: "subject.roles", Operator: OpContains, Value: "viewer"}, false},
+		{"contains mixed list", Condition{Attribute: "resource.tags", Operator: OpContains, Value: "7"}, true},
+		{"contains on scalar", Condition{Attribute: "subject.name", Operator: OpContains, Value: "ali"}, false},
+		{"exists", Condition{Attribute: "subject.name", Operator: OpExists}, true},
+		{"exists missing", Condition{Attribute: "subject.missing", Operator: OpExists}, false},
+		{"exists nil", Condition{Attribute: "subject.nil", Operator: OpExists}, false},
+		{"gt", Condition{Attribute: "subject.id", Operator: OpGreaterThan, Value: 4}, true},
+		{"gt equal", Condition{Attribute: "subject.id", Operator: OpGreaterThan, Value: 5}, false},
+		{"gte", Condition{Attribute: "subject.id", Operator: OpGreaterOrEqual, Value: 5}, true},
+		{"lt numeric string", Condition{Attribute: "subject.level", Operator: OpLessThan, Value: 10}, true},
+		{"lte", Condition{Attribute: "subject.level", Operator: OpLessOrEqual, Value: 2.5}, false},
+		{"gt non-numeric attribute", Condition{Attribute: "subject.name", Operator: OpGreaterThan, Value: 1}, false},
+		{"lt non-numeric value", Condition{Attribute: "subject.id", Operator: OpLessThan, Value: "ten"}, false},
+		{"gt on list", Condition{Attribute: "subject.roles", Operator: OpGreaterThan, Value: 1}, false},
+		{"gt missing attribute", Condition{Attribute: "subject.missing", Operator: OpGreaterThan, Value: 1}, false},
+		{"eq nil attribute", Condition{Attribute: "subject.nil", Operator: OpEquals, Value: "<nil>"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := evaluateCondition(tt.condition, attrs).Passed; got != tt.want {
+				t.Errorf("%s %s %v = %v, want %v", tt.condition.Attribute, tt.condition.Operator, tt.condition.Value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() Policy {
+		return Policy{
+			Name:        "p",
+			Effect:      EffectAllow,
+			Permissions: []string{"user:read"},
+			Conditions:  []Condition{{Attribute: "subject.id", Operator: OpEquals, Value: 1}},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(p *Policy)
+		wantErr bool
+	}{
+		{"valid", func(p *Policy) {}, false},
+		{"missing name", func(p *Policy) { p.Name = "" }, true},
+		{"unknown effect", func(p *Policy) { p.Effect = "maybe" }, true},
+		{"no permissions", func(p *Policy) { p.Permissions = nil }, true},
+		{"malformed permission", func(p *Policy) { p.Permissions = []string{"user"} }, true},
+		{"attribute without namespace", func(p *Policy) { p.Conditions[0].Attribute = "id" }, true},
+		{"value_from without namespace", func(p *Policy) { p.Conditions[0].ValueFrom = "id" }, true},
+		{"unknown operator", func(p *Policy) { p.Conditions[0].Operator = "like" }, true},
+		{"missing value", func(p *Policy) { p.Conditions[0].Value = nil }, true},
+		{"in with scalar", func(p *Policy) { p.Conditions[0] = Condition{Attribute: "subject.id", Operator: OpIn, Value: 1} }, true},
+		{"in with value_from", func(p *Policy) {
+			p.Conditions[0] = Condition{Attribute: "subject.id", Operator: OpIn, ValueFrom: "resource.members"}
+		}, false},
+		{"exists without value", func(p *Policy) { p.Conditions[0] = Condition{Attribute: "subject.id", Operator: OpExists} }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid()
+			tt.modify(&p)
+			if err := p.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
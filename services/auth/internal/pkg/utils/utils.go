@@ -2,9 +2,17 @@ package utils
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
+
+	"minisapi/services/auth/internal/pkg/password"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 // GenerateRandomString generates a random string of specified length
@@ -16,6 +24,31 @@ func GenerateRandomString(length int) (string, error) {
 	return base64.URLEncoding.EncodeToString(b), nil
 }
 
+// HashToken returns the SHA-256 hex digest of an opaque token. Only the
+// digest is persisted so a database leak does not expose usable tokens.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// AppendQuery adds the parameters to the query of a URL, keeping the
+// parameters it already has
+func AppendQuery(rawURL string, params url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
 // ParseTime parses a time string in RFC3339 format
 func ParseTime(timeStr string) (time.Time, error) {
 	return time.Parse(time.RFC3339, timeStr)
@@ -37,15 +70,19 @@ func GetExpirationTime(duration time.Duration) time.Time {
 }
 
 // HashPassword hashes a password using bcrypt
-func HashPassword(password string) (string, error) {
-	// Implementation will be added when needed
-	return "", nil
+func HashPassword(plain string) (string, error) {
+	alg, err := password.NewBcrypt(bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return alg.Hash(plain)
 }
 
-// ComparePasswords compares a password with its hash
-func ComparePasswords(password, hash string) bool {
-	// Implementation will be added when needed
-	return false
+// ComparePasswords compares a password with its hash. Both bcrypt and
+// argon2id hashes are accepted.
+func ComparePasswords(plain, hash string) bool {
+	ok, err := password.Verify(plain, hash)
+	return err == nil && ok
 }
 
 // GenerateOTP generates a 6-digit OTP
@@ -69,4 +106,49 @@ func ValidateOTP(otp string) bool {
 		}
 	}
 	return true
-} 
\ No newline at end of file
+}
+
+// DeviceLabel derives a short human readable label such as "Chrome on
+// Windows" from a User-Agent header
+func DeviceLabel(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+
+	browser := "Unknown browser"
+	for _, candidate := range []struct{ token, name string }{
+		// Order matters: Edge and Opera also announce Chrome, and Chrome
+		// announces Safari
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	} {
+		if strings.Contains(userAgent, candidate.token) {
+			browser = candidate.name
+			break
+		}
+	}
+
+	platform := ""
+	for _, candidate := range []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, candidate.token) {
+			platform = candidate.name
+			break
+		}
+	}
+
+	if platform == "" {
+		return browser
+	}
+	return browser + " on " + platform
+}
@@ -0,0 +1,297 @@
+// Package authzclient asks the auth service whether a user may perform an
+// action on a resource. Decisions are cached locally for a short time, so a
+// service can check on every request without a round trip each time.
+//
+//	client := authzclient.New("http://auth:8080", authzclient.WithServiceToken(token))
+//	decision, err := client.Check(ctx, authzclient.Subject{Token: userToken}, authzclient.Check{
+//		Permission: "notifications:send",
+//	})
+//	if err != nil || !decision.Allowed {
+//		// refuse the request
+//	}
+package authzclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCacheTTL is how long decisions are reused. It is short so that
+	// revoked tokens and role changes take effect quickly.
+	DefaultCacheTTL = 5 * time.Second
+
+	// DefaultTimeout bounds each call to the auth service
+	DefaultTimeout = 3 * time.Second
+
+	// maxCacheEntries bounds the cache; expired entries are dropped first,
+	// then the cache is cleared
+	maxCacheEntries = 10000
+
+	// maxBatchSize is the number of checks the auth service accepts at once
+	maxBatchSize = 100
+
+	checkBatchPath = "/api/v1/authz/check-batch"
+)
+
+// Subject names the user a check is about: the holder of an access token,
+// or a user ID. Asking about anyone but the caller needs a service token
+// holding the authz:check permission.
+type Subject struct {
+	Token  string `json:"token,omitempty"`
+	UserID uint   `json:"user_id,omitempty"`
+	// OrganizationID is the organization a user ID subject acts in. Token
+	// subjects act in the organization their token is scoped to.
+	OrganizationID uint `json:"organization_id,omitempty"`
+	// Environment is exposed to access policies as environment.<name>, such
+	// as the "ip" the subject's request came from
+	Environment map[string]interface{} `json:"environment,omitempty"`
+}
+
+// Check is one resource:action question
+type Check struct {
+	Permission string `json:"permission"`
+	// ResourceAttributes are exposed to access policies as
+	// resource.<name>, such as "owner_id"
+	ResourceAttributes map[string]interface{} `json:"resource_attributes,omitempty"`
+}
+
+// Decision is the answer to one check
+type Decision struct {
+	Permission string `json:"permission"`
+	Allowed    bool   `json:"allowed"`
+	Reason     string `json:"reason"`
+}
+
+// Error is returned when the auth service refuses a call
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("authz: auth service responded %d: %s", e.StatusCode, e.Message)
+}
+
+// Client calls the authorization API of the auth service. It is safe for
+// concurrent use.
+type Client struct {
+	baseURL      string
+	serviceToken string
+	httpClient   *http.Client
+	cacheTTL     time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	decision  Decision
+	expiresAt time.Time
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithServiceToken authenticates calls with the service's own access token
+// instead of the subject's. It is needed to check subjects by user ID and
+// to learn why a subject token was rejected.
+func WithServiceToken(token string) Option {
+	return func(c *Client) {
+		c.serviceToken = token
+	}
+}
+
+// WithHTTPClient replaces the HTTP client, for example to configure TLS
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithCacheTTL sets how long decisions are reused; zero disables the cache
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(c *Client) {
+		c.cacheTTL = ttl
+	}
+}
+
+// New creates a client for the auth service at baseURL, such as
+// "http://auth:8080"
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+		cacheTTL:   DefaultCacheTTL,
+		cache:      make(map[string]cacheEntry),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Check decides one permission for the subject
+func (c *Client) Check(ctx context.Context, subject Subject, check Check) (Decision, error) {
+	decisions, err := c.CheckBatch(ctx, subject, []Check{check})
+	if err != nil {
+		return Decision{}, err
+	}
+	return decisions[0], nil
+}
+
+// Allowed reports whether the subject holds the permission. Errors deny.
+func (c *Client) Allowed(ctx context.Context, subject Subject, permission string) bool {
+	decision, err := c.Check(ctx, subject, Check{Permission: permission})
+	return err == nil && decision.Allowed
+}
+
+// CheckBatch decides several permissions for the subject, in the order of
+// the checks. Only the checks that are not cached are sent.
+func (c *Client) CheckBatch(ctx context.Context, subject Subject, checks []Check) ([]Decision, error) {
+	decisions := make([]Decision, len(checks))
+	keys := make([]string, len(checks))
+
+	var missing []int
+	for i, check := range checks {
+		keys[i] = cacheKey(subject, check)
+		if decision, ok := c.cached(keys[i]); ok {
+			decisions[i] = decision
+			continue
+		}
+		missing = append(missing, i)
+	}
+	if len(missing) == 0 {
+		return decisions, nil
+	}
+
+	for start := 0; start < len(missing); start += maxBatchSize {
+		end := start + maxBatchSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+		batch := missing[start:end]
+
+		pending := make([]Check, 0, len(batch))
+		for _, i := range batch {
+			pending = append(pending, checks[i])
+		}
+
+		var response struct {
+			Results []Decision `json:"results"`
+		}
+		body := struct {
+			Subject
+			Checks []Check `json:"checks"`
+		}{subject, pending}
+		if err := c.post(ctx, checkBatchPath, subject.Token, body, &response); err != nil {
+			return nil, err
+		}
+		if len(response.Results) != len(pending) {
+			return nil, fmt.Errorf("authz: expected %d results, got %d", len(pending), len(response.Results))
+		}
+
+		for j, i := range batch {
+			decisions[i] = response.Results[j]
+			c.store(keys[i], response.Results[j])
+		}
+	}
+	return decisions, nil
+}
+
+func (c *Client) post(ctx context.Context, path, subjectToken string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Without a service token the subject asks about itself
+	token := c.serviceToken
+	if token == "" {
+		token = subjectToken
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("authz: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&failure)
+		return &Error{StatusCode: resp.StatusCode, Message: failure.Error}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("authz: invalid response: %v", err)
+	}
+	return nil
+}
+
+func (c *Client) cached(key string) (Decision, bool) {
+	if c.cacheTTL <= 0 {
+		return Decision{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.cache[key]
+	if !ok || !time.Now().Before(entry.expiresAt) {
+		return Decision{}, false
+	}
+	return entry.decision, true
+}
+
+func (c *Client) store(key string, decision Decision) {
+	if c.cacheTTL <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.cache) >= maxCacheEntries {
+		for k, entry := range c.cache {
+			if !now.Before(entry.expiresAt) {
+				delete(c.cache, k)
+			}
+		}
+		if len(c.cache) >= maxCacheEntries {
+			c.cache = make(map[string]cacheEntry)
+		}
+	}
+	c.cache[key] = cacheEntry{decision: decision, expiresAt: now.Add(c.cacheTTL)}
+}
+
+// cacheKey identifies a check. It is a hash so the cache does not hold on to
+// subject tokens.
+func cacheKey(subject Subject, check Check) string {
+	data, _ := json.Marshal(struct {
+		Subject
+		Check
+	}{subject, check})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
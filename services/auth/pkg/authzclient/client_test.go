@@ -0,0 +1,221 @@
+package authzclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// authServer answers batch checks, allowing the permissions in allowed, and
+// records the requests it receives
+type authServer struct {
+	*httptest.Server
+	allowed map[string]bool
+	status  int
+
+	mu       sync.Mutex
+	requests []recordedRequest
+}
+
+type recordedRequest struct {
+	authorization string
+	subject       Subject
+	checks        []Check
+}
+
+func newAuthServer(t *testing.T, allowed ...string) *authServer {
+	t.Helper()
+	s := &authServer{allowed: make(map[string]bool), status: http.StatusOK}
+	for _, permission := range allowed {
+		s.allowed[permission] = true
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *authServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != checkBatchPath {
+		http.NotFound(w, r)
+		return
+	}
+
+	var body struct {
+		Subject
+		Checks []Check `json:"checks"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, recordedRequest{r.Header.Get("Authorization"), body.Subject, body.Checks})
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if s.status != http.StatusOK {
+		w.WriteHeader(s.status)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "Forbidden"})
+		return
+	}
+
+	results := make([]Decision, 0, len(body.Checks))
+	for _, check := range body.Checks {
+		results = append(results, Decision{Permission: check.Permission, Allowed: s.allowed[check.Permission]})
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+}
+
+// checked returns the permissions sent in each request
+func (s *authServer) checked() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var batches [][]string
+	for _, req := range s.requests {
+		var permissions []string
+		for _, check := range req.checks {
+			permissions = append(permissions, check.Permission)
+		}
+		batches = append(batches, permissions)
+	}
+	return batches
+}
+
+func TestCheckCachesDecisions(t *testing.T) {
+	server := newAuthServer(t, "notifications:send")
+	client := New(server.URL)
+	ctx := context.Background()
+	subject := Subject{Token: "user-token"}
+
+	for i := 0; i < 3; i++ {
+		if !client.Allowed(ctx, subject, "notifications:send") {
+			t.Fatalf("check %d is denied", i)
+		}
+	}
+	if got := len(server.checked()); got != 1 {
+		t.Fatalf("auth service called %d times, want once", got)
+	}
+
+	// Other subjects and other resources are not answered from the cache
+	_ = client.Allowed(ctx, Subject{Token: "other-token"}, "notifications:send")
+	_, _ = client.Check(ctx, subject, Check{
+		Permission:         "notifications:send",
+		ResourceAttributes: map[string]interface{}{"owner_id": 2},
+	})
+	if got := len(server.checked()); got != 3 {
+		t.Errorf("auth service called %d times, want 3", got)
+	}
+}
+
+func TestCacheEntriesExpire(t *testing.T) {
+	server := newAuthServer(t, "notifications:send")
+	ctx := context.Background()
+	subject := Subject{UserID: 42}
+
+	uncached := New(server.URL, WithCacheTTL(0))
+	_ = uncached.Allowed(ctx, subject, "notifications:send")
+	_ = uncached.Allowed(ctx, subject, "notifications:send")
+	if got := len(server.checked()); got != 2 {
+		t.Fatalf("auth service called %d times without a cache, want 2", got)
+	}
+
+	shortLived := New(server.URL, WithCacheTTL(10*time.Millisecond))
+	_ = shortLived.Allowed(ctx, subject, "notifications:send")
+	time.Sleep(20 * time.Millisecond)
+	_ = shortLived.Allowed(ctx, subject, "notifications:send")
+	if got := len(server.checked()); got != 4 {
+		t.Errorf("auth service called %d times, want an expired decision to be checked again", got)
+	}
+}
+
+// TestCheckBatchSendsOnlyUncachedChecks checks that decisions are returned in
+// the order of the checks, mixing cached and fresh ones, and that large
+// batches are split
+func TestCheckBatchSendsOnlyUncachedChecks(t *testing.T) {
+	server := newAuthServer(t, "user:read")
+	client := New(server.URL)
+	ctx := context.Background()
+	subject := Subject{Token: "user-token"}
+
+	_ = client.Allowed(ctx, subject, "user:read")
+
+	checks := []Check{{Permission: "user:delete"}, {Permission: "user:read"}}
+	for i := 0; i < maxBatchSize; i++ {
+		checks = append(checks, Check{Permission: "resource:read", ResourceAttributes: map[string]interface{}{"id": i}})
+	}
+	decisions, err := client.CheckBatch(ctx, subject, checks)
+	if err != nil {
+		t.Fatalf("CheckBatch: %v", err)
+	}
+
+	if len(decisions) != len(checks) {
+		t.Fatalf("got %d decisions for %d checks", len(decisions), len(checks))
+	}
+	if decisions[0].Permission != "user:delete" || decisions[0].Allowed ||
+		decisions[1].Permission != "user:read" || !decisions[1].Allowed {
+		t.Errorf("decisions = %+v %+v, want user:delete denied and user:read allowed", decisions[0], decisions[1])
+	}
+
+	batches := server.checked()
+	if len(batches) != 3 || len(batches[1]) != maxBatchSize || len(batches[2]) != 1 {
+		t.Fatalf("sent %d requests, want the cached check skipped and the rest split in two", len(batches))
+	}
+	for _, batch := range batches[1:] {
+		for _, permission := range batch {
+			if permission == "user:read" {
+				t.Error("a cached check is sent again")
+			}
+		}
+	}
+}
+
+// TestServiceToken checks that calls carry the service token when one is
+// configured and the subject's token otherwise
+func TestServiceToken(t *testing.T) {
+	server := newAuthServer(t)
+	ctx := context.Background()
+	subject := Subject{Token: "user-token"}
+
+	_ = New(server.URL).Allowed(ctx, subject, "user:read")
+	_ = New(server.URL, WithServiceToken("service-token")).Allowed(ctx, subject, "user:read")
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if got := server.requests[0].authorization; got != "Bearer user-token" {
+		t.Errorf("without a service token, Authorization = %q", got)
+	}
+	if got := server.requests[1].authorization; got != "Bearer service-token" {
+		t.Errorf("with a service token, Authorization = %q", got)
+	}
+	if got := server.requests[1].subject.Token; got != "user-token" {
+		t.Errorf("subject token = %q, want it sent in the body", got)
+	}
+}
+
+// TestErrorsDeny checks that refused calls are reported, deny and are not
+// cached
+func TestErrorsDeny(t *testing.T) {
+	server := newAuthServer(t, "user:read")
+	server.status = http.StatusForbidden
+	client := New(server.URL)
+	ctx := context.Background()
+	subject := Subject{UserID: 42}
+
+	_, err := client.Check(ctx, subject, Check{Permission: "user:read"})
+	if authzErr, ok := err.(*Error); !ok || authzErr.StatusCode != http.StatusForbidden || authzErr.Message != "Forbidden" {
+		t.Fatalf("Check error = %v, want a 403 *Error", err)
+	}
+	if client.Allowed(ctx, subject, "user:read") {
+		t.Error("a refused check is allowed")
+	}
+
+	server.status = http.StatusOK
+	if !client.Allowed(ctx, subject, "user:read") {
+		t.Error("a refusal was cached")
+	}
+}